@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	tui "github.com/imfing/gptui/pkg/chat"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// assistantCmd represents the assistant command
+var assistantCmd = &cobra.Command{
+	Use:   "assistant",
+	Short: "Manage and chat with assistants of the Assistants API",
+}
+
+// newAPIClient creates a client for the API endpoints other than chat completion from the global flags
+func newAPIClient() *tui.Client {
+	return tui.NewChatClient(viper.GetString("openai-api-base"), viper.GetString("openai-api-key"), "", "", false, 0)
+}
+
+// assistantCreateCmd represents the assistant create command
+var assistantCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create an assistant",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		instructions, _ := cmd.Flags().GetString("instructions")
+		model, _ := cmd.Flags().GetString("model")
+		toolTypes, _ := cmd.Flags().GetStringSlice("tool")
+
+		var tools []tui.Tool
+		for _, toolType := range toolTypes {
+			tools = append(tools, tui.Tool{Type: toolType})
+		}
+		assistant, err := newAPIClient().CreateAssistant(args[0], instructions, model, tools)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(assistant.ID)
+	},
+}
+
+// assistantListCmd represents the assistant list command
+var assistantListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the assistants, newest first",
+	Run: func(cmd *cobra.Command, args []string) {
+		assistants, err := newAPIClient().ListAssistants()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, assistant := range assistants {
+			fmt.Printf("%s  %-20s  %s\n", assistant.ID, assistant.Name, assistant.Model)
+		}
+	},
+}
+
+// assistantThreadCmd represents the assistant thread command
+var assistantThreadCmd = &cobra.Command{
+	Use:   "thread",
+	Short: "Chat with an assistant in a thread",
+	Long:  `Starts the terminal UI with the responses generated by the assistant in a thread instead of the chat completion API. A new thread is created unless --thread-id is set.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		assistantID, _ := cmd.Flags().GetString("assistant-id")
+		threadID, _ := cmd.Flags().GetString("thread-id")
+		viper.Set("backend", "assistant")
+		viper.Set("assistant-id", assistantID)
+		viper.Set("thread-id", threadID)
+		viper.Set("version", cmd.Root().Version)
+
+		model, err := tea.NewProgram(tui.NewModel()).Run()
+		if err != nil {
+			tui.SaveCrashReport(model, err)
+			fmt.Println("Error running program:", err)
+			os.Exit(1)
+		}
+		if model == nil {
+			os.Exit(1)
+		}
+	},
+}
+
+// assistantRunCmd represents the assistant run command
+var assistantRunCmd = &cobra.Command{
+	Use:   "run [message]",
+	Short: "Run an assistant on a thread and print its reply",
+	Long:  `Adds the message to the thread if given, runs the assistant on the thread, waits for the run to complete and prints the reply.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		assistantID, _ := cmd.Flags().GetString("assistant-id")
+		threadID, _ := cmd.Flags().GetString("thread-id")
+
+		client := newAPIClient()
+		if len(threadID) == 0 {
+			thread, err := client.CreateThread()
+			if err != nil {
+				log.Fatal(err)
+			}
+			threadID = thread.ID
+			fmt.Fprintln(os.Stderr, "thread:", threadID)
+		}
+		if len(args) > 0 {
+			if err := client.AddMessage(threadID, strings.Join(args, " ")); err != nil {
+				log.Fatal(err)
+			}
+		}
+		run, err := client.RunThread(threadID, assistantID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		reply, err := client.RunReply(threadID, run.ID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(reply)
+	},
+}
+
+func init() {
+	assistantCreateCmd.Flags().String("instructions", "", "system instructions of the assistant")
+	assistantCreateCmd.Flags().String("model", defaultModel, "model used by the assistant")
+	assistantCreateCmd.Flags().StringSlice("tool", nil, "tool enabled for the assistant: code_interpreter or retrieval, can be repeated")
+
+	for _, cmd := range []*cobra.Command{assistantThreadCmd, assistantRunCmd} {
+		cmd.Flags().String("assistant-id", "", "ID of the assistant")
+		cmd.Flags().String("thread-id", "", "ID of the thread, a new thread is created if empty")
+		cmd.MarkFlagRequired("assistant-id")
+	}
+
+	assistantCmd.AddCommand(assistantCreateCmd)
+	assistantCmd.AddCommand(assistantListCmd)
+	assistantCmd.AddCommand(assistantThreadCmd)
+	assistantCmd.AddCommand(assistantRunCmd)
+
+	rootCmd.AddCommand(assistantCmd)
+}
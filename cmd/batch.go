@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tui "github.com/imfing/gptui/pkg/chat"
+	"github.com/spf13/cobra"
+)
+
+// batchCmd represents the batch command
+var batchCmd = &cobra.Command{
+	Use:   "batch",
+	Short: "Answer conversations offline with the Batch API",
+}
+
+// batchSubmitCmd represents the batch submit command
+var batchSubmitCmd = &cobra.Command{
+	Use:   "submit",
+	Short: "Submit every turn of a conversation as a batch and wait for the results",
+	Long:  `Uploads a batch with a chat completion request per user message of the conversation, each with the conversation up to the message, polls the batch until it has finished and writes the results.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		history, _ := cmd.Flags().GetString("history")
+		model, _ := cmd.Flags().GetString("model")
+		output, _ := cmd.Flags().GetString("output")
+		interval, _ := cmd.Flags().GetDuration("poll-interval")
+
+		session, err := tui.LoadSession(history)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(model) == 0 && len(session.Metadata.Model) == 0 {
+			model = defaultModel
+		}
+		input, err := tui.NewBatchInput(session, model)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		client := newAPIClient()
+		name := strings.TrimSuffix(filepath.Base(history), filepath.Ext(history)) + ".jsonl"
+		file, err := client.UploadFile(name, input, "batch")
+		if err != nil {
+			log.Fatal(err)
+		}
+		batch, err := client.CreateBatch(file.ID)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintln(os.Stderr, "batch:", batch.ID)
+
+		status := batch.Status
+		for !batch.Finished() {
+			time.Sleep(interval)
+			if batch, err = client.GetBatch(batch.ID); err != nil {
+				log.Fatal(err)
+			}
+			if batch.Status != status {
+				status = batch.Status
+				printBatchStatus(batch)
+			}
+		}
+		writeBatchResults(client, batch.ID, output)
+	},
+}
+
+// batchStatusCmd represents the batch status command
+var batchStatusCmd = &cobra.Command{
+	Use:   "status <batch-id>",
+	Short: "Print the status of a batch",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		batch, err := newAPIClient().GetBatch(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		printBatchStatus(batch)
+	},
+}
+
+// batchResultsCmd represents the batch results command
+var batchResultsCmd = &cobra.Command{
+	Use:   "results <batch-id>",
+	Short: "Download the results of a finished batch",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		writeBatchResults(newAPIClient(), args[0], output)
+	},
+}
+
+// printBatchStatus prints the status and request counts of the batch
+func printBatchStatus(batch *tui.Batch) {
+	counts := batch.RequestCounts
+	fmt.Fprintf(os.Stderr, "%s  %s  %d/%d completed, %d failed\n", batch.ID, batch.Status, counts.Completed, counts.Total, counts.Failed)
+}
+
+// writeBatchResults writes the results of the batch as JSONL to the output file,
+// or prints the response of each request if output is empty
+func writeBatchResults(client *tui.Client, batchID string, output string) {
+	results, err := client.GetBatchResults(batchID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(output) == 0 {
+		for _, result := range results {
+			if result.Error != nil {
+				fmt.Printf("%s: error: %s\n\n", result.CustomID, result.Error.Message)
+				continue
+			}
+			fmt.Printf("%s:\n%s\n\n", result.CustomID, result.Content())
+		}
+		return
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	encoder := json.NewEncoder(f)
+	for _, result := range results {
+		if err := encoder.Encode(result); err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d results written to %s\n", len(results), output)
+}
+
+func init() {
+	batchSubmitCmd.Flags().String("history", "", "path to the conversation history file to submit")
+	batchSubmitCmd.Flags().String("model", "", "model answering the requests, the model of the conversation if empty")
+	batchSubmitCmd.Flags().String("output", "", "JSONL file the results are written to, printed if empty")
+	batchSubmitCmd.Flags().Duration("poll-interval", time.Minute, "interval between status requests while the batch is in progress")
+	batchSubmitCmd.MarkFlagRequired("history")
+
+	batchResultsCmd.Flags().String("output", "", "JSONL file the results are written to, printed if empty")
+
+	batchCmd.AddCommand(batchSubmitCmd)
+	batchCmd.AddCommand(batchStatusCmd)
+	batchCmd.AddCommand(batchResultsCmd)
+
+	rootCmd.AddCommand(batchCmd)
+}
@@ -2,16 +2,26 @@ package cmd
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	tea "github.com/charmbracelet/bubbletea"
 	tui "github.com/imfing/gptui/pkg/chat"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	"log"
-	"os"
 )
 
-const defaultModel = "gpt-3.5-turbo"
+const (
+	defaultModel     = "gpt-3.5-turbo"
+	defaultImageSize = "1024x1024"
+)
 
 // chatCmd represents the chat command
 var chatCmd = &cobra.Command{
@@ -20,13 +30,53 @@ var chatCmd = &cobra.Command{
 	Long:  `Given a chat conversation, the model will return a chat completion response.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		message := viper.GetString("message")
-		// Read the input from the pipe
-		if len(message) == 0 {
-			stat, err := os.Stdin.Stat()
+		stdinPiped, stdoutPiped := !isTerminal(os.Stdin), !isTerminal(os.Stdout)
+
+		// quit gracefully on SIGINT and SIGTERM
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		// print the exchanges of the messages of the file without the TUI
+		if filePath := viper.GetString("file"); len(filePath) > 0 && viper.GetBool("no-tui") {
+			messages, err := tui.LoadMessages(filePath, viper.GetString("file-delimiter"))
+			if err == nil {
+				viper.Set("version", cmd.Root().Version)
+				err = tui.RunFile(ctx, messages, os.Stdout)
+			}
+			// interrupted by a signal, the conversation so far is saved
+			if errors.Is(err, context.Canceled) {
+				os.Exit(130)
+			}
 			if err != nil {
-				log.Fatal(err)
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		// pipe mode: answer the message from stdin on stdout without the TUI
+		if stdinPiped && stdoutPiped {
+			if len(message) == 0 {
+				data, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					log.Fatal(err)
+				}
+				message = string(data)
+			}
+			if err := tui.RunPipe(ctx, message, os.Stdout); err != nil {
+				// interrupted by a signal, the partial response is written
+				if errors.Is(err, context.Canceled) {
+					os.Exit(130)
+				}
+				fmt.Fprintln(os.Stderr, "error:", err)
+				os.Exit(1)
 			}
-			if (stat.Mode() & os.ModeCharDevice) == 0 {
+			return
+		}
+
+		// Read the input from the pipe
+		if len(message) == 0 {
+			if stdinPiped {
 				scanner := bufio.NewScanner(os.Stdin)
 				for scanner.Scan() {
 					message += scanner.Text()
@@ -35,21 +85,98 @@ var chatCmd = &cobra.Command{
 			viper.Set("message", message)
 		}
 
-		// start TUI
-		if _, err := tea.NewProgram(tui.NewModel()).Run(); err != nil {
-			fmt.Println("Error running program:", err)
-			os.Exit(1)
-		}
+		viper.Set("version", cmd.Root().Version)
+
+		runTUI(ctx)
 	},
 }
 
+// runTUI starts the terminal UI, which quits gracefully when the context is done.
+// A crash report is saved if the program fails.
+func runTUI(ctx context.Context) {
+	model, err := tea.NewProgram(tui.NewModel().WithShutdown(ctx), tea.WithoutSignalHandler()).Run()
+	if err != nil {
+		tui.SaveCrashReport(model, err)
+		fmt.Println("Error running program:", err)
+		closeLogFile()
+		os.Exit(1)
+	}
+	// the program returns no model if it recovered from a panic
+	if model == nil {
+		closeLogFile()
+		os.Exit(1)
+	}
+}
+
+// isTerminal reports whether the file is a terminal rather than a pipe or a regular file
+func isTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
 func init() {
 	chatCmd.Flags().String("model", defaultModel, "model to use for chat completion")
 	chatCmd.Flags().StringP("message", "m", "", "message for the chat input")
 	chatCmd.Flags().String("system", "", "system message that helps set the behavior of the assistant")
+	chatCmd.Flags().StringToString("persona", nil, "named system message selected with /persona <name> or @name, e.g. --persona reviewer=\"Review my Go code\"")
+	chatCmd.Flags().String("prompt-library", "", "YAML file of prompts inserted with ctrl+/, e.g. prompts: [{name: review, text: \"Review {{code}}\", tags: [go]}]")
+	chatCmd.Flags().Bool("strict-env", false, "if set, unset environment variables in ${KEY} tokens of the system message are an error")
 	chatCmd.Flags().Int("max-context-length", 1024, "maximum number of tokens for GPT context")
+	chatCmd.Flags().Float32("temperature", 0, "sampling temperature between 0 and 2 (0 uses the default of the API)")
+	chatCmd.Flags().Int("max-tokens", 0, "maximum number of tokens to generate in the response (0 for no limit)")
+	chatCmd.Flags().String("file", "", "file of messages to send one after another in a single session, a line per message")
+	chatCmd.Flags().String("file-delimiter", "", "delimiter between the messages of --file instead of a newline, e.g. \"\\n\\n\" for paragraphs")
+	chatCmd.Flags().Bool("no-tui", false, "if set, the exchanges of --file are printed instead of starting the TUI")
+	chatCmd.Flags().Int("multi-session", 0, "number of sessions side by side which each message is sent to, for comparing responses")
+	chatCmd.Flags().StringArray("multi-system", nil, "system message of the next session of --multi-session, repeat for each session")
+	chatCmd.Flags().String("session-name-pattern", "2006-01-02_15-04-05", "Go time layout of the names of the session files, e.g. 2006-01-02 for a session per day, an existing session of the name is offered to resume")
+	chatCmd.Flags().String("session-name", "", "fixed name of the session file instead of --session-name-pattern, an existing session of the name is offered to resume, or _1, _2… is appended")
 	chatCmd.Flags().String("history", "", "path to conversation history file to restore from")
 	chatCmd.Flags().Bool("stream", true, "if set, partial message deltas will be sent, like in ChatGPT")
+	chatCmd.Flags().String("stream-format", "auto", "format of the streamed responses: sse, ndjson or auto to detect it from the Content-Type")
+	chatCmd.Flags().Duration("stream-flush-interval", 50*time.Millisecond, "interval for rendering buffered stream deltas, 0 renders every delta")
+	chatCmd.Flags().Duration("cache-ttl", 0, "reuse the responses of identical requests for this duration, e.g. 10m (0 to disable)")
+	chatCmd.Flags().Bool("line-numbers", false, "if set, line numbers are shown in the conversation")
+	chatCmd.Flags().String("whisper-model", "whisper-1", "model to use for audio transcription")
+	chatCmd.Flags().Bool("tts", false, "if set, assistant responses are read aloud")
+	chatCmd.Flags().String("tts-voice", "alloy", "voice for text to speech: alloy, echo, fable, onyx, nova or shimmer")
+	chatCmd.Flags().String("image-size", defaultImageSize, "size of generated images: 256x256, 512x512 or 1024x1024")
+	chatCmd.Flags().Int("image-n", 1, "number of images to generate")
+	chatCmd.Flags().Int("compact-threshold", 0, "compact the history when it exceeds this number of tokens (0 to disable)")
+	chatCmd.Flags().Int("warn-input-tokens", 500, "the border of the input turns amber when its estimated tokens exceed this number (0 to disable)")
+	chatCmd.Flags().Int("token-warn-at", 80, "show a warning above the input when the history uses more than this percentage of the context window (0 to disable)")
+	chatCmd.Flags().Bool("bell", false, "if set, the terminal bell rings when a response completes and no key was pressed for 5 seconds")
+	chatCmd.Flags().Bool("no-window-title", false, "if set, the terminal window title is not set to the session title")
+	chatCmd.Flags().Bool("no-header", false, "if set, the header with the model and the system message above the conversation is hidden")
+	chatCmd.Flags().Bool("no-context-bar", false, "if set, the context window utilization bar is hidden")
+	chatCmd.Flags().String("separator", "", "text rendered centered between messages, e.g. \"* * *\"")
+	chatCmd.Flags().String("separator-style", "", "built-in separator between messages if --separator is empty: line, dots or arrows")
+	chatCmd.Flags().Int("max-history-memory", 1000, "maximum number of messages kept in memory, older ones are archived to the session file (0 for no limit)")
+	chatCmd.Flags().Int("word-wrap-margin", 2, "columns between the wrapped Markdown and the edge of the conversation")
+	chatCmd.Flags().Bool("no-word-wrap", false, "if set, Markdown is not wrapped to the width of the terminal")
+	chatCmd.Flags().String("expected-lang", "", "ISO 639-1 code of the language responses are expected in, others are highlighted, e.g. en")
+	chatCmd.Flags().Int("page-size", 0, "in pipe mode, print the response in pages of this many lines, waiting for enter between pages (0 to disable)")
+	chatCmd.Flags().Bool("auto-multiline-paste", true, "if set, pasting several lines switches to multi-line mode instead of sending them")
+	chatCmd.Flags().Bool("inline-images", false, "if set, https images in responses are fetched from public addresses and displayed on terminals supporting the kitty graphics protocol")
+	chatCmd.Flags().Bool("spell-check", false, "if set, misspelled words of the input are underlined and ctrl+space suggests corrections")
+	chatCmd.Flags().String("dict-file", "", "Hunspell .dic file used for spell checking instead of the built-in en_US dictionary")
+	chatCmd.Flags().Bool("no-hscroll", false, "if set, code blocks are wrapped instead of scrolling horizontally with ctrl+←/→")
+	chatCmd.Flags().Bool("benchmark-startup", false, "if set, the time until the TUI is ready is printed to stderr and the program exits")
+	chatCmd.Flags().Bool("welcome-animation", false, "if set, the welcome animation is shown, otherwise only on the first launch")
+	chatCmd.Flags().Bool("no-draft", false, "if set, unsent messages are not saved on exit and restored on the next start")
+	chatCmd.Flags().Bool("no-duplicate-check", false, "if set, sending a message identical to a recent one is not confirmed")
+	chatCmd.Flags().String("code-theme", "", "chroma style for code blocks, e.g. dracula, monokai, github or solarized-light")
+	chatCmd.Flags().Bool("allow-go-eval", false, "if set, /eval runs the last Go code block of the last response on this machine")
+	chatCmd.Flags().Bool("mdns-discover", false, "if set, OpenAI-compatible servers announced as _openai._tcp with mDNS on the local network are listed to pick the base URL from")
+	chatCmd.Flags().String("backend", "openai", "backend generating the responses: openai or llamacpp")
+	chatCmd.Flags().String("model-path", "", "path to the GGUF model file for the llamacpp backend")
+	chatCmd.Flags().String("model-info-file", "", "JSON file mapping model IDs to {\"context_window\": int, \"max_output\": int}, overriding the built-in table")
+	chatCmd.Flags().String("fallback-model", "", "model to switch to when the quota of the model is exhausted or it does not exist")
+	chatCmd.Flags().String("context-prefix", "", "text prepended to every user message sent to the API")
+	chatCmd.Flags().String("context-suffix", "", "text appended to every user message sent to the API, e.g. \"Reply in JSON.\"")
 
 	err := viper.BindPFlags(chatCmd.Flags())
 	if err != nil {
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"os"
+
+	tui "github.com/imfing/gptui/pkg/chat"
+	"github.com/spf13/cobra"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the configuration and the terminal for common issues",
+	Run: func(cmd *cobra.Command, args []string) {
+		if !tui.RunDoctor(os.Stdout, tui.DoctorChecks()) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
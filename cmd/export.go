@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	tui "github.com/imfing/gptui/pkg/chat"
+	"github.com/spf13/cobra"
+)
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export a saved conversation",
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		history, _ := cmd.Flags().GetString("history")
+		vaultDir, _ := cmd.Flags().GetString("vault-dir")
+
+		switch format {
+		case "obsidian":
+		case "jsonl":
+			session, err := tui.LoadSession(history)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := tui.WriteFineTuningJSONL(os.Stdout, *session); err != nil {
+				log.Fatal(err)
+			}
+			return
+		default:
+			log.Fatalf("unsupported export format %q", format)
+		}
+		if len(vaultDir) == 0 {
+			log.Fatal("--vault-dir is required for the obsidian format")
+		}
+		dir, err := tui.HistoryDir()
+		if err != nil {
+			log.Fatal(err)
+		}
+		notePath, err := tui.ExportObsidian(history, vaultDir, dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Exported %s\n", notePath)
+	},
+}
+
+func init() {
+	exportCmd.Flags().String("format", "obsidian", "export format: obsidian, or jsonl to print fine-tuning examples with their ratings")
+	exportCmd.Flags().String("history", "", "path to the conversation history file to export")
+	exportCmd.Flags().String("vault-dir", "", "path to the Obsidian vault")
+	exportCmd.MarkFlagRequired("history")
+
+	rootCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	tui "github.com/imfing/gptui/pkg/chat"
+	"github.com/spf13/cobra"
+)
+
+// helpCmd replaces the help command of cobra to add the cheatsheets as subcommands
+var helpCmd = &cobra.Command{
+	Use:   "help [command]",
+	Short: "Help about any command",
+	Long:  `Help provides help for any command in the application, and cheatsheets of the key bindings and inline commands of the TUI.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		target, _, err := cmd.Root().Find(args)
+		if target == nil || err != nil {
+			cmd.Printf("Unknown help topic %#q\n", args)
+			cobra.CheckErr(cmd.Root().Usage())
+			return
+		}
+		target.InitDefaultHelpFlag()
+		target.InitDefaultVersionFlag()
+		cobra.CheckErr(target.Help())
+	},
+}
+
+// helpKeysCmd represents the help keys command
+var helpKeysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Print the key bindings of the TUI",
+	Run: func(cmd *cobra.Command, args []string) {
+		markdown := cheatsheetMarkdown(cmd)
+		var rows [][]string
+		for _, binding := range tui.DefaultBindings() {
+			rows = append(rows, []string{binding.Action, binding.Key})
+		}
+		fmt.Print(tui.FormatTable([]string{"Action", "Key"}, rows, markdown))
+	},
+}
+
+// helpCommandsCmd represents the help commands command
+var helpCommandsCmd = &cobra.Command{
+	Use:   "commands",
+	Short: "Print the inline commands of the TUI",
+	Run: func(cmd *cobra.Command, args []string) {
+		markdown := cheatsheetMarkdown(cmd)
+		var rows [][]string
+		for _, c := range tui.InlineCommands() {
+			command := "/" + c.Name
+			if len(c.Args) > 0 {
+				command += " " + c.Args
+			}
+			rows = append(rows, []string{command, c.Description})
+		}
+		fmt.Print(tui.FormatTable([]string{"Command", "Description"}, rows, markdown))
+	},
+}
+
+// cheatsheetMarkdown returns whether the cheatsheet is printed as a Markdown table
+func cheatsheetMarkdown(cmd *cobra.Command) bool {
+	format, _ := cmd.Flags().GetString("format")
+	switch format {
+	case "text":
+		return false
+	case "markdown":
+		return true
+	}
+	log.Fatalf("unsupported format %q", format)
+	return false
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{helpKeysCmd, helpCommandsCmd} {
+		cmd.Flags().String("format", "text", "output format: text or markdown")
+		helpCmd.AddCommand(cmd)
+	}
+
+	rootCmd.SetHelpCommand(helpCmd)
+}
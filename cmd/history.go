@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	tui "github.com/imfing/gptui/pkg/chat"
+	"github.com/spf13/cobra"
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Manage saved conversations",
+}
+
+// historyListCmd represents the history list command
+var historyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List saved conversations, pinned first",
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, err := tui.HistoryDir()
+		if err != nil {
+			log.Fatal(err)
+		}
+		sessions, err := tui.ListSessions(dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, session := range sessions {
+			prefix := "  "
+			if session.Pinned {
+				prefix = "📌"
+			}
+			tree := ""
+			if session.Threaded() {
+				tree = "  🌳"
+			}
+			fmt.Printf("%s %s  %d messages%s\n", prefix, session.ID, len(session.Messages), tree)
+		}
+	},
+}
+
+// historyPinCmd represents the history pin command
+var historyPinCmd = &cobra.Command{
+	Use:   "pin <session-id>",
+	Short: "Pin or unpin a saved conversation",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, err := tui.HistoryDir()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := tui.TogglePin(args[0], dir); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// historyShowCmd represents the history show command
+var historyShowCmd = &cobra.Command{
+	Use:   "show <session-id>",
+	Short: "Print a saved conversation with the notes of its messages",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, err := tui.HistoryDir()
+		if err != nil {
+			log.Fatal(err)
+		}
+		session, err := tui.LoadSession(filepath.Join(dir, args[0]+".json"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Print(tui.FormatTranscript(*session))
+	},
+}
+
+// historyImportCmd represents the history import command
+var historyImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import conversations from a gptui session or ChatGPT export file",
+	Run: func(cmd *cobra.Command, args []string) {
+		url, _ := cmd.Flags().GetString("url")
+		user, _ := cmd.Flags().GetString("import-user")
+		password, _ := cmd.Flags().GetString("import-password")
+
+		dir, err := tui.HistoryDir()
+		if err != nil {
+			log.Fatal(err)
+		}
+		paths, err := tui.ImportSessions(url, user, password, dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, filePath := range paths {
+			fmt.Printf("Imported %s\n", filePath)
+		}
+	},
+}
+
+// historyPruneCmd represents the history prune command
+var historyPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete old conversations with few messages",
+	Run: func(cmd *cobra.Command, args []string) {
+		olderThan, _ := cmd.Flags().GetString("older-than")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		minMessages, _ := cmd.Flags().GetInt("min-messages")
+		keepPinned, _ := cmd.Flags().GetBool("keep-pinned")
+
+		age, err := parseAge(olderThan)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dir, err := tui.HistoryDir()
+		if err != nil {
+			log.Fatal(err)
+		}
+		paths, err := tui.PruneSessions(dir, tui.PruneOptions{
+			OlderThan:   age,
+			MinMessages: minMessages,
+			KeepPinned:  keepPinned,
+			DryRun:      dryRun,
+		})
+		for _, filePath := range paths {
+			if dryRun {
+				fmt.Printf("Would delete %s\n", filePath)
+			} else {
+				fmt.Printf("Deleted %s\n", filePath)
+			}
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+// historyReplayCmd represents the history replay command
+var historyReplayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Replay a saved conversation message by message",
+	Run: func(cmd *cobra.Command, args []string) {
+		history, _ := cmd.Flags().GetString("history")
+		speed, _ := cmd.Flags().GetString("speed")
+
+		replaySpeed, err := tui.ParseReplaySpeed(speed)
+		if err != nil {
+			log.Fatal(err)
+		}
+		model, err := tui.NewReplayModel(history, replaySpeed)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err := tea.NewProgram(model).Run(); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+const (
+	// histogramBins and histogramWidth are the number of bins and the width of the longest bar
+	// of the response length histogram
+	histogramBins  = 10
+	histogramWidth = 40
+)
+
+// historyStatsCmd represents the history stats command
+var historyStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show statistics of saved conversations",
+	Run: func(cmd *cobra.Command, args []string) {
+		history, _ := cmd.Flags().GetString("history")
+		words, _ := cmd.Flags().GetInt("words")
+		role, _ := cmd.Flags().GetString("role")
+		histogram, _ := cmd.Flags().GetBool("histogram")
+		rating, _ := cmd.Flags().GetBool("rating")
+
+		var sessions []tui.Session
+		if len(history) > 0 {
+			session, err := tui.LoadSession(history)
+			if err != nil {
+				log.Fatal(err)
+			}
+			sessions = []tui.Session{*session}
+		} else {
+			dir, err := tui.HistoryDir()
+			if err != nil {
+				log.Fatal(err)
+			}
+			if sessions, err = tui.ListSessions(dir); err != nil && !os.IsNotExist(err) {
+				log.Fatal(err)
+			}
+		}
+		var messages []tui.Message
+		for _, session := range sessions {
+			messages = append(messages, session.Messages...)
+		}
+
+		if rating {
+			average, distribution := tui.RatingStats(sessions)
+			total := 0
+			for _, n := range distribution {
+				total += n
+			}
+			fmt.Printf("%d rated responses, average %.2f\n", total, average)
+			for i := len(distribution) - 1; i >= 0; i-- {
+				fmt.Printf("  %d  %d\n", i+1, distribution[i])
+			}
+			return
+		}
+
+		if histogram {
+			var lengths []int
+			for _, message := range messages {
+				if message.Role == "assistant" {
+					lengths = append(lengths, len(strings.Fields(message.Content)))
+				}
+			}
+			fmt.Println("assistant response length (words)")
+			fmt.Print(tui.RenderHistogram(tui.BuildHistogram(lengths, histogramBins), histogramWidth))
+			return
+		}
+		if words > 0 {
+			frequency := tui.WordFrequency(messages, role, tui.StopWords)
+			for _, count := range tui.TopWords(frequency, words) {
+				fmt.Printf("%6d  %s\n", count.Count, count.Word)
+			}
+			return
+		}
+		counts := map[string]int{}
+		for _, message := range messages {
+			counts[message.Role]++
+		}
+		fmt.Printf("%d messages\n", len(messages))
+		for _, r := range []string{"system", "user", "assistant"} {
+			fmt.Printf("  %-10s %d\n", r, counts[r])
+		}
+	},
+}
+
+// parseAge parses a duration which may use days, e.g. "30d"
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func init() {
+	historyImportCmd.Flags().String("url", "", "URL of the session file to import")
+	historyImportCmd.Flags().String("import-user", "", "Username for basic authentication")
+	historyImportCmd.Flags().String("import-password", "", "Password for basic authentication")
+	historyImportCmd.MarkFlagRequired("url")
+
+	historyPruneCmd.Flags().String("older-than", "30d", "delete conversations older than this duration, e.g. 30d or 12h")
+	historyPruneCmd.Flags().Bool("dry-run", false, "print the conversations which would be deleted without deleting them")
+	historyPruneCmd.Flags().Int("min-messages", 1, "keep conversations with at least this many messages")
+	historyPruneCmd.Flags().Bool("keep-pinned", false, "keep pinned conversations")
+
+	historyReplayCmd.Flags().String("history", "", "path to the conversation history file to replay")
+	historyReplayCmd.Flags().String("speed", "1x", "replay speed, e.g. 0.5x, 1x or 2x")
+	historyReplayCmd.MarkFlagRequired("history")
+
+	historyStatsCmd.Flags().String("history", "", "path to a conversation history file, all saved conversations if empty")
+	historyStatsCmd.Flags().Int("words", 0, "print the N most frequent words instead of the message counts")
+	historyStatsCmd.Flags().Bool("histogram", false, "print a histogram of the assistant response lengths in words instead of the message counts")
+	historyStatsCmd.Flags().Bool("rating", false, "print the average and distribution of the response ratings instead of the message counts")
+	historyStatsCmd.Flags().String("role", "assistant", "role of the messages to count words of, all roles if empty")
+
+	historyCmd.AddCommand(historyListCmd)
+	historyCmd.AddCommand(historyPinCmd)
+	historyCmd.AddCommand(historyShowCmd)
+	historyCmd.AddCommand(historyImportCmd)
+	historyCmd.AddCommand(historyPruneCmd)
+	historyCmd.AddCommand(historyReplayCmd)
+	historyCmd.AddCommand(historyStatsCmd)
+
+	rootCmd.AddCommand(historyCmd)
+}
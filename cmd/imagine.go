@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	tui "github.com/imfing/gptui/pkg/chat"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// imagineCmd represents the imagine command
+var imagineCmd = &cobra.Command{
+	Use:   "imagine <prompt>",
+	Short: "Generate images from a prompt",
+	Long:  `Given a prompt, DALL-E will generate images and save them to the images folder of the gptui config directory (~/.config/gptui/images on Linux).`,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client := tui.NewChatClient(viper.GetString("openai-api-base"), viper.GetString("openai-api-key"), "", "", false, 0)
+		images, err := client.GenerateImage(strings.Join(args, " "), viper.GetString("image-size"), viper.GetInt("image-n"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		paths, err := tui.SaveImages(images)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, filePath := range paths {
+			fmt.Println("🖼 Image saved:", filePath)
+			if err := tui.OpenFile(filePath); err != nil {
+				log.Println(err)
+			}
+		}
+	},
+}
+
+func init() {
+	// the flags of chat are bound to the viper keys
+	imagineCmd.Flags().AddFlag(chatCmd.Flags().Lookup("image-size"))
+	imagineCmd.Flags().AddFlag(chatCmd.Flags().Lookup("image-n"))
+
+	rootCmd.AddCommand(imagineCmd)
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	tui "github.com/imfing/gptui/pkg/chat"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// pluginsCmd represents the plugins command
+var pluginsCmd = &cobra.Command{
+	Use:   "plugins",
+	Short: "Manage the plugins adding inline commands",
+}
+
+// pluginsListCmd represents the plugins list command
+var pluginsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the plugins of the plugins directory with their commands",
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := viper.GetString("plugins-dir")
+		if len(dir) == 0 {
+			log.Fatal("no plugins directory, set --plugins-dir or $GPTUI_PLUGINS_DIR")
+		}
+		plugins, err := tui.LoadPlugins(dir)
+		if err != nil {
+			// list the plugins which loaded anyway
+			fmt.Fprintln(os.Stderr, err)
+		}
+		for _, p := range plugins {
+			fmt.Printf("%-20s  /%s\n", p.Name(), strings.Join(p.Commands(), " /"))
+		}
+	},
+}
+
+func init() {
+	pluginsCmd.AddCommand(pluginsListCmd)
+
+	rootCmd.AddCommand(pluginsCmd)
+}
@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"io"
+	"log"
+	"log/slog"
 	"os"
+	"path/filepath"
 	"strings"
 
+	tui "github.com/imfing/gptui/pkg/chat"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -16,9 +21,13 @@ var rootCmd = &cobra.Command{
 	Short: "Terminal UI for OpenAI GPT",
 }
 
+// openedLogFile is the file opened for --log-file, closed when the command exits
+var openedLogFile *os.File
+
 func Execute(version string) {
 	rootCmd.Version = version
 	err := rootCmd.Execute()
+	closeLogFile()
 	if err != nil {
 		os.Exit(1)
 	}
@@ -29,6 +38,9 @@ func init() {
 
 	rootCmd.PersistentFlags().String("openai-api-key", "", "OpenAI API key")
 	rootCmd.PersistentFlags().String("openai-api-base", BaseURL, "OpenAI API endpoint")
+	rootCmd.PersistentFlags().String("log-file", "", "path to the log file, logging is disabled if empty")
+	rootCmd.PersistentFlags().String("log-level", "info", "log level: debug, info, warn or error")
+	rootCmd.PersistentFlags().String("plugins-dir", "", "directory of the plugin programs adding inline commands, $GPTUI_PLUGINS_DIR if empty")
 }
 
 func initConfig() {
@@ -36,4 +48,67 @@ func initConfig() {
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 
 	viper.BindPFlags(rootCmd.PersistentFlags())
+	viper.BindEnv("plugins-dir", "GPTUI_PLUGINS_DIR")
+
+	if err := initLogger(viper.GetString("log-file"), viper.GetString("log-level")); err != nil {
+		log.Fatal(err)
+	}
+
+	// secrets managers such as Docker Swarm or Kubernetes mount the key as a file
+	if keyFile := os.Getenv("OPENAI_API_KEY_FILE"); len(keyFile) > 0 && len(viper.GetString("openai-api-key")) == 0 {
+		key, err := readAPIKeyFromFile(keyFile)
+		if err != nil {
+			log.Printf("warning: failed to read the API key from $OPENAI_API_KEY_FILE: %v", err)
+		} else {
+			viper.Set("openai-api-key", key)
+		}
+	}
+}
+
+// readAPIKeyFromFile reads the API key from the file, the path may start with ~/
+func readAPIKeyFromFile(path string) (string, error) {
+	if strings.HasPrefix(path, "~/") {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(homeDir, path[2:])
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// initLogger configures the JSON logger writing to the given file
+func initLogger(logFile string, logLevel string) error {
+	if len(logFile) == 0 {
+		return nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	closeLogFile()
+	openedLogFile = f
+	tui.SetLogger(slog.New(slog.NewJSONHandler(f, &slog.HandlerOptions{Level: level})))
+	return nil
+}
+
+// closeLogFile syncs and closes the log file, the logger is disabled afterwards
+func closeLogFile() {
+	if openedLogFile == nil {
+		return
+	}
+	tui.SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	openedLogFile.Sync()
+	if err := openedLogFile.Close(); err != nil {
+		log.Printf("warning: failed to close the log file: %v", err)
+	}
+	openedLogFile = nil
 }
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAPIKeyFromFile(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	assert.NoError(t, os.WriteFile(filepath.Join(home, "openai_key"), []byte("  sk-test-key\n"), 0600))
+
+	key, err := readAPIKeyFromFile(filepath.Join(home, "openai_key"))
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-test-key", key)
+
+	key, err = readAPIKeyFromFile("~/openai_key")
+	assert.NoError(t, err)
+	assert.Equal(t, "sk-test-key", key)
+
+	_, err = readAPIKeyFromFile(filepath.Join(home, "missing"))
+	assert.Error(t, err)
+}
+
+func TestInitConfig_APIKeyFile(t *testing.T) {
+	defer viper.Reset()
+	keyFile := filepath.Join(t.TempDir(), "openai_key")
+	assert.NoError(t, os.WriteFile(keyFile, []byte("sk-from-file\n"), 0600))
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("OPENAI_API_KEY_FILE", keyFile)
+
+	initConfig()
+	assert.Equal(t, "sk-from-file", viper.GetString("openai-api-key"))
+
+	// the key of the environment takes precedence
+	viper.Reset()
+	t.Setenv("OPENAI_API_KEY", "sk-from-env")
+	initConfig()
+	assert.Equal(t, "sk-from-env", viper.GetString("openai-api-key"))
+}
+
+func TestWorkspaceCmd_ChatFlags(t *testing.T) {
+	defer viper.Reset()
+	assert.NoError(t, viper.BindPFlags(chatCmd.Flags()))
+	assert.NoError(t, workspaceCmd.ParseFlags([]string{"--dir", ".", "--model", "gpt-4", "--system", "Review the code"}))
+	assert.Equal(t, "gpt-4", viper.GetString("model"))
+	assert.Equal(t, "Review the code", viper.GetString("system"))
+}
+
+func TestImagineCmd_ChatFlags(t *testing.T) {
+	defer viper.Reset()
+	assert.NoError(t, viper.BindPFlags(chatCmd.Flags()))
+	assert.NoError(t, imagineCmd.ParseFlags([]string{"--image-size", "512x512", "--image-n", "2"}))
+	assert.Equal(t, "512x512", viper.GetString("image-size"))
+	assert.Equal(t, 2, viper.GetInt("image-n"))
+}
+
+func TestInitLogger_ClosesLogFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "gptui.log")
+	assert.NoError(t, initLogger(filePath, "info"))
+	f := openedLogFile
+	assert.NotNil(t, f)
+
+	closeLogFile()
+	assert.Nil(t, openedLogFile)
+	// the file is closed
+	_, err := f.Write([]byte("x"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+	closeLogFile()
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/imfing/gptui/pkg/updater"
+	"github.com/spf13/cobra"
+)
+
+// updateCmd represents the update command
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update gptui to the latest release",
+	Run: func(cmd *cobra.Command, args []string) {
+		check, _ := cmd.Flags().GetBool("check")
+
+		release, err := updater.LatestRelease()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !updater.IsNewer(release.TagName, rootCmd.Version) {
+			fmt.Printf("gptui %s is up to date\n", rootCmd.Version)
+			return
+		}
+		if check {
+			fmt.Printf("Update available: %s → %s\n", rootCmd.Version, release.TagName)
+			return
+		}
+
+		if err := updater.Install(release); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Updated gptui to %s\n", release.TagName)
+	},
+}
+
+func init() {
+	updateCmd.Flags().Bool("check", false, "only check whether an update is available")
+
+	rootCmd.AddCommand(updateCmd)
+}
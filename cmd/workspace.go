@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"context"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// workspaceCmd represents the workspace command
+var workspaceCmd = &cobra.Command{
+	Use:   "workspace",
+	Short: "Chat about the source files of a directory",
+	Long:  `Starts the terminal UI with the source files of the directory attached to the first message and its file tree in the system message. The files which do not fit in three quarters of --max-context-length are skipped. The attached files are watched for changes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, _ := cmd.Flags().GetString("dir")
+		extensions, _ := cmd.Flags().GetStringSlice("ext")
+		maxFiles, _ := cmd.Flags().GetInt("max-files")
+		maxFileSize, _ := cmd.Flags().GetInt64("max-file-size")
+		viper.Set("workspace-dir", dir)
+		viper.Set("workspace-ext", extensions)
+		viper.Set("workspace-max-files", maxFiles)
+		viper.Set("workspace-max-file-size", maxFileSize)
+		viper.Set("version", cmd.Root().Version)
+
+		// quit gracefully on SIGINT and SIGTERM
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		runTUI(ctx)
+	},
+}
+
+func init() {
+	workspaceCmd.Flags().String("dir", "", "directory of the source files")
+	workspaceCmd.Flags().StringSlice("ext", []string{".go", ".py", ".js", ".ts", ".rs", ".java", ".c", ".h", ".cpp", ".rb", ".md"}, "extensions of the attached files")
+	workspaceCmd.Flags().Int("max-files", 20, "number of files attached at most")
+	workspaceCmd.Flags().Int64("max-file-size", 64*1024, "size in bytes above which files are skipped")
+	workspaceCmd.MarkFlagRequired("dir")
+	// the flags of chat, e.g. --model and --system, are bound to the same viper keys
+	workspaceCmd.Flags().AddFlagSet(chatCmd.Flags())
+
+	rootCmd.AddCommand(workspaceCmd)
+}
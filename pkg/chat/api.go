@@ -3,11 +3,19 @@ package chat
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/imfing/gptui/pkg/rest"
@@ -54,6 +62,8 @@ type CompletionRequest struct {
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// ParentID is the ID of the message this one replies to, it is not sent to the API
+	ParentID *string `json:"parent_id,omitempty"`
 }
 
 type CompletionStreamDelta struct {
@@ -67,6 +77,12 @@ type CompletionStreamChoice struct {
 	FinishReason string                `json:"finish_reason,omitempty"`
 }
 
+// maxStreamLineSize is the longest line of a stream body
+const maxStreamLineSize = 16 * 1024 * 1024
+
+// finishReasonIncomplete finishes a stream which ended after malformed events without a finish event
+const finishReasonIncomplete = "incomplete"
+
 type CompletionStreamResponse struct {
 	ID      string                   `json:"id,omitempty"`
 	Object  string                   `json:"object,omitempty"`
@@ -74,9 +90,195 @@ type CompletionStreamResponse struct {
 	Choices []CompletionStreamChoice `json:"choices,omitempty"`
 }
 
+type TranscriptionResponse struct {
+	Text string `json:"text"`
+}
+
+type SpeechRequest struct {
+	Model string `json:"model"`
+	Input string `json:"input"`
+	Voice string `json:"voice"`
+}
+
+// OpenAI Images API types
+// See https://platform.openai.com/docs/api-reference/images
+
+type ImageRequest struct {
+	Prompt         string `json:"prompt"`
+	N              int    `json:"n,omitempty"`
+	Size           string `json:"size,omitempty"`
+	ResponseFormat string `json:"response_format,omitempty"`
+}
+
+type ImageResult struct {
+	B64JSON       string `json:"b64_json,omitempty"`
+	URL           string `json:"url,omitempty"`
+	RevisedPrompt string `json:"revised_prompt,omitempty"`
+}
+
+type ImageResponse struct {
+	Created int64         `json:"created,omitempty"`
+	Data    []ImageResult `json:"data"`
+}
+
+// OpenAI Assistants API types
+// See https://platform.openai.com/docs/api-reference/assistants
+
+type Tool struct {
+	Type string `json:"type"`
+}
+
+type Assistant struct {
+	ID           string `json:"id,omitempty"`
+	Object       string `json:"object,omitempty"`
+	CreatedAt    int64  `json:"created_at,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Instructions string `json:"instructions,omitempty"`
+	Model        string `json:"model"`
+	Tools        []Tool `json:"tools,omitempty"`
+}
+
+type AssistantList struct {
+	Data []Assistant `json:"data"`
+}
+
+type Thread struct {
+	ID        string `json:"id"`
+	Object    string `json:"object,omitempty"`
+	CreatedAt int64  `json:"created_at,omitempty"`
+}
+
+type ThreadMessageText struct {
+	Value string `json:"value"`
+}
+
+type ThreadMessageContent struct {
+	Type string             `json:"type"`
+	Text *ThreadMessageText `json:"text,omitempty"`
+}
+
+type ThreadMessage struct {
+	ID        string                 `json:"id,omitempty"`
+	Object    string                 `json:"object,omitempty"`
+	CreatedAt int64                  `json:"created_at,omitempty"`
+	ThreadID  string                 `json:"thread_id,omitempty"`
+	Role      string                 `json:"role"`
+	Content   []ThreadMessageContent `json:"content"`
+	RunID     string                 `json:"run_id,omitempty"`
+}
+
+type ThreadMessageList struct {
+	Data []ThreadMessage `json:"data"`
+}
+
+// OpenAI Files and Batch API types
+// See https://platform.openai.com/docs/api-reference/batch
+
+type File struct {
+	ID        string `json:"id"`
+	Object    string `json:"object,omitempty"`
+	Bytes     int64  `json:"bytes,omitempty"`
+	CreatedAt int64  `json:"created_at,omitempty"`
+	Filename  string `json:"filename,omitempty"`
+	Purpose   string `json:"purpose,omitempty"`
+}
+
+type BatchRequest struct {
+	InputFileID      string `json:"input_file_id"`
+	Endpoint         string `json:"endpoint"`
+	CompletionWindow string `json:"completion_window"`
+}
+
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+type Batch struct {
+	ID               string             `json:"id"`
+	Object           string             `json:"object,omitempty"`
+	Endpoint         string             `json:"endpoint,omitempty"`
+	InputFileID      string             `json:"input_file_id,omitempty"`
+	CompletionWindow string             `json:"completion_window,omitempty"`
+	Status           string             `json:"status"`
+	OutputFileID     string             `json:"output_file_id,omitempty"`
+	ErrorFileID      string             `json:"error_file_id,omitempty"`
+	CreatedAt        int64              `json:"created_at,omitempty"`
+	RequestCounts    BatchRequestCounts `json:"request_counts"`
+}
+
+// BatchInputLine is a request of the JSONL input file of a batch
+type BatchInputLine struct {
+	CustomID string             `json:"custom_id"`
+	Method   string             `json:"method"`
+	URL      string             `json:"url"`
+	Body     *CompletionRequest `json:"body"`
+}
+
+type BatchResponse struct {
+	StatusCode int                `json:"status_code"`
+	RequestID  string             `json:"request_id,omitempty"`
+	Body       CompletionResponse `json:"body"`
+}
+
+// BatchResult is a line of the JSONL output file of a batch
+type BatchResult struct {
+	ID       string         `json:"id"`
+	CustomID string         `json:"custom_id"`
+	Response *BatchResponse `json:"response"`
+	Error    *APIError      `json:"error"`
+}
+
+type RunError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type Run struct {
+	ID          string    `json:"id,omitempty"`
+	Object      string    `json:"object,omitempty"`
+	CreatedAt   int64     `json:"created_at,omitempty"`
+	ThreadID    string    `json:"thread_id,omitempty"`
+	AssistantID string    `json:"assistant_id"`
+	Status      string    `json:"status,omitempty"`
+	LastError   *RunError `json:"last_error,omitempty"`
+}
+
+// Text returns the text contents of the message
+func (m ThreadMessage) Text() string {
+	var texts []string
+	for _, content := range m.Content {
+		if content.Type == "text" && content.Text != nil {
+			texts = append(texts, content.Text.Value)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// Finished reports whether the batch has stopped, successfully or not
+func (b *Batch) Finished() bool {
+	switch b.Status {
+	case "completed", "failed", "expired", "cancelled":
+		return true
+	}
+	return false
+}
+
+// finished reports whether the run has stopped, successfully or not
+func (r *Run) finished() bool {
+	switch r.Status {
+	case "queued", "in_progress", "cancelling":
+		return false
+	}
+	return true
+}
+
 // Client implements a REST client for OpenAI API
 type Client struct {
 	httpClient *rest.Client
+	// baseURL is the base URL of the API
+	baseURL string
 	// model ID of the model to use
 	model string
 	// system optional message that helps set the behavior of the assistant
@@ -87,38 +289,100 @@ type Client struct {
 	token string
 	// maxContextLength sets the limit for the number of tokens from context
 	maxContextLength int
+	// maxTokens sets the maximum number of tokens to generate, 0 means no limit
+	maxTokens int
+	// temperature sets the sampling temperature, 0 uses the default of the API
+	temperature float32
+	// contextPrefix and contextSuffix are added to the content of every user message sent
+	contextPrefix string
+	contextSuffix string
+	// whisperModel is the model ID used for audio transcription
+	whisperModel string
 	// events is the channel for streaming the data-only server-sent events
 	events chan CompletionStreamResponse
+	// rateLimits receives the rate limits of the completion responses, dropped if not read
+	rateLimits chan RateLimitInfo
+	// done is closed when the client is closed to stop streaming
+	done      chan struct{}
+	closeOnce sync.Once
+	// lastRequestID is the X-Request-ID of the last completion request
+	lastRequestID string
+	// streamFormat is the format of the streamed responses: auto, sse or ndjson
+	streamFormat string
+	// backend generates the completions instead of the API if set
+	backend Backend
 	// history stores list of previous messages
 	history []Message
 }
 
+const (
+	defaultWhisperModel = "whisper-1"
+	defaultSpeechModel  = "tts-1"
+)
+
+// Formats of the streamed responses, auto detects the format from the Content-Type of the response
+const (
+	streamFormatAuto   = "auto"
+	streamFormatSSE    = "sse"
+	streamFormatNDJSON = "ndjson"
+)
+
+// runPollInterval is the interval between status requests while a run is in progress
+var runPollInterval = time.Second
+
+// maxStreamReconnects is the number of times an interrupted stream of server-sent events is resumed
+const maxStreamReconnects = 3
+
+// streamReconnectDelay is the delay before resuming an interrupted stream, unless the server sets one
+var streamReconnectDelay = time.Second
+
+// speechVoices lists the voices supported by the speech API
+var speechVoices = []string{"alloy", "echo", "fable", "onyx", "nova", "shimmer"}
+
 // NewChatClient creates a Client configured for chat completion
 func NewChatClient(baseURL string, token string, model string, system string, stream bool, maxContextLength int) *Client {
-	c := rest.NewClient(
-		rest.WithBaseURL(baseURL),
-		rest.WithTimeout(time.Minute),
-	)
 	client := &Client{
-		httpClient:       c,
+		httpClient:       newHTTPClient(baseURL),
+		baseURL:          baseURL,
 		model:            model,
 		system:           system,
 		stream:           stream,
 		token:            token,
 		maxContextLength: maxContextLength,
-		events:           make(chan CompletionStreamResponse),
+		whisperModel:     defaultWhisperModel,
+		events:           make(chan CompletionStreamResponse, 1),
+		rateLimits:       make(chan RateLimitInfo, 1),
+		done:             make(chan struct{}),
 		history:          []Message{},
 	}
 	return client
 }
 
+// newHTTPClient creates the REST client for the API at baseURL
+func newHTTPClient(baseURL string) *rest.Client {
+	return rest.NewClient(
+		rest.WithBaseURL(baseURL),
+		rest.WithTimeout(time.Minute),
+	)
+}
+
+// setBaseURL sends the following requests to the API at baseURL
+func (c *Client) setBaseURL(baseURL string) {
+	c.baseURL = baseURL
+	c.httpClient = newHTTPClient(baseURL)
+}
+
 // NewRequest creates a http request for the chat completion API
 func (c *Client) NewRequest(body *CompletionRequest) (*http.Request, error) {
+	return c.newRequest(body, c.stream)
+}
+
+// newRequest creates a http request for the chat completion API, streaming the response if stream is set
+func (c *Client) newRequest(body *CompletionRequest, stream bool) (*http.Request, error) {
 	header := http.Header{
-		"Authorization": []string{fmt.Sprintf("Bearer %s", c.token)},
-		"Content-Type":  []string{"application/json"},
+		"Content-Type": []string{"application/json"},
 	}
-	if c.stream {
+	if stream {
 		header.Set("Accept", "text/event-stream")
 		header.Set("Cache-Control", "no-cache")
 		header.Set("Connection", "keep-alive")
@@ -133,6 +397,7 @@ func (c *Client) NewRequest(body *CompletionRequest) (*http.Request, error) {
 	req, err := c.httpClient.NewRequest(
 		"/chat/completions",
 		rest.WithMethod(http.MethodPost),
+		rest.WithBearerToken(c.token),
 		rest.WithHeader(header),
 		rest.WithBody(bytes.NewReader(payload)),
 	)
@@ -143,28 +408,86 @@ func (c *Client) NewRequest(body *CompletionRequest) (*http.Request, error) {
 	return req, nil
 }
 
+// Close stops streaming responses, in-flight requests are cancelled
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if c.backend != nil {
+			if err := c.backend.Close(); err != nil {
+				logger.Warn("failed to close backend", "error", err)
+			}
+		}
+	})
+}
+
 // CreateCompletion sends the CompletionRequest
 // If stream is enabled, server-sent events will be sent into the events channel
 // Otherwise, it returns CompletionResponse
 func (c *Client) CreateCompletion(request *CompletionRequest) (*CompletionResponse, error) {
-	req, err := c.NewRequest(request)
-	if err != nil {
-		return nil, err
+	return c.createCompletion(request, c.stream)
+}
+
+// completeWithBackend collects the completion streamed by the backend into a CompletionResponse
+func completeWithBackend(backend Backend, request *CompletionRequest, done <-chan struct{}) (*CompletionResponse, error) {
+	events := make(chan CompletionStreamResponse)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- backend.Complete(request, events, done)
+		close(events)
+	}()
+
+	message := Message{Role: "assistant"}
+	var finishReason string
+	for event := range events {
+		for _, choice := range event.Choices {
+			message.Content += choice.Delta.Content
+			if len(choice.FinishReason) > 0 {
+				finishReason = choice.FinishReason
+			}
+		}
 	}
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
+	if err := <-errs; err != nil {
 		return nil, err
 	}
+	return &CompletionResponse{Choices: []CompletionChoice{{Message: message, FinishReason: finishReason}}}, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, err
+// createCompletion sends the CompletionRequest, streaming the response into the events channel if stream is set
+func (c *Client) createCompletion(request *CompletionRequest, stream bool) (*CompletionResponse, error) {
+	if c.backend != nil {
+		if stream {
+			return nil, c.backend.Complete(request, c.events, c.done)
+		}
+		return completeWithBackend(c.backend, request, c.done)
+	}
+
+	requestID := generateRequestID()
+	c.lastRequestID = requestID
+
+	// cancel the request when the client is closed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.done:
+			cancel()
+		case <-ctx.Done():
 		}
-		return nil, fmt.Errorf("status code: %d, body: %s", resp.StatusCode, string(body))
+	}()
+
+	tokens := 0
+	for _, message := range request.Messages {
+		tokens += countTokens(message.Content)
 	}
+	logger.Debug("sending completion request",
+		"model", request.Model, "messages", len(request.Messages), "tokens", tokens, "request_id", requestID)
 
-	if !c.stream {
+	resp, err := c.sendCompletionRequest(ctx, request, stream, requestID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if !stream {
 		body, err := io.ReadAll(resp.Body)
 		var ret CompletionResponse
 		if err = json.Unmarshal(body, &ret); err != nil {
@@ -174,28 +497,728 @@ func (c *Client) CreateCompletion(request *CompletionRequest) (*CompletionRespon
 	}
 
 	// process stream response
-	scanner := bufio.NewScanner(resp.Body)
+	format := c.streamFormat
+	if format == streamFormatAuto || len(format) == 0 {
+		format = streamFormatSSE
+		if strings.Contains(resp.Header.Get("Content-Type"), "application/x-ndjson") {
+			format = streamFormatNDJSON
+		}
+	}
+	if format == streamFormatSSE {
+		return nil, c.streamSSE(ctx, request, requestID, resp)
+	}
+	err = c.readNDJSONStream(resp.Body)
+	if closeErr := resp.Body.Close(); closeErr != nil {
+		return nil, closeErr
+	}
+	return nil, err
+}
+
+// sendCompletionRequest sends the request and returns the response if its status is OK.
+// If lastEventID is set, it is sent as Last-Event-ID to resume an interrupted stream.
+func (c *Client) sendCompletionRequest(ctx context.Context, request *CompletionRequest, stream bool, requestID, lastEventID string) (*http.Response, error) {
+	req, err := c.newRequest(request, stream)
+	if err != nil {
+		return nil, err
+	}
+	if len(requestID) > 0 {
+		rest.WithRequestID(requestID)(req)
+	}
+	if len(lastEventID) > 0 {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		logger.Error("completion request failed", "error", err)
+		return nil, err
+	}
+
+	if info, ok := parseRateLimit(resp.Header, time.Now()); ok {
+		// replace the rate limits which have not been read yet
+		select {
+		case <-c.rateLimits:
+		default:
+		}
+		select {
+		case c.rateLimits <- info:
+		default:
+		}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		err := statusError(resp)
+		logger.Error("completion request failed", "error", err)
+		return nil, err
+	}
+	return resp, nil
+}
 
-	for scanner.Scan() {
+// sseStream is the state of the server-sent events of a completion. It is kept across
+// the connections of an interrupted stream, so the events resent after a reconnect are skipped.
+type sseStream struct {
+	// seen are the IDs of the events already processed
+	seen map[string]bool
+	// lastEventID is the ID sent by the server with the last event, which resumes the stream
+	lastEventID string
+	// seq numbers the events if the server does not send event IDs
+	seq int
+	// retry is the delay before reconnecting set by the server
+	retry time.Duration
+	// parseErrs are the malformed events, which are skipped and reported after the stream
+	parseErrs []error
+	// finished is set by the finish event, done by the [DONE] event or when the client is closed
+	finished, done bool
+}
+
+// streamSSE sends the server-sent events of the response to the events channel. If the
+// connection drops before the stream is done, the request is sent again with the ID of
+// the last event as Last-Event-ID, at most maxStreamReconnects times.
+func (c *Client) streamSSE(ctx context.Context, request *CompletionRequest, requestID string, resp *http.Response) error {
+	stream := &sseStream{seen: map[string]bool{}}
+	for reconnects := 0; ; reconnects++ {
+		err := c.readSSEStream(resp.Body, stream)
+		if closeErr := resp.Body.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		// only the servers which send event IDs can resume the stream
+		if stream.done || stream.finished || len(stream.lastEventID) == 0 || reconnects == maxStreamReconnects {
+			if err != nil || c.closed() {
+				return err
+			}
+			return c.endStream(stream.parseErrs, stream.finished)
+		}
+
+		delay := streamReconnectDelay
+		if stream.retry > 0 {
+			delay = stream.retry
+		}
+		logger.Warn("stream interrupted, resuming", "last_event_id", stream.lastEventID, "error", err, "request_id", requestID)
+		select {
+		case <-time.After(delay):
+		case <-c.done:
+			return nil
+		}
+		if resp, err = c.sendCompletionRequest(ctx, request, true, requestID, stream.lastEventID); err != nil {
+			return err
+		}
+	}
+}
+
+// readSSEStream sends the server-sent events of the body to the events channel until
+// the [DONE] event, the end of the body or the client is closed
+func (c *Client) readSSEStream(body io.Reader, stream *sseStream) error {
+	scanner := newStreamScanner(body)
+	var eventID string
+	var data []string
+	for {
+		more := scanner.Scan()
 		line := scanner.Text()
-		if strings.HasPrefix(line, "data:") {
-			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		// a blank line dispatches the event
+		if more && len(line) > 0 {
+			if strings.HasPrefix(line, "id:") {
+				eventID = strings.TrimSpace(strings.TrimPrefix(line, "id:"))
+			} else if strings.HasPrefix(line, "data:") {
+				data = append(data, strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+			} else if strings.HasPrefix(line, "retry:") {
+				if ms, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "retry:"))); err == nil {
+					stream.retry = time.Duration(ms) * time.Millisecond
+				}
+			}
+			continue
+		}
 
-			if data == "[DONE]" {
+		if len(data) > 0 {
+			payload := strings.Join(data, "\n")
+			if payload == "[DONE]" {
+				stream.done = true
+				stream.seen = map[string]bool{}
 				break
+			}
+			stream.seq++
+			if len(eventID) > 0 {
+				stream.lastEventID = eventID
 			} else {
+				eventID = strconv.Itoa(stream.seq)
+			}
+			if stream.seen[eventID] {
+				logger.Debug("skipping duplicate event", "id", eventID)
+			} else {
+				stream.seen[eventID] = true
 				var streamResp CompletionStreamResponse
-				if err := json.Unmarshal([]byte(data), &streamResp); err != nil {
-					return nil, err
+				if err := json.Unmarshal([]byte(payload), &streamResp); err != nil {
+					stream.parseErrs = append(stream.parseErrs, fmt.Errorf("event %s: %w", eventID, err))
+				} else if !c.sendEvent(streamResp) {
+					stream.done = true
+					return nil
+				} else {
+					stream.finished = stream.finished || isFinishEvent(streamResp)
 				}
-				c.events <- streamResp
 			}
 		}
+		eventID = ""
+		data = nil
+
+		if !more {
+			break
+		}
+	}
+	return c.scanError(scanner)
+}
+
+// readNDJSONStream sends the responses of the newline-delimited JSON body to the events
+// channel until the end of the body or the client is closed
+func (c *Client) readNDJSONStream(body io.Reader) error {
+	scanner := newStreamScanner(body)
+	var parseErrs []error
+	finished := false
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var streamResp CompletionStreamResponse
+		if err := json.Unmarshal(line, &streamResp); err != nil {
+			parseErrs = append(parseErrs, fmt.Errorf("line %d: %w", n, err))
+		} else if !c.sendEvent(streamResp) {
+			return nil
+		} else {
+			finished = finished || isFinishEvent(streamResp)
+		}
+	}
+	if err := c.scanError(scanner); err != nil {
+		return err
+	}
+	return c.endStream(parseErrs, finished)
+}
+
+// scanError returns the error which cut the stream body, e.g. a line longer than the buffer
+// or a dropped connection, unless the client was closed
+func (c *Client) scanError(scanner *bufio.Scanner) error {
+	if c.closed() {
+		return nil
+	}
+	return scanner.Err()
+}
+
+// closed reports whether the client was closed
+func (c *Client) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// newStreamScanner returns a scanner of the lines of the stream body, which may be long
+// when an event carries a large chunk of content
+func newStreamScanner(body io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxStreamLineSize)
+	return scanner
+}
+
+// isFinishEvent reports whether the event finishes the response
+func isFinishEvent(resp CompletionStreamResponse) bool {
+	return len(resp.Choices) > 0 && len(resp.Choices[0].FinishReason) > 0
+}
+
+// endStream returns the error of the malformed events skipped while streaming, if any.
+// If the finish event was one of them, a finish event is sent in its place so that the
+// response received so far is complete.
+func (c *Client) endStream(parseErrs []error, finished bool) error {
+	if len(parseErrs) > 0 && !finished {
+		if !c.sendEvent(CompletionStreamResponse{Choices: []CompletionStreamChoice{{FinishReason: finishReasonIncomplete}}}) {
+			return nil
+		}
+	}
+	return streamError(parseErrs)
+}
+
+// sendEvent sends the response to the events channel, it reports false if the client was closed
+func (c *Client) sendEvent(resp CompletionStreamResponse) bool {
+	select {
+	case c.events <- resp:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// streamError returns the errors of the malformed events skipped while streaming, if any
+func streamError(parseErrs []error) error {
+	if len(parseErrs) == 0 {
+		return nil
+	}
+	for _, err := range parseErrs {
+		logger.Debug("skipped malformed stream event", "error", err)
+	}
+	return &StreamError{Errors: parseErrs}
+}
+
+// CreateCompletionWithFallback sends the CompletionRequest and retries it with the fallback model
+// if the quota of the requested model is exhausted or the model does not exist.
+// The model of the request is changed to the fallback if it succeeded, otherwise the original error is returned.
+func (c *Client) CreateCompletionWithFallback(req *CompletionRequest, fallback string) (*CompletionResponse, error) {
+	resp, err := c.CreateCompletion(req)
+	var apiErr *APIError
+	if err == nil || len(fallback) == 0 || fallback == req.Model || !errors.As(err, &apiErr) {
+		return resp, err
+	}
+	if apiErr.Type != "insufficient_quota" && apiErr.Code != "model_not_found" {
+		return resp, err
+	}
+
+	logger.Warn("retrying with fallback model", "model", req.Model, "fallback", fallback, "error", err)
+	retry := *req
+	retry.Model = fallback
+	resp, fallbackErr := c.CreateCompletion(&retry)
+	if fallbackErr != nil {
+		logger.Error("fallback model failed", "model", fallback, "error", fallbackErr)
+		return nil, err
+	}
+	req.Model = fallback
+	return resp, nil
+}
+
+// NewTranscriptionRequest creates a multipart http request for the audio transcription API
+func (c *Client) NewTranscriptionRequest(filePath string) (*http.Request, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err := writer.WriteField("model", c.whisperModel); err != nil {
+		return nil, err
+	}
+	part, err := writer.CreateFormFile("file", filepath.Base(filePath))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	header := http.Header{
+		"Content-Type": []string{writer.FormDataContentType()},
+	}
+	return c.httpClient.NewRequest(
+		"/audio/transcriptions",
+		rest.WithMethod(http.MethodPost),
+		rest.WithBearerToken(c.token),
+		rest.WithHeader(header),
+		rest.WithBody(&body),
+	)
+}
+
+// Transcribe sends the audio file to the transcription API and returns the text
+func (c *Client) Transcribe(filePath string) (string, error) {
+	req, err := c.NewTranscriptionRequest(filePath)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError(resp)
+	}
+
+	var ret TranscriptionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return "", err
+	}
+	return ret.Text, nil
+}
+
+// NewSpeechRequest creates a http request for the text to speech API
+func (c *Client) NewSpeechRequest(text string, voice string) (*http.Request, error) {
+	if !slices.Contains(speechVoices, voice) {
+		return nil, fmt.Errorf("unsupported voice: %s", voice)
+	}
+	payload, err := json.Marshal(SpeechRequest{Model: defaultSpeechModel, Input: text, Voice: voice})
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{
+		"Content-Type": []string{"application/json"},
+	}
+	return c.httpClient.NewRequest(
+		"/audio/speech",
+		rest.WithMethod(http.MethodPost),
+		rest.WithBearerToken(c.token),
+		rest.WithHeader(header),
+		rest.WithBody(bytes.NewReader(payload)),
+	)
+}
+
+// TextToSpeech sends the text to the speech API and returns the MP3 audio
+func (c *Client) TextToSpeech(text string, voice string) ([]byte, error) {
+	req, err := c.NewSpeechRequest(text, voice)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// NewImageRequest creates a http request for the image generation API
+func (c *Client) NewImageRequest(prompt string, size string, n int) (*http.Request, error) {
+	payload, err := json.Marshal(ImageRequest{Prompt: prompt, N: n, Size: size, ResponseFormat: "b64_json"})
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{
+		"Content-Type": []string{"application/json"},
+	}
+	return c.httpClient.NewRequest(
+		"/images/generations",
+		rest.WithMethod(http.MethodPost),
+		rest.WithBearerToken(c.token),
+		rest.WithHeader(header),
+		rest.WithBody(bytes.NewReader(payload)),
+	)
+}
+
+// GenerateImage creates images for the given prompt
+func (c *Client) GenerateImage(prompt string, size string, n int) ([]ImageResult, error) {
+	req, err := c.NewImageRequest(prompt, size, n)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+
+	var ret ImageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+		return nil, err
+	}
+	return ret.Data, nil
+}
+
+// NewAssistantsRequest creates a http request for the Assistants API with the JSON encoding of body, if not nil
+func (c *Client) NewAssistantsRequest(method string, path string, body any) (*http.Request, error) {
+	opts := []rest.RequestOption{
+		rest.WithMethod(method),
+		rest.WithBearerToken(c.token),
+		rest.WithHeader(http.Header{"OpenAI-Beta": []string{"assistants=v1"}}),
+	}
+	if body != nil {
+		opts = append(opts, rest.WithBodyJSON(body))
+	}
+	return c.httpClient.NewRequest(path, opts...)
+}
+
+// doAssistants sends the request to the Assistants API and decodes the response into ret
+func (c *Client) doAssistants(method string, path string, body any, ret any) error {
+	req, err := c.NewAssistantsRequest(method, path, body)
+	if err != nil {
+		return err
+	}
+	return c.doJSON(req, ret)
+}
+
+// doJSON sends the request and decodes the JSON response into ret, if not nil
+func (c *Client) doJSON(req *http.Request, ret any) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp)
+	}
+	if ret == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(ret)
+}
+
+// ModelList is the response of the models API
+type ModelList struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// ListModels returns the IDs of the models available with the API key
+func (c *Client) ListModels() ([]string, error) {
+	req, err := c.httpClient.NewRequest("/models", rest.WithMethod(http.MethodGet), rest.WithBearerToken(c.token))
+	if err != nil {
+		return nil, err
+	}
+	var ret ModelList
+	if err := c.doJSON(req, &ret); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(ret.Data))
+	for i, model := range ret.Data {
+		ids[i] = model.ID
+	}
+	return ids, nil
+}
+
+// CreateAssistant creates an assistant with the instructions and tools
+func (c *Client) CreateAssistant(name, instructions, model string, tools []Tool) (*Assistant, error) {
+	body := Assistant{Name: name, Instructions: instructions, Model: model, Tools: tools}
+	var ret Assistant
+	if err := c.doAssistants(http.MethodPost, "/assistants", body, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// ListAssistants returns the assistants, newest first
+func (c *Client) ListAssistants() ([]Assistant, error) {
+	var ret AssistantList
+	if err := c.doAssistants(http.MethodGet, "/assistants", nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret.Data, nil
+}
+
+// CreateThread creates an empty thread
+func (c *Client) CreateThread() (*Thread, error) {
+	var ret Thread
+	if err := c.doAssistants(http.MethodPost, "/threads", struct{}{}, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// AddMessage adds a user message to the thread
+func (c *Client) AddMessage(threadID, content string) error {
+	body := Message{Role: "user", Content: content}
+	return c.doAssistants(http.MethodPost, "/threads/"+threadID+"/messages", body, nil)
+}
+
+// ListMessages returns the messages of the thread, newest first
+func (c *Client) ListMessages(threadID string) ([]ThreadMessage, error) {
+	var ret ThreadMessageList
+	if err := c.doAssistants(http.MethodGet, "/threads/"+threadID+"/messages", nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret.Data, nil
+}
+
+// RunReply returns the text of the assistant messages added to the thread by the run
+func (c *Client) RunReply(threadID, runID string) (string, error) {
+	messages, err := c.ListMessages(threadID)
+	if err != nil {
+		return "", err
+	}
+	// the messages are listed newest first
+	var replies []string
+	for _, message := range messages {
+		if message.RunID == runID && message.Role == "assistant" {
+			replies = append([]string{message.Text()}, replies...)
+		}
+	}
+	return strings.Join(replies, "\n\n"), nil
+}
+
+// RunThread runs the assistant on the thread and polls the run until it has finished.
+// An error is returned with the run if it did not complete.
+func (c *Client) RunThread(threadID, assistantID string) (*Run, error) {
+	var run Run
+	if err := c.doAssistants(http.MethodPost, "/threads/"+threadID+"/runs", Run{AssistantID: assistantID}, &run); err != nil {
+		return nil, err
+	}
+	for !run.finished() {
+		select {
+		case <-time.After(runPollInterval):
+		case <-c.done:
+			return &run, errors.New("run cancelled")
+		}
+		if err := c.doAssistants(http.MethodGet, "/threads/"+threadID+"/runs/"+run.ID, nil, &run); err != nil {
+			return nil, err
+		}
+	}
+	if run.Status != "completed" {
+		if run.LastError != nil {
+			return &run, fmt.Errorf("run %s: %s", run.Status, run.LastError.Message)
+		}
+		return &run, fmt.Errorf("run %s", run.Status)
+	}
+	return &run, nil
+}
+
+// batchEndpoint is the endpoint of the requests of a batch
+const batchEndpoint = "/v1/chat/completions"
+
+// UploadFile uploads the data as a file for the purpose, e.g. batch
+func (c *Client) UploadFile(filename string, data []byte, purpose string) (*File, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err := writer.WriteField("purpose", purpose); err != nil {
+		return nil, err
+	}
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	header := http.Header{
+		"Content-Type": []string{writer.FormDataContentType()},
+	}
+	req, err := c.httpClient.NewRequest(
+		"/files",
+		rest.WithMethod(http.MethodPost),
+		rest.WithBearerToken(c.token),
+		rest.WithHeader(header),
+		rest.WithBody(&body),
+	)
+	if err != nil {
+		return nil, err
 	}
-	err = resp.Body.Close()
+	var ret File
+	if err := c.doJSON(req, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// CreateBatch creates a batch of the chat completion requests of the uploaded input file
+func (c *Client) CreateBatch(inputFileID string) (*Batch, error) {
+	req, err := c.httpClient.NewRequest(
+		"/batches",
+		rest.WithMethod(http.MethodPost),
+		rest.WithBearerToken(c.token),
+		rest.WithBodyJSON(BatchRequest{InputFileID: inputFileID, Endpoint: batchEndpoint, CompletionWindow: "24h"}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var ret Batch
+	if err := c.doJSON(req, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetBatch returns the batch with its status
+func (c *Client) GetBatch(batchID string) (*Batch, error) {
+	req, err := c.httpClient.NewRequest("/batches/"+batchID, rest.WithBearerToken(c.token))
+	if err != nil {
+		return nil, err
+	}
+	var ret Batch
+	if err := c.doJSON(req, &ret); err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetBatchResults downloads the output file of the batch and returns its results
+func (c *Client) GetBatchResults(batchID string) ([]BatchResult, error) {
+	batch, err := c.GetBatch(batchID)
+	if err != nil {
+		return nil, err
+	}
+	if len(batch.OutputFileID) == 0 {
+		return nil, fmt.Errorf("batch %s has no results, status: %s", batchID, batch.Status)
+	}
+
+	req, err := c.httpClient.NewRequest("/files/"+batch.OutputFileID+"/content", rest.WithBearerToken(c.token))
 	if err != nil {
 		return nil, err
 	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
-	return nil, nil
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	return parseBatchResults(resp.Body)
+}
+
+// APIError is an error response of the API
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Message    string `json:"message"`
+	Type       string `json:"type"`
+	Code       string `json:"code"`
+	Body       string `json:"-"`
+	// RequestID identifies the request for the support of the API
+	RequestID string `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	if len(e.RequestID) > 0 {
+		return fmt.Sprintf("status code: %d, body: %s, request ID: %s", e.StatusCode, e.Body, e.RequestID)
+	}
+	return fmt.Sprintf("status code: %d, body: %s", e.StatusCode, e.Body)
+}
+
+// StreamError reports the events of a streamed response which could not be parsed.
+// The other events of the stream were processed.
+type StreamError struct {
+	Errors []error
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("%d stream events were malformed and skipped", len(e.Errors))
+}
+
+func (e *StreamError) Unwrap() []error {
+	return e.Errors
+}
+
+// statusError returns an error describing the unexpected response status
+func statusError(resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	apiErr := &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	// the ID given by the API is the one its support knows, the one sent otherwise
+	if apiErr.RequestID = resp.Header.Get("X-Request-ID"); len(apiErr.RequestID) == 0 && resp.Request != nil {
+		apiErr.RequestID = resp.Request.Header.Get("X-Request-ID")
+	}
+	// the details are left empty if the body is not an API error
+	var errResp struct {
+		Error *APIError `json:"error"`
+	}
+	if json.Unmarshal(body, &errResp) == nil && errResp.Error != nil {
+		apiErr.Message = errResp.Error.Message
+		apiErr.Type = errResp.Error.Type
+		apiErr.Code = errResp.Error.Code
+	}
+	return apiErr
 }
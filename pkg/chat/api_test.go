@@ -0,0 +1,474 @@
+package chat
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateCompletion_Logging(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Hi"}}]}`))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	client := NewChatClient(server.URL, "token", "gpt-3.5-turbo", "", false, 1024)
+	req := &CompletionRequest{Model: "gpt-3.5-turbo", Messages: []Message{{Role: "user", Content: "hello there"}}}
+	resp, err := client.CreateCompletion(req)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Hi", resp.Choices[0].Message.Content)
+	assert.Contains(t, buf.String(), "sending completion request")
+	assert.Contains(t, buf.String(), "model=gpt-3.5-turbo")
+	assert.Contains(t, buf.String(), "messages=1")
+	assert.Contains(t, buf.String(), "tokens=2")
+}
+
+func TestCreateCompletion_LogsError(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	var buf bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	defer SetLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	client := NewChatClient(server.URL, "token", "gpt-3.5-turbo", "", false, 1024)
+	_, err := client.CreateCompletion(&CompletionRequest{Model: "gpt-3.5-turbo"})
+
+	assert.Error(t, err)
+	assert.Contains(t, buf.String(), "level=ERROR")
+	assert.Contains(t, buf.String(), "status code: 401")
+}
+
+func TestNewTranscriptionRequest(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audio.wav")
+	assert.NoError(t, os.WriteFile(file, []byte("RIFF audio"), 0644))
+
+	client := NewChatClient("http://localhost:8080", "token", "gpt-3.5-turbo", "", false, 1024)
+	req, err := client.NewTranscriptionRequest(file)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "http://localhost:8080/audio/transcriptions", req.URL.String())
+	assert.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+
+	assert.NoError(t, req.ParseMultipartForm(1<<20))
+	assert.Equal(t, "whisper-1", req.FormValue("model"))
+
+	f, header, err := req.FormFile("file")
+	assert.NoError(t, err)
+	defer f.Close()
+	assert.Equal(t, "audio.wav", header.Filename)
+	data, err := io.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "RIFF audio", string(data))
+}
+
+func TestTranscribe(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"text":"hello world"}`))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	file := filepath.Join(t.TempDir(), "audio.wav")
+	assert.NoError(t, os.WriteFile(file, []byte("RIFF audio"), 0644))
+
+	client := NewChatClient(server.URL, "token", "gpt-3.5-turbo", "", false, 1024)
+	text, err := client.Transcribe(file)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", text)
+}
+
+func TestNewSpeechRequest(t *testing.T) {
+	client := NewChatClient("http://localhost:8080", "token", "gpt-3.5-turbo", "", false, 1024)
+	req, err := client.NewSpeechRequest("Hello!", "nova")
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "http://localhost:8080/audio/speech", req.URL.String())
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(req.Body)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"model":"tts-1","input":"Hello!","voice":"nova"}`, string(body))
+
+	_, err = client.NewSpeechRequest("Hello!", "robot")
+	assert.Error(t, err)
+}
+
+func TestNewImageRequest(t *testing.T) {
+	client := NewChatClient("http://localhost:8080", "token", "gpt-3.5-turbo", "", false, 1024)
+	req, err := client.NewImageRequest("a cat in space", "512x512", 2)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "http://localhost:8080/images/generations", req.URL.String())
+
+	body, err := io.ReadAll(req.Body)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"prompt":"a cat in space","n":2,"size":"512x512","response_format":"b64_json"}`, string(body))
+}
+
+func TestGenerateImage(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"created":1,"data":[{"b64_json":"iVBORw0KGgo="}]}`))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := NewChatClient(server.URL, "token", "gpt-3.5-turbo", "", false, 1024)
+	images, err := client.GenerateImage("a cat in space", "256x256", 1)
+
+	assert.NoError(t, err)
+	assert.Len(t, images, 1)
+	assert.Equal(t, "iVBORw0KGgo=", images[0].B64JSON)
+}
+
+func TestClient_CloseStopsStreaming(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`data: {"choices":[{"delta":{"content":"Hi"}}]}` + "\n\n"))
+		w.(http.Flusher).Flush()
+		// a slow server which never finishes the stream
+		<-r.Context().Done()
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	baseline := runtime.NumGoroutine()
+
+	client := NewChatClient(server.URL, "token", "gpt-3.5-turbo", "", true, 1024)
+	errs := make(chan error)
+	go func() {
+		_, err := client.CreateCompletion(&CompletionRequest{Model: "gpt-3.5-turbo"})
+		errs <- err
+	}()
+
+	event := <-client.events
+	assert.Equal(t, "Hi", event.Choices[0].Delta.Content)
+
+	// nothing reads the events anymore after quitting
+	client.Close()
+	select {
+	case err := <-errs:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("streaming did not stop after Close")
+	}
+	assert.Nil(t, waitEventsCmd(client)())
+
+	assert.Eventually(t, func() bool {
+		return runtime.NumGoroutine() <= baseline
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestCreateCompletionWithFallback(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req CompletionRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		switch req.Model {
+		case "gpt-4":
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":{"message":"You exceeded your current quota","type":"insufficient_quota","code":"insufficient_quota"}}`))
+		case "gpt-3.5-turbo":
+			w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"message":"The model does not exist","type":"invalid_request_error","code":"model_not_found"}}`))
+		}
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := NewChatClient(server.URL, "token", "gpt-4", "", false, 1024)
+
+	req := &CompletionRequest{Model: "gpt-4"}
+	resp, err := client.CreateCompletionWithFallback(req, "gpt-3.5-turbo")
+	assert.NoError(t, err)
+	assert.Equal(t, "Hi", resp.Choices[0].Message.Content)
+	assert.Equal(t, "gpt-3.5-turbo", req.Model)
+
+	// the original error is returned if the fallback fails too
+	req = &CompletionRequest{Model: "gpt-4"}
+	_, err = client.CreateCompletionWithFallback(req, "gpt-5")
+	var apiErr *APIError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, "insufficient_quota", apiErr.Type)
+	assert.Equal(t, http.StatusTooManyRequests, apiErr.StatusCode)
+	assert.Equal(t, "gpt-4", req.Model)
+
+	// no fallback without a fallback model
+	_, err = client.CreateCompletionWithFallback(&CompletionRequest{Model: "gpt-4"}, "")
+	assert.ErrorAs(t, err, &apiErr)
+}
+
+func TestAssistantTypes_JSON(t *testing.T) {
+	assistant := Assistant{Name: "Tutor", Instructions: "Answer math questions.", Model: "gpt-4", Tools: []Tool{{Type: "code_interpreter"}}}
+	data, err := json.Marshal(assistant)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"name":"Tutor","instructions":"Answer math questions.","model":"gpt-4","tools":[{"type":"code_interpreter"}]}`, string(data))
+
+	data, err = json.Marshal(Run{AssistantID: "asst_1"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"assistant_id":"asst_1"}`, string(data))
+
+	var run Run
+	assert.NoError(t, json.Unmarshal([]byte(`{"id":"run_1","object":"thread.run","thread_id":"thread_1","assistant_id":"asst_1","status":"failed","last_error":{"code":"rate_limit_exceeded","message":"Rate limit reached"}}`), &run))
+	assert.Equal(t, Run{ID: "run_1", Object: "thread.run", ThreadID: "thread_1", AssistantID: "asst_1", Status: "failed",
+		LastError: &RunError{Code: "rate_limit_exceeded", Message: "Rate limit reached"}}, run)
+	assert.True(t, run.finished())
+
+	var message ThreadMessage
+	assert.NoError(t, json.Unmarshal([]byte(`{"id":"msg_1","role":"assistant","run_id":"run_1","content":[
+		{"type":"text","text":{"value":"x = 2","annotations":[]}},
+		{"type":"image_file","image_file":{"file_id":"file_1"}},
+		{"type":"text","text":{"value":"Done."}}]}`), &message))
+	assert.Equal(t, "run_1", message.RunID)
+	assert.Equal(t, "x = 2\n\nDone.", message.Text())
+}
+
+func TestRunThread(t *testing.T) {
+	defer func(d time.Duration) { runPollInterval = d }(runPollInterval)
+	runPollInterval = time.Millisecond
+
+	polls := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "assistants=v1", r.Header.Get("OpenAI-Beta"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		switch r.Method + " " + r.URL.Path {
+		case "POST /threads/thread_1/messages":
+			body, _ := io.ReadAll(r.Body)
+			assert.JSONEq(t, `{"role":"user","content":"Solve 3x = 6"}`, string(body))
+			w.Write([]byte(`{"id":"msg_1","role":"user"}`))
+		case "POST /threads/thread_1/runs":
+			w.Write([]byte(`{"id":"run_1","status":"queued"}`))
+		case "GET /threads/thread_1/runs/run_1":
+			if polls++; polls < 3 {
+				w.Write([]byte(`{"id":"run_1","status":"in_progress"}`))
+			} else {
+				w.Write([]byte(`{"id":"run_1","status":"completed"}`))
+			}
+		case "GET /threads/thread_1/messages":
+			w.Write([]byte(`{"data":[
+				{"role":"assistant","run_id":"run_1","content":[{"type":"text","text":{"value":"x = 2"}}]},
+				{"role":"assistant","run_id":"run_1","content":[{"type":"text","text":{"value":"Let me solve it."}}]},
+				{"role":"user","content":[{"type":"text","text":{"value":"Solve 3x = 6"}}]}]}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := NewChatClient(server.URL, "token", "gpt-4", "", false, 1024)
+
+	assert.NoError(t, client.AddMessage("thread_1", "Solve 3x = 6"))
+	run, err := client.RunThread("thread_1", "asst_1")
+	assert.NoError(t, err)
+	assert.Equal(t, "completed", run.Status)
+	assert.Equal(t, 3, polls)
+
+	reply, err := client.RunReply("thread_1", run.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Let me solve it.\n\nx = 2", reply)
+}
+
+func TestCreateCompletion_Compressed(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(`{"id":"chatcmpl-1","choices":[{"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`))
+		gz.Close()
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := NewChatClient(server.URL, "token", "gpt-3.5-turbo", "", false, 1024)
+	resp, err := client.CreateCompletion(&CompletionRequest{Model: "gpt-3.5-turbo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "chatcmpl-1", resp.ID)
+	assert.Equal(t, "Hi", resp.Choices[0].Message.Content)
+}
+
+// streamEvents reads the events sent to the client until the stream is read
+func streamEvents(client *Client, read func() error) ([]string, error) {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- read()
+		close(client.events)
+	}()
+	var contents []string
+	for event := range client.events {
+		contents = append(contents, event.Choices[0].Delta.Content)
+	}
+	return contents, <-errs
+}
+
+// readSSE reads the server-sent events of the body like a stream of a single connection
+func readSSE(client *Client, body io.Reader) error {
+	stream := &sseStream{seen: map[string]bool{}}
+	if err := client.readSSEStream(body, stream); err != nil {
+		return err
+	}
+	return client.endStream(stream.parseErrs, stream.finished)
+}
+
+func TestReadSSEStream(t *testing.T) {
+	body := "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n" +
+		": keep-alive\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\" world\"}}]}\n\n" +
+		"data: {malformed\n\n" +
+		"data: [DONE]\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"after done\"}}]}\n\n"
+	client := NewChatClient("http://localhost", "token", "gpt-3.5-turbo", "", true, 1024)
+	contents, err := streamEvents(client, func() error { return readSSE(client, strings.NewReader(body)) })
+	// the malformed event may have been the finish event, one is sent in its place
+	assert.Equal(t, []string{"Hello", " world", ""}, contents)
+	var streamErr *StreamError
+	assert.ErrorAs(t, err, &streamErr)
+	assert.Len(t, streamErr.Errors, 1)
+}
+
+func TestCreateCompletion_StreamReconnects(t *testing.T) {
+	defer func(delay time.Duration) { streamReconnectDelay = delay }(streamReconnectDelay)
+	streamReconnectDelay = time.Hour
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// the retry field of the server sets the delay
+		fmt.Fprintf(w, "retry: 1\nid: %d\ndata: {\"choices\":[{\"delta\":{\"content\":\"%d\"}}]}\n\n", requests, requests)
+	}))
+	defer server.Close()
+
+	// the stream is resumed at most maxStreamReconnects times
+	client := NewChatClient(server.URL, "token", "gpt-3.5-turbo", "", true, 1024)
+	contents, err := streamEvents(client, func() error {
+		_, err := client.CreateCompletion(&CompletionRequest{Model: "gpt-3.5-turbo"})
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3", "4"}, contents)
+	assert.Equal(t, maxStreamReconnects+1, requests)
+
+	// the streams without event IDs cannot be resumed
+	requests = 0
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n\n"))
+	})
+	client = NewChatClient(server.URL, "token", "gpt-3.5-turbo", "", true, 1024)
+	contents, err = streamEvents(client, func() error {
+		_, err := client.CreateCompletion(&CompletionRequest{Model: "gpt-3.5-turbo"})
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Hi"}, contents)
+	assert.Equal(t, 1, requests)
+}
+
+func TestReadNDJSONStream(t *testing.T) {
+	body := "{\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n" +
+		"\n" +
+		"{\"choices\":[{\"delta\":{\"content\":\" world\"}}]}\n" +
+		"{malformed\n" +
+		"{\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}"
+	client := NewChatClient("http://localhost", "token", "gpt-3.5-turbo", "", true, 1024)
+	contents, err := streamEvents(client, func() error { return client.readNDJSONStream(strings.NewReader(body)) })
+	assert.Equal(t, []string{"Hello", " world", ""}, contents)
+	var streamErr *StreamError
+	assert.ErrorAs(t, err, &streamErr)
+	assert.ErrorContains(t, streamErr.Errors[0], "line 4")
+}
+
+func TestReadSSEStream_LongEvent(t *testing.T) {
+	content := strings.Repeat("a", 100*1024)
+	body := "data: {\"choices\":[{\"delta\":{\"content\":\"" + content + "\"}}]}\n\n" +
+		"data: [DONE]\n\n"
+	client := NewChatClient("http://localhost", "token", "gpt-3.5-turbo", "", true, 1024)
+	contents, err := streamEvents(client, func() error { return readSSE(client, strings.NewReader(body)) })
+	assert.NoError(t, err)
+	assert.Equal(t, []string{content}, contents)
+}
+
+func TestReadNDJSONStream_ReadError(t *testing.T) {
+	body := io.MultiReader(strings.NewReader("{\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n"), iotest.ErrReader(io.ErrUnexpectedEOF))
+	client := NewChatClient("http://localhost", "token", "gpt-3.5-turbo", "", true, 1024)
+	contents, err := streamEvents(client, func() error { return client.readNDJSONStream(body) })
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	assert.Equal(t, []string{"Hello"}, contents)
+}
+
+func TestCreateCompletion_StreamFormat(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write([]byte("{\"choices\":[{\"delta\":{\"content\":\"Hi\"}}]}\n"))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for format, expected := range map[string][]string{
+		streamFormatAuto: {"Hi"},
+		// the lines are not events of the SSE format
+		streamFormatSSE: nil,
+	} {
+		client := NewChatClient(server.URL, "token", "gpt-3.5-turbo", "", true, 1024)
+		client.streamFormat = format
+		contents, err := streamEvents(client, func() error {
+			_, err := client.CreateCompletion(&CompletionRequest{Model: "gpt-3.5-turbo"})
+			return err
+		})
+		assert.NoError(t, err, format)
+		assert.Equal(t, expected, contents, format)
+	}
+}
+
+func TestCreateCompletion_RequestID(t *testing.T) {
+	var requestIDs []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestIDs = append(requestIDs, r.Header.Get("X-Request-ID"))
+		if len(requestIDs) > 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"error":{"message":"server error"}}`))
+			return
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Hi"}}]}`))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := NewChatClient(server.URL, "token", "gpt-3.5-turbo", "", false, 1024)
+	_, err := client.CreateCompletion(&CompletionRequest{Model: "gpt-3.5-turbo"})
+	assert.NoError(t, err)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, requestIDs[0])
+	assert.Equal(t, requestIDs[0], client.lastRequestID)
+
+	// every request has its own ID, which the errors include
+	_, err = client.CreateCompletion(&CompletionRequest{Model: "gpt-3.5-turbo"})
+	assert.NotEqual(t, requestIDs[0], requestIDs[1])
+	assert.Equal(t, requestIDs[1], client.lastRequestID)
+	assert.ErrorContains(t, err, "request ID: "+requestIDs[1])
+}
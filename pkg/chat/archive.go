@@ -0,0 +1,30 @@
+package chat
+
+// archiveHistory moves the oldest messages out of memory once the history reaches
+// maxHistoryMemory messages, keeping the most recent four fifths of the limit and at
+// least one message. The archived messages stay in the session file and are loaded
+// back by scrolling up.
+func (m *Model) archiveHistory() error {
+	if m.maxHistoryMemory <= 0 || len(m.client.history) < m.maxHistoryMemory {
+		return nil
+	}
+	n := len(m.client.history) - max(m.maxHistoryMemory*4/5, 1)
+	if n <= 0 {
+		return nil
+	}
+	// the loader records the offsets of the messages as they are saved
+	if m.historyLoader == nil {
+		filePath, err := m.historyPath()
+		if err != nil {
+			return err
+		}
+		m.historyLoader = &historyLoader{path: filePath}
+	}
+	if err := m.saveHistory(); err != nil {
+		return err
+	}
+	m.historyOffset += n
+	// copy the kept messages so that the archived ones can be freed
+	m.client.history = append([]Message(nil), m.client.history[n:]...)
+	return nil
+}
@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"errors"
+)
+
+// AssistantBackend answers the messages with an assistant of the Assistants API.
+// The thread keeps the conversation, so only the last user message of a request is sent.
+type AssistantBackend struct {
+	client      *Client
+	AssistantID string
+	ThreadID    string
+}
+
+// NewAssistantBackend creates an AssistantBackend sending the requests with the client.
+// A new thread is created on the first completion if threadID is empty.
+func NewAssistantBackend(client *Client, assistantID, threadID string) *AssistantBackend {
+	return &AssistantBackend{client: client, AssistantID: assistantID, ThreadID: threadID}
+}
+
+// Complete adds the last user message to the thread, runs the assistant and sends its reply as a single event
+func (b *AssistantBackend) Complete(request *CompletionRequest, events chan<- CompletionStreamResponse, done <-chan struct{}) error {
+	if len(request.Messages) == 0 || request.Messages[len(request.Messages)-1].Role != "user" {
+		return errors.New("the assistant can only answer a user message")
+	}
+	if len(b.ThreadID) == 0 {
+		thread, err := b.client.CreateThread()
+		if err != nil {
+			return err
+		}
+		b.ThreadID = thread.ID
+		logger.Info("created thread", "thread", thread.ID)
+	}
+
+	if err := b.client.AddMessage(b.ThreadID, request.Messages[len(request.Messages)-1].Content); err != nil {
+		return err
+	}
+	run, err := b.client.RunThread(b.ThreadID, b.AssistantID)
+	if err != nil {
+		return err
+	}
+	reply, err := b.client.RunReply(b.ThreadID, run.ID)
+	if err != nil {
+		return err
+	}
+	for _, event := range []CompletionStreamResponse{
+		{ID: run.ID, Choices: []CompletionStreamChoice{{Delta: CompletionStreamDelta{Role: "assistant", Content: reply}}}},
+		{ID: run.ID, Choices: []CompletionStreamChoice{{FinishReason: "stop"}}},
+	} {
+		select {
+		case events <- event:
+		case <-done:
+			return nil
+		}
+	}
+	return nil
+}
+
+// Close does nothing, the run is stopped by closing the client
+func (b *AssistantBackend) Close() error {
+	return nil
+}
@@ -0,0 +1,68 @@
+package chat
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxAttachmentSize is the maximum size of an attached file in bytes
+const maxAttachmentSize = 1 << 20
+
+// fileURIPattern matches the start of a file URI in pasted text
+var fileURIPattern = regexp.MustCompile(`file://(localhost)?/`)
+
+// extractFileURIs returns the paths of the file URIs in the pasted text.
+// A URI ends at a line break or where the next URI starts, so paths may contain spaces.
+func extractFileURIs(text string) []string {
+	matches := fileURIPattern.FindAllStringSubmatchIndex(text, -1)
+	var paths []string
+	for i, match := range matches {
+		// the path starts at the slash
+		start, end := match[1]-1, len(text)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		uri, _, _ := strings.Cut(text[start:end], "\n")
+		uri = strings.TrimRight(strings.TrimSpace(uri), `'"`)
+		filePath, err := url.PathUnescape(uri)
+		if err != nil {
+			filePath = uri
+		}
+		if len(filePath) > 1 {
+			paths = append(paths, filePath)
+		}
+	}
+	return paths
+}
+
+// resolveAttachments reads the files and returns them as fenced code blocks
+func resolveAttachments(paths []string) ([]string, error) {
+	var blocks []string
+	for _, filePath := range paths {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("%s is a directory", filePath)
+		}
+		if info.Size() > maxAttachmentSize {
+			return nil, fmt.Errorf("%s is larger than %d bytes", filePath, maxAttachmentSize)
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		if !utf8.Valid(data) {
+			return nil, fmt.Errorf("%s is not a text file", filePath)
+		}
+		lang := strings.TrimPrefix(filepath.Ext(filePath), ".")
+		blocks = append(blocks, fmt.Sprintf("%s\n```%s\n%s\n```", filepath.Base(filePath), lang, strings.TrimRight(string(data), "\n")))
+	}
+	return blocks, nil
+}
@@ -0,0 +1,66 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractFileURIs(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"plain text", "hello world", nil},
+		{"single file", "file:///home/me/notes.txt", []string{"/home/me/notes.txt"}},
+		{"localhost", "file://localhost/home/me/notes.txt", []string{"/home/me/notes.txt"}},
+		{"encoded space", "file:///home/me/My%20Notes.md", []string{"/home/me/My Notes.md"}},
+		{"raw space", "file:///home/me/My Notes.md\n", []string{"/home/me/My Notes.md"}},
+		{"special characters", "file:///tmp/a%26b%20(1)%23.txt", []string{"/tmp/a&b (1)#.txt"}},
+		{"unicode", "file:///tmp/r%C3%A9sum%C3%A9.txt", []string{"/tmp/résumé.txt"}},
+		{"quoted", "'file:///tmp/a b.txt'", []string{"/tmp/a b.txt"}},
+		{"multiple files", "file:///tmp/a.go file:///tmp/b c.go\nfile:///tmp/d.go", []string{"/tmp/a.go", "/tmp/b c.go", "/tmp/d.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, extractFileURIs(tt.text))
+		})
+	}
+}
+
+func TestUpdate_PasteFileURI(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "hello world.go")
+	assert.NoError(t, os.WriteFile(filePath, []byte("package main\n"), 0644))
+
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.textarea.SetValue("see ")
+	m = runInput(t, m, "file://"+filepath.ToSlash(dir)+"/hello%20world.go ")
+
+	assert.Equal(t, "see ", m.textarea.Value())
+	assert.Equal(t, []string{"hello world.go\n```go\npackage main\n```"}, m.attachments)
+	assert.Contains(t, m.notice, "📎 hello world.go attached")
+}
+
+func TestUpdate_TypedFileURI(t *testing.T) {
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	// keys typed one by one are not a paste
+	for _, r := range "file:///tmp/a.go" {
+		model, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = model.(Model)
+		model, _ = m.Update(pasteEndMsg{seq: m.pasteSeq})
+		m = model.(Model)
+	}
+	assert.Equal(t, "file:///tmp/a.go", m.textarea.Value())
+	assert.Empty(t, m.attachments)
+}
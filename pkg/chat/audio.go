@@ -0,0 +1,176 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// maxRecordingDuration limits the length of a single recording
+const maxRecordingDuration = 60 * time.Second
+
+// recordingDoneMsg is sent when the recording has stopped
+type recordingDoneMsg struct {
+	file string
+	err  error
+}
+
+// transcriptionMsg carries the transcribed text of a recording, or the error transcribing it
+type transcriptionMsg struct {
+	text string
+	err  error
+}
+
+// tempAudioFiles are the temporary recordings and speeches which are not removed yet
+var tempAudioFiles sync.Map
+
+// createTempAudio creates an empty temporary audio file, removed by removeTempAudio
+func createTempAudio(pattern string) (*os.File, error) {
+	f, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return nil, err
+	}
+	tempAudioFiles.Store(f.Name(), true)
+	return f, nil
+}
+
+// removeTempAudio removes the temporary audio file
+func removeTempAudio(file string) {
+	if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		logger.Warn("failed to remove audio file", "path", file, "error", err)
+	}
+	tempAudioFiles.Delete(file)
+}
+
+// removeTempAudioFiles removes the temporary audio files still in use on quit, as the
+// commands using them do not get to remove them
+func removeTempAudioFiles() {
+	tempAudioFiles.Range(func(file, _ any) bool {
+		removeTempAudio(file.(string))
+		return true
+	})
+}
+
+// speechDoneMsg is sent when the playback of a spoken response has finished
+type speechDoneMsg struct {
+	id  int
+	err error
+}
+
+// recorder records audio from the microphone into a WAV file using ffmpeg
+type recorder struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	file  string
+}
+
+// audioInputArgs returns the ffmpeg input arguments for the current platform
+func audioInputArgs() []string {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"-f", "avfoundation", "-i", ":0"}
+	case "windows":
+		return []string{"-f", "dshow", "-i", "audio=default"}
+	default:
+		return []string{"-f", "alsa", "-i", "default"}
+	}
+}
+
+// startRecording starts recording into a temporary WAV file
+func startRecording() (*recorder, error) {
+	f, err := createTempAudio("gptui-*.wav")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	args := append([]string{"-y", "-loglevel", "error"}, audioInputArgs()...)
+	args = append(args, "-t", strconv.Itoa(int(maxRecordingDuration.Seconds())), f.Name())
+	cmd := exec.Command("ffmpeg", args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		removeTempAudio(f.Name())
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		removeTempAudio(f.Name())
+		return nil, err
+	}
+	return &recorder{cmd: cmd, stdin: stdin, file: f.Name()}, nil
+}
+
+// stop asks ffmpeg to finish the recording
+func (r *recorder) stop() error {
+	// ffmpeg finalizes the output file when it reads "q" from stdin
+	if _, err := r.stdin.Write([]byte("q")); err != nil {
+		return err
+	}
+	return r.stdin.Close()
+}
+
+// kill stops ffmpeg without finishing the recording and removes the file
+func (r *recorder) kill() {
+	if err := r.cmd.Process.Kill(); err != nil {
+		logger.Warn("failed to stop recording", "error", err)
+	}
+	removeTempAudio(r.file)
+}
+
+// waitRecordingCmd returns a tea.Cmd which waits for the recording to finish
+func waitRecordingCmd(r *recorder) tea.Cmd {
+	return func() tea.Msg {
+		err := r.cmd.Wait()
+		return recordingDoneMsg{file: r.file, err: err}
+	}
+}
+
+// transcribeCmd returns a tea.Cmd which transcribes the recorded file
+func transcribeCmd(client *Client, file string) tea.Cmd {
+	return func() tea.Msg {
+		defer removeTempAudio(file)
+		text, err := client.Transcribe(file)
+		return transcriptionMsg{text: text, err: err}
+	}
+}
+
+// playAudio plays the audio file and blocks until the playback finishes
+func playAudio(ctx context.Context, file string) error {
+	name, args := "ffplay", []string{"-nodisp", "-autoexit", "-loglevel", "quiet", file}
+	if runtime.GOOS == "darwin" {
+		name, args = "afplay", []string{file}
+	}
+	return exec.CommandContext(ctx, name, args...).Run()
+}
+
+// speakCmd returns a tea.Cmd which reads the text aloud until ctx is cancelled
+func speakCmd(ctx context.Context, id int, client *Client, text string, voice string) tea.Cmd {
+	return func() tea.Msg {
+		audio, err := client.TextToSpeech(text, voice)
+		if err != nil {
+			return speechDoneMsg{id: id, err: err}
+		}
+		f, err := createTempAudio("gptui-*.mp3")
+		if err != nil {
+			return speechDoneMsg{id: id, err: err}
+		}
+		defer removeTempAudio(f.Name())
+		_, err = f.Write(audio)
+		f.Close()
+		if err != nil {
+			return speechDoneMsg{id: id, err: err}
+		}
+		if err := playAudio(ctx, f.Name()); err != nil && ctx.Err() == nil {
+			return speechDoneMsg{id: id, err: err}
+		}
+		return speechDoneMsg{id: id}
+	}
+}
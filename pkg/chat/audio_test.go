@@ -0,0 +1,66 @@
+package chat
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate_TranscriptionError(t *testing.T) {
+	m := newTestModel(t)
+	m.textarea = newTextArea()
+	m.transcribing = true
+
+	// the error is shown once, the next recording starts without it
+	model, _ := m.Update(transcriptionMsg{err: errors.New("connection reset")})
+	m = model.(Model)
+	assert.False(t, m.transcribing)
+	assert.NoError(t, m.err)
+	assert.Contains(t, m.notice, "transcription failed: connection reset")
+
+	model, _ = m.Update(transcriptionMsg{text: "Hello"})
+	m = model.(Model)
+	assert.Equal(t, "Hello", m.textarea.Value())
+}
+
+func TestUpdate_SpeechError(t *testing.T) {
+	m := newTestModel(t)
+	m.speechID = 1
+
+	// the error of the API or the player is shown
+	model, _ := m.Update(speechDoneMsg{id: 1, err: errors.New("exec: \"ffplay\": executable file not found in $PATH")})
+	m = model.(Model)
+	assert.Contains(t, m.notice, "text to speech failed: exec: \"ffplay\": executable file not found")
+	assert.Nil(t, m.cancelSpeech)
+}
+
+func TestQuit_StopsRecording(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep is not installed")
+	}
+	setTestHome(t)
+	f, err := createTempAudio("gptui-test-*.wav")
+	require.NoError(t, err)
+	f.Close()
+	speech, err := createTempAudio("gptui-test-*.mp3")
+	require.NoError(t, err)
+	speech.Close()
+	cmd := exec.Command(sleep, "60")
+	require.NoError(t, cmd.Start())
+
+	m := newTestModel(t)
+	m.textarea = newTextArea()
+	m.recorder = &recorder{cmd: cmd, file: f.Name()}
+	m.quit()
+
+	// ffmpeg is killed and the audio files are removed
+	assert.Error(t, cmd.Wait())
+	assert.NoFileExists(t, f.Name())
+	assert.NoFileExists(t, speech.Name())
+	_, ok := tempAudioFiles.Load(speech.Name())
+	assert.False(t, ok)
+}
@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// NewBatchInput returns the JSONL input file of a batch answering every user message of the session.
+// Each request contains the conversation up to the message, its custom ID is turn-<index>.
+// The model the session was created with is used if model is empty.
+func NewBatchInput(session *Session, model string) ([]byte, error) {
+	if len(model) == 0 {
+		model = session.Metadata.Model
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for i, message := range session.Messages {
+		if message.Role != "user" {
+			continue
+		}
+		line := BatchInputLine{
+			CustomID: fmt.Sprintf("turn-%d", i),
+			Method:   http.MethodPost,
+			URL:      batchEndpoint,
+			Body: &CompletionRequest{
+				Model:       model,
+				Messages:    session.Messages[:i+1],
+				Temperature: session.Metadata.Temperature,
+			},
+		}
+		if err := encoder.Encode(line); err != nil {
+			return nil, err
+		}
+	}
+	if buf.Len() == 0 {
+		return nil, fmt.Errorf("session %s has no user messages", session.ID)
+	}
+	return buf.Bytes(), nil
+}
+
+// parseBatchResults parses the JSONL output file of a batch
+func parseBatchResults(r io.Reader) ([]BatchResult, error) {
+	var results []BatchResult
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		var result BatchResult
+		if err := json.Unmarshal([]byte(line), &result); err != nil {
+			return nil, fmt.Errorf("invalid batch result: %w", err)
+		}
+		results = append(results, result)
+	}
+	return results, scanner.Err()
+}
+
+// Content returns the content of the response of the result
+func (r BatchResult) Content() string {
+	if r.Response == nil || len(r.Response.Body.Choices) == 0 {
+		return ""
+	}
+	return r.Response.Body.Choices[0].Message.Content
+}
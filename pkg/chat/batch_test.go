@@ -0,0 +1,111 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewBatchInput(t *testing.T) {
+	session := &Session{
+		ID:       "2023-05-01_10-00-00",
+		Metadata: SessionMetadata{Model: "gpt-4", Temperature: 0.5},
+		Messages: []Message{
+			{Role: "system", Content: "Be brief."},
+			{Role: "user", Content: "Hi"},
+			{Role: "assistant", Content: "Hello!"},
+			{Role: "user", Content: "Bye"},
+		},
+	}
+	input, err := NewBatchInput(session, "")
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(string(input), "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.JSONEq(t, `{"custom_id":"turn-1","method":"POST","url":"/v1/chat/completions","body":{
+		"model":"gpt-4","temperature":0.5,
+		"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"}]}}`, lines[0])
+	assert.JSONEq(t, `{"custom_id":"turn-3","method":"POST","url":"/v1/chat/completions","body":{
+		"model":"gpt-4","temperature":0.5,
+		"messages":[{"role":"system","content":"Be brief."},{"role":"user","content":"Hi"},{"role":"assistant","content":"Hello!"},{"role":"user","content":"Bye"}]}}`, lines[1])
+
+	// the model of the session is overridden
+	input, err = NewBatchInput(session, "gpt-3.5-turbo")
+	require.NoError(t, err)
+	var line BatchInputLine
+	require.NoError(t, json.NewDecoder(bytes.NewReader(input)).Decode(&line))
+	assert.Equal(t, "gpt-3.5-turbo", line.Body.Model)
+
+	_, err = NewBatchInput(&Session{ID: "empty", Messages: []Message{}}, "gpt-4")
+	assert.Error(t, err)
+}
+
+func TestParseBatchResults(t *testing.T) {
+	output := `{"id":"batch_req_1","custom_id":"turn-1","response":{"status_code":200,"request_id":"req_1","body":{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"Hello!"},"finish_reason":"stop"}]}},"error":null}
+
+{"id":"batch_req_2","custom_id":"turn-3","response":null,"error":{"code":"invalid_request","message":"Invalid model"}}
+`
+	results, err := parseBatchResults(strings.NewReader(output))
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "turn-1", results[0].CustomID)
+	assert.Equal(t, 200, results[0].Response.StatusCode)
+	assert.Equal(t, "Hello!", results[0].Content())
+	assert.Equal(t, "Invalid model", results[1].Error.Message)
+	assert.Empty(t, results[1].Content())
+
+	_, err = parseBatchResults(strings.NewReader("{"))
+	assert.Error(t, err)
+}
+
+func TestBatchAPI(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		switch r.Method + " " + r.URL.Path {
+		case "POST /files":
+			assert.Equal(t, "batch", r.FormValue("purpose"))
+			f, header, err := r.FormFile("file")
+			require.NoError(t, err)
+			data, _ := io.ReadAll(f)
+			assert.Equal(t, "session.jsonl", header.Filename)
+			assert.Equal(t, "{}\n", string(data))
+			w.Write([]byte(`{"id":"file-in","object":"file","purpose":"batch"}`))
+		case "POST /batches":
+			body, _ := io.ReadAll(r.Body)
+			assert.JSONEq(t, `{"input_file_id":"file-in","endpoint":"/v1/chat/completions","completion_window":"24h"}`, string(body))
+			w.Write([]byte(`{"id":"batch_1","status":"validating"}`))
+		case "GET /batches/batch_1":
+			w.Write([]byte(`{"id":"batch_1","status":"completed","output_file_id":"file-out","request_counts":{"total":1,"completed":1,"failed":0}}`))
+		case "GET /files/file-out/content":
+			w.Write([]byte(`{"id":"batch_req_1","custom_id":"turn-1","response":{"status_code":200,"body":{"choices":[{"message":{"role":"assistant","content":"Hi"}}]}}}` + "\n"))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	client := NewChatClient(server.URL, "token", "gpt-4", "", false, 1024)
+
+	file, err := client.UploadFile("session.jsonl", []byte("{}\n"), "batch")
+	require.NoError(t, err)
+	batch, err := client.CreateBatch(file.ID)
+	require.NoError(t, err)
+	assert.False(t, batch.Finished())
+
+	batch, err = client.GetBatch(batch.ID)
+	require.NoError(t, err)
+	assert.True(t, batch.Finished())
+	assert.Equal(t, BatchRequestCounts{Total: 1, Completed: 1}, batch.RequestCounts)
+
+	results, err := client.GetBatchResults(batch.ID)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "Hi", results[0].Content())
+}
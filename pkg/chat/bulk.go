@@ -0,0 +1,100 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// LoadMessages reads the messages of the file separated by the delimiter, a line per message
+// if it is empty. Escape sequences of the delimiter such as \n are interpreted, so that
+// --file-delimiter "\n\n" reads a message per paragraph. Blank messages are skipped.
+func LoadMessages(filePath, delimiter string) ([]string, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(delimiter) == 0 {
+		delimiter = "\n"
+	} else if unquoted, err := strconv.Unquote(`"` + delimiter + `"`); err == nil {
+		delimiter = unquoted
+	}
+	content := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	var messages []string
+	for _, message := range strings.Split(content, delimiter) {
+		if message = strings.TrimSpace(message); len(message) > 0 {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+// RunFile sends the messages one after another in a single conversation configured by
+// the chat flags, writing each exchange to w. The conversation is saved as a session.
+// When ctx is done the remaining messages are skipped, and the conversation so far
+// is saved before the error of ctx is returned.
+func RunFile(ctx context.Context, messages []string, w io.Writer) error {
+	client, err := newClientFromConfig()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	createdAt := time.Now()
+	for i, message := range messages {
+		if _, err := fmt.Fprintf(w, "--- Message %d/%d ---\n> %s\n\n", i+1, len(messages), message); err != nil {
+			return err
+		}
+		client.history = append(client.history, Message{Role: "user", Content: message})
+		content, err := writeResponse(ctx, client, w)
+		if ctx.Err() != nil {
+			// keep the partial response of the interrupted exchange
+			if len(content) > 0 {
+				client.history = append(client.history, Message{Role: "assistant", Content: content})
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		client.history = append(client.history, Message{Role: "assistant", Content: content})
+		if i < len(messages)-1 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+	}
+
+	dir, err := HistoryDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	id := createdAt.Format(sessionTimeLayout)
+	session := &Session{
+		ID:        id,
+		CreatedAt: createdAt,
+		Metadata: SessionMetadata{
+			Model:        client.model,
+			BaseURL:      client.baseURL,
+			Temperature:  client.temperature,
+			SystemPrompt: client.system,
+			GptUIVersion: viper.GetString("version"),
+		},
+		Messages: client.history,
+	}
+	if err := SaveSession(path.Join(dir, id+".json"), session); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,91 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMessages(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "prompts.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("First question\r\nSecond question\n\n  Third question  \n"), 0644))
+
+	messages, err := LoadMessages(filePath, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"First question", "Second question", "Third question"}, messages)
+
+	_, err = LoadMessages(filepath.Join(t.TempDir(), "missing.txt"), "")
+	assert.Error(t, err)
+}
+
+func TestLoadMessages_Paragraphs(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "prompts.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("Summarize:\nline one\nline two\n\nTranslate:\nbonjour\n\n\n"), 0644))
+
+	// the delimiter is passed escaped from the command line
+	for _, delimiter := range []string{`\n\n`, "\n\n"} {
+		messages, err := LoadMessages(filePath, delimiter)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Summarize:\nline one\nline two", "Translate:\nbonjour"}, messages)
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	defer func(f func() (string, error)) { userConfigDir = f }(userConfigDir)
+	setTestHome(t)
+	configDir := t.TempDir()
+	userConfigDir = func() (string, error) { return configDir, nil }
+
+	var requests []CompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request CompletionRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests = append(requests, request)
+		fmt.Fprintf(w, `{"choices":[{"message":{"role":"assistant","content":"Answer %d"},"finish_reason":"stop"}]}`, len(requests))
+	}))
+	defer server.Close()
+	setPipeConfig(t, map[string]any{"openai-api-base": server.URL, "model": "gpt-4", "stream": false})
+
+	var out bytes.Buffer
+	require.NoError(t, RunFile(context.Background(), []string{"One", "Two"}, &out))
+	assert.Equal(t, "--- Message 1/2 ---\n> One\n\nAnswer 1\n\n--- Message 2/2 ---\n> Two\n\nAnswer 2\n", out.String())
+
+	// the exchanges form a single conversation
+	require.Len(t, requests, 2)
+	assert.Equal(t, []Message{
+		{Role: "user", Content: "One"}, {Role: "assistant", Content: "Answer 1"}, {Role: "user", Content: "Two"},
+	}, requests[1].Messages)
+
+	sessions, err := ListSessions(filepath.Join(configDir, appName, "chat"))
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Len(t, sessions[0].Messages, 4)
+}
+
+func TestStatusView_BulkProgress(t *testing.T) {
+	m := newTestModel(t)
+	m.bulkTotal = 3
+	m.pendingMessages = []string{"Three"}
+	m.waiting = true
+	assert.Contains(t, m.statusView(), "Message 2/3")
+
+	m.pendingMessages = nil
+	m.waiting = false
+	assert.NotContains(t, m.statusView(), "Message")
+
+	// the progress is not shown for messages queued after the run
+	m.dequeue()
+	assert.Zero(t, m.bulkTotal)
+	m.pendingMessages = []string{"Four"}
+	m.waiting = true
+	assert.NotContains(t, m.statusView(), "Message")
+}
@@ -0,0 +1,69 @@
+package chat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// ResponseCache stores completion responses by request for a limited time.
+// Expired entries are evicted lazily when a response is looked up.
+type ResponseCache struct {
+	ttl     time.Duration
+	entries sync.Map
+	// now returns the current time, replaced in tests
+	now func() time.Time
+}
+
+// cacheEntry is a cached response and the time it was stored
+type cacheEntry struct {
+	resp     CompletionResponse
+	storedAt time.Time
+}
+
+// NewResponseCache creates a ResponseCache keeping responses for the ttl
+func NewResponseCache(ttl time.Duration) *ResponseCache {
+	return &ResponseCache{ttl: ttl, now: time.Now}
+}
+
+// cacheKey returns the hex SHA-256 of the canonical JSON of the request.
+// Streamed and non-streamed requests share the key.
+func cacheKey(req *CompletionRequest) (string, error) {
+	canonical := *req
+	canonical.Stream = false
+	payload, err := json.Marshal(canonical)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Get returns the response stored for the key if it has not expired
+func (c *ResponseCache) Get(key string) (*CompletionResponse, bool) {
+	c.Evict()
+	value, ok := c.entries.Load(key)
+	if !ok {
+		return nil, false
+	}
+	resp := value.(cacheEntry).resp
+	return &resp, true
+}
+
+// Set stores the response for the key
+func (c *ResponseCache) Set(key string, resp CompletionResponse) {
+	c.entries.Store(key, cacheEntry{resp: resp, storedAt: c.now()})
+}
+
+// Evict removes the entries older than the ttl
+func (c *ResponseCache) Evict() {
+	now := c.now()
+	c.entries.Range(func(key, value any) bool {
+		if now.Sub(value.(cacheEntry).storedAt) > c.ttl {
+			c.entries.Delete(key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,47 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseCache_TTL(t *testing.T) {
+	now := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	c := NewResponseCache(time.Minute)
+	c.now = func() time.Time { return now }
+
+	resp := CompletionResponse{ID: "chatcmpl-1"}
+	c.Set("key", resp)
+
+	now = now.Add(time.Minute)
+	cached, ok := c.Get("key")
+	require.True(t, ok)
+	assert.Equal(t, resp, *cached)
+
+	now = now.Add(time.Second)
+	_, ok = c.Get("key")
+	assert.False(t, ok)
+	_, ok = c.entries.Load("key")
+	assert.False(t, ok, "expired entries are evicted on lookup")
+}
+
+func TestCacheKey(t *testing.T) {
+	req := &CompletionRequest{Model: "gpt-3.5-turbo", Messages: []Message{{Role: "user", Content: "Hi"}}}
+	key, err := cacheKey(req)
+	require.NoError(t, err)
+
+	streamed := *req
+	streamed.Stream = true
+	streamedKey, err := cacheKey(&streamed)
+	require.NoError(t, err)
+	assert.Equal(t, key, streamedKey)
+
+	other := *req
+	other.Model = "gpt-4"
+	otherKey, err := cacheKey(&other)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, otherKey)
+}
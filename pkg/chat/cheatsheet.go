@@ -0,0 +1,121 @@
+package chat
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/mattn/go-runewidth"
+)
+
+// KeyBinding is an entry of the keyboard shortcut cheatsheet
+type KeyBinding struct {
+	Action string
+	Key    string
+}
+
+// modeBinding is a key binding of one of the modes entered with the keymap,
+// which has no help of its own
+type modeBinding struct {
+	mode    string
+	binding key.Binding
+	action  string
+}
+
+// modeBindings are the key bindings of the modes in the order of the cheatsheet
+var modeBindings = []modeBinding{
+	{"search", searchDoneKeys, "keep the matches highlighted"},
+	{"select context", selectionUpKeys, "previous message"},
+	{"select context", selectionDownKeys, "next message"},
+	{"select context", selectionToggleKeys, "toggle the message"},
+	{"select context", selectionConfirmKeys, "confirm the selection"},
+	{"annotate", noteUpKeys, "previous response"},
+	{"annotate", noteDownKeys, "next response"},
+	{"annotate", noteRateKeys, "rate the response"},
+	{"annotate", noteEditKeys, "edit the note"},
+	{"navigate code blocks", codeUpKeys, "previous code block"},
+	{"navigate code blocks", codeDownKeys, "next code block"},
+	{"navigate code blocks", codeToggleKeys, "expand or collapse the code block"},
+	{"mention", mentionUpKeys, "previous persona"},
+	{"mention", mentionDownKeys, "next persona"},
+	{"mention", mentionSelectKeys, "insert the persona"},
+	{"command palette", paletteUpKeys, "previous entry"},
+	{"command palette", paletteDownKeys, "next entry"},
+	{"command palette", paletteSelectKeys, "run the entry"},
+	{"prompts", promptSelectKeys, "insert the prompt"},
+	{"conversation", scrollUpKeys, "scroll up, loading older messages at the top"},
+}
+
+// AllBindings returns the key bindings of the help of the keymap followed by the
+// ones of the modes it enters, such as annotating or navigating code blocks
+func AllBindings(keys keymap) []KeyBinding {
+	var bindings []KeyBinding
+	for _, row := range keys.FullHelp() {
+		for _, binding := range row {
+			bindings = append(bindings, KeyBinding{Action: binding.Help().Desc, Key: binding.Help().Key})
+		}
+	}
+	for _, b := range modeBindings {
+		names := slices.Clone(b.binding.Keys())
+		for i, name := range names {
+			if name == " " {
+				names[i] = "space"
+			}
+		}
+		bindings = append(bindings, KeyBinding{Action: b.mode + ": " + b.action, Key: strings.Join(names, "/")})
+	}
+	return bindings
+}
+
+// DefaultBindings returns all key bindings of the TUI
+func DefaultBindings() []KeyBinding {
+	return AllBindings(keys)
+}
+
+// InlineCommands returns the inline commands with their descriptions
+func InlineCommands() []CommandDef {
+	return slices.Clone(commands)
+}
+
+// FormatTable renders the rows as columns aligned with spaces under the header,
+// or as a Markdown table if markdown is set
+func FormatTable(header []string, rows [][]string, markdown bool) string {
+	var b strings.Builder
+	if markdown {
+		writeRow := func(cells []string) {
+			escaped := make([]string, len(cells))
+			for i, cell := range cells {
+				escaped[i] = strings.ReplaceAll(cell, "|", `\|`)
+			}
+			b.WriteString("| " + strings.Join(escaped, " | ") + " |\n")
+		}
+		writeRow(header)
+		separators := make([]string, len(header))
+		for i := range separators {
+			separators[i] = "---"
+		}
+		writeRow(separators)
+		for _, row := range rows {
+			writeRow(row)
+		}
+		return b.String()
+	}
+
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			widths[i] = max(widths[i], runewidth.StringWidth(cell))
+		}
+	}
+	for _, row := range append([][]string{header}, rows...) {
+		var cells []string
+		for i, cell := range row {
+			if i < len(row)-1 {
+				cell = runewidth.FillRight(cell, widths[i])
+			}
+			cells = append(cells, cell)
+		}
+		b.WriteString(strings.Join(cells, "  ") + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,41 @@
+package chat
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllBindings(t *testing.T) {
+	bindings := AllBindings(keys)
+	for _, b := range bindings {
+		assert.NotEmpty(t, b.Action)
+		assert.NotEmpty(t, b.Key)
+	}
+
+	// every binding of the keymap is listed, so none may be left out of the help
+	v := reflect.ValueOf(keys)
+	for i := 0; i < v.NumField(); i++ {
+		binding := v.Field(i).Interface().(key.Binding)
+		assert.Contains(t, bindings, KeyBinding{Action: binding.Help().Desc, Key: binding.Help().Key}, v.Type().Field(i).Name)
+	}
+	assert.Contains(t, bindings, KeyBinding{Action: "annotate: rate the response", Key: "1/2/3/4/5"})
+	assert.Contains(t, bindings, KeyBinding{Action: "select context: toggle the message", Key: "space"})
+	assert.Contains(t, bindings, KeyBinding{Action: "mention: insert the persona", Key: "enter/tab"})
+	assert.Len(t, bindings, v.NumField()+len(modeBindings))
+}
+
+func TestFormatTable(t *testing.T) {
+	header := []string{"Command", "Description"}
+	rows := [][]string{{"/pin", "pin the session"}, {"/system [message|expand]", "edit the system message"}}
+
+	assert.Equal(t, "Command                   Description\n"+
+		"/pin                      pin the session\n"+
+		"/system [message|expand]  edit the system message\n", FormatTable(header, rows, false))
+	assert.Equal(t, "| Command | Description |\n"+
+		"| --- | --- |\n"+
+		"| /pin | pin the session |\n"+
+		"| /system [message\\|expand] | edit the system message |\n", FormatTable(header, rows, true))
+}
@@ -0,0 +1,229 @@
+package chat
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// handleCommand runs the inline command from the input, e.g. "/imagine a cat".
+// It reports false if the input is not a known command, so it is sent as a message.
+func (m *Model) handleCommand(input string) (tea.Cmd, bool) {
+	if !strings.HasPrefix(input, "/") {
+		return nil, false
+	}
+	name, args, _ := strings.Cut(strings.TrimPrefix(input, "/"), " ")
+	args = strings.TrimSpace(args)
+
+	switch name {
+	case "imagine":
+		if len(args) == 0 {
+			m.setNotice(warnStyle.Render("usage: /imagine <prompt>"))
+			return nil, true
+		}
+		return tea.Batch(imagineCmd(m.client, args, m.imageSize, m.imageN), m.startWaiting()), true
+	case "compact":
+		if !m.compactable() {
+			m.setNotice(warnStyle.Render("the conversation of an assistant cannot be compacted"))
+			return nil, true
+		}
+		if len(m.client.history) == 0 {
+			m.setNotice(warnStyle.Render("nothing to compact"))
+			return nil, true
+		}
+		return m.compact(), true
+	case "system":
+		switch args {
+		case "expand", "collapse":
+			m.systemExpanded = args == "expand"
+			m.setNotice("")
+		case "":
+			// edit the system message in the textarea, it is replaced on send
+			m.editingSystem = true
+			m.textarea.SetValue(m.client.system)
+			m.setNotice(helpStyle.Render("Editing the system message, press Enter to apply"))
+		default:
+			m.client.system = args
+			m.setNotice("System message updated")
+		}
+		return nil, true
+	case "mark-system":
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 || n > len(m.client.history) {
+			m.setNotice(warnStyle.Render(fmt.Sprintf("usage: /mark-system <1-%d>", len(m.client.history))))
+			return nil, true
+		}
+		m.toggleSystem(n - 1)
+		if err := m.saveHistory(); err != nil {
+			m.setNotice(errorStyle.Render(err.Error()))
+			return nil, true
+		}
+		m.setNotice(fmt.Sprintf("Message %d is now a %s message", n, m.client.history[n-1].Role))
+		return nil, true
+	case "tag":
+		if len(args) == 0 {
+			m.setNotice(warnStyle.Render("usage: /tag <name>"))
+			return nil, true
+		}
+		// tagging again removes the tag
+		if i := slices.Index(m.tags, args); i >= 0 {
+			m.tags = slices.Delete(m.tags, i, i+1)
+		} else {
+			m.tags = append(m.tags, args)
+		}
+		if err := m.saveHistory(); err != nil {
+			m.setNotice(errorStyle.Render(err.Error()))
+			return nil, true
+		}
+		m.setNotice("Tags: " + strings.Join(m.tags, ", "))
+		return nil, true
+	case "model":
+		model := m.client.model
+		if len(args) > 0 {
+			model = args
+		}
+		view, ok := m.modelInfoView(model)
+		if !ok {
+			m.setNotice(warnStyle.Render("no model info for " + model))
+			return nil, true
+		}
+		m.setNotice(model + "\n" + view)
+		return nil, true
+	case "persona":
+		system, ok := m.personas[args]
+		if !ok {
+			names := make([]string, 0, len(m.personas))
+			for name := range m.personas {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			m.setNotice(warnStyle.Render("usage: /persona <" + strings.Join(names, "|") + ">"))
+			return nil, true
+		}
+		m.client.system = system
+		m.setNotice("Persona: " + args)
+		return nil, true
+	case "math":
+		if len(args) == 0 {
+			m.setNotice(warnStyle.Render("usage: /math <latex>"))
+			return nil, true
+		}
+		return mathCmd(args), true
+	case "title":
+		if len(args) == 0 {
+			m.setNotice(warnStyle.Render("usage: /title <title>"))
+			return nil, true
+		}
+		m.title = args
+		if err := m.saveHistory(); err != nil {
+			m.setNotice(errorStyle.Render(err.Error()))
+			return nil, true
+		}
+		m.setNotice("Title: " + m.title)
+		return nil, true
+	case "pin", "unpin":
+		m.pinned = name == "pin"
+		if err := m.saveHistory(); err != nil {
+			m.setNotice(errorStyle.Render(err.Error()))
+			return nil, true
+		}
+		if m.pinned {
+			m.setNotice("📌 Session pinned")
+		} else {
+			m.setNotice("Session unpinned")
+		}
+		return nil, true
+	case "rate":
+		rating, err := strconv.Atoi(args)
+		if err != nil {
+			m.setNotice(warnStyle.Render(fmt.Sprintf("usage: /rate <%d-%d>", minRating, maxRating)))
+			return nil, true
+		}
+		i := m.nextAssistantMessage(len(m.client.history), -1)
+		if i < 0 {
+			m.setNotice(warnStyle.Render("no response to rate"))
+			return nil, true
+		}
+		if err := m.rateMessage(i, rating); err != nil {
+			m.setNotice(errorStyle.Render(err.Error()))
+			return nil, true
+		}
+		m.setNotice("Rated " + ratingStyle.Render(ratingStars(rating)))
+		return nil, true
+	case "diff":
+		if len(args) == 0 {
+			m.setNotice(warnStyle.Render("usage: /diff <file>"))
+			return nil, true
+		}
+		i := m.nextAssistantMessage(len(m.client.history), -1)
+		if i < 0 {
+			m.setNotice(warnStyle.Render("no response to compare"))
+			return nil, true
+		}
+		reference, err := os.ReadFile(args)
+		if err != nil {
+			m.setNotice(errorStyle.Render(err.Error()))
+			return nil, true
+		}
+		m.setNotice(helpStyle.Render("--- "+args+"\n+++ last response") + "\n" + DiffText(string(reference), m.client.history[i].Content))
+		return nil, true
+	case "reply-to":
+		if !m.replyTo(args) {
+			m.setNotice(warnStyle.Render(fmt.Sprintf("usage: /reply-to <1-%d>", m.historyOffset+len(m.client.history))))
+			return nil, true
+		}
+		m.setNotice(fmt.Sprintf("%sReplying to message %s", threadConnector, args))
+		return nil, true
+	case "eval":
+		if !m.allowGoEval {
+			m.setNotice(warnStyle.Render("/eval runs code on this machine, start gptui with --allow-go-eval to enable it"))
+			return nil, true
+		}
+		block, ok := m.lastCodeBlock()
+		if !ok {
+			m.setNotice(warnStyle.Render("no code block in the last response"))
+			return nil, true
+		}
+		if len(block.Language) > 0 && block.Language != "go" {
+			m.setNotice(warnStyle.Render("/eval only runs Go code, the last code block is " + block.Language))
+			return nil, true
+		}
+		m.setNotice("")
+		return tea.Batch(evalCmd(block.Code), m.startWaiting()), true
+	}
+	if p, ok := pluginFor(m.plugins, name); ok {
+		m.setNotice(fmt.Sprintf("running /%s…", name))
+		return pluginCmd(p, PluginRequest{
+			Command:  name,
+			Args:     strings.Fields(args),
+			Messages: slices.Clone(m.client.history),
+		}), true
+	}
+	return nil, false
+}
+
+// toggleSystem changes the role of the message at index i to system, or back to its previous role.
+// The previous roles are kept by message ID, which stays the same when the history is paged.
+func (m *Model) toggleSystem(i int) {
+	message := &m.client.history[i]
+	id := messageID(m.historyOffset + i)
+	if message.Role != "system" {
+		if m.markedRoles == nil {
+			m.markedRoles = map[string]string{}
+		}
+		m.markedRoles[id] = message.Role
+		message.Role = "system"
+		return
+	}
+	role, ok := m.markedRoles[id]
+	if !ok {
+		// the previous role is unknown for messages marked in an earlier session
+		role = "user"
+	}
+	delete(m.markedRoles, id)
+	message.Role = role
+}
@@ -0,0 +1,90 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// compactPrompt asks the model to summarize the conversation into a shorter list of messages
+const compactPrompt = `Summarize the conversation above into as few messages as possible while keeping all facts, decisions and open questions needed to continue it.
+Reply with a JSON array only, without any other text: [{"role":"user|assistant|system","content":"..."}]`
+
+// compactMsg carries the compacted history
+type compactMsg []Message
+
+// compactCmd returns a tea.Cmd which asks the model to compact the history
+func compactCmd(client *Client, history []Message) tea.Cmd {
+	return func() tea.Msg {
+		messages := append([]Message{}, history...)
+		messages = append(messages, Message{Role: "user", Content: compactPrompt})
+		resp, err := client.createCompletion(&CompletionRequest{Model: client.model, Messages: messages}, false)
+		if err != nil {
+			return err
+		}
+		if len(resp.Choices) == 0 {
+			return errors.New("compaction returned no response")
+		}
+		compacted, err := parseCompactResponse(resp.Choices[0].Message.Content)
+		if err != nil {
+			return err
+		}
+		return compactMsg(compacted)
+	}
+}
+
+// parseCompactResponse parses the JSON list of messages from the compaction response.
+// The JSON may be wrapped in a Markdown code block.
+func parseCompactResponse(content string) ([]Message, error) {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(content, "```json")
+		content = strings.TrimPrefix(content, "```")
+		content = strings.TrimSuffix(content, "```")
+	}
+
+	var messages []Message
+	if err := json.Unmarshal([]byte(content), &messages); err != nil {
+		return nil, fmt.Errorf("invalid compaction response: %w", err)
+	}
+	if err := (Session{Messages: messages}).validate(); err != nil {
+		return nil, fmt.Errorf("invalid compaction response: %w", err)
+	}
+	return messages, nil
+}
+
+// historyTokens returns the number of tokens in the messages
+func (m Model) historyTokens(messages []Message) int {
+	return m.tokens.total(m.tokenCounter, messages)
+}
+
+// historyUtilization returns the ratio of tokens in the history to the context window of the model
+func (m Model) historyUtilization(model string) float64 {
+	return contextUtilization(m.historyTokens(m.client.history), model)
+}
+
+// compact starts the compaction of the history. The older messages of the session file
+// which are not loaded yet are loaded first, since the compacted history replaces them.
+func (m *Model) compact() tea.Cmd {
+	if m.historyOffset > 0 {
+		if err := m.loadMessagesFrom(0); err != nil {
+			return func() tea.Msg { return err }
+		}
+	}
+	return tea.Batch(compactCmd(m.client, m.client.history), m.startWaiting())
+}
+
+// compactable reports whether the history can be compacted. The thread of an assistant keeps
+// the conversation on the server, where the compaction prompt would be posted as a message.
+func (m Model) compactable() bool {
+	_, assistant := m.client.backend.(*AssistantBackend)
+	return !assistant
+}
+
+// shouldCompact reports whether the history exceeds the compaction threshold
+func (m Model) shouldCompact() bool {
+	return m.compactThreshold > 0 && m.compactable() && m.historyTokens(m.client.history) > m.compactThreshold
+}
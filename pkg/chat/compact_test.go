@@ -0,0 +1,104 @@
+package chat
+
+import (
+	"fmt"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCompactResponse(t *testing.T) {
+	want := []Message{
+		{Role: "system", Content: "The user is planning a trip to Japan."},
+		{Role: "assistant", Content: "Suggested Kyoto in spring."},
+	}
+
+	messages, err := parseCompactResponse(`[{"role":"system","content":"The user is planning a trip to Japan."},{"role":"assistant","content":"Suggested Kyoto in spring."}]`)
+	assert.NoError(t, err)
+	assert.Equal(t, want, messages)
+
+	messages, err = parseCompactResponse("```json\n[{\"role\":\"system\",\"content\":\"The user is planning a trip to Japan.\"},{\"role\":\"assistant\",\"content\":\"Suggested Kyoto in spring.\"}]\n```")
+	assert.NoError(t, err)
+	assert.Equal(t, want, messages)
+
+	for _, content := range []string{"Sure! Here is the summary.", `[]`, `[{"role":"narrator","content":"..."}]`, `{"role":"user","content":"..."}`} {
+		_, err := parseCompactResponse(content)
+		assert.Error(t, err, content)
+	}
+}
+
+func TestHandleCommand_CompactLlamaCpp(t *testing.T) {
+	setTestHome(t)
+	m := newTestModel(t)
+	m.client = newTestLlamaCppClient(t, "compact")
+	m.client.history = []Message{
+		{Role: "user", Content: "Where should I go in Japan?"},
+		{Role: "assistant", Content: "Kyoto in spring."},
+	}
+
+	cmd, ok := m.handleCommand("/compact")
+	require.True(t, ok)
+	var compacted tea.Msg
+	for _, msg := range batchMessages(cmd) {
+		if _, ok := msg.(compactMsg); ok {
+			compacted = msg
+		}
+	}
+	require.NotNil(t, compacted)
+	model, _ := m.Update(compacted)
+	m = model.(Model)
+	assert.Equal(t, []Message{{Role: "system", Content: "The user plans a trip to Kyoto in spring."}}, m.client.history)
+	assert.False(t, m.waiting)
+}
+
+func TestCompact_LoadsArchivedMessages(t *testing.T) {
+	setTestHome(t)
+	m := newTestModel(t)
+	m.client = newTestLlamaCppClient(t, "compact")
+	m.sessionId = "compact"
+	m.maxHistoryMemory = 10
+	for i := 0; i < 10; i++ {
+		m.client.history = append(m.client.history, Message{Role: "user", Content: fmt.Sprintf("message %d", i)})
+	}
+	require.NoError(t, m.archiveHistory())
+	require.Equal(t, 2, m.historyOffset)
+
+	// the archived messages are compacted with the loaded ones
+	cmd := m.compact()
+	assert.Equal(t, 0, m.historyOffset)
+	require.Len(t, m.client.history, 10)
+	assert.Equal(t, "message 0", m.client.history[0].Content)
+	var compacted tea.Msg
+	for _, msg := range batchMessages(cmd) {
+		if _, ok := msg.(compactMsg); ok {
+			compacted = msg
+		}
+	}
+	require.NotNil(t, compacted)
+	model, _ := m.Update(compacted)
+	m = model.(Model)
+
+	filePath, err := m.historyPath()
+	require.NoError(t, err)
+	saved, err := LoadSession(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, []Message{{Role: "system", Content: "The user plans a trip to Kyoto in spring."}}, saved.Messages)
+}
+
+func TestHandleCommand_CompactAssistant(t *testing.T) {
+	m := newTestModel(t)
+	m.client.backend = NewAssistantBackend(m.client, "asst_1", "thread_1")
+	m.client.history = []Message{
+		{Role: "user", Content: "Where should I go in Japan?"},
+		{Role: "assistant", Content: "Kyoto in spring."},
+	}
+	m.compactThreshold = 1
+
+	cmd, ok := m.handleCommand("/compact")
+	assert.True(t, ok)
+	assert.Nil(t, cmd)
+	assert.Contains(t, m.notice, "cannot be compacted")
+	assert.False(t, m.shouldCompact())
+}
@@ -0,0 +1,172 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// CrashReport is the state of a chat session written when the TUI crashes
+type CrashReport struct {
+	SessionID string         `json:"session_id"`
+	CreatedAt time.Time      `json:"created_at"`
+	Model     string         `json:"model"`
+	System    string         `json:"system,omitempty"`
+	Error     string         `json:"error"`
+	Title     string         `json:"title,omitempty"`
+	Pinned    bool           `json:"pinned,omitempty"`
+	Tags      []string       `json:"tags,omitempty"`
+	Notes     map[int]string `json:"notes,omitempty"`
+	Ratings   map[int]int    `json:"ratings,omitempty"`
+	// HistoryOffset is the number of older messages of the session file which were not loaded
+	HistoryOffset int       `json:"history_offset,omitempty"`
+	Messages      []Message `json:"messages"`
+}
+
+// restoreMsg offers to restore the session from the crash report
+type restoreMsg struct {
+	report   *CrashReport
+	filePath string
+}
+
+// crashDir returns the directory where crash reports are saved
+func crashDir() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, "crash"), nil
+}
+
+// writeCrashReport saves the state of the model with the error in the crash directory
+func (m Model) writeCrashReport(reason any) (string, error) {
+	dir, err := crashDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	report := CrashReport{
+		SessionID:     m.sessionId,
+		CreatedAt:     m.createdAt,
+		Error:         fmt.Sprint(reason),
+		Title:         m.title,
+		Pinned:        m.pinned,
+		Tags:          m.tags,
+		Notes:         m.notes,
+		Ratings:       m.ratings,
+		HistoryOffset: m.historyOffset,
+	}
+	if m.client != nil {
+		report.Model = m.client.model
+		report.System = m.client.system
+		report.Messages = m.client.history
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return "", err
+	}
+	filePath := path.Join(dir, time.Now().Format(sessionTimeLayout)+".json")
+	return filePath, os.WriteFile(filePath, data, 0644)
+}
+
+// SaveCrashReport saves the state of the final model of a program which exited with an error
+func SaveCrashReport(model tea.Model, err error) {
+	m, ok := model.(Model)
+	if !ok {
+		return
+	}
+	if _, err := m.writeCrashReport(err); err != nil {
+		logger.Error("failed to write crash report", "error", err)
+	}
+}
+
+// loadCrashReport reads the crash report from a JSON file
+func loadCrashReport(filePath string) (*CrashReport, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var report CrashReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// findCrashReport returns the path of the latest crash report, or an empty string if there is none
+func findCrashReport() string {
+	dir, err := crashDir()
+	if err != nil {
+		return ""
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && path.Ext(entry.Name()) == ".json" {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return path.Join(dir, names[len(names)-1])
+}
+
+// restoreCmd returns a tea.Cmd which reads the crash report to restore
+func restoreCmd(filePath string) tea.Cmd {
+	return func() tea.Msg {
+		report, err := loadCrashReport(filePath)
+		if err != nil {
+			logger.Warn("removing invalid crash report", "path", filePath, "error", err)
+			os.Remove(filePath)
+			return nil
+		}
+		return restoreMsg{report: report, filePath: filePath}
+	}
+}
+
+// restore replaces the session with the one from the crash report. The older
+// messages of the session file which were not loaded are kept before the messages
+// of the report, so saving the restored session does not drop them.
+func (m *Model) restore(report *CrashReport) {
+	m.sessionId = report.SessionID
+	m.createdAt = report.CreatedAt
+	m.client.model = report.Model
+	m.client.system = report.System
+	m.client.history = report.Messages
+	m.parseLastResponse()
+	m.title = report.Title
+	m.pinned = report.Pinned
+	m.tags = report.Tags
+	m.notes = report.Notes
+	m.ratings = report.Ratings
+	m.historyLoader = nil
+	m.historyOffset = 0
+	if report.HistoryOffset == 0 {
+		return
+	}
+	filePath, err := m.historyPath()
+	if err != nil {
+		logger.Warn("failed to find the session of the crash report", "error", err)
+		return
+	}
+	_, loader, err := sessionStorage.open(filePath, 0)
+	if err != nil {
+		logger.Warn("failed to open the session of the crash report", "path", filePath, "error", err)
+		return
+	}
+	m.historyLoader = loader
+	m.historyOffset = min(report.HistoryOffset, len(loader.ends))
+}
@@ -0,0 +1,91 @@
+package chat
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate_CrashReport(t *testing.T) {
+	setTestHome(t)
+
+	m := newTestModel(t)
+	m.sessionId = "2023-05-01_10-00-00"
+	m.client.system = "You are a helpful assistant."
+	m.client.history = []Message{{Role: "user", Content: "Hello"}}
+
+	// a buffered stream response without choices crashes the update
+	m.streamBuffer = []CompletionStreamResponse{{}}
+	assert.Panics(t, func() { m.Update(flushStreamMsg{}) })
+
+	filePath := findCrashReport()
+	assert.NotEmpty(t, filePath)
+	report, err := loadCrashReport(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "2023-05-01_10-00-00", report.SessionID)
+	assert.Equal(t, "gpt-3.5-turbo", report.Model)
+	assert.Equal(t, "You are a helpful assistant.", report.System)
+	assert.Equal(t, m.client.history, report.Messages)
+	assert.Contains(t, report.Error, "index out of range")
+
+	// restore the session on the next start
+	restored := newTestModel(t)
+	restored.crashReport = filePath
+	model, _ := restored.Update(restoreCmd(filePath)())
+	restored = model.(Model)
+	assert.Contains(t, restored.notice, "Restore?")
+
+	model, _ = restored.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	restored = model.(Model)
+	assert.Equal(t, "2023-05-01_10-00-00", restored.sessionId)
+	assert.Equal(t, m.client.history, restored.client.history)
+	assert.Empty(t, restored.textarea.Value())
+	_, err = os.Stat(filePath)
+	assert.True(t, os.IsNotExist(err))
+	assert.Empty(t, findCrashReport())
+}
+
+func TestUpdate_CrashReport_LazySession(t *testing.T) {
+	setTestHome(t)
+
+	// a session of 120 messages of which only the last 50 are loaded
+	m := newTestModel(t)
+	m.sessionId = "fixture"
+	filePath, err := m.historyPath()
+	require.NoError(t, err)
+	writeSessionFixture(t, filePath, 120)
+	require.NoError(t, m.loadHistory(filePath))
+	m.title = "Long session"
+	m.tags = []string{"go"}
+	m.notes = map[int]string{3: "remember this"}
+	assert.Equal(t, 70, m.historyOffset)
+	m.client.history = append(m.client.history, Message{Role: "assistant", Content: "message 120"})
+
+	m.streamBuffer = []CompletionStreamResponse{{}}
+	assert.Panics(t, func() { m.Update(flushStreamMsg{}) })
+	report := findCrashReport()
+	require.NotEmpty(t, report)
+
+	restored := newTestModel(t)
+	restored.crashReport = report
+	model, _ := restored.Update(restoreCmd(report)())
+	model, _ = model.(Model).Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	restored = model.(Model)
+	assert.Equal(t, 70, restored.historyOffset)
+	assert.Len(t, restored.client.history, 51)
+
+	// the older messages and the metadata of the session file are kept
+	saved, err := LoadSession(filePath)
+	require.NoError(t, err)
+	require.Len(t, saved.Messages, 121)
+	for i, message := range saved.Messages {
+		assert.Equal(t, fmt.Sprintf("message %d", i), message.Content)
+	}
+	assert.Equal(t, "Long session", saved.Title)
+	assert.Equal(t, []string{"go"}, saved.Tags)
+	assert.Equal(t, map[int]string{3: "remember this"}, saved.Notes)
+}
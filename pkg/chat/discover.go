@@ -0,0 +1,94 @@
+package chat
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/imfing/gptui/pkg/discovery"
+	"github.com/spf13/viper"
+)
+
+// discoveryTimeout is the time the servers on the local network have to answer
+const discoveryTimeout = 2 * time.Second
+
+// serversDiscoveredMsg holds the servers found on the local network
+type serversDiscoveredMsg struct {
+	services []discovery.ServiceInfo
+	err      error
+}
+
+// discoverServersCmd browses the local network for OpenAI-compatible servers
+func discoverServersCmd() tea.Cmd {
+	return func() tea.Msg {
+		services, err := discovery.DiscoverServers(discoveryTimeout)
+		return serversDiscoveredMsg{services: services, err: err}
+	}
+}
+
+// serverItem is an entry of the server picker
+type serverItem struct {
+	service discovery.ServiceInfo
+}
+
+func (i serverItem) Title() string { return i.service.Instance }
+func (i serverItem) Description() string {
+	return fmt.Sprintf("%s:%d", i.service.HostName, i.service.Port)
+}
+func (i serverItem) FilterValue() string { return i.service.Instance }
+
+// startServerPicker opens the picker of the discovered servers
+func (m *Model) startServerPicker(msg serversDiscoveredMsg) {
+	if msg.err != nil {
+		m.setNotice(errorStyle.Render("mDNS discovery failed: " + msg.err.Error()))
+		return
+	}
+	if len(msg.services) == 0 {
+		m.setNotice(warnStyle.Render("no " + discovery.ServiceType + " server found on the local network"))
+		return
+	}
+	var items []list.Item
+	for _, service := range msg.services {
+		items = append(items, serverItem{service: service})
+	}
+	delegate := list.NewDefaultDelegate()
+	delegate.SetSpacing(0)
+	m.serverList = list.New(items, delegate, 0, 0)
+	m.serverList.Title = "Servers on the local network"
+	m.serverList.SetShowStatusBar(false)
+	m.serverList.SetShowHelp(false)
+	m.serverList.SetFilteringEnabled(false)
+	m.serverList.SetSize(min(60, m.viewport.Width)-paletteStyle.GetHorizontalFrameSize(), max(m.viewport.Height-paletteStyle.GetVerticalFrameSize(), 1))
+	m.pickingServer = true
+}
+
+// updateServerPicker handles the keys of the open server picker
+func (m *Model) updateServerPicker(msg tea.KeyMsg) {
+	switch {
+	case key.Matches(msg, paletteUpKeys):
+		m.serverList.CursorUp()
+	case key.Matches(msg, paletteDownKeys):
+		m.serverList.CursorDown()
+	case key.Matches(msg, promptSelectKeys):
+		m.pickingServer = false
+		item, ok := m.serverList.SelectedItem().(serverItem)
+		if !ok {
+			return
+		}
+		baseURL := item.service.BaseURL()
+		m.client.setBaseURL(baseURL)
+		// the clients of new tabs use the server too
+		viper.Set("openai-api-base", baseURL)
+		m.setNotice("Base URL: " + baseURL)
+	case key.Matches(msg, m.keys.Esc):
+		m.pickingServer = false
+	}
+}
+
+// serverPickerView renders the server picker centered over the conversation
+func (m Model) serverPickerView() string {
+	return lipgloss.Place(m.viewport.Width, m.viewport.Height, lipgloss.Center, lipgloss.Center, paletteStyle.Render(m.serverList.View()))
+}
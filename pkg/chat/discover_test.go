@@ -0,0 +1,41 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/imfing/gptui/pkg/discovery"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerPicker(t *testing.T) {
+	defer viper.Set("openai-api-base", nil)
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+
+	model, _ := m.Update(serversDiscoveredMsg{err: errors.New("no multicast")})
+	m = model.(Model)
+	assert.False(t, m.pickingServer)
+	assert.Contains(t, m.notice, "no multicast")
+
+	model, _ = m.Update(serversDiscoveredMsg{services: []discovery.ServiceInfo{
+		{Instance: "LM Studio", HostName: "studio.local", Port: 1234},
+		{Instance: "ollama", HostName: "gpu.local", Port: 11434},
+	}})
+	m = model.(Model)
+	assert.True(t, m.pickingServer)
+	assert.Contains(t, ansiPattern.ReplaceAllString(m.View(), ""), "gpu.local:11434")
+
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m = model.(Model)
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = model.(Model)
+	assert.False(t, m.pickingServer)
+	assert.Equal(t, "http://gpu.local:11434/v1", m.client.baseURL)
+	assert.Equal(t, "http://gpu.local:11434/v1", viper.GetString("openai-api-base"))
+	assert.Empty(t, m.client.history)
+}
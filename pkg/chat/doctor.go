@@ -0,0 +1,170 @@
+package chat
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+)
+
+const (
+	// doctorTimeout is the timeout of the request checking that the base URL is reachable
+	doctorTimeout = 5 * time.Second
+	// minTerminalWidth and minTerminalHeight are the dimensions the TUI is usable with
+	minTerminalWidth  = 80
+	minTerminalHeight = 24
+)
+
+// apiKeyPattern matches the format of the OpenAI API keys, e.g. sk-... or sk-proj-...
+var apiKeyPattern = regexp.MustCompile(`^sk-[A-Za-z0-9_-]{20,}$`)
+
+// DoctorCheck is a diagnostic of gptui doctor. Run reports whether the check passed,
+// with a hint to fix the configuration otherwise.
+type DoctorCheck struct {
+	Name string
+	Run  func() (passed bool, hint string)
+}
+
+// DoctorChecks returns the checks of the current configuration and terminal
+func DoctorChecks() []DoctorCheck {
+	apiKey := viper.GetString("openai-api-key")
+	baseURL := viper.GetString("openai-api-base")
+	client := NewChatClient(baseURL, apiKey, viper.GetString("model"), "", false, 0)
+	return []DoctorCheck{
+		{"API key", checkAPIKey(apiKey)},
+		{"base URL", checkBaseURL(baseURL, &http.Client{Timeout: doctorTimeout})},
+		{"model", checkModel(client, viper.GetString("model"))},
+		{"config files", checkConfigFiles(viper.GetString("prompt-library"), viper.GetString("model-info-file"))},
+		{"history directory", checkHistoryDir(HistoryDir)},
+		{"terminal colors", checkColors(lipgloss.ColorProfile())},
+		{"terminal size", checkTerminalSize(func() (int, int, error) { return term.GetSize(int(os.Stdout.Fd())) })},
+	}
+}
+
+// RunDoctor runs the checks, printing ✓ or ✗ for each with the hint of the failed ones,
+// and returns whether all of them passed
+func RunDoctor(w io.Writer, checks []DoctorCheck) bool {
+	ok := true
+	for _, check := range checks {
+		passed, hint := check.Run()
+		if passed {
+			fmt.Fprintf(w, "✓ %s\n", check.Name)
+			continue
+		}
+		ok = false
+		fmt.Fprintf(w, "✗ %s: %s\n", check.Name, hint)
+	}
+	return ok
+}
+
+// checkAPIKey checks that the API key is set and looks like an OpenAI API key
+func checkAPIKey(apiKey string) func() (bool, string) {
+	return func() (bool, string) {
+		if len(apiKey) == 0 {
+			return false, "set the API key with --openai-api-key or $OPENAI_API_KEY"
+		}
+		if !apiKeyPattern.MatchString(apiKey) {
+			return false, "the API key should start with sk- followed by at least 20 letters, digits, - or _"
+		}
+		return true, ""
+	}
+}
+
+// checkBaseURL checks that the API answers at the base URL, whatever the status
+func checkBaseURL(baseURL string, httpClient *http.Client) func() (bool, string) {
+	return func() (bool, string) {
+		resp, err := httpClient.Get(baseURL)
+		if err != nil {
+			return false, fmt.Sprintf("%s is unreachable (%v), check --openai-api-base and the network", baseURL, err)
+		}
+		resp.Body.Close()
+		return true, ""
+	}
+}
+
+// checkModel checks that the model is listed by the API
+func checkModel(client *Client, model string) func() (bool, string) {
+	return func() (bool, string) {
+		models, err := client.ListModels()
+		if err != nil {
+			return false, fmt.Sprintf("failed to list the models (%v), check the API key and base URL", err)
+		}
+		if !slices.Contains(models, model) {
+			return false, fmt.Sprintf("model %q does not exist, set --model to one of the models of the API", model)
+		}
+		return true, ""
+	}
+}
+
+// checkConfigFiles checks that the prompt library and the model info file parse, if set
+func checkConfigFiles(promptLibrary, modelInfoFile string) func() (bool, string) {
+	return func() (bool, string) {
+		if len(promptLibrary) > 0 {
+			if _, err := LoadPromptLibrary(promptLibrary); err != nil {
+				return false, fmt.Sprintf("fix or unset --prompt-library: %v", err)
+			}
+		}
+		if len(modelInfoFile) > 0 {
+			data, err := os.ReadFile(modelInfoFile)
+			if err == nil {
+				_, err = parseModelInfo(data)
+			}
+			if err != nil {
+				return false, fmt.Sprintf("fix or unset --model-info-file: %v", err)
+			}
+		}
+		return true, ""
+	}
+}
+
+// checkHistoryDir checks that a file can be created in the history directory
+func checkHistoryDir(historyDir func() (string, error)) func() (bool, string) {
+	return func() (bool, string) {
+		dir, err := historyDir()
+		if err != nil {
+			return false, fmt.Sprintf("no history directory: %v", err)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return false, fmt.Sprintf("failed to create %s: %v", dir, err)
+		}
+		f, err := os.CreateTemp(dir, ".doctor-*")
+		if err != nil {
+			return false, fmt.Sprintf("%s is not writable, check its permissions", dir)
+		}
+		f.Close()
+		os.Remove(f.Name())
+		return true, ""
+	}
+}
+
+// checkColors checks that the terminal supports colors
+func checkColors(profile termenv.Profile) func() (bool, string) {
+	return func() (bool, string) {
+		if profile == termenv.Ascii {
+			return false, "the terminal does not support colors, set $TERM, e.g. to xterm-256color, and unset $NO_COLOR"
+		}
+		return true, ""
+	}
+}
+
+// checkTerminalSize checks that the terminal is at least 80×24
+func checkTerminalSize(size func() (width, height int, err error)) func() (bool, string) {
+	return func() (bool, string) {
+		width, height, err := size()
+		if err != nil {
+			return false, "stdout is not a terminal, run gptui doctor in the terminal gptui is used in"
+		}
+		if width < minTerminalWidth || height < minTerminalHeight {
+			return false, fmt.Sprintf("the terminal is %d×%d, resize it to at least %d×%d", width, height, minTerminalWidth, minTerminalHeight)
+		}
+		return true, ""
+	}
+}
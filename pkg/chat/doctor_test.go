@@ -0,0 +1,141 @@
+package chat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/muesli/termenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckAPIKey(t *testing.T) {
+	passed, hint := checkAPIKey("")()
+	assert.False(t, passed)
+	assert.Contains(t, hint, "--openai-api-key")
+
+	passed, hint = checkAPIKey("not-a-key")()
+	assert.False(t, passed)
+	assert.Contains(t, hint, "sk-")
+
+	passed, _ = checkAPIKey("sk-proj-abcdefghijklmnopqrstuvwxyz0123")()
+	assert.True(t, passed)
+}
+
+func TestCheckBaseURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	// any response shows that the API is reachable
+	passed, _ := checkBaseURL(server.URL, server.Client())()
+	assert.True(t, passed)
+
+	server.Close()
+	passed, hint := checkBaseURL(server.URL, server.Client())()
+	assert.False(t, passed)
+	assert.Contains(t, hint, "unreachable")
+}
+
+func TestCheckModel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer sk-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "/models", r.URL.Path)
+		fmt.Fprint(w, `{"data":[{"id":"gpt-3.5-turbo"},{"id":"gpt-4"}]}`)
+	}))
+	defer server.Close()
+
+	passed, _ := checkModel(NewChatClient(server.URL, "sk-test", "", "", false, 0), "gpt-4")()
+	assert.True(t, passed)
+
+	passed, hint := checkModel(NewChatClient(server.URL, "sk-test", "", "", false, 0), "gpt-5")()
+	assert.False(t, passed)
+	assert.Contains(t, hint, `"gpt-5" does not exist`)
+
+	passed, hint = checkModel(NewChatClient(server.URL, "sk-wrong", "", "", false, 0), "gpt-4")()
+	assert.False(t, passed)
+	assert.Contains(t, hint, "failed to list the models")
+}
+
+func TestCheckConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	prompts := filepath.Join(dir, "prompts.yaml")
+	require.NoError(t, os.WriteFile(prompts, []byte("prompts:\n  - name: review\n    text: Review {{code}}\n"), 0644))
+	modelInfo := filepath.Join(dir, "models.json")
+	require.NoError(t, os.WriteFile(modelInfo, []byte(`{"local": {"context_window": 4096}}`), 0644))
+
+	passed, _ := checkConfigFiles("", "")()
+	assert.True(t, passed)
+	passed, _ = checkConfigFiles(prompts, modelInfo)()
+	assert.True(t, passed)
+
+	invalid := filepath.Join(dir, "invalid")
+	require.NoError(t, os.WriteFile(invalid, []byte("prompts: [{name: review}"), 0644))
+	passed, hint := checkConfigFiles(invalid, "")()
+	assert.False(t, passed)
+	assert.Contains(t, hint, "--prompt-library")
+	passed, hint = checkConfigFiles(prompts, invalid)()
+	assert.False(t, passed)
+	assert.Contains(t, hint, "--model-info-file")
+}
+
+func TestCheckHistoryDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "chat")
+	passed, _ := checkHistoryDir(func() (string, error) { return dir, nil })()
+	assert.True(t, passed)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	if os.Geteuid() != 0 {
+		require.NoError(t, os.Chmod(dir, 0555))
+		passed, hint := checkHistoryDir(func() (string, error) { return dir, nil })()
+		assert.False(t, passed)
+		assert.Contains(t, hint, "not writable")
+	}
+
+	passed, _ = checkHistoryDir(func() (string, error) { return "", errors.New("no home") })()
+	assert.False(t, passed)
+}
+
+func TestCheckColors(t *testing.T) {
+	passed, _ := checkColors(termenv.ANSI256)()
+	assert.True(t, passed)
+	passed, hint := checkColors(termenv.Ascii)()
+	assert.False(t, passed)
+	assert.Contains(t, hint, "$TERM")
+}
+
+func TestCheckTerminalSize(t *testing.T) {
+	size := func(width, height int, err error) func() (int, int, error) {
+		return func() (int, int, error) { return width, height, err }
+	}
+	passed, _ := checkTerminalSize(size(120, 40, nil))()
+	assert.True(t, passed)
+	passed, hint := checkTerminalSize(size(80, 20, nil))()
+	assert.False(t, passed)
+	assert.Equal(t, "the terminal is 80×20, resize it to at least 80×24", hint)
+	passed, _ = checkTerminalSize(size(0, 0, errors.New("not a terminal")))()
+	assert.False(t, passed)
+}
+
+func TestRunDoctor(t *testing.T) {
+	var out bytes.Buffer
+	ok := RunDoctor(&out, []DoctorCheck{
+		{"first", func() (bool, string) { return true, "" }},
+		{"second", func() (bool, string) { return false, "fix it" }},
+	})
+	assert.False(t, ok)
+	assert.Equal(t, "✓ first\n✗ second: fix it\n", out.String())
+
+	out.Reset()
+	assert.True(t, RunDoctor(&out, []DoctorCheck{{"first", func() (bool, string) { return true, "" }}}))
+}
@@ -0,0 +1,82 @@
+package chat
+
+import (
+	"errors"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// draftSuffix ends the names of draft files, which start with the session ID
+// so that instances running at the same time do not overwrite each other's draft
+const draftSuffix = "-draft.txt"
+
+// draftDir returns the directory where unsent drafts are saved
+func draftDir() (string, error) {
+	return configDir()
+}
+
+// draftPath returns the path of the draft file of the session
+func draftPath(sessionID string) (string, error) {
+	dir, err := draftDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, sessionID+draftSuffix), nil
+}
+
+// saveDraft saves the unsent content of the session, an empty draft removes the file
+func saveDraft(sessionID, content string) error {
+	if len(strings.TrimSpace(content)) == 0 {
+		return removeDraft(sessionID)
+	}
+	filePath, err := draftPath(sessionID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, []byte(content), 0644)
+}
+
+// removeDraft removes the draft file of the session if it exists
+func removeDraft(sessionID string) error {
+	filePath, err := draftPath(sessionID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// findDraft returns the path and content of the latest draft, or an empty path if there is none
+func findDraft() (string, string) {
+	dir, err := draftDir()
+	if err != nil {
+		return "", ""
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", ""
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), draftSuffix) {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return "", ""
+	}
+	sort.Strings(names)
+	filePath := path.Join(dir, names[len(names)-1])
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", ""
+	}
+	return filePath, string(data)
+}
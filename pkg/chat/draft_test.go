@@ -0,0 +1,31 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDraft_RoundTrip(t *testing.T) {
+	setTestHome(t)
+
+	filePath, content := findDraft()
+	assert.Empty(t, filePath)
+	assert.Empty(t, content)
+
+	assert.NoError(t, saveDraft("2023-04-01_10-00-00", "older draft"))
+	assert.NoError(t, saveDraft("2023-04-02_10-00-00", "unsent\nmessage"))
+	filePath, content = findDraft()
+	assert.Contains(t, filePath, "2023-04-02_10-00-00"+draftSuffix)
+	assert.Equal(t, "unsent\nmessage", content)
+
+	// an empty draft removes the file
+	assert.NoError(t, saveDraft("2023-04-02_10-00-00", "  \n"))
+	_, content = findDraft()
+	assert.Equal(t, "older draft", content)
+
+	assert.NoError(t, removeDraft("2023-04-01_10-00-00"))
+	assert.NoError(t, removeDraft("2023-04-01_10-00-00"))
+	filePath, _ = findDraft()
+	assert.Empty(t, filePath)
+}
@@ -0,0 +1,139 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// evalBuildTimeout is the time /eval lets the code compile, which includes filling the build cache
+	evalBuildTimeout = 2 * time.Minute
+	// evalTimeout is the time /eval lets the compiled code run
+	evalTimeout = 5 * time.Second
+)
+
+var (
+	// packagePattern matches the package clause of a Go source file
+	packagePattern = regexp.MustCompile(`(?m)^package\s+\w+`)
+	// mainFuncPattern matches the declaration of the main function
+	mainFuncPattern = regexp.MustCompile(`(?m)^func\s+main\s*\(\s*\)`)
+	// importPattern matches the import declarations leading a snippet of statements
+	importPattern = regexp.MustCompile(`^\s*(import\s*\([^)]*\)|import\s+("[^"]*"|\w+\s+"[^"]*"))\s*`)
+)
+
+// evalResultMsg is the output of the code run by /eval
+type evalResultMsg struct {
+	output string
+}
+
+// wrapGoCode returns the code as a main package. Code without package clause gets one,
+// and statements without main function are wrapped in one after their imports.
+func wrapGoCode(code string) string {
+	if packagePattern.MatchString(code) {
+		return code
+	}
+	if mainFuncPattern.MatchString(code) {
+		return "package main\n\n" + code
+	}
+	var imports []string
+	for {
+		loc := importPattern.FindStringIndex(code)
+		if loc == nil {
+			break
+		}
+		imports = append(imports, strings.TrimSpace(code[:loc[1]]))
+		code = code[loc[1]:]
+	}
+	var b strings.Builder
+	b.WriteString("package main\n\n")
+	for _, declaration := range imports {
+		b.WriteString(declaration + "\n")
+	}
+	b.WriteString("\nfunc main() {\n" + code + "\n}\n")
+	return b.String()
+}
+
+// EvalGoCode compiles and runs the Go code, wrapped in a main package if needed, and returns
+// its output. The compilation is given evalBuildTimeout, and the program is killed if it runs
+// longer than timeout. err is set if the code does not compile, fails or times out.
+func EvalGoCode(code string, timeout time.Duration) (stdout, stderr string, err error) {
+	dir, err := os.MkdirTemp("", "gptui-eval-")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(wrapGoCode(code)), 0644); err != nil {
+		return "", "", err
+	}
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	// build first, so that the timeout kills the program itself and not only go run
+	buildCtx, cancelBuild := context.WithTimeout(context.Background(), evalBuildTimeout)
+	defer cancelBuild()
+	build := exec.CommandContext(buildCtx, "go", "build", "-o", "main", "main.go")
+	build.Dir = dir
+	build.Stderr = &stderrBuf
+	if err := build.Run(); err != nil {
+		return "", stderrBuf.String(), evalError(buildCtx, evalBuildTimeout, fmt.Errorf("compilation failed: %w", err))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	run := exec.CommandContext(ctx, filepath.Join(dir, "main"))
+	run.Dir = dir
+	run.Stdout = &stdoutBuf
+	run.Stderr = &stderrBuf
+	err = run.Run()
+	return stdoutBuf.String(), stderrBuf.String(), evalError(ctx, timeout, err)
+}
+
+// evalError reports the timeout instead of the kill of the command
+func evalError(ctx context.Context, timeout time.Duration, err error) error {
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	return err
+}
+
+// evalCmd runs the code and returns its output with the error, if any
+func evalCmd(code string) tea.Cmd {
+	return func() tea.Msg {
+		stdout, stderr, err := EvalGoCode(code, evalTimeout)
+		output := strings.TrimRight(stdout+stderr, "\n")
+		if err != nil {
+			output = strings.TrimLeft(output+"\n"+err.Error(), "\n")
+		}
+		return evalResultMsg{output: output}
+	}
+}
+
+// lastCodeBlock returns the last code block of the last response
+func (m Model) lastCodeBlock() (CodeSegment, bool) {
+	for i := len(m.lastParsedResponse) - 1; i >= 0; i-- {
+		if code, ok := m.lastParsedResponse[i].(CodeSegment); ok {
+			return code, true
+		}
+	}
+	return CodeSegment{}, false
+}
+
+// appendEvalOutput appends the output of /eval to the conversation as a user message
+func (m *Model) appendEvalOutput(output string) {
+	m.client.history = append(m.client.history, Message{Role: "user", Content: "Output:\n```\n" + output + "\n```"})
+	content, _ := m.renderMessages(m.client.history)
+	m.viewport.SetContent(content)
+	m.viewport.GotoBottom()
+	if err := m.saveHistory(); err != nil {
+		logger.Error("failed to save history", "error", err)
+	}
+}
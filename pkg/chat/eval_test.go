@@ -0,0 +1,86 @@
+package chat
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func requireGo(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+}
+
+func TestWrapGoCode(t *testing.T) {
+	program := "package main\n\nfunc main() {}\n"
+	assert.Equal(t, program, wrapGoCode(program))
+	assert.Equal(t, "package main\n\nfunc main() {}\n", wrapGoCode("func main() {}\n"))
+	assert.Equal(t, "package main\n\nimport \"fmt\"\nimport (\n\t\"os\"\n)\n\nfunc main() {\nfmt.Fprintln(os.Stdout, 1)\n}\n",
+		wrapGoCode("import \"fmt\"\nimport (\n\t\"os\"\n)\n\nfmt.Fprintln(os.Stdout, 1)"))
+}
+
+func TestEvalGoCode(t *testing.T) {
+	requireGo(t)
+	stdout, stderr, err := EvalGoCode("import \"fmt\"\n\nfmt.Println(\"hello\")", evalTimeout)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", stdout)
+	assert.Empty(t, stderr)
+}
+
+func TestEvalGoCode_CompilationError(t *testing.T) {
+	requireGo(t)
+	stdout, stderr, err := EvalGoCode("func main() { undefined() }", evalTimeout)
+	assert.ErrorContains(t, err, "compilation failed")
+	assert.Empty(t, stdout)
+	assert.Contains(t, stderr, "undefined: undefined")
+}
+
+func TestEvalGoCode_RuntimeError(t *testing.T) {
+	requireGo(t)
+	stdout, stderr, err := EvalGoCode("import \"fmt\"\n\nfmt.Println(\"before\")\nvar s []int\n_ = s[1]", evalTimeout)
+	var exitErr *exec.ExitError
+	assert.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, "before\n", stdout)
+	assert.Contains(t, stderr, "index out of range")
+}
+
+func TestEvalGoCode_Timeout(t *testing.T) {
+	requireGo(t)
+	// the timeout applies to running the program, not to compiling it
+	_, _, err := EvalGoCode("for {}", time.Second)
+	require.EqualError(t, err, "timed out after 1s")
+}
+
+func TestHandleCommand_Eval(t *testing.T) {
+	requireGo(t)
+	// keep the build cache of the user, which moves with $HOME
+	cache, err := exec.Command("go", "env", "GOCACHE").Output()
+	require.NoError(t, err)
+	t.Setenv("GOCACHE", strings.TrimSpace(string(cache)))
+	setTestHome(t)
+	m := newTestModel(t)
+	m.client.history = []Message{{Role: "user", Content: "print hello in go"}}
+	m.appendResponse(Message{Role: "assistant", Content: "```go\npackage main\n\nimport \"fmt\"\n\nfunc main() { fmt.Println(\"hello\") }\n```"})
+
+	_, ok := m.handleCommand("/eval")
+	assert.True(t, ok)
+	assert.Contains(t, m.notice, "--allow-go-eval")
+
+	m.allowGoEval = true
+	cmd, ok := m.handleCommand("/eval")
+	assert.True(t, ok)
+	assert.True(t, m.waiting)
+	require.NotNil(t, cmd)
+
+	msgs := batchMessages(cmd)
+	assert.Contains(t, msgs, evalResultMsg{output: "hello"})
+	model, _ := m.Update(evalResultMsg{output: "hello"})
+	m = model.(Model)
+	assert.False(t, m.waiting)
+	assert.Equal(t, Message{Role: "user", Content: "Output:\n```\nhello\n```"}, m.client.history[2])
+}
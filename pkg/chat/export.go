@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// obsidianFolder is the folder of the vault where conversations are exported to
+const obsidianFolder = "GPT Conversations"
+
+// SessionMeta identifies a session without its messages
+type SessionMeta struct {
+	ID    string
+	Title string
+	Tags  []string
+}
+
+// Meta returns the SessionMeta of the session
+func (s Session) Meta() SessionMeta {
+	return SessionMeta{ID: s.ID, Title: s.Title, Tags: s.Tags}
+}
+
+// noteName returns the name of the note for the session, its title or ID
+func (s SessionMeta) noteName() string {
+	name := s.ID
+	if len(strings.TrimSpace(s.Title)) > 0 {
+		name = s.Title
+	}
+	// characters which are not allowed in Obsidian note names
+	return strings.NewReplacer("/", "-", "\\", "-", ":", "-", "#", "", "^", "", "[", "", "]", "", "|", "-").Replace(name)
+}
+
+// ToObsidianNote renders the session as an Obsidian note with frontmatter,
+// a callout block per message and wiki links to the linked sessions
+func ToObsidianNote(session Session, linkedSessions []SessionMeta) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "session_id: %q\n", session.ID)
+	fmt.Fprintf(&b, "date: %s\n", session.CreatedAt.Format("2006-01-02"))
+	if len(session.Metadata.Model) > 0 {
+		fmt.Fprintf(&b, "model: %q\n", session.Metadata.Model)
+	}
+	b.WriteString("tags:\n")
+	for _, tag := range session.Tags {
+		fmt.Fprintf(&b, "  - %q\n", tag)
+	}
+	b.WriteString("---\n\n")
+	fmt.Fprintf(&b, "# %s\n", session.Meta().noteName())
+
+	for _, message := range session.Messages {
+		fmt.Fprintf(&b, "\n> [!%s]\n", message.Role)
+		for _, line := range strings.Split(strings.TrimRight(message.Content, "\n"), "\n") {
+			if len(line) == 0 {
+				b.WriteString(">\n")
+			} else {
+				b.WriteString("> " + line + "\n")
+			}
+		}
+	}
+
+	if len(linkedSessions) > 0 {
+		b.WriteString("\n## Related\n\n")
+		for _, linked := range linkedSessions {
+			fmt.Fprintf(&b, "- [[%s]]\n", linked.noteName())
+		}
+	}
+	return b.String()
+}
+
+// FormatTranscript renders the messages of the session as plain text,
+// each note on a line below its message
+func FormatTranscript(session Session) string {
+	var b strings.Builder
+	for i, message := range session.Messages {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "[%s]\n%s\n", message.Role, strings.TrimRight(message.Content, "\n"))
+		if note, ok := session.Notes[i]; ok {
+			fmt.Fprintf(&b, "✎ %s\n", note)
+		}
+	}
+	return b.String()
+}
+
+// relatedSessions returns the other sessions sharing a tag with the session
+func relatedSessions(session Session, sessions []Session) []SessionMeta {
+	var related []SessionMeta
+	for _, other := range sessions {
+		if other.ID == session.ID {
+			continue
+		}
+		for _, tag := range other.Tags {
+			if slices.Contains(session.Tags, tag) {
+				related = append(related, other.Meta())
+				break
+			}
+		}
+	}
+	return related
+}
+
+// ExportObsidian writes the session file as a note into the vault directory and returns the path of the note.
+// Sessions in historyDir sharing a tag with it are linked.
+func ExportObsidian(filePath, vaultDir, historyDir string) (string, error) {
+	session, err := LoadSession(filePath)
+	if err != nil {
+		return "", err
+	}
+	sessions, err := ListSessions(historyDir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	dir := path.Join(vaultDir, obsidianFolder)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	notePath := path.Join(dir, session.Meta().noteName()+".md")
+	note := ToObsidianNote(*session, relatedSessions(*session, sessions))
+	return notePath, os.WriteFile(notePath, []byte(note), 0644)
+}
@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToObsidianNote(t *testing.T) {
+	session := Session{
+		ID:        "2023-05-01_10-00-00",
+		Title:     "Trip to Japan",
+		CreatedAt: time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC),
+		Metadata:  SessionMetadata{Model: "gpt-4"},
+		Tags:      []string{"travel"},
+		Messages: []Message{
+			{Role: "user", Content: "Where should I go?"},
+			{Role: "assistant", Content: "Kyoto.\n\nIn spring."},
+		},
+	}
+	note := ToObsidianNote(session, []SessionMeta{{ID: "2023-04-01_09-00-00"}})
+
+	assert.Equal(t, `---
+session_id: "2023-05-01_10-00-00"
+date: 2023-05-01
+model: "gpt-4"
+tags:
+  - "travel"
+---
+
+# Trip to Japan
+
+> [!user]
+> Where should I go?
+
+> [!assistant]
+> Kyoto.
+>
+> In spring.
+
+## Related
+
+- [[2023-04-01_09-00-00]]
+`, note)
+}
+
+func TestExportObsidian(t *testing.T) {
+	historyDir := t.TempDir()
+	vaultDir := t.TempDir()
+	sessions := []Session{
+		{ID: "a", Title: "Kyoto: temples", Tags: []string{"travel"}, Messages: []Message{{Role: "user", Content: "Hi"}}},
+		{ID: "b", Tags: []string{"travel", "food"}},
+		{ID: "c", Tags: []string{"work"}},
+	}
+	for _, session := range sessions {
+		session := session
+		assert.NoError(t, SaveSession(path.Join(historyDir, session.ID+".json"), &session))
+	}
+
+	notePath, err := ExportObsidian(path.Join(historyDir, "a.json"), vaultDir, historyDir)
+	assert.NoError(t, err)
+	assert.Equal(t, path.Join(vaultDir, "GPT Conversations", "Kyoto- temples.md"), notePath)
+
+	data, err := os.ReadFile(notePath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "[[b]]")
+	assert.NotContains(t, string(data), "[[c]]")
+}
@@ -0,0 +1,34 @@
+package chat
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+// headerHeight is the number of lines of the sticky header above the conversation
+const headerHeight = 2
+
+// headerStyle sets the sticky header apart from the conversation
+var headerStyle = lipgloss.NewStyle().Background(lipgloss.Color("236")).Foreground(lipgloss.Color("252"))
+
+// renderHeader returns the model and an excerpt of the system message, truncated to width,
+// e.g. Model: gpt-4-turbo  System: "You are a helpful…"
+func renderHeader(model, system string, width int) string {
+	text := "Model: " + model + "  System: "
+	if excerpt := strings.Join(strings.Fields(system), " "); len(excerpt) == 0 {
+		text += "(none)"
+	} else if available := width - runewidth.StringWidth(text) - 2; available > 0 {
+		// truncate within the quotes, so that the closing one stays visible
+		text += `"` + runewidth.Truncate(excerpt, available, "…") + `"`
+	} else {
+		text += `"` + excerpt + `"`
+	}
+	return runewidth.Truncate(text, width, "…")
+}
+
+// headerView renders the sticky header followed by a blank line
+func (m Model) headerView() string {
+	return headerStyle.Width(m.viewport.Width).Render(renderHeader(m.client.model, m.client.system, m.viewport.Width)) + "\n"
+}
@@ -0,0 +1,41 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderHeader(t *testing.T) {
+	for _, tt := range []struct {
+		model, system string
+		width         int
+		expected      string
+	}{
+		{"gpt-4-turbo", "", 80, "Model: gpt-4-turbo  System: (none)"},
+		{"gpt-4-turbo", "  \n", 80, "Model: gpt-4-turbo  System: (none)"},
+		{"gpt-4-turbo", "You are a helpful assistant.", 80, `Model: gpt-4-turbo  System: "You are a helpful assistant."`},
+		// the excerpt is truncated within the quotes
+		{"gpt-4-turbo", "You are a helpful assistant.", 48, `Model: gpt-4-turbo  System: "You are a helpful…"`},
+		{"gpt-3.5-turbo", "Answer in French.\nBe concise.", 80, `Model: gpt-3.5-turbo  System: "Answer in French. Be concise."`},
+		// too narrow for the excerpt
+		{"gpt-4-turbo", "You are a helpful assistant.", 20, "Model: gpt-4-turbo …"},
+		{"gpt-4-turbo", "", 10, "Model: gp…"},
+		{"gpt-4", "日本語で答えてください", 35, `Model: gpt-4  System: "日本語で答…"`},
+	} {
+		header := renderHeader(tt.model, tt.system, tt.width)
+		assert.Equal(t, tt.expected, header)
+		assert.LessOrEqual(t, runewidth.StringWidth(header), tt.width, header)
+	}
+}
+
+func TestHeaderView(t *testing.T) {
+	m := newTestModel(t)
+	m.client.system = strings.Repeat("Be helpful. ", 20)
+	lines := strings.Split(m.headerView(), "\n")
+	assert.Len(t, lines, headerHeight)
+	assert.Equal(t, 80, runewidth.StringWidth(ansiPattern.ReplaceAllString(lines[0], "")))
+	assert.True(t, strings.HasSuffix(ansiPattern.ReplaceAllString(lines[0], ""), `…"`))
+}
@@ -0,0 +1,205 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// historyPageSize is the number of messages decoded at once from a session file
+const historyPageSize = 50
+
+// historyLoader decodes the messages of a session file lazily.
+// It records the byte offset where each message ends, so a range of
+// messages can be read later without decoding the whole file again.
+type historyLoader struct {
+	path string
+	// start is the offset right after the opening bracket of the messages array
+	start int64
+	// ends holds the offset right after each message
+	ends []int64
+}
+
+// openHistory scans the session file and returns the session with only the
+// last pageSize messages decoded, together with the loader for the rest
+func openHistory(filePath string, pageSize int) (*Session, *historyLoader, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	loader := &historyLoader{path: filePath}
+	dec := json.NewDecoder(f)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fields := map[string]json.RawMessage{}
+	switch tok {
+	case json.Delim('['):
+		// file containing only a list of messages
+		if err := loader.scanMessages(dec); err != nil {
+			return nil, nil, err
+		}
+	case json.Delim('{'):
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, nil, err
+			}
+			if key == "messages" {
+				if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+					return nil, nil, fmt.Errorf("invalid messages in %s", filePath)
+				}
+				if err := loader.scanMessages(dec); err != nil {
+					return nil, nil, err
+				}
+				continue
+			}
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return nil, nil, err
+			}
+			fields[fmt.Sprint(key)] = value
+		}
+	default:
+		return nil, nil, fmt.Errorf("invalid session file %s", filePath)
+	}
+
+	// decode the remaining fields into the session
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, nil, err
+	}
+	if err := session.setDefaults(filePath); err != nil {
+		return nil, nil, err
+	}
+
+	total := len(loader.ends)
+	from := total - pageSize
+	if from < 0 {
+		from = 0
+	}
+	session.Messages, err = loader.messages(from, total)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &session, loader, nil
+}
+
+// scanMessages records the end offset of each message until the closing bracket
+func (l *historyLoader) scanMessages(dec *json.Decoder) error {
+	l.start = dec.InputOffset()
+	for dec.More() {
+		var message json.RawMessage
+		if err := dec.Decode(&message); err != nil {
+			return err
+		}
+		l.ends = append(l.ends, dec.InputOffset())
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// raw returns the JSON of the messages in the range [from, to) separated by commas
+func (l *historyLoader) raw(from, to int) ([]byte, error) {
+	if from >= to {
+		return nil, nil
+	}
+	begin := l.start
+	if from > 0 {
+		begin = l.ends[from-1]
+	}
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data := make([]byte, l.ends[to-1]-begin)
+	if _, err := f.ReadAt(data, begin); err != nil && err != io.EOF {
+		return nil, err
+	}
+	// drop the separator left over from the previous message
+	data = bytes.TrimLeft(data, " \t\r\n,")
+	return data, nil
+}
+
+// messages decodes the messages in the range [from, to)
+func (l *historyLoader) messages(from, to int) ([]Message, error) {
+	data, err := l.raw(from, to)
+	if err != nil {
+		return nil, err
+	}
+	messages := []Message{}
+	if len(data) == 0 {
+		return messages, nil
+	}
+	err = json.Unmarshal(append(append([]byte("["), data...), ']'), &messages)
+	return messages, err
+}
+
+// save writes the session to filePath, where the first pending messages of
+// the loader's file which were not decoded yet are put before the session
+// messages. The loader is updated to read from the saved file, with the
+// offsets of the written messages instead of scanning the file again.
+func (l *historyLoader) save(filePath string, session *Session, pending int) error {
+	prefix, err := l.raw(0, pending)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	delete(fields, "messages")
+	data, err = json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	// the messages are written last, so their offsets are known
+	var b bytes.Buffer
+	b.Write(data[:len(data)-1])
+	if len(fields) > 0 {
+		b.WriteByte(',')
+	}
+	b.WriteString(`"messages":[`)
+	start := int64(b.Len())
+	ends := make([]int64, 0, pending+len(session.Messages))
+	for _, end := range l.ends[:pending] {
+		// the prefix ends where the last pending message ends
+		ends = append(ends, start+int64(len(prefix))-(l.ends[pending-1]-end))
+	}
+	b.Write(prefix)
+	for i, message := range session.Messages {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		if i > 0 || len(prefix) > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(data)
+		ends = append(ends, int64(b.Len()))
+	}
+	b.WriteString("]}")
+	if err := os.WriteFile(filePath, b.Bytes(), 0644); err != nil {
+		return err
+	}
+	*l = historyLoader{path: filePath, start: start, ends: ends}
+	return nil
+}
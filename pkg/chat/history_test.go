@@ -0,0 +1,141 @@
+package chat
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeSessionFixture saves a session with n numbered messages
+func writeSessionFixture(t *testing.T, filePath string, n int) {
+	session := &Session{ID: "fixture", CreatedAt: time.Now()}
+	for i := 0; i < n; i++ {
+		session.Messages = append(session.Messages, Message{Role: "user", Content: fmt.Sprintf("message %d", i)})
+	}
+	assert.NoError(t, SaveSession(filePath, session))
+}
+
+func TestOpenHistory_Incremental(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "fixture.json")
+	writeSessionFixture(t, filePath, 1000)
+
+	session, loader, err := openHistory(filePath, historyPageSize)
+	assert.NoError(t, err)
+	assert.Equal(t, "fixture", session.ID)
+	assert.Len(t, loader.ends, 1000)
+	assert.Len(t, session.Messages, 50)
+	assert.Equal(t, "message 950", session.Messages[0].Content)
+	assert.Equal(t, "message 999", session.Messages[49].Content)
+
+	// load older messages page by page
+	offset := 950
+	for offset > 0 {
+		older, err := loader.messages(offset-historyPageSize, offset)
+		assert.NoError(t, err)
+		assert.Len(t, older, 50)
+		assert.Equal(t, fmt.Sprintf("message %d", offset-historyPageSize), older[0].Content)
+		offset -= historyPageSize
+	}
+}
+
+func TestOpenHistory_MessagesOnly(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "2023-05-01_10-00-00.json")
+	data := `[ {"role":"user","content":"a"} , {"role":"assistant","content":"b"} ]`
+	assert.NoError(t, os.WriteFile(filePath, []byte(data), 0644))
+
+	session, loader, err := openHistory(filePath, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "2023-05-01_10-00-00", session.ID)
+	assert.Equal(t, []Message{{Role: "assistant", Content: "b"}}, session.Messages)
+
+	older, err := loader.messages(0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []Message{{Role: "user", Content: "a"}}, older)
+}
+
+func TestHistoryLoader_Save(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "fixture.json")
+	writeSessionFixture(t, filePath, 120)
+
+	session, loader, err := openHistory(filePath, historyPageSize)
+	assert.NoError(t, err)
+	session.Messages = append(session.Messages, Message{Role: "assistant", Content: "new"})
+
+	// the 70 messages which are not loaded yet are kept in the file
+	assert.NoError(t, loader.save(filePath, session, 70))
+	assert.Len(t, loader.ends, 121)
+	// the offsets of the saved messages match a scan of the file
+	_, scanned, err := openHistory(filePath, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, scanned, loader)
+
+	saved, err := LoadSession(filePath)
+	assert.NoError(t, err)
+	assert.Len(t, saved.Messages, 121)
+	for i := 0; i < 120; i++ {
+		assert.Equal(t, fmt.Sprintf("message %d", i), saved.Messages[i].Content)
+	}
+	assert.Equal(t, "new", saved.Messages[120].Content)
+}
+
+func TestArchiveHistory(t *testing.T) {
+	setTestHome(t)
+	m := newTestModel(t)
+	m.sessionId = "archive"
+	m.maxHistoryMemory = 1000
+	for i := 0; i < 999; i++ {
+		m.client.history = append(m.client.history, Message{Role: "user", Content: fmt.Sprintf("message %d", i)})
+	}
+	assert.NoError(t, m.archiveHistory())
+	assert.Len(t, m.client.history, 999)
+
+	m.client.history = append(m.client.history, Message{Role: "assistant", Content: "message 999"})
+	assert.NoError(t, m.archiveHistory())
+	// the oldest 200 messages are archived and the most recent 800 are kept
+	assert.Len(t, m.client.history, 800)
+	assert.Equal(t, 200, m.historyOffset)
+	assert.Equal(t, "message 200", m.client.history[0].Content)
+	assert.Equal(t, "message 999", m.client.history[799].Content)
+
+	// the session file holds both the archived and the kept messages
+	m.client.history = append(m.client.history, Message{Role: "user", Content: "message 1000"})
+	assert.NoError(t, m.saveHistory())
+	filePath, err := m.historyPath()
+	assert.NoError(t, err)
+	saved, err := LoadSession(filePath)
+	assert.NoError(t, err)
+	assert.Len(t, saved.Messages, 1001)
+	for i, message := range saved.Messages {
+		assert.Equal(t, fmt.Sprintf("message %d", i), message.Content)
+	}
+
+	// scrolling up at the top loads the archived messages back
+	assert.NoError(t, m.loadOlderMessages())
+	assert.Equal(t, 150, m.historyOffset)
+	assert.Equal(t, "message 150", m.client.history[0].Content)
+}
+
+func TestArchiveHistory_KeepsOneMessage(t *testing.T) {
+	setTestHome(t)
+	m := newTestModel(t)
+	m.sessionId = "archive"
+	m.maxHistoryMemory = 1
+	m.client.history = []Message{{Role: "user", Content: "message 0"}}
+	assert.NoError(t, m.archiveHistory())
+	assert.Len(t, m.client.history, 1)
+
+	for i := 1; i < 3; i++ {
+		m.client.history = append(m.client.history, Message{Role: "user", Content: fmt.Sprintf("message %d", i)})
+		assert.NoError(t, m.archiveHistory())
+		assert.Equal(t, []Message{{Role: "user", Content: fmt.Sprintf("message %d", i)}}, m.client.history)
+		assert.Equal(t, i, m.historyOffset)
+	}
+
+	older, err := sessionStorage.messages(m.historyLoader, 0, m.historyOffset)
+	assert.NoError(t, err)
+	assert.Equal(t, []Message{{Role: "user", Content: "message 0"}, {Role: "user", Content: "message 1"}}, older)
+}
@@ -0,0 +1,134 @@
+package chat
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// imagesMsg carries the paths of the generated images
+type imagesMsg []string
+
+// imagesDir returns the directory where generated images are saved
+func imagesDir() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, "images"), nil
+}
+
+// SaveImages decodes the base64 images and saves them as PNG files
+func SaveImages(images []ImageResult) ([]string, error) {
+	dir, err := imagesDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	timestamp := timeNow().Format("2006-01-02_15-04-05")
+	var paths []string
+	for i, image := range images {
+		data, err := base64.StdEncoding.DecodeString(image.B64JSON)
+		if err != nil {
+			return nil, err
+		}
+		name := timestamp
+		if len(images) > 1 {
+			name = fmt.Sprintf("%s_%d", timestamp, i+1)
+		}
+		f, err := createImageFile(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		_, err = f.Write(data)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, f.Name())
+	}
+	return paths, nil
+}
+
+// createImageFile creates the PNG file of the name in dir, with a -2, -3… suffix if
+// the file exists, e.g. when images are generated twice in the same second
+func createImageFile(dir, name string) (*os.File, error) {
+	for n := 1; ; n++ {
+		filePath := path.Join(dir, name+".png")
+		if n > 1 {
+			filePath = path.Join(dir, fmt.Sprintf("%s-%d.png", name, n))
+		}
+		f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !errors.Is(err, fs.ErrExist) {
+			return f, err
+		}
+	}
+}
+
+// OpenFile opens the file with the default application of the platform.
+// The launcher process is waited for in the background, so it does not linger as a zombie.
+func OpenFile(filePath string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", filePath)
+	case "windows":
+		cmd = exec.Command("explorer", filePath)
+	default:
+		cmd = exec.Command("xdg-open", filePath)
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// openFilesCmd returns a tea.Cmd which opens the files with the default application
+func openFilesCmd(paths []string) tea.Cmd {
+	return func() tea.Msg {
+		for _, filePath := range paths {
+			if err := OpenFile(filePath); err != nil {
+				logger.Warn("failed to open image", "path", filePath, "error", err)
+			}
+		}
+		return nil
+	}
+}
+
+// shortenHome replaces the home directory prefix of the path with "~"
+func shortenHome(filePath string) string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil || !strings.HasPrefix(filePath, homeDir) {
+		return filePath
+	}
+	return "~" + strings.TrimPrefix(filePath, homeDir)
+}
+
+// imagineCmd returns a tea.Cmd which generates and saves images for the prompt
+func imagineCmd(client *Client, prompt string, size string, n int) tea.Cmd {
+	return func() tea.Msg {
+		images, err := client.GenerateImage(prompt, size, n)
+		if err != nil {
+			return err
+		}
+		paths, err := SaveImages(images)
+		if err != nil {
+			return err
+		}
+		return imagesMsg(paths)
+	}
+}
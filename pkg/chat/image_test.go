@@ -0,0 +1,49 @@
+package chat
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveImages(t *testing.T) {
+	setTestHome(t)
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	timeNow = func() time.Time { return time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC) }
+	image := ImageResult{B64JSON: base64.StdEncoding.EncodeToString([]byte("png"))}
+
+	paths, err := SaveImages([]ImageResult{image, image})
+	require.NoError(t, err)
+	require.Len(t, paths, 2)
+	assert.Equal(t, "2023-05-01_12-00-00_1.png", filepath.Base(paths[0]))
+	assert.Equal(t, "2023-05-01_12-00-00_2.png", filepath.Base(paths[1]))
+
+	// the images generated in the same second do not overwrite each other
+	paths, err = SaveImages([]ImageResult{image, image})
+	require.NoError(t, err)
+	assert.Equal(t, "2023-05-01_12-00-00_1-2.png", filepath.Base(paths[0]))
+	assert.Equal(t, "2023-05-01_12-00-00_2-2.png", filepath.Base(paths[1]))
+	data, err := os.ReadFile(paths[1])
+	require.NoError(t, err)
+	assert.Equal(t, "png", string(data))
+
+	paths, err = SaveImages([]ImageResult{image})
+	require.NoError(t, err)
+	assert.Equal(t, "2023-05-01_12-00-00.png", filepath.Base(paths[0]))
+}
+
+func TestUpdate_ImagesOpenedByCommand(t *testing.T) {
+	m := newTestModel(t)
+	m.waiting = true
+	model, cmd := m.Update(imagesMsg{"/tmp/a.png"})
+	m = model.(Model)
+	assert.False(t, m.waiting)
+	assert.Contains(t, m.notice, "🖼 Image saved: /tmp/a.png")
+	// the image is opened outside of the update
+	assert.NotNil(t, cmd)
+}
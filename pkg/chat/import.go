@@ -0,0 +1,229 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/imfing/gptui/pkg/rest"
+)
+
+// maxImportSize is the maximum size of an imported session file in bytes
+const maxImportSize = 256 << 20
+
+// chatGPTConversation is a conversation of the ChatGPT data export
+type chatGPTConversation struct {
+	Title       string                 `json:"title"`
+	CreateTime  float64                `json:"create_time"`
+	CurrentNode string                 `json:"current_node"`
+	Mapping     map[string]chatGPTNode `json:"mapping"`
+}
+
+// chatGPTNode is a node of the message tree of a ChatGPT conversation
+type chatGPTNode struct {
+	Parent  string `json:"parent"`
+	Message *struct {
+		Author struct {
+			Role string `json:"role"`
+		} `json:"author"`
+		Content struct {
+			Parts []json.RawMessage `json:"parts"`
+		} `json:"content"`
+	} `json:"message"`
+}
+
+// messages returns the messages on the path from the root to the current node.
+// It fails if the path loops back to one of its nodes.
+func (c chatGPTConversation) messages() ([]Message, error) {
+	var messages []Message
+	visited := map[string]bool{}
+	for id := c.CurrentNode; len(id) > 0; id = c.Mapping[id].Parent {
+		if visited[id] {
+			return nil, fmt.Errorf("conversation %q has a cycle at node %s", c.Title, id)
+		}
+		visited[id] = true
+		node, ok := c.Mapping[id]
+		if !ok || node.Message == nil {
+			continue
+		}
+		var parts []string
+		for _, raw := range node.Message.Content.Parts {
+			// non-text parts such as images are skipped
+			var part string
+			if json.Unmarshal(raw, &part) == nil && len(part) > 0 {
+				parts = append(parts, part)
+			}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+		messages = append(messages, Message{Role: node.Message.Author.Role, Content: strings.Join(parts, "\n")})
+	}
+	// reverse the messages to chronological order
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+// parseSessions parses the sessions of a gptui session file or a ChatGPT data export
+func parseSessions(data []byte) ([]Session, error) {
+	var probe any
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+
+	var sessions []Session
+	switch v := probe.(type) {
+	case map[string]any:
+		if _, ok := v["mapping"]; ok {
+			var conversation chatGPTConversation
+			if err := json.Unmarshal(data, &conversation); err != nil {
+				return nil, err
+			}
+			session, err := conversation.session()
+			if err != nil {
+				return nil, err
+			}
+			sessions = append(sessions, session)
+		} else {
+			var session Session
+			if err := json.Unmarshal(data, &session); err != nil {
+				return nil, err
+			}
+			sessions = append(sessions, session)
+		}
+	case []any:
+		if len(v) > 0 {
+			if first, ok := v[0].(map[string]any); ok && first["mapping"] != nil {
+				var conversations []chatGPTConversation
+				if err := json.Unmarshal(data, &conversations); err != nil {
+					return nil, err
+				}
+				for _, conversation := range conversations {
+					session, err := conversation.session()
+					if err != nil {
+						return nil, err
+					}
+					sessions = append(sessions, session)
+				}
+				break
+			}
+		}
+		var session Session
+		if err := json.Unmarshal(data, &session.Messages); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	default:
+		return nil, errors.New("unsupported session format")
+	}
+
+	for i := range sessions {
+		// tool results cannot be sent again without the tool calls they answer
+		sessions[i].Messages = slices.DeleteFunc(sessions[i].Messages, func(message Message) bool { return message.Role == "tool" })
+		if err := sessions[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	return sessions, nil
+}
+
+// session converts the conversation to a Session
+func (c chatGPTConversation) session() (Session, error) {
+	messages, err := c.messages()
+	if err != nil {
+		return Session{}, err
+	}
+	session := Session{Title: c.Title, Messages: messages}
+	if c.CreateTime > 0 {
+		sec := int64(c.CreateTime)
+		session.CreatedAt = time.Unix(sec, int64((c.CreateTime-float64(sec))*1e9))
+	}
+	return session, nil
+}
+
+// validate checks that the session contains valid messages
+func (s Session) validate() error {
+	if len(s.Messages) == 0 {
+		return errors.New("session has no messages")
+	}
+	for i, message := range s.Messages {
+		switch message.Role {
+		case "system", "user", "assistant":
+		default:
+			return fmt.Errorf("message %d has invalid role %q", i, message.Role)
+		}
+	}
+	return nil
+}
+
+// ImportSessions fetches a session file from the URL and saves it as new sessions in historyDir.
+// If user is not empty, the request is sent with basic authentication.
+func ImportSessions(url, user, password, historyDir string) ([]string, error) {
+	client := rest.NewClient(rest.WithBaseURL(url), rest.WithTimeout(time.Minute))
+	var opts []rest.RequestOption
+	if len(user) > 0 {
+		opts = append(opts, rest.WithBasicAuth(user, password))
+	}
+	req, err := client.NewRequest("", opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImportSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImportSize {
+		return nil, fmt.Errorf("session file is larger than %d MB", maxImportSize>>20)
+	}
+
+	sessions, err := parseSessions(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session file: %w", err)
+	}
+
+	if err := os.MkdirAll(historyDir, 0755); err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, session := range sessions {
+		if session.CreatedAt.IsZero() {
+			session.CreatedAt = time.Now()
+		}
+		// imported sessions always get a new ID so existing ones are not overwritten
+		session.ID = session.CreatedAt.Format(sessionTimeLayout)
+		filePath := path.Join(historyDir, session.ID+".json")
+		for i := 2; fileExists(filePath); i++ {
+			session.ID = fmt.Sprintf("%s_%d", session.CreatedAt.Format(sessionTimeLayout), i)
+			filePath = path.Join(historyDir, session.ID+".json")
+		}
+		if err := SaveSession(filePath, &session); err != nil {
+			return nil, err
+		}
+		paths = append(paths, filePath)
+	}
+	return paths, nil
+}
+
+// fileExists reports whether the file exists
+func fileExists(filePath string) bool {
+	_, err := os.Stat(filePath)
+	return err == nil
+}
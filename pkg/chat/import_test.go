@@ -0,0 +1,117 @@
+package chat
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportSessions(t *testing.T) {
+	fixture := `{"id":"2023-05-01_10-00-00","created_at":"2023-05-01T10:00:00Z","messages":[{"role":"user","content":"Hello"},{"role":"assistant","content":"Hi"}]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "alice" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(fixture))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	_, err := ImportSessions(server.URL+"/session.json", "", "", dir)
+	assert.Error(t, err)
+
+	paths, err := ImportSessions(server.URL+"/session.json", "alice", "secret", dir)
+	assert.NoError(t, err)
+	assert.Len(t, paths, 1)
+
+	m := newTestModel(t)
+	assert.NoError(t, m.loadHistory(paths[0]))
+	assert.Equal(t, []Message{{Role: "user", Content: "Hello"}, {Role: "assistant", Content: "Hi"}}, m.client.history)
+
+	// importing again does not overwrite the first session
+	paths2, err := ImportSessions(server.URL+"/session.json", "alice", "secret", dir)
+	assert.NoError(t, err)
+	assert.NotEqual(t, paths[0], paths2[0])
+}
+
+func TestParseSessions_ChatGPTExport(t *testing.T) {
+	data := `[{
+		"title": "Greeting",
+		"create_time": 1682935200.5,
+		"current_node": "c",
+		"mapping": {
+			"root": {"parent": null, "message": null},
+			"a": {"parent": "root", "message": {"author": {"role": "user"}, "content": {"parts": ["Hello"]}}},
+			"b": {"parent": "a", "message": {"author": {"role": "assistant"}, "content": {"parts": ["Hi", {"asset": "image"}]}}},
+			"c": {"parent": "b", "message": {"author": {"role": "user"}, "content": {"parts": ["Bye"]}}}
+		}
+	}]`
+	sessions, err := parseSessions([]byte(data))
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, []Message{
+		{Role: "user", Content: "Hello"},
+		{Role: "assistant", Content: "Hi"},
+		{Role: "user", Content: "Bye"},
+	}, sessions[0].Messages)
+	assert.Equal(t, int64(1682935200), sessions[0].CreatedAt.Unix())
+}
+
+func TestParseSessions_ChatGPTExportCycle(t *testing.T) {
+	data := `{
+		"title": "Loop",
+		"current_node": "b",
+		"mapping": {
+			"a": {"parent": "b", "message": {"author": {"role": "user"}, "content": {"parts": ["Hello"]}}},
+			"b": {"parent": "a", "message": {"author": {"role": "assistant"}, "content": {"parts": ["Hi"]}}}
+		}
+	}`
+	_, err := parseSessions([]byte(data))
+	assert.EqualError(t, err, `conversation "Loop" has a cycle at node b`)
+}
+
+func TestParseSessions_ToolMessage(t *testing.T) {
+	// the tool results are dropped, they cannot be sent without their tool calls
+	data := `[{"role":"user","content":"Weather?"},{"role":"tool","content":"sunny"},{"role":"assistant","content":"It is sunny."}]`
+	sessions, err := parseSessions([]byte(data))
+	assert.NoError(t, err)
+	assert.Equal(t, []Message{{Role: "user", Content: "Weather?"}, {Role: "assistant", Content: "It is sunny."}}, sessions[0].Messages)
+
+	data = `{
+		"title": "Browsing",
+		"current_node": "c",
+		"mapping": {
+			"a": {"parent": "", "message": {"author": {"role": "user"}, "content": {"parts": ["News?"]}}},
+			"b": {"parent": "a", "message": {"author": {"role": "tool"}, "content": {"parts": ["search results"]}}},
+			"c": {"parent": "b", "message": {"author": {"role": "assistant"}, "content": {"parts": ["Nothing new."]}}}
+		}
+	}`
+	sessions, err = parseSessions([]byte(data))
+	assert.NoError(t, err)
+	assert.Equal(t, []Message{{Role: "user", Content: "News?"}, {Role: "assistant", Content: "Nothing new."}}, sessions[0].Messages)
+
+	_, err = parseSessions([]byte(`[{"role":"tool","content":"sunny"}]`))
+	assert.EqualError(t, err, "session has no messages")
+}
+
+func TestImportSessions_TooLarge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte(" "), maxImportSize+1))
+	}))
+	defer server.Close()
+
+	_, err := ImportSessions(server.URL+"/session.json", "", "", t.TempDir())
+	assert.EqualError(t, err, "session file is larger than 256 MB")
+}
+
+func TestParseSessions_Invalid(t *testing.T) {
+	for _, data := range []string{`not json`, `"text"`, `{"messages":[]}`, `[{"role":"robot","content":"beep"}]`} {
+		_, err := parseSessions([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
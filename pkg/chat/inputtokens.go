@@ -0,0 +1,70 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// inputTokensDelay is the time without change of the input after which its tokens are counted
+const inputTokensDelay = 100 * time.Millisecond
+
+// inputTokensMsg is sent inputTokensDelay after the change seq of the input
+type inputTokensMsg struct {
+	seq int
+}
+
+// inputChanged schedules the count of the tokens of the input. The count is skipped
+// if the input changes again before, so that it runs once the typing pauses.
+func (m *Model) inputChanged() tea.Cmd {
+	m.inputSeq++
+	seq := m.inputSeq
+	return tea.Tick(inputTokensDelay, func(time.Time) tea.Msg {
+		return inputTokensMsg{seq: seq}
+	})
+}
+
+// countInputTokens counts the tokens of the input unless it changed after msg was scheduled
+func (m *Model) countInputTokens(msg inputTokensMsg) {
+	if msg.seq != m.inputSeq {
+		return
+	}
+	m.inputTokens = m.tokenCounter.Count(m.textarea.Value())
+}
+
+// inputTokensExceeded reports whether the input has more tokens than --warn-input-tokens
+func (m Model) inputTokensExceeded() bool {
+	return m.warnInputTokens > 0 && m.inputTokens > m.warnInputTokens
+}
+
+// inputView renders the textarea with the characters and estimated tokens of the input in its
+// top border, which turns amber when the tokens exceed the threshold
+func (m Model) inputView() string {
+	ta := m.textarea
+	value := ta.Value()
+	if !ta.Focused() || len(value) == 0 {
+		return ta.View()
+	}
+	color := textAreaStyle.GetBorderTopForeground()
+	if m.inputTokensExceeded() {
+		color = warnStyle.GetForeground()
+		// the textarea renders with the style it was focused with
+		ta.FocusedStyle.Base = textAreaStyle.Copy().BorderForeground(color)
+		ta.Focus()
+	}
+	view := ta.View()
+	top, rest, _ := strings.Cut(view, "\n")
+	width := lipgloss.Width(top)
+	title := fmt.Sprintf(" chars: %d ≈ %d tokens ", utf8.RuneCountInString(value), m.inputTokens)
+	border := lipgloss.RoundedBorder()
+	fill := width - lipgloss.Width(title) - 3
+	if fill < 0 {
+		return view
+	}
+	top = border.TopLeft + border.Top + title + strings.Repeat(border.Top, fill) + border.TopRight
+	return lipgloss.NewStyle().Foreground(color).Render(top) + "\n" + rest
+}
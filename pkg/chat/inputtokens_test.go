@@ -0,0 +1,69 @@
+package chat
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate_InputTokensDebounce(t *testing.T) {
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+
+	var ticks []tea.Cmd
+	for _, r := range "one two" {
+		model, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = model.(Model)
+		ticks = append(ticks, cmd)
+	}
+	assert.Equal(t, 7, m.inputSeq)
+	assert.Zero(t, m.inputTokens)
+
+	// the counts scheduled before the last change are skipped
+	model, _ := m.Update(inputTokensMsg{seq: 3})
+	m = model.(Model)
+	assert.Zero(t, m.inputTokens)
+
+	var msg tea.Msg
+	for _, msg = range batchMessages(ticks[len(ticks)-1]) {
+		if _, ok := msg.(inputTokensMsg); ok {
+			break
+		}
+	}
+	require.Equal(t, inputTokensMsg{seq: 7}, msg)
+	model, cmd := m.Update(msg)
+	m = model.(Model)
+	assert.Equal(t, 2, m.inputTokens)
+	// messages which do not change the input schedule no count
+	assert.Nil(t, cmd)
+	assert.Contains(t, ansiPattern.ReplaceAllString(m.inputView(), ""), "╭─ chars: 7 ≈ 2 tokens ─")
+}
+
+func TestInputView_WarnInputTokens(t *testing.T) {
+	lipgloss.SetColorProfile(termenv.ANSI256)
+	defer lipgloss.SetColorProfile(termenv.Ascii)
+
+	m := newTestModel(t)
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.warnInputTokens = 2
+	m.textarea.SetValue("one two")
+	m.countInputTokens(inputTokensMsg{})
+	assert.False(t, m.inputTokensExceeded())
+	assert.NotContains(t, m.inputView(), "38;5;214")
+
+	m.textarea.SetValue("one two three")
+	m.countInputTokens(inputTokensMsg{})
+	assert.True(t, m.inputTokensExceeded())
+	assert.Contains(t, m.inputView(), "38;5;214")
+
+	// the threshold is disabled with 0
+	m.warnInputTokens = 0
+	assert.False(t, m.inputTokensExceeded())
+}
@@ -0,0 +1,129 @@
+package chat
+
+import (
+	"strings"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// languageNames are the names of the languages responses are detected as, by ISO 639-1 code
+var languageNames = map[string]string{
+	"ar": "Arabic", "de": "German", "en": "English", "es": "Spanish", "fr": "French",
+	"hi": "Hindi", "id": "Indonesian", "it": "Italian", "ja": "Japanese", "ko": "Korean",
+	"nl": "Dutch", "pl": "Polish", "pt": "Portuguese", "ru": "Russian", "sv": "Swedish",
+	"tr": "Turkish", "uk": "Ukrainian", "vi": "Vietnamese", "zh": "Chinese",
+}
+
+// stopWords are the most frequent words of the languages written in the Latin script.
+// A text is detected as the language of which it contains the most words.
+var stopWords = map[string][]string{
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "sich", "auf", "für", "ich", "sie", "es", "wie", "auch", "dem"},
+	"en": {"the", "and", "is", "are", "of", "to", "that", "it", "you", "for", "with", "this", "was", "not", "be", "have", "how", "what", "does", "if", "an", "your"},
+	"es": {"el", "la", "los", "las", "de", "que", "y", "en", "es", "un", "una", "por", "con", "para", "no", "se", "del", "como", "está", "pero"},
+	"fr": {"le", "la", "les", "des", "est", "une", "un", "et", "du", "pour", "pas", "que", "qui", "dans", "vous", "nous", "je", "ce", "il", "avec", "sur", "comment", "bonjour"},
+	"id": {"yang", "dan", "di", "ini", "itu", "dengan", "untuk", "tidak", "dari", "dalam", "akan", "ada", "saya", "anda", "apa", "bagaimana", "juga", "ke", "bisa", "kami"},
+	"it": {"il", "lo", "la", "gli", "di", "che", "è", "e", "un", "una", "per", "non", "sono", "con", "come", "del", "della", "questo", "anche", "ma"},
+	"nl": {"de", "het", "een", "en", "is", "van", "dat", "niet", "op", "te", "zijn", "met", "voor", "ik", "je", "wat", "hoe", "er", "maar", "ook"},
+	"pl": {"i", "w", "z", "na", "się", "nie", "to", "jest", "że", "do", "jak", "co", "ale", "o", "czy", "tak", "dla", "od", "po", "są"},
+	"pt": {"o", "os", "as", "de", "que", "e", "é", "um", "uma", "para", "não", "com", "do", "da", "em", "se", "por", "mais", "como", "você"},
+	"sv": {"och", "att", "det", "som", "en", "är", "på", "för", "med", "inte", "jag", "till", "av", "har", "den", "om", "du", "vad", "hur", "kan"},
+	"tr": {"bir", "ve", "bu", "için", "ile", "da", "de", "ne", "çok", "olarak", "değil", "var", "mı", "mi", "ben", "sen", "gibi", "daha", "nasıl", "ama"},
+	"vi": {"của", "là", "và", "không", "có", "được", "những", "một", "trong", "này", "cho", "với", "các", "tôi", "bạn", "người", "thể", "đã", "khi", "như"},
+}
+
+// detectLanguage returns the lowercase ISO 639-1 code and the name of the primary language of the text.
+// The languages of other scripts than Latin are detected by their script, the others by their stop words.
+func detectLanguage(text string) (code string, name string, ok bool) {
+	scripts := map[string]int{}
+	for _, r := range text {
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			scripts["ja"]++
+		case unicode.Is(unicode.Han, r):
+			scripts["zh"]++
+		case unicode.Is(unicode.Hangul, r):
+			scripts["ko"]++
+		case unicode.Is(unicode.Arabic, r):
+			scripts["ar"]++
+		case unicode.Is(unicode.Devanagari, r):
+			scripts["hi"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			scripts["ru"]++
+		case unicode.Is(unicode.Latin, r):
+			scripts["latin"]++
+		}
+	}
+	code = mostFrequent(scripts)
+	switch code {
+	case "":
+		return "", "", false
+	case "latin":
+		code = detectLatinLanguage(text)
+		if len(code) == 0 {
+			return "", "", false
+		}
+	case "zh":
+		// Japanese mixes kanji with kana
+		if scripts["ja"] > 0 {
+			code = "ja"
+		}
+	case "ru":
+		if strings.ContainsAny(strings.ToLower(text), "іїєґ") {
+			code = "uk"
+		}
+	}
+	return code, languageNames[code], true
+}
+
+// detectLatinLanguage returns the language of which the text contains the most stop words,
+// or an empty string if none or several do
+func detectLatinLanguage(text string) string {
+	words := map[string]int{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		words[word]++
+	}
+	scores := map[string]int{}
+	for code, stops := range stopWords {
+		for _, word := range stops {
+			scores[code] += words[word]
+		}
+	}
+	return mostFrequent(scores)
+}
+
+// mostFrequent returns the key with the highest count, or an empty string if the highest count is zero or tied
+func mostFrequent(counts map[string]int) string {
+	var most string
+	var highest int
+	tied := false
+	for key, count := range counts {
+		switch {
+		case count > highest:
+			most, highest, tied = key, count, false
+		case count == highest:
+			tied = true
+		}
+	}
+	if highest == 0 || tied {
+		return ""
+	}
+	return most
+}
+
+// languageMsg is the language detected in the assistant response with the message ID
+type languageMsg struct {
+	id         string
+	code, name string
+}
+
+// detectLanguageCmd returns a tea.Cmd which detects the language of the response with the message ID
+func detectLanguageCmd(id string, content string) tea.Cmd {
+	return func() tea.Msg {
+		code, name, ok := detectLanguage(content)
+		if !ok {
+			return nil
+		}
+		return languageMsg{id: id, code: code, name: name}
+	}
+}
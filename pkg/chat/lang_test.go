@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	for _, tt := range []struct {
+		text, code, name string
+	}{
+		{"Hello, how are you today?", "en", "English"},
+		{"The function returns an error if the file does not exist.", "en", "English"},
+		{"Bonjour, comment allez-vous aujourd'hui ?", "fr", "French"},
+		{"La fonction renvoie une erreur si le fichier n'existe pas.", "fr", "French"},
+		{"Die Funktion gibt einen Fehler zurück, wenn die Datei nicht existiert.", "de", "German"},
+		{"La función devuelve un error si el archivo no existe.", "es", "Spanish"},
+		{"Функция возвращает ошибку, если файл не существует.", "ru", "Russian"},
+		{"Функція повертає помилку, якщо файл не існує.", "uk", "Ukrainian"},
+		{"如果文件不存在，函数返回错误。", "zh", "Chinese"},
+		{"ファイルが存在しない場合、関数はエラーを返します。", "ja", "Japanese"},
+		{"파일이 없으면 함수가 오류를 반환합니다.", "ko", "Korean"},
+	} {
+		code, name, ok := detectLanguage(tt.text)
+		assert.True(t, ok, tt.text)
+		assert.Equal(t, tt.code, code, tt.text)
+		assert.Equal(t, tt.name, name, tt.text)
+	}
+
+	_, _, ok := detectLanguage("12345 !!!")
+	assert.False(t, ok)
+	// no stop words
+	_, _, ok = detectLanguage("fmt.Println(x)")
+	assert.False(t, ok)
+}
+
+func TestUpdate_LanguageMsg(t *testing.T) {
+	m := newTestModel(t)
+	m.expectedLang = "en"
+	m.client.history = []Message{
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello!"},
+		{Role: "user", Content: "En français ?"},
+		{Role: "assistant", Content: "Bonjour !"},
+	}
+
+	model, _ := m.Update(languageMsg{id: "2", code: "en", name: "English"})
+	m = model.(Model)
+	assert.Equal(t, "en", m.lang)
+	assert.Contains(t, m.statusView(), "lang: en")
+	assert.Empty(t, m.notice)
+	assert.False(t, m.langMismatch)
+
+	model, _ = m.Update(languageMsg{id: "4", code: "fr", name: "French"})
+	m = model.(Model)
+	assert.Contains(t, m.statusView(), "lang: fr")
+	assert.Equal(t, "🌐 language changed to French", m.notice)
+	assert.True(t, m.langMismatch)
+	assert.Contains(t, m.viewport.View(), "╭")
+
+	// the mismatch stays on its message when the history is paged
+	m.client.history = m.client.history[2:]
+	m.historyOffset = 2
+	content, err := m.renderMessages(m.client.history)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(content, "╭"))
+	assert.Less(t, strings.Index(content, "Bonjour"), strings.Index(content, "╰"))
+}
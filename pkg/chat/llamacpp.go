@@ -0,0 +1,122 @@
+package chat
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Backend generates completions in place of the chat completion API
+type Backend interface {
+	// Complete streams the completion of the request into events until it finishes or done is closed
+	Complete(request *CompletionRequest, events chan<- CompletionStreamResponse, done <-chan struct{}) error
+	// Close stops the running completion
+	Close() error
+}
+
+// defaultLlamaCppCommand is the llama.cpp command line program
+const defaultLlamaCppCommand = "llama-cli"
+
+// LlamaCppBackend runs a local GGUF model with the llama.cpp command line program
+type LlamaCppBackend struct {
+	// Command is the llama.cpp program, llama-cli if empty
+	Command string
+	// Args are passed to the program before the generated arguments
+	Args      []string
+	ModelPath string
+
+	mu  sync.Mutex
+	cmd *exec.Cmd
+}
+
+// formatLlamaPrompt formats the messages as a USER/ASSISTANT transcript ending with the assistant's turn
+func formatLlamaPrompt(messages []Message) string {
+	var b strings.Builder
+	for _, message := range messages {
+		fmt.Fprintf(&b, "%s: %s\n", strings.ToUpper(message.Role), message.Content)
+	}
+	b.WriteString("ASSISTANT:")
+	return b.String()
+}
+
+// Complete runs the program for the request and streams its output line by line
+func (b *LlamaCppBackend) Complete(request *CompletionRequest, events chan<- CompletionStreamResponse, done <-chan struct{}) error {
+	command := b.Command
+	if len(command) == 0 {
+		command = defaultLlamaCppCommand
+	}
+	args := append(append([]string{}, b.Args...), "-m", b.ModelPath, "-p", formatLlamaPrompt(request.Messages), "--no-display-prompt")
+	if request.MaxTokens > 0 {
+		args = append(args, "-n", strconv.Itoa(request.MaxTokens))
+	}
+
+	cmd := exec.Command(command, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	if err := cmd.Start(); err != nil {
+		b.mu.Unlock()
+		return err
+	}
+	b.cmd = cmd
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.cmd = nil
+		b.mu.Unlock()
+	}()
+	logger.Debug("started llama.cpp", "command", command, "model", b.ModelPath, "messages", len(request.Messages))
+
+	send := func(delta string, finishReason string) bool {
+		event := CompletionStreamResponse{Choices: []CompletionStreamChoice{{
+			Delta:        CompletionStreamDelta{Content: delta},
+			FinishReason: finishReason,
+		}}}
+		select {
+		case events <- event:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	lines := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		// the model starts the next turn of the user
+		if strings.HasPrefix(line, "USER:") {
+			cmd.Process.Kill()
+			break
+		}
+		if lines > 0 {
+			line = "\n" + line
+		}
+		lines++
+		if !send(line, "") {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return nil
+		}
+	}
+	if err := cmd.Wait(); err != nil && lines == 0 {
+		return fmt.Errorf("llama.cpp failed: %w", err)
+	}
+	send("", "stop")
+	return nil
+}
+
+// Close kills the running program
+func (b *LlamaCppBackend) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cmd == nil || b.cmd.Process == nil {
+		return nil
+	}
+	return b.cmd.Process.Kill()
+}
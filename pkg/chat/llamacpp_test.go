@@ -0,0 +1,92 @@
+package chat
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLlamaCppHelperProcess is run as the mock llama.cpp program by the tests below
+func TestLlamaCppHelperProcess(t *testing.T) {
+	mode := os.Getenv("GPTUI_LLAMACPP_HELPER")
+	if len(mode) == 0 {
+		return
+	}
+	switch mode {
+	case "answer":
+		fmt.Println("Hello!")
+		fmt.Println("How can I help?")
+		fmt.Println("USER: tell me a joke")
+		fmt.Println("never sent")
+	case "compact":
+		fmt.Println(`[{"role":"system","content":"The user plans a trip to Kyoto in spring."}]`)
+	case "hang":
+		fmt.Println("thinking")
+		time.Sleep(time.Minute)
+	}
+	os.Exit(0)
+}
+
+func newTestLlamaCppClient(t *testing.T, mode string) *Client {
+	t.Setenv("GPTUI_LLAMACPP_HELPER", mode)
+	client := NewChatClient("", "", "llama", "", true, 1024)
+	client.backend = &LlamaCppBackend{
+		Command:   os.Args[0],
+		Args:      []string{"-test.run=TestLlamaCppHelperProcess", "--"},
+		ModelPath: "model.gguf",
+	}
+	return client
+}
+
+func TestFormatLlamaPrompt(t *testing.T) {
+	prompt := formatLlamaPrompt([]Message{
+		{Role: "system", Content: "Be nice."},
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello"},
+		{Role: "user", Content: "How are you?"},
+	})
+	assert.Equal(t, "SYSTEM: Be nice.\nUSER: Hi\nASSISTANT: Hello\nUSER: How are you?\nASSISTANT:", prompt)
+}
+
+func TestLlamaCppBackend_Stream(t *testing.T) {
+	client := newTestLlamaCppClient(t, "answer")
+	errs := make(chan error)
+	go func() {
+		_, err := client.CreateCompletion(&CompletionRequest{Messages: []Message{{Role: "user", Content: "Hi"}}})
+		errs <- err
+	}()
+
+	var content strings.Builder
+	for {
+		event := <-client.events
+		choice := event.Choices[0]
+		if len(choice.FinishReason) > 0 {
+			assert.Equal(t, "stop", choice.FinishReason)
+			break
+		}
+		content.WriteString(choice.Delta.Content)
+	}
+	assert.NoError(t, <-errs)
+	assert.Equal(t, "Hello!\nHow can I help?", content.String())
+}
+
+func TestLlamaCppBackend_Close(t *testing.T) {
+	client := newTestLlamaCppClient(t, "hang")
+	errs := make(chan error)
+	go func() {
+		_, err := client.CreateCompletion(&CompletionRequest{Messages: []Message{{Role: "user", Content: "Hi"}}})
+		errs <- err
+	}()
+
+	assert.Equal(t, "thinking", (<-client.events).Choices[0].Delta.Content)
+	client.Close()
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("subprocess was not killed on Close")
+	}
+}
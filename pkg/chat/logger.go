@@ -0,0 +1,15 @@
+package chat
+
+import (
+	"io"
+	"log/slog"
+)
+
+// logger is the structured logger used throughout the package.
+// It discards all records unless configured with SetLogger.
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// SetLogger sets the logger used by the chat package
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
@@ -0,0 +1,262 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// mathBlockPattern matches the $$...$$ display math blocks of a message
+var mathBlockPattern = regexp.MustCompile(`(?s)\$\$(.+?)\$\$`)
+
+var (
+	// katexCommand is the KaTeX command line program converting LaTeX to MathML
+	katexCommand = "katex"
+
+	// renderedLaTeX caches the output of katex, as streamed messages are rendered repeatedly
+	renderedLaTeX = map[string]string{}
+	// pendingLaTeX are the sources waiting for katex, true once renderMathCmd runs them
+	pendingLaTeX = map[string]bool{}
+	// latexGeneration counts the sources rendered, the rendered messages are stale when it changes
+	latexGeneration int
+	renderedLaTeXMu sync.Mutex
+)
+
+// mathRenderedMsg reports that LaTeX sources were rendered, the messages are rendered again
+type mathRenderedMsg struct{}
+
+// mathNoticeMsg is the rendering of /math
+type mathNoticeMsg string
+
+// latexFallback returns the raw LaTeX source in a fenced block
+func latexFallback(src string) string {
+	return "```latex\n" + strings.TrimSpace(src) + "\n```"
+}
+
+// renderLaTeX renders the LaTeX source as a fenced block of Unicode text using katex and
+// caches it. The raw source is returned in a latex block if katex is not installed or fails.
+func renderLaTeX(src string) (string, error) {
+	src = strings.TrimSpace(src)
+	renderedLaTeXMu.Lock()
+	output, ok := renderedLaTeX[src]
+	renderedLaTeXMu.Unlock()
+	if ok {
+		return output, nil
+	}
+
+	output, err := runKaTeX(src)
+	if err != nil {
+		// the fallback is cached too, so that katex does not run again on each render
+		output = latexFallback(src)
+	}
+	renderedLaTeXMu.Lock()
+	renderedLaTeX[src] = output
+	delete(pendingLaTeX, src)
+	latexGeneration++
+	renderedLaTeXMu.Unlock()
+	return output, err
+}
+
+// runKaTeX renders the LaTeX source as a fenced block of Unicode text using katex,
+// or in a latex block if katex is not installed
+func runKaTeX(src string) (string, error) {
+	command, err := exec.LookPath(katexCommand)
+	if err != nil {
+		return latexFallback(src), nil
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(command, "--display-mode", "--output", "mathml")
+	cmd.Stdin = strings.NewReader(src)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("katex failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	text, err := mathMLToUnicode(stdout.String())
+	if err != nil {
+		return "", err
+	}
+	return "```\n" + text + "\n```", nil
+}
+
+// cachedLaTeX returns the rendering of the LaTeX source if katex already rendered it.
+// Otherwise the source is queued for renderMathCmd and its fallback is returned.
+func cachedLaTeX(src string) string {
+	src = strings.TrimSpace(src)
+	renderedLaTeXMu.Lock()
+	defer renderedLaTeXMu.Unlock()
+	if output, ok := renderedLaTeX[src]; ok {
+		return output
+	}
+	if _, ok := pendingLaTeX[src]; !ok {
+		pendingLaTeX[src] = false
+	}
+	return latexFallback(src)
+}
+
+// renderMathCmd returns a tea.Cmd rendering the queued LaTeX sources with katex outside of
+// the update loop, nil if none is queued
+func renderMathCmd() tea.Cmd {
+	renderedLaTeXMu.Lock()
+	var sources []string
+	for src, running := range pendingLaTeX {
+		if !running {
+			pendingLaTeX[src] = true
+			sources = append(sources, src)
+		}
+	}
+	renderedLaTeXMu.Unlock()
+	if len(sources) == 0 {
+		return nil
+	}
+	return func() tea.Msg {
+		for _, src := range sources {
+			if _, err := renderLaTeX(src); err != nil {
+				logger.Warn("failed to render LaTeX", "error", err)
+			}
+		}
+		return mathRenderedMsg{}
+	}
+}
+
+// mathCmd returns a tea.Cmd rendering the LaTeX source of /math
+func mathCmd(src string) tea.Cmd {
+	return func() tea.Msg {
+		output, err := renderLaTeX(src)
+		if err != nil {
+			logger.Warn("failed to render LaTeX", "error", err)
+		}
+		return mathNoticeMsg(output)
+	}
+}
+
+// currentLaTeXGeneration returns the number of LaTeX sources rendered so far
+func currentLaTeXGeneration() int {
+	renderedLaTeXMu.Lock()
+	defer renderedLaTeXMu.Unlock()
+	return latexGeneration
+}
+
+// replaceMathBlocks replaces the $$...$$ blocks of the Markdown content outside of fenced
+// code blocks with their rendering. The blocks which katex has not rendered yet are shown
+// as LaTeX source until renderMathCmd renders them.
+func replaceMathBlocks(content string) string {
+	var b strings.Builder
+	start := 0
+	replace := func(text string) string {
+		return mathBlockPattern.ReplaceAllStringFunc(text, func(block string) string {
+			return "\n" + cachedLaTeX(mathBlockPattern.FindStringSubmatch(block)[1]) + "\n"
+		})
+	}
+	for _, block := range parseCodeBlocks(content) {
+		b.WriteString(replace(content[start:block.Start]))
+		b.WriteString(content[block.Start:block.End])
+		start = block.End
+	}
+	b.WriteString(replace(content[start:]))
+	return b.String()
+}
+
+// mathNode is an element of a MathML document
+type mathNode struct {
+	XMLName  xml.Name
+	Text     string     `xml:",chardata"`
+	Children []mathNode `xml:",any"`
+}
+
+// mathMLToUnicode approximates the MathML document as a line of Unicode text
+func mathMLToUnicode(mathML string) (string, error) {
+	decoder := xml.NewDecoder(strings.NewReader(mathML))
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+	var root mathNode
+	if err := decoder.Decode(&root); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(root.unicode()), nil
+}
+
+var (
+	superscripts = strings.NewReplacer(
+		"0", "⁰", "1", "¹", "2", "²", "3", "³", "4", "⁴", "5", "⁵", "6", "⁶", "7", "⁷", "8", "⁸", "9", "⁹",
+		"+", "⁺", "-", "⁻", "−", "⁻", "=", "⁼", "(", "⁽", ")", "⁾", "n", "ⁿ", "i", "ⁱ",
+	)
+	subscripts = strings.NewReplacer(
+		"0", "₀", "1", "₁", "2", "₂", "3", "₃", "4", "₄", "5", "₅", "6", "₆", "7", "₇", "8", "₈", "9", "₉",
+		"+", "₊", "-", "₋", "−", "₋", "=", "₌", "(", "₍", ")", "₎", "a", "ₐ", "e", "ₑ", "i", "ᵢ", "j", "ⱼ",
+		"k", "ₖ", "n", "ₙ", "o", "ₒ", "x", "ₓ",
+	)
+)
+
+// script returns the text with the replacer applied if every character has a replacement,
+// otherwise it is marked with the prefix, e.g. ^(a+b)
+func script(text string, replacer *strings.Replacer, prefix string) string {
+	text = strings.TrimSpace(text)
+	for _, r := range text {
+		if replacer.Replace(string(r)) == string(r) {
+			return prefix + group(text)
+		}
+	}
+	return replacer.Replace(text)
+}
+
+// group wraps text longer than one character in parentheses
+func group(text string) string {
+	if utf8.RuneCountInString(text) > 1 {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+func (n mathNode) children() []string {
+	var texts []string
+	for _, child := range n.Children {
+		texts = append(texts, child.unicode())
+	}
+	return texts
+}
+
+func (n mathNode) unicode() string {
+	children := n.children()
+	arg := func(i int) string {
+		if i < len(children) {
+			return children[i]
+		}
+		return ""
+	}
+	switch n.XMLName.Local {
+	case "annotation", "annotation-xml":
+		return ""
+	case "mi", "mn", "mtext":
+		return strings.TrimSpace(n.Text)
+	case "mo":
+		op := strings.TrimSpace(n.Text)
+		if strings.ContainsAny(op, "=+−-×÷<>≤≥≈→") {
+			return " " + op + " "
+		}
+		return op
+	case "mspace":
+		return " "
+	case "msup":
+		return arg(0) + script(arg(1), superscripts, "^")
+	case "msub":
+		return arg(0) + script(arg(1), subscripts, "_")
+	case "msubsup":
+		return arg(0) + script(arg(1), subscripts, "_") + script(arg(2), superscripts, "^")
+	case "munderover":
+		return arg(0) + script(arg(1), subscripts, "_") + script(arg(2), superscripts, "^")
+	case "mfrac":
+		return group(arg(0)) + "/" + group(arg(1))
+	case "msqrt":
+		return "√" + group(strings.Join(children, ""))
+	case "mroot":
+		return script(arg(1), superscripts, "^") + "√" + group(arg(0))
+	}
+	return strings.Join(children, "")
+}
@@ -0,0 +1,127 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMathBlockPattern(t *testing.T) {
+	content := "The area is $$A = \\pi r^2$$ and\n$$\n\\frac{a}{b}\n$$ but $5 is not math."
+	matches := mathBlockPattern.FindAllStringSubmatch(content, -1)
+	assert.Len(t, matches, 2)
+	assert.Equal(t, "A = \\pi r^2", matches[0][1])
+	assert.Equal(t, "\n\\frac{a}{b}\n", matches[1][1])
+
+	assert.Empty(t, mathBlockPattern.FindAllString("no $$ closing", -1))
+}
+
+func TestRenderLaTeX_Fallback(t *testing.T) {
+	katexCommand = "katex-not-installed"
+	t.Cleanup(func() { katexCommand = "katex" })
+
+	output, err := renderLaTeX(" x^2 + y^2 ")
+	assert.NoError(t, err)
+	assert.Equal(t, "```latex\nx^2 + y^2\n```", output)
+
+	content := replaceMathBlocks("Pythagoras: $$a^2 + b^2 = c^2$$")
+	assert.Equal(t, "Pythagoras: \n```latex\na^2 + b^2 = c^2\n```\n", content)
+}
+
+// setTestKaTeX replaces katex with a script printing the MathML of x², and clears the cache
+func setTestKaTeX(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test katex is a shell script")
+	}
+	katex := filepath.Join(t.TempDir(), "katex")
+	script := "#!/bin/sh\ncat >/dev/null\necho '<math><msup><mi>x</mi><mn>2</mn></msup></math>'\n"
+	require.NoError(t, os.WriteFile(katex, []byte(script), 0755))
+	katexCommand = katex
+	reset := func() {
+		renderedLaTeXMu.Lock()
+		renderedLaTeX, pendingLaTeX = map[string]string{}, map[string]bool{}
+		renderedLaTeXMu.Unlock()
+	}
+	reset()
+	t.Cleanup(func() {
+		katexCommand = "katex"
+		reset()
+	})
+}
+
+func TestReplaceMathBlocks_Async(t *testing.T) {
+	setTestKaTeX(t)
+
+	// katex does not run while rendering, the source is shown until it rendered it
+	content := "Square: $$x^2$$"
+	assert.Equal(t, "Square: \n```latex\nx^2\n```\n", replaceMathBlocks(content))
+	cmd := renderMathCmd()
+	require.NotNil(t, cmd)
+	// the source is rendered once
+	replaceMathBlocks(content)
+	assert.Nil(t, renderMathCmd())
+
+	generation := currentLaTeXGeneration()
+	assert.Equal(t, mathRenderedMsg{}, cmd())
+	assert.Equal(t, generation+1, currentLaTeXGeneration())
+	assert.Equal(t, "Square: \n```\nx²\n```\n", replaceMathBlocks(content))
+	assert.Nil(t, renderMathCmd())
+}
+
+func TestReplaceMathBlocks_CodeFence(t *testing.T) {
+	setTestKaTeX(t)
+	content := "```sh\necho $$x$$\n```\n"
+	assert.Equal(t, content, replaceMathBlocks(content))
+	assert.Nil(t, renderMathCmd())
+}
+
+func TestUpdate_MathRendered(t *testing.T) {
+	setTestKaTeX(t)
+	m := newTestModel(t)
+	m.client.history = []Message{{Role: "assistant", Content: "$$x^2$$"}}
+	content, _ := m.renderMessages(m.client.history)
+	m.viewport.SetContent(content)
+	assert.Contains(t, ansiPattern.ReplaceAllString(m.viewport.View(), ""), "x^2")
+
+	_, cmd := m.Update(nil)
+	var rendered tea.Msg
+	for _, msg := range batchMessages(cmd) {
+		if _, ok := msg.(mathRenderedMsg); ok {
+			rendered = msg
+		}
+	}
+	require.NotNil(t, rendered)
+	model, _ := m.Update(rendered)
+	m = model.(Model)
+	view := ansiPattern.ReplaceAllString(m.viewport.View(), "")
+	assert.Contains(t, view, "x²")
+	assert.NotContains(t, view, "x^2")
+}
+
+func TestMathMLToUnicode(t *testing.T) {
+	mathML := `<math xmlns="http://www.w3.org/1998/Math/MathML" display="block"><semantics><mrow>` +
+		`<msup><mi>x</mi><mn>2</mn></msup><mo>+</mo><mfrac><mn>1</mn><mrow><mi>a</mi><mo>+</mo><mi>b</mi></mrow></mfrac>` +
+		`<mo>=</mo><msqrt><msub><mi>y</mi><mn>0</mn></msub></msqrt></mrow>` +
+		`<annotation encoding="application/x-tex">x^2+\frac{1}{a+b}=\sqrt{y_0}</annotation></semantics></math>`
+	text, err := mathMLToUnicode(mathML)
+	assert.NoError(t, err)
+	assert.Equal(t, "x² + 1/(a + b) = √(y₀)", text)
+}
+
+func TestHandleCommand_Math(t *testing.T) {
+	setTestKaTeX(t)
+	m := newTestModel(t)
+	cmd, ok := m.handleCommand("/math x^2")
+	require.True(t, ok)
+	require.NotNil(t, cmd)
+	msg := cmd()
+	assert.Equal(t, mathNoticeMsg("```\nx²\n```"), msg)
+	model, _ := m.Update(msg)
+	m = model.(Model)
+	assert.Contains(t, ansiPattern.ReplaceAllString(m.notice, ""), "x²")
+}
@@ -0,0 +1,194 @@
+package chat
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	// maxMentionItems is the number of entries visible in the mention dropdown
+	maxMentionItems = 5
+	// lineNumberWidth is the width of the line numbers of the textarea in multi-line mode
+	lineNumberWidth = 3
+)
+
+var (
+	// mentionUpKeys and mentionDownKeys move the selection of the mention dropdown
+	mentionUpKeys   = key.NewBinding(key.WithKeys("up"))
+	mentionDownKeys = key.NewBinding(key.WithKeys("down"))
+	// mentionSelectKeys replace the mention with the command of the selected entry
+	mentionSelectKeys = key.NewBinding(key.WithKeys("enter", "tab"))
+)
+
+// mentionItem is an entry of the mention dropdown, a model or a persona
+type mentionItem struct {
+	name string
+	kind string
+}
+
+func (i mentionItem) Title() string       { return i.name }
+func (i mentionItem) Description() string { return i.kind }
+func (i mentionItem) FilterValue() string { return i.name }
+
+// command returns the inline command selecting the entry
+func (i mentionItem) command() string {
+	return "/" + i.kind + " " + i.name
+}
+
+// autoCompleteItems returns the models and personas containing the prefix, ignoring case.
+// Names starting with the prefix come first, models before personas, each sorted by name.
+func autoCompleteItems(prefix string, models []string, personas []string) []list.Item {
+	prefix = strings.ToLower(prefix)
+	var starting, containing []list.Item
+	add := func(names []string, kind string) {
+		names = append([]string(nil), names...)
+		sort.Strings(names)
+		for _, name := range names {
+			lower := strings.ToLower(name)
+			if strings.HasPrefix(lower, prefix) {
+				starting = append(starting, mentionItem{name: name, kind: kind})
+			} else if strings.Contains(lower, prefix) {
+				containing = append(containing, mentionItem{name: name, kind: kind})
+			}
+		}
+	}
+	add(models, "model")
+	add(personas, "persona")
+	return append(starting, containing...)
+}
+
+// mentionQuery returns the text typed after the "@" before the cursor of the line,
+// the "@" has to start a word
+func mentionQuery(line string, col int) (string, bool) {
+	runes := []rune(line)
+	col = min(col, len(runes))
+	for i := col - 1; i >= 0; i-- {
+		switch {
+		case runes[i] == '@':
+			if i > 0 && !unicode.IsSpace(runes[i-1]) {
+				return "", false
+			}
+			return string(runes[i+1 : col]), true
+		case unicode.IsSpace(runes[i]):
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// newMentionList creates the list of the mention dropdown
+func newMentionList() list.Model {
+	delegate := list.NewDefaultDelegate()
+	delegate.ShowDescription = false
+	delegate.SetSpacing(0)
+	l := list.New(nil, delegate, 0, 0)
+	l.SetShowTitle(false)
+	l.SetShowStatusBar(false)
+	l.SetShowPagination(false)
+	l.SetShowHelp(false)
+	l.SetFilteringEnabled(false)
+	return l
+}
+
+// mentionNames returns the names of the known models and of the personas
+func (m Model) mentionNames() ([]string, []string) {
+	models := make([]string, 0, len(modelInfos))
+	for model := range modelInfos {
+		models = append(models, model)
+	}
+	personas := make([]string, 0, len(m.personas))
+	for persona := range m.personas {
+		personas = append(personas, persona)
+	}
+	return models, personas
+}
+
+// updateMention opens, filters or closes the mention dropdown for the "@" word at the cursor
+func (m *Model) updateMention() {
+	value := m.textarea.Value()
+	if !strings.Contains(value, "@") {
+		m.mentioning = false
+		m.mentionDismissed = false
+		return
+	}
+	lines := strings.Split(value, "\n")
+	info := m.textarea.LineInfo()
+	query, ok := mentionQuery(lines[min(m.textarea.Line(), len(lines)-1)], info.StartColumn+info.ColumnOffset)
+	if !ok {
+		m.mentioning = false
+		m.mentionDismissed = false
+		return
+	}
+	models, personas := m.mentionNames()
+	items := autoCompleteItems(query, models, personas)
+	m.mentioning = len(items) > 0 && !m.mentionDismissed
+	m.mentionQuery = query
+	m.mentionColumn = info.ColumnOffset - len([]rune(query)) - 1
+	m.mentionList.SetItems(items)
+	m.mentionList.SetSize(mentionListWidth(items), min(len(items), maxMentionItems))
+	if m.mentionList.Index() >= len(items) {
+		m.mentionList.Select(0)
+	}
+}
+
+// mentionListWidth returns the width fitting the longest entry of the dropdown
+func mentionListWidth(items []list.Item) int {
+	width := 0
+	for _, item := range items {
+		width = max(width, len(item.(mentionItem).name))
+	}
+	// the default delegate indents the entries
+	return width + 4
+}
+
+// updateMentioning handles the keys of the open mention dropdown. It reports
+// false for the keys which are typed into the textarea.
+func (m *Model) updateMentioning(msg tea.KeyMsg) bool {
+	switch {
+	case key.Matches(msg, mentionUpKeys):
+		m.mentionList.CursorUp()
+	case key.Matches(msg, mentionDownKeys):
+		m.mentionList.CursorDown()
+	case key.Matches(msg, mentionSelectKeys):
+		item, ok := m.mentionList.SelectedItem().(mentionItem)
+		if !ok {
+			return true
+		}
+		// delete the mention and the "@" before inserting the command
+		for range []rune("@" + m.mentionQuery) {
+			m.textarea, _ = m.textarea.Update(tea.KeyMsg{Type: tea.KeyBackspace})
+		}
+		m.textarea.InsertString(item.command())
+		m.mentioning = false
+	case key.Matches(msg, m.keys.Esc):
+		m.mentioning = false
+		m.mentionDismissed = true
+	default:
+		return false
+	}
+	return true
+}
+
+// mentionView renders the mention dropdown over the bottom lines of the conversation,
+// aligned with the "@" in the textarea
+func (m Model) mentionView(conversation string) string {
+	lines := strings.Split(conversation, "\n")
+	dropdown := strings.Split(m.mentionList.View(), "\n")
+	indent := lipgloss.Width(m.textarea.Prompt) + max(m.mentionColumn, 0)
+	if m.textarea.ShowLineNumbers {
+		indent += lineNumberWidth
+	}
+	start := max(len(lines)-len(dropdown), 0)
+	for i, line := range dropdown {
+		if start+i < len(lines) {
+			lines[start+i] = strings.Repeat(" ", indent) + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoCompleteItems(t *testing.T) {
+	models := []string{"gpt-4", "gpt-3.5-turbo", "gpt-4-32k"}
+	personas := []string{"reviewer", "GPT-tutor"}
+	names := func(items []list.Item) []string {
+		var names []string
+		for _, item := range items {
+			names = append(names, item.(mentionItem).command())
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{
+		"/model gpt-3.5-turbo", "/model gpt-4", "/model gpt-4-32k", "/persona GPT-tutor", "/persona reviewer",
+	}, names(autoCompleteItems("", models, personas)))
+	assert.Equal(t, []string{"/model gpt-4", "/model gpt-4-32k"}, names(autoCompleteItems("gpt-4", models, personas)))
+	// matching ignores case and names containing the prefix come last
+	assert.Equal(t, []string{"/model gpt-3.5-turbo", "/model gpt-4", "/model gpt-4-32k", "/persona GPT-tutor"},
+		names(autoCompleteItems("GPT", models, personas)))
+	assert.Equal(t, []string{"/persona reviewer", "/model gpt-3.5-turbo", "/persona GPT-tutor"}, names(autoCompleteItems("r", models, personas)))
+	assert.Empty(t, autoCompleteItems("claude", models, personas))
+}
+
+func TestMentionQuery(t *testing.T) {
+	query, ok := mentionQuery("ask @gp", 7)
+	assert.True(t, ok)
+	assert.Equal(t, "gp", query)
+
+	query, ok = mentionQuery("@", 1)
+	assert.True(t, ok)
+	assert.Empty(t, query)
+
+	_, ok = mentionQuery("ask @gp now", 11)
+	assert.False(t, ok)
+	_, ok = mentionQuery("me@example", 10)
+	assert.False(t, ok)
+}
+
+func TestUpdate_Mention(t *testing.T) {
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.mentionList = newMentionList()
+	m.personas = map[string]string{"reviewer": "Review my code"}
+
+	for _, r := range "use @rev" {
+		model, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = model.(Model)
+	}
+	assert.True(t, m.mentioning)
+	assert.Contains(t, m.View(), "reviewer")
+
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyTab})
+	m = model.(Model)
+	assert.False(t, m.mentioning)
+	assert.Equal(t, "use /persona reviewer", m.textarea.Value())
+
+	// the dropdown stays closed after esc until the mention is finished
+	m.textarea.SetValue("")
+	for _, r := range "@gpt" {
+		model, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = model.(Model)
+	}
+	assert.True(t, m.mentioning)
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m = model.(Model)
+	assert.False(t, m.mentioning)
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("-")})
+	m = model.(Model)
+	assert.False(t, m.mentioning)
+}
@@ -0,0 +1,66 @@
+package chat
+
+import (
+	_ "embed"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// ModelInfo describes the token limits of a model
+type ModelInfo struct {
+	ContextWindow int `json:"context_window"`
+	MaxOutput     int `json:"max_output"`
+}
+
+//go:embed model_info.json
+var embeddedModelInfo []byte
+
+// modelInfos maps model IDs to their limits.
+// Versioned model names match the longest known prefix.
+var modelInfos = mustParseModelInfo(embeddedModelInfo)
+
+// parseModelInfo parses a JSON object mapping model IDs to ModelInfo
+func parseModelInfo(data []byte) (map[string]ModelInfo, error) {
+	infos := map[string]ModelInfo{}
+	if err := json.Unmarshal(data, &infos); err != nil {
+		return nil, err
+	}
+	return infos, nil
+}
+
+func mustParseModelInfo(data []byte) map[string]ModelInfo {
+	infos, err := parseModelInfo(data)
+	if err != nil {
+		panic(err)
+	}
+	return infos
+}
+
+// loadModelInfoFile adds the models of the file to modelInfos, replacing the embedded ones
+func loadModelInfoFile(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	infos, err := parseModelInfo(data)
+	if err != nil {
+		return err
+	}
+	for model, info := range infos {
+		modelInfos[model] = info
+	}
+	return nil
+}
+
+// lookupModelInfo returns the info of the model with the longest matching prefix
+func lookupModelInfo(model string) (ModelInfo, bool) {
+	var info ModelInfo
+	longest := -1
+	for prefix, i := range modelInfos {
+		if strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			info, longest = i, len(prefix)
+		}
+	}
+	return info, longest >= 0
+}
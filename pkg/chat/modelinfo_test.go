@@ -0,0 +1,42 @@
+package chat
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookupModelInfo(t *testing.T) {
+	infos, err := parseModelInfo(embeddedModelInfo)
+	assert.NoError(t, err)
+	assert.Equal(t, 128000, infos["gpt-4-turbo"].ContextWindow)
+
+	info, ok := lookupModelInfo("gpt-4-turbo")
+	assert.True(t, ok)
+	assert.Equal(t, 128000, info.ContextWindow)
+	assert.Equal(t, 4096, info.MaxOutput)
+
+	info, ok = lookupModelInfo("gpt-4-turbo-2024-04-09")
+	assert.True(t, ok)
+	assert.Equal(t, 128000, info.ContextWindow)
+
+	_, ok = lookupModelInfo("llama-2-7b")
+	assert.False(t, ok)
+}
+
+func TestLoadModelInfoFile(t *testing.T) {
+	saved := modelInfos
+	modelInfos = mustParseModelInfo(embeddedModelInfo)
+	t.Cleanup(func() { modelInfos = saved })
+
+	filePath := path.Join(t.TempDir(), "models.json")
+	assert.NoError(t, os.WriteFile(filePath, []byte(`{"llama-2-7b": {"context_window": 4096, "max_output": 2048}}`), 0644))
+	assert.NoError(t, loadModelInfoFile(filePath))
+
+	info, ok := lookupModelInfo("llama-2-7b-chat")
+	assert.True(t, ok)
+	assert.Equal(t, 4096, info.ContextWindow)
+	assert.Equal(t, 128000, contextWindow("gpt-4-turbo"))
+}
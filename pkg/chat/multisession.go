@@ -0,0 +1,228 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+var (
+	// paneStyle is the style of the panes of the sessions in multi-session mode
+	paneStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("238")).Padding(0, 1)
+	// paneGap is the number of columns between two panes
+	paneGap = 1
+)
+
+// SessionPane is one of the sessions a message is sent to in multi-session mode.
+// Each pane has its own client, history and viewport.
+type SessionPane struct {
+	client       *Client
+	viewport     viewport.Model
+	spinner      spinner.Model
+	renderer     *glamour.TermRenderer
+	cache        *messageCache
+	waiting      bool
+	streamDeltas string
+	err          error
+}
+
+// paneMsg wraps a message of the client of the pane at index
+type paneMsg struct {
+	index int
+	msg   tea.Msg
+}
+
+// newSessionPanes creates n panes with clients configured by the chat flags.
+// The systems are the system messages of the panes, the others keep the --system message.
+func newSessionPanes(n int, systems []string) ([]SessionPane, error) {
+	panes := make([]SessionPane, n)
+	for i := range panes {
+		client, err := newClientFromConfig()
+		if err != nil {
+			return nil, err
+		}
+		if i < len(systems) {
+			client.system = expandEnvVars(systems[i])
+		}
+		panes[i] = SessionPane{
+			client:   client,
+			viewport: viewport.New(0, 0),
+			spinner:  spinner.New(spinner.WithStyle(lipgloss.NewStyle().Foreground(lipgloss.Color("63")))),
+			cache:    &messageCache{},
+		}
+	}
+	return panes, nil
+}
+
+// paneWidths returns the widths of n panes side by side in width columns, separated by
+// paneGap. The columns left over by the division go to the first panes.
+func paneWidths(n, width int) []int {
+	if n <= 0 {
+		return nil
+	}
+	available := max(width-paneGap*(n-1), 0)
+	widths := make([]int, n)
+	for i := range widths {
+		widths[i] = available / n
+		if i < available%n {
+			widths[i]++
+		}
+	}
+	return widths
+}
+
+// paneCmd returns a tea.Cmd which wraps the message of cmd for the pane at index
+func paneCmd(index int, cmd tea.Cmd) tea.Cmd {
+	return func() tea.Msg {
+		return paneMsg{index: index, msg: cmd()}
+	}
+}
+
+// layoutPanes sizes the panes to share the width of the conversation
+func (m *Model) layoutPanes() {
+	for i, width := range paneWidths(len(m.sessions), m.viewport.Width) {
+		pane := &m.sessions[i]
+		pane.viewport.Width = max(width-paneStyle.GetHorizontalFrameSize(), 0)
+		// a line is taken by the title of the pane
+		pane.viewport.Height = max(m.viewport.Height-paneStyle.GetVerticalFrameSize()-1, 0)
+		renderer, err := newGlamourRenderer(wordWrapWidth(pane.viewport.Width, m.wordWrapMargin), m.rendererStyle())
+		if err != nil {
+			logger.Warn("failed to create renderer", "error", err)
+			continue
+		}
+		pane.renderer = renderer
+		pane.render()
+	}
+}
+
+// sendAll sends the input to the sessions of all panes at once
+func (m *Model) sendAll(input string) []tea.Cmd {
+	var commands []tea.Cmd
+	for i := range m.sessions {
+		pane := &m.sessions[i]
+		if pane.waiting {
+			continue
+		}
+		pane.client.history = append(pane.client.history, Message{Role: "user", Content: input})
+		pane.err = nil
+		pane.waiting = true
+		pane.render()
+		req := newCompletionRequest(pane.client, m.tokenCounter, nil)
+		commands = append(commands, paneCmd(i, createCompletionCmd(pane.client, req, m.fallbackModel)), pane.spinner.Tick)
+		if pane.client.stream {
+			commands = append(commands, paneCmd(i, waitEventsCmd(pane.client)))
+		}
+	}
+	return commands
+}
+
+// updatePane handles a message of the client of the pane at index
+func (m *Model) updatePane(index int, msg tea.Msg) tea.Cmd {
+	pane := &m.sessions[index]
+	switch msg := msg.(type) {
+	case *CompletionResponse:
+		pane.waiting = false
+		if len(msg.Choices) == 0 || len(msg.Choices[0].Message.Content) == 0 {
+			pane.err = errEmptyResponse
+			break
+		}
+		pane.client.history = append(pane.client.history, msg.Choices[0].Message)
+	case fallbackMsg:
+		pane.client.model = msg.model
+		if msg.resp != nil {
+			return m.updatePane(index, msg.resp)
+		}
+	case CompletionStreamResponse:
+		// events without choices, e.g. the usage, carry no content
+		if len(msg.Choices) == 0 {
+			return paneCmd(index, waitEventsCmd(pane.client))
+		}
+		choice := msg.Choices[0]
+		pane.streamDeltas += choice.Delta.Content
+		if len(choice.FinishReason) > 0 {
+			pane.waiting = false
+			if len(pane.streamDeltas) == 0 {
+				pane.err = errEmptyResponse
+				break
+			}
+			pane.client.history = append(pane.client.history, Message{Role: "assistant", Content: pane.streamDeltas})
+			pane.streamDeltas = ""
+		} else {
+			pane.render()
+			return paneCmd(index, waitEventsCmd(pane.client))
+		}
+	case error:
+		pane.waiting = false
+		pane.streamDeltas = ""
+		pane.err = msg
+	}
+	pane.render()
+	return nil
+}
+
+// updatePaneSpinners advances the spinners of the waiting panes
+func (m *Model) updatePaneSpinners(msg spinner.TickMsg) tea.Cmd {
+	for i := range m.sessions {
+		pane := &m.sessions[i]
+		if msg.ID == pane.spinner.ID() && pane.waiting {
+			var cmd tea.Cmd
+			pane.spinner, cmd = pane.spinner.Update(msg)
+			return cmd
+		}
+	}
+	return nil
+}
+
+// render renders the history of the pane with the partial stream message
+func (p *SessionPane) render() {
+	messages := p.client.history
+	if len(p.streamDeltas) > 0 {
+		n := len(messages)
+		messages = append(messages[:n:n], Message{Role: "assistant", Content: p.streamDeltas})
+	}
+	var rendered []string
+	for i, message := range messages {
+		author := senderStyle.Render(userName)
+		if message.Role == "assistant" {
+			author = chatStyle.Render(chatGPTName)
+		}
+		output, err := p.cache.render(p.renderer, nil, i, message)
+		if err != nil {
+			logger.Warn("falling back to plain text", "error", err)
+		}
+		rendered = append(rendered, author+"\n"+output)
+	}
+	if p.err != nil {
+		rendered = append(rendered, errorStyle.Render(fmt.Sprintf("error: %v", p.err)))
+	}
+	p.viewport.SetContent(strings.Join(rendered, "\n"))
+	p.viewport.GotoBottom()
+}
+
+// panesView renders the panes side by side, each titled with its number and system message
+func (m Model) panesView() string {
+	var panes []string
+	for i, pane := range m.sessions {
+		title := fmt.Sprintf("Session %d", i+1)
+		if len(pane.client.system) > 0 {
+			title += ": " + pane.client.system
+		}
+		if pane.waiting {
+			spinner := pane.spinner.View()
+			title = spinner + helpStyle.Render(runewidth.Truncate(title, pane.viewport.Width-lipgloss.Width(spinner), "…"))
+		} else {
+			title = helpStyle.Render(runewidth.Truncate(title, pane.viewport.Width, "…"))
+		}
+		panes = append(panes, paneStyle.Render(title+"\n"+pane.viewport.View()))
+		if i < len(m.sessions)-1 {
+			panes = append(panes, strings.Repeat(" ", paneGap))
+		}
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Top, panes...)
+}
@@ -0,0 +1,96 @@
+package chat
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaneWidths(t *testing.T) {
+	tests := []struct {
+		n, width int
+		want     []int
+	}{
+		{1, 80, []int{80}},
+		{2, 80, []int{40, 39}},
+		{3, 80, []int{26, 26, 26}},
+		{3, 81, []int{27, 26, 26}},
+		{4, 100, []int{25, 24, 24, 24}},
+		{3, 1, []int{0, 0, 0}},
+		{0, 80, nil},
+	}
+	for _, tt := range tests {
+		widths := paneWidths(tt.n, tt.width)
+		assert.Equal(t, tt.want, widths, "%d panes in %d columns", tt.n, tt.width)
+		if total := 0; len(widths) > 0 && tt.width > paneGap*(tt.n-1) {
+			for _, w := range widths {
+				total += w
+			}
+			assert.Equal(t, tt.width, total+paneGap*(tt.n-1))
+		}
+	}
+}
+
+func TestUpdate_MultiSession(t *testing.T) {
+	setPipeConfig(t, map[string]any{"model": "gpt-4", "stream": false, "system": "Be brief."})
+	sessions, err := newSessionPanes(2, []string{"Answer in French."})
+	require.NoError(t, err)
+	assert.Equal(t, "Answer in French.", sessions[0].client.system)
+	assert.Equal(t, "Be brief.", sessions[1].client.system)
+
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.sessions = sessions
+	model, _ := m.Update(tea.WindowSizeMsg{Width: 84, Height: 40})
+	m = model.(Model)
+	assert.Equal(t, 36, m.sessions[0].viewport.Width)
+
+	m.textarea.SetValue("Hello")
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = model.(Model)
+	assert.Empty(t, m.textarea.Value())
+	for _, pane := range m.sessions {
+		assert.True(t, pane.waiting)
+		assert.Equal(t, []Message{{Role: "user", Content: "Hello"}}, pane.client.history)
+	}
+	assert.Empty(t, m.client.history)
+
+	resp := &CompletionResponse{Choices: []CompletionChoice{{Message: Message{Role: "assistant", Content: "Bonjour"}}}}
+	model, _ = m.Update(paneMsg{index: 0, msg: resp})
+	m = model.(Model)
+	assert.False(t, m.sessions[0].waiting)
+	assert.True(t, m.sessions[1].waiting)
+	assert.Len(t, m.sessions[0].client.history, 2)
+	assert.Contains(t, ansiPattern.ReplaceAllString(m.panesView(), ""), "Bonjour")
+
+	// a response without choices is an error of its pane
+	model, _ = m.Update(paneMsg{index: 1, msg: &CompletionResponse{}})
+	m = model.(Model)
+	assert.False(t, m.sessions[1].waiting)
+	assert.Equal(t, errEmptyResponse, m.sessions[1].err)
+	assert.Len(t, m.sessions[1].client.history, 1)
+	assert.Nil(t, m.sessions[0].err)
+	assert.Contains(t, ansiPattern.ReplaceAllString(m.panesView(), ""), errEmptyResponse.Error())
+}
+
+func TestUpdatePane_EmptyStream(t *testing.T) {
+	setPipeConfig(t, map[string]any{"model": "gpt-4", "stream": true})
+	sessions, err := newSessionPanes(1, nil)
+	require.NoError(t, err)
+	m := newTestModel(t)
+	m.sessions = sessions
+	m.sessions[0].waiting = true
+
+	// events without choices are skipped
+	assert.NotNil(t, m.updatePane(0, CompletionStreamResponse{}))
+	assert.True(t, m.sessions[0].waiting)
+
+	m.updatePane(0, CompletionStreamResponse{Choices: []CompletionStreamChoice{{FinishReason: "stop"}}})
+	assert.False(t, m.sessions[0].waiting)
+	assert.Equal(t, errEmptyResponse, m.sessions[0].err)
+	assert.Empty(t, m.sessions[0].client.history)
+}
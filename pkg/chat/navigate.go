@@ -0,0 +1,60 @@
+package chat
+
+import (
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+var (
+	// codeUpKeys and codeDownKeys move the cursor between the code blocks in navigation mode
+	codeUpKeys   = key.NewBinding(key.WithKeys("k", "up"))
+	codeDownKeys = key.NewBinding(key.WithKeys("j", "down"))
+	// codeToggleKeys expand or collapse the code block at the cursor
+	codeToggleKeys = key.NewBinding(key.WithKeys("enter"))
+)
+
+// codeBlockCount returns the number of code blocks in the history
+func (m Model) codeBlockCount() int {
+	n := 0
+	for _, message := range m.client.history {
+		n += len(parseCodeBlocks(message.Content))
+	}
+	return n
+}
+
+// startNavigating enters the navigation mode with all code blocks collapsed
+// and the cursor on the last one
+func (m *Model) startNavigating() {
+	n := m.codeBlockCount()
+	if n == 0 {
+		m.setNotice(warnStyle.Render("no code blocks to navigate"))
+		return
+	}
+	m.navigating = true
+	m.codeCursor = n - 1
+	m.expandedBlocks = map[int]bool{}
+	m.setNotice(helpStyle.Render("Navigate code blocks: j/k move, enter expands or collapses, esc exits"))
+}
+
+// updateNavigating handles the keys of the navigation mode
+func (m *Model) updateNavigating(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, codeUpKeys):
+		m.codeCursor = max(m.codeCursor-1, 0)
+	case key.Matches(msg, codeDownKeys):
+		m.codeCursor = min(m.codeCursor+1, m.codeBlockCount()-1)
+	case key.Matches(msg, codeToggleKeys):
+		m.expandedBlocks[m.codeCursor] = !m.expandedBlocks[m.codeCursor]
+	case key.Matches(msg, m.keys.Esc, m.keys.Navigate):
+		m.navigating = false
+		m.expandedBlocks = nil
+		m.setNotice("")
+		return nil
+	default:
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return cmd
+	}
+	m.setNotice(m.notice)
+	return nil
+}
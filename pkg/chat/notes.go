@@ -0,0 +1,118 @@
+package chat
+
+import (
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+var (
+	// noteStyle renders the private notes below the messages
+	noteStyle = lipgloss.NewStyle().Faint(true).Italic(true)
+	// noteUpKeys and noteDownKeys move the cursor between the assistant messages in annotation mode
+	noteUpKeys   = key.NewBinding(key.WithKeys("k", "up"))
+	noteDownKeys = key.NewBinding(key.WithKeys("j", "down"))
+	// noteEditKeys open the note of the message at the cursor, and save it while editing
+	noteEditKeys = key.NewBinding(key.WithKeys("enter"))
+	// noteRateKeys rate the message at the cursor
+	noteRateKeys = key.NewBinding(key.WithKeys("1", "2", "3", "4", "5"))
+)
+
+// startAnnotating enters the annotation mode with the cursor on the last assistant message
+func (m *Model) startAnnotating() {
+	cursor := m.nextAssistantMessage(len(m.client.history), -1)
+	if cursor < 0 {
+		m.setNotice(warnStyle.Render("no responses to annotate"))
+		return
+	}
+	m.annotating = true
+	m.noteCursor = cursor
+	m.setNotice(helpStyle.Render("Annotate a response: j/k move, 1-5 rate, enter edits the note, esc exits"))
+}
+
+// nextAssistantMessage returns the index of the next assistant message from i in the direction, or -1
+func (m Model) nextAssistantMessage(i int, direction int) int {
+	for i += direction; i >= 0 && i < len(m.client.history); i += direction {
+		if m.client.history[i].Role == "assistant" {
+			return i
+		}
+	}
+	return -1
+}
+
+// updateAnnotating handles the keys of the annotation mode and of the note input
+func (m *Model) updateAnnotating(msg tea.KeyMsg) tea.Cmd {
+	var cmd tea.Cmd
+	if m.noteInput.Focused() {
+		switch {
+		case key.Matches(msg, noteEditKeys):
+			m.setNote(m.noteCursor, m.noteInput.Value())
+			m.noteInput.Blur()
+		case key.Matches(msg, m.keys.Esc):
+			m.noteInput.Blur()
+		default:
+			m.noteInput, cmd = m.noteInput.Update(msg)
+		}
+		m.setNotice(m.notice)
+		return cmd
+	}
+
+	switch {
+	case key.Matches(msg, noteUpKeys):
+		if i := m.nextAssistantMessage(m.noteCursor, -1); i >= 0 {
+			m.noteCursor = i
+		}
+	case key.Matches(msg, noteDownKeys):
+		if i := m.nextAssistantMessage(m.noteCursor, 1); i >= 0 {
+			m.noteCursor = i
+		}
+	case key.Matches(msg, noteRateKeys):
+		if err := m.rateMessage(m.noteCursor, int(msg.Runes[0]-'0')); err != nil {
+			logger.Error("failed to save rating", "error", err)
+		}
+	case key.Matches(msg, noteEditKeys):
+		m.noteInput = textinput.New()
+		m.noteInput.Prompt = "✎ "
+		m.noteInput.Placeholder = "Private note, not sent to the API"
+		m.noteInput.SetValue(m.notes[m.historyOffset+m.noteCursor])
+		cmd = m.noteInput.Focus()
+	case key.Matches(msg, m.keys.Esc, m.keys.Annotate):
+		m.annotating = false
+		m.setNotice("")
+		return nil
+	default:
+		m.viewport, cmd = m.viewport.Update(msg)
+		return cmd
+	}
+	m.setNotice(m.notice)
+	return cmd
+}
+
+// setNote sets the note of the message at index i of the history, an empty note removes it
+func (m *Model) setNote(i int, note string) {
+	// notes are indexed by the position of the message in the session file
+	i += m.historyOffset
+	if len(note) == 0 {
+		delete(m.notes, i)
+	} else {
+		if m.notes == nil {
+			m.notes = map[int]string{}
+		}
+		m.notes[i] = note
+	}
+	if err := m.saveHistory(); err != nil {
+		logger.Error("failed to save note", "error", err)
+	}
+}
+
+// renderNote renders the note of the message at index i of the history, or its input while editing
+func (m Model) renderNote(i int) string {
+	if m.annotating && i == m.noteCursor && m.noteInput.Focused() {
+		return m.noteInput.View() + "\n"
+	}
+	if note, ok := m.notes[m.historyOffset+i]; ok {
+		return noteStyle.Render("✎ "+note) + "\n"
+	}
+	return ""
+}
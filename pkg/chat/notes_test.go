@@ -0,0 +1,84 @@
+package chat
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSession_NotesRoundTrip(t *testing.T) {
+	session := Session{
+		ID:       "2023-05-01_10-00-00",
+		Notes:    map[int]string{1: "check the sources", 3: "wrong"},
+		Messages: []Message{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Hello"}},
+	}
+	data, err := json.Marshal(session)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"notes":{"1":"check the sources","3":"wrong"}`)
+
+	var loaded Session
+	require.NoError(t, json.Unmarshal(data, &loaded))
+	assert.Equal(t, session.Notes, loaded.Notes)
+
+	data, err = json.Marshal(Session{ID: "no-notes", Messages: []Message{}})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"notes"`)
+}
+
+func TestUpdate_Annotate(t *testing.T) {
+	setTestHome(t)
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.client.history = []Message{
+		{Role: "user", Content: "first question"},
+		{Role: "assistant", Content: "first answer"},
+		{Role: "user", Content: "second question"},
+		{Role: "assistant", Content: "second answer"},
+	}
+
+	press := func(msgs ...tea.KeyMsg) {
+		for _, msg := range msgs {
+			model, _ := m.Update(msg)
+			m = model.(Model)
+		}
+	}
+	press(tea.KeyMsg{Type: tea.KeyCtrlO})
+	require.True(t, m.annotating)
+	assert.Equal(t, 3, m.noteCursor)
+
+	// annotate the first answer
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("k")}, tea.KeyMsg{Type: tea.KeyEnter})
+	require.True(t, m.noteInput.Focused())
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("verify this")}, tea.KeyMsg{Type: tea.KeyEnter})
+	press(tea.KeyMsg{Type: tea.KeyEsc})
+	assert.False(t, m.annotating)
+	assert.Equal(t, map[int]string{1: "verify this"}, m.notes)
+
+	// the note is rendered between the annotated message and the next one
+	content, err := m.renderMessages(m.client.history)
+	require.NoError(t, err)
+	view := ansiPattern.ReplaceAllString(content, "")
+	note := strings.Index(view, "✎ verify this")
+	require.Positive(t, note)
+	assert.Less(t, strings.Index(view, "first answer"), note)
+	assert.Less(t, note, strings.Index(view, "second question"))
+
+	// notes are not sent
+	for _, message := range newCompletionRequest(m.client, nil, nil).Messages {
+		assert.NotContains(t, message.Content, "verify this")
+	}
+}
+
+func TestFormatTranscript(t *testing.T) {
+	session := Session{
+		Notes:    map[int]string{1: "verify this"},
+		Messages: []Message{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Hello\n"}},
+	}
+	assert.Equal(t, "[user]\nHi\n\n[assistant]\nHello\n✎ verify this\n", FormatTranscript(session))
+}
@@ -0,0 +1,160 @@
+package chat
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// CommandDef describes an inline command handled by handleCommand
+type CommandDef struct {
+	// Name is the command without the slash, e.g. tag
+	Name string
+	// Args describes the arguments, empty if there are none
+	Args        string
+	Description string
+}
+
+// commands are the inline commands listed in the command palette
+var commands = []CommandDef{
+	{Name: "imagine", Args: "<prompt>", Description: "generate images from the prompt"},
+	{Name: "compact", Description: "summarize the history to free up context"},
+	{Name: "system", Args: "[message|expand|collapse]", Description: "edit, replace, expand or collapse the system message"},
+	{Name: "mark-system", Args: "<n>", Description: "turn message n into a system message and back"},
+	{Name: "tag", Args: "<name>", Description: "add or remove a tag of the session"},
+	{Name: "model", Args: "[name]", Description: "show the context window and output limits of a model"},
+	{Name: "persona", Args: "<name>", Description: "switch to the system message of a persona"},
+	{Name: "math", Args: "<latex>", Description: "render a LaTeX formula"},
+	{Name: "title", Args: "<title>", Description: "set the title of the session"},
+	{Name: "pin", Description: "pin the session to the top of the history"},
+	{Name: "unpin", Description: "unpin the session"},
+	{Name: "rate", Args: "<1-5>", Description: "rate the last response"},
+	{Name: "diff", Args: "<file>", Description: "compare the last response with a reference file"},
+	{Name: "reply-to", Args: "<n>", Description: "send the next message as a reply to message n"},
+	{Name: "eval", Description: "run the last Go code block of the last response and append its output"},
+}
+
+var (
+	// paletteUpKeys and paletteDownKeys move the selection while the filter is typed
+	paletteUpKeys   = key.NewBinding(key.WithKeys("up"))
+	paletteDownKeys = key.NewBinding(key.WithKeys("down"))
+	// paletteSelectKeys insert the selected command or run the selected key binding
+	paletteSelectKeys = key.NewBinding(key.WithKeys("enter"))
+	// paletteStyle is the style of the box around the command palette
+	paletteStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("63")).Padding(0, 1)
+)
+
+// paletteItem is an entry of the command palette, an inline command or a key binding
+type paletteItem struct {
+	title       string
+	description string
+	// command is inserted into the textarea when the entry is selected
+	command string
+	// keys are pressed when the entry is selected if there is no command
+	keys string
+}
+
+func (i paletteItem) Title() string       { return i.title }
+func (i paletteItem) Description() string { return i.description }
+func (i paletteItem) FilterValue() string { return i.title + " " + i.description }
+
+// commandPaletteItems returns the entries of the command palette: the inline
+// commands and the ones of the plugins followed by the key bindings of the help
+func commandPaletteItems(plugins []Plugin) []list.Item {
+	var items []list.Item
+	for _, c := range commands {
+		title, command := "/"+c.Name, "/"+c.Name
+		if len(c.Args) > 0 {
+			title += " " + c.Args
+			command += " "
+		}
+		items = append(items, paletteItem{title: title, description: c.Description, command: command})
+	}
+	for _, p := range plugins {
+		for _, name := range p.Commands() {
+			items = append(items, paletteItem{title: "/" + name, description: "plugin " + p.Name(), command: "/" + name + " "})
+		}
+	}
+	for _, row := range keys.FullHelp() {
+		for _, binding := range row {
+			// the palette is not run from itself, and sending needs a message
+			if binding.Keys()[0] == keys.Palette.Keys()[0] || binding.Keys()[0] == keys.Send.Keys()[0] {
+				continue
+			}
+			items = append(items, paletteItem{title: binding.Help().Key, description: binding.Help().Desc, keys: binding.Keys()[0]})
+		}
+	}
+	return items
+}
+
+// startPalette opens the command palette with the filter focused
+func (m *Model) startPalette() tea.Cmd {
+	delegate := list.NewDefaultDelegate()
+	delegate.SetSpacing(0)
+	m.palette = list.New(commandPaletteItems(m.plugins), delegate, 0, 0)
+	m.palette.Title = "Commands"
+	m.palette.SetShowStatusBar(false)
+	m.palette.SetShowHelp(false)
+	m.palette.SetSize(min(60, m.viewport.Width)-paletteStyle.GetHorizontalFrameSize(), max(m.viewport.Height-paletteStyle.GetVerticalFrameSize(), 1))
+	m.showPalette = true
+	// start typing the filter right away
+	var cmd tea.Cmd
+	m.palette, cmd = m.palette.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("/")})
+	return cmd
+}
+
+// updatePalette handles the keys of the open command palette
+func (m *Model) updatePalette(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, paletteUpKeys):
+		m.palette.CursorUp()
+	case key.Matches(msg, paletteDownKeys):
+		m.palette.CursorDown()
+	case key.Matches(msg, paletteSelectKeys):
+		m.showPalette = false
+		item, ok := m.palette.SelectedItem().(paletteItem)
+		if !ok {
+			return nil
+		}
+		if len(item.command) > 0 {
+			m.textarea.InsertString(item.command)
+			return nil
+		}
+		if keyMsg, ok := keyMsgFor(item.keys); ok {
+			return func() tea.Msg { return keyMsg }
+		}
+	case key.Matches(msg, m.keys.Esc, m.keys.Palette):
+		m.showPalette = false
+	default:
+		var cmd tea.Cmd
+		m.palette, cmd = m.palette.Update(msg)
+		return cmd
+	}
+	return nil
+}
+
+// paletteView renders the command palette centered over the conversation
+func (m Model) paletteView() string {
+	return lipgloss.Place(m.viewport.Width, m.viewport.Height, lipgloss.Center, lipgloss.Center, paletteStyle.Render(m.palette.View()))
+}
+
+// keyMsgFor returns the key message of the key name of a binding, e.g. ctrl+t or alt+p
+func keyMsgFor(name string) (tea.KeyMsg, bool) {
+	alt := strings.HasPrefix(name, "alt+") && len(name) > len("alt+")
+	if alt {
+		name = strings.TrimPrefix(name, "alt+")
+	}
+	if runes := []rune(name); len(runes) == 1 {
+		return tea.KeyMsg{Type: tea.KeyRunes, Runes: runes, Alt: alt}, true
+	}
+	// the special keys have negative types, the control keys are ASCII codes
+	for t := tea.KeyType(-64); t <= tea.KeyCtrlQuestionMark; t++ {
+		if t != tea.KeyRunes && (tea.KeyMsg{Type: t}).String() == name {
+			return tea.KeyMsg{Type: t, Alt: alt}, true
+		}
+	}
+	return tea.KeyMsg{}, false
+}
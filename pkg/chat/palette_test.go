@@ -0,0 +1,93 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandPaletteItems(t *testing.T) {
+	items := commandPaletteItems(nil)
+	titles := map[string]bool{}
+	for _, item := range items {
+		titles[strings.Fields(item.(paletteItem).title)[0]] = true
+	}
+	for _, c := range commands {
+		assert.True(t, titles["/"+c.Name], c.Name)
+	}
+	assert.True(t, titles[keys.Theme.Help().Key])
+	assert.False(t, titles[keys.Palette.Help().Key])
+}
+
+func TestCommands_Handled(t *testing.T) {
+	setTestHome(t)
+	// every command of the palette is known to handleCommand
+	for _, c := range commands {
+		m := newTestModel(t)
+		m.textarea = newTextArea()
+		_, ok := m.handleCommand("/" + c.Name)
+		assert.True(t, ok, c.Name)
+	}
+}
+
+func TestKeyMsgFor(t *testing.T) {
+	for _, name := range []string{"ctrl+t", "ctrl+@", "alt+p", "alt+r", "ctrl+left", "esc", "enter"} {
+		msg, ok := keyMsgFor(name)
+		require.True(t, ok, name)
+		assert.Equal(t, name, msg.String())
+	}
+	_, ok := keyMsgFor("ctrl+shift+nothing")
+	assert.False(t, ok)
+}
+
+func TestUpdate_CommandPalette(t *testing.T) {
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlP})
+	m = model.(Model)
+	require.True(t, m.showPalette)
+	assert.Contains(t, m.View(), "/compact")
+
+	// typing filters the entries
+	for _, r := range "pin" {
+		var cmd tea.Cmd
+		model, cmd = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = model.(Model)
+		for _, msg := range batchMessages(cmd) {
+			if matches, ok := msg.(list.FilterMatchesMsg); ok {
+				model, _ = m.Update(matches)
+				m = model.(Model)
+			}
+		}
+	}
+	assert.Equal(t, "/pin", m.palette.SelectedItem().(paletteItem).title)
+
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = model.(Model)
+	assert.False(t, m.showPalette)
+	assert.Equal(t, "/pin", m.textarea.Value())
+}
+
+// batchMessages runs the command and the commands of a batch, returning their messages
+func batchMessages(cmd tea.Cmd) []tea.Msg {
+	if cmd == nil {
+		return nil
+	}
+	msg := cmd()
+	batch, ok := msg.(tea.BatchMsg)
+	if !ok {
+		return []tea.Msg{msg}
+	}
+	var msgs []tea.Msg
+	for _, c := range batch {
+		msgs = append(msgs, batchMessages(c)...)
+	}
+	return msgs
+}
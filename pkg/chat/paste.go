@@ -0,0 +1,85 @@
+package chat
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pasteInterval is the longest pause between the keys of pasted text. bubbletea sends each
+// rune of pasted text as its own KeyMsg, back to back, while typed keys are further apart.
+const pasteInterval = 25 * time.Millisecond
+
+// pasteEndMsg ends the paste if no key followed the key with the same sequence number
+type pasteEndMsg struct {
+	seq int
+}
+
+// isPasteRune reports whether the key types a rune of pasted text
+func isPasteRune(msg tea.KeyMsg) bool {
+	return (msg.Type == tea.KeyRunes || msg.Type == tea.KeySpace || msg.Type == tea.KeyTab) && !msg.Alt
+}
+
+// isPasteLineBreak reports whether the key is a line break of pasted text,
+// a carriage return or a line feed
+func isPasteLineBreak(msg tea.KeyMsg) bool {
+	return (msg.Type == tea.KeyEnter || msg.Type == tea.KeyCtrlJ) && !msg.Alt
+}
+
+// updatePaste records the keys of pasted text. A line break following another key of the
+// paste is entered in multi-line mode instead of sending the input, and handled is set.
+// The returned command ends the paste once no key follows.
+func (m *Model) updatePaste(msg tea.KeyMsg) (cmd tea.Cmd, handled bool) {
+	now := timeNow()
+	pasting := len(m.pasteText) > 0 && now.Sub(m.lastPasteKey) <= pasteInterval
+	switch {
+	case isPasteRune(msg):
+		if !pasting {
+			m.pasteText, m.pasteValue = "", m.textarea.Value()
+		}
+		if msg.Type == tea.KeyTab {
+			m.pasteText += "\t"
+		} else {
+			m.pasteText += string(msg.Runes)
+		}
+	case isPasteLineBreak(msg) && pasting && m.autoMultilinePaste:
+		// pasted lines would be sent line by line in single-line mode
+		if !m.multiline {
+			m.setMultiline(true)
+			m.setNotice(fmt.Sprintf("Multiline mode enabled for paste. Send with %s, then %s.",
+				m.keys.Multiline.Help().Key, m.keys.Send.Help().Key))
+		}
+		// InsertString drops a lone line break
+		m.textarea, _ = m.textarea.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		m.pasteText += "\n"
+		handled = true
+	default:
+		m.pasteText = ""
+		return nil, false
+	}
+	m.lastPasteKey = now
+	m.pasteSeq++
+	seq := m.pasteSeq
+	return tea.Tick(pasteInterval, func(time.Time) tea.Msg {
+		return pasteEndMsg{seq: seq}
+	}), handled
+}
+
+// endPaste attaches the files dropped onto the terminal, which pastes them as file URIs,
+// in place of the pasted text
+func (m *Model) endPaste(seq int) {
+	if seq != m.pasteSeq || len(m.pasteText) == 0 {
+		return
+	}
+	text := m.pasteText
+	m.pasteText = ""
+	// a single key is typed, not pasted
+	if len([]rune(text)) < 2 {
+		return
+	}
+	if paths := extractFileURIs(text); len(paths) > 0 {
+		m.textarea.SetValue(m.pasteValue)
+		m.attach(paths)
+	}
+}
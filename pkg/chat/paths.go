@@ -0,0 +1,59 @@
+package chat
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// appName is the name of the directory of gptui in the user config directory
+const appName = "gptui"
+
+var (
+	// userConfigDir returns the config directory of the user, replaced in tests
+	userConfigDir = os.UserConfigDir
+	// userHomeDir returns the home directory of the user, replaced in tests
+	userHomeDir = os.UserHomeDir
+)
+
+// configDir returns the directory where gptui stores its files:
+// $XDG_CONFIG_HOME/gptui or ~/.config/gptui on Linux,
+// ~/Library/Application Support/gptui on macOS and %AppData%\gptui on Windows
+func configDir() (string, error) {
+	dir, err := userConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return migrateConfigDir(filepath.Join(dir, appName)), nil
+}
+
+// migrateConfigDir moves the files of ~/.config/gptui, where gptui stored them on every platform
+// before, to dir if dir does not exist yet, and returns the directory to use. The old directory
+// keeps being used if its files cannot be moved.
+func migrateConfigDir(dir string) string {
+	home, err := userHomeDir()
+	if err != nil {
+		return dir
+	}
+	legacyDir := filepath.Join(home, ".config", appName)
+	if legacyDir == dir {
+		return dir
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, fs.ErrNotExist) {
+		return dir
+	}
+	if info, err := os.Stat(legacyDir); err != nil || !info.IsDir() {
+		return dir
+	}
+	err = os.MkdirAll(filepath.Dir(dir), 0755)
+	if err == nil {
+		err = os.Rename(legacyDir, dir)
+	}
+	if err != nil {
+		logger.Warn("failed to move the config directory", "from", legacyDir, "to", dir, "error", err)
+		return legacyDir
+	}
+	logger.Info("moved the config directory", "from", legacyDir, "to", dir)
+	return dir
+}
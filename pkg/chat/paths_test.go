@@ -0,0 +1,78 @@
+package chat
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setTestHome isolates the files written by the test in a temporary home directory,
+// which also holds the config directory, and returns it
+func setTestHome(t *testing.T) string {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("AppData", filepath.Join(home, "AppData"))
+	return home
+}
+
+func TestConfigDir(t *testing.T) {
+	defer func(f func() (string, error)) { userConfigDir = f }(userConfigDir)
+	setTestHome(t)
+
+	for _, tt := range []struct {
+		platform, userDir string
+	}{
+		{"linux", "/home/gopher/.config"},
+		{"linux with XDG_CONFIG_HOME", "/home/gopher/.local/config"},
+		{"darwin", "/Users/gopher/Library/Application Support"},
+		{"windows", `C:\Users\gopher\AppData\Roaming`},
+	} {
+		userConfigDir = func() (string, error) { return tt.userDir, nil }
+		dir, err := configDir()
+		assert.NoError(t, err, tt.platform)
+		assert.Equal(t, filepath.Join(tt.userDir, "gptui"), dir, tt.platform)
+	}
+
+	userConfigDir = func() (string, error) { return "", errors.New("neither $XDG_CONFIG_HOME nor $HOME are defined") }
+	_, err := configDir()
+	assert.Error(t, err)
+}
+
+func TestHistoryDir_ConfigDir(t *testing.T) {
+	defer func(f func() (string, error)) { userConfigDir = f }(userConfigDir)
+	setTestHome(t)
+	userConfigDir = func() (string, error) { return "/home/gopher/.config", nil }
+
+	dir, err := HistoryDir()
+	assert.NoError(t, err)
+	assert.Equal(t, "/home/gopher/.config/gptui/chat", filepath.ToSlash(dir))
+}
+
+func TestConfigDir_MigratesLegacyDir(t *testing.T) {
+	defer func(f func() (string, error)) { userConfigDir = f }(userConfigDir)
+	home := setTestHome(t)
+	legacyDir := filepath.Join(home, ".config", "gptui")
+	require.NoError(t, os.MkdirAll(filepath.Join(legacyDir, "chat"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(legacyDir, "chat", "session.json"), []byte("{}"), 0644))
+
+	// e.g. ~/Library/Application Support on macOS
+	userDir := filepath.Join(home, "Library", "Application Support")
+	userConfigDir = func() (string, error) { return userDir, nil }
+	dir, err := configDir()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(userDir, "gptui"), dir)
+	assert.FileExists(t, filepath.Join(dir, "chat", "session.json"))
+	assert.NoDirExists(t, legacyDir)
+
+	// the files of the new directory are kept
+	require.NoError(t, os.MkdirAll(legacyDir, 0755))
+	dir, err = configDir()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(userDir, "gptui"), dir)
+	assert.DirExists(t, legacyDir)
+}
@@ -0,0 +1,148 @@
+package chat
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// ttyPath is the terminal read by the page prompt, as stdin is the piped message
+const ttyPath = "/dev/tty"
+
+// RunPipe sends the message as a single completion request configured by the chat flags
+// and writes the content of the response to w followed by a newline.
+// Streamed deltas are written as soon as they arrive, unless the response is paginated with --page-size.
+// When ctx is done the request is cancelled, and the content streamed so far is written
+// before the error of ctx is returned.
+func RunPipe(ctx context.Context, message string, w io.Writer) error {
+	pageSize := viper.GetInt("page-size")
+	if pageSize <= 0 {
+		return writeCompletion(ctx, message, w)
+	}
+	var b strings.Builder
+	if err := writeCompletion(ctx, message, &b); err != nil {
+		return err
+	}
+	return PaginateOutput(b.String(), pageSize, confirmTTY, w)
+}
+
+// PaginateOutput writes the text to w in pages of pageSize lines. Each page is followed by
+// a "--- page M/T ---" line, and confirm is called before the next page is written.
+func PaginateOutput(text string, pageSize int, confirm func() error, w io.Writer) error {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if pageSize <= 0 || len(lines) <= pageSize {
+		_, err := io.WriteString(w, text)
+		return err
+	}
+	pages := (len(lines) + pageSize - 1) / pageSize
+	for page := 1; page <= pages; page++ {
+		chunk := lines[(page-1)*pageSize : min(page*pageSize, len(lines))]
+		if _, err := fmt.Fprintf(w, "%s\n--- page %d/%d ---\n", strings.Join(chunk, "\n"), page, pages); err != nil {
+			return err
+		}
+		if page < pages {
+			if err := confirm(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// confirmTTY waits until enter is pressed in the terminal
+func confirmTTY() error {
+	tty, err := os.Open(ttyPath)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+	_, err = bufio.NewReader(tty).ReadBytes('\n')
+	return err
+}
+
+// writeCompletion writes the content of the response to the message to w followed by a newline
+func writeCompletion(ctx context.Context, message string, w io.Writer) error {
+	client, err := newClientFromConfig()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	client.history = append(client.history, Message{Role: "user", Content: message})
+	_, err = writeResponse(ctx, client, w)
+	return err
+}
+
+// writeResponse requests the completion of the history of the client and writes its
+// content to w followed by a newline. The content is returned without the newline.
+// When ctx is done the client is closed, and the partial content of a stream is
+// written and returned with the error of ctx.
+func writeResponse(ctx context.Context, client *Client, w io.Writer) (string, error) {
+	stop := context.AfterFunc(ctx, client.Close)
+	defer stop()
+	req := newCompletionRequest(client, nil, nil)
+
+	if !client.stream {
+		resp, err := client.CreateCompletion(req)
+		if err != nil {
+			return "", err
+		}
+		if len(resp.Choices) == 0 {
+			return "", errors.New("no choices in the completion response")
+		}
+		content := resp.Choices[0].Message.Content
+		_, err = fmt.Fprintln(w, content)
+		return content, err
+	}
+
+	var content strings.Builder
+	w = io.MultiWriter(w, &content)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := client.CreateCompletion(req)
+		errs <- err
+	}()
+	write := func(event CompletionStreamResponse) error {
+		if len(event.Choices) == 0 {
+			return nil
+		}
+		_, err := io.WriteString(w, event.Choices[0].Delta.Content)
+		return err
+	}
+	for {
+		select {
+		case event := <-client.events:
+			if err := write(event); err != nil {
+				return "", err
+			}
+		case err := <-errs:
+			var streamErr *StreamError
+			if errors.As(err, &streamErr) {
+				logger.Warn("stream events were skipped", "error", err)
+			} else if err != nil && ctx.Err() == nil {
+				return "", err
+			}
+			// the last event may still be buffered when the request returns
+			for {
+				select {
+				case event := <-client.events:
+					if err := write(event); err != nil {
+						return "", err
+					}
+				default:
+					text := content.String()
+					if _, err := fmt.Fprintln(w); err != nil {
+						return text, err
+					}
+					return text, ctx.Err()
+				}
+			}
+		}
+	}
+}
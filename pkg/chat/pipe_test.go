@@ -0,0 +1,159 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// setPipeConfig sets the chat flags read by RunPipe for the duration of the test
+func setPipeConfig(t *testing.T, values map[string]any) {
+	viper.Set("max-context-length", 1024)
+	for key, value := range values {
+		viper.Set(key, value)
+	}
+	t.Cleanup(viper.Reset)
+}
+
+func TestRunPipe(t *testing.T) {
+	var request CompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/chat/completions", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"Bonjour"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+	setPipeConfig(t, map[string]any{
+		"openai-api-base": server.URL,
+		"model":           "gpt-4",
+		"system":          "Answer in French.",
+		"stream":          false,
+	})
+
+	var out bytes.Buffer
+	assert.NoError(t, RunPipe(context.Background(), "hello\n", &out))
+	assert.Equal(t, "Bonjour\n", out.String())
+	assert.Equal(t, "gpt-4", request.Model)
+	assert.Equal(t, []Message{{Role: "system", Content: "Answer in French."}, {Role: "user", Content: "hello\n"}}, request.Messages)
+}
+
+func TestRunPipe_Stream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range []string{"Hel", "lo", " world"} {
+			w.Write([]byte(`data: {"choices":[{"delta":{"content":"` + delta + `"}}]}` + "\n\n"))
+		}
+		w.Write([]byte(`data: {"choices":[{"delta":{},"finish_reason":"stop"}]}` + "\n\n"))
+		w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	defer server.Close()
+	setPipeConfig(t, map[string]any{"openai-api-base": server.URL, "model": "gpt-4", "stream": true})
+
+	var out bytes.Buffer
+	assert.NoError(t, RunPipe(context.Background(), "hello", &out))
+	assert.Equal(t, "Hello world\n", out.String())
+}
+
+func TestRunPipe_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error":{"message":"Incorrect API key provided","type":"invalid_request_error"}}`))
+	}))
+	defer server.Close()
+	setPipeConfig(t, map[string]any{"openai-api-base": server.URL, "model": "gpt-4", "stream": true})
+
+	var out bytes.Buffer
+	err := RunPipe(context.Background(), "hello", &out)
+	var apiErr *APIError
+	assert.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Empty(t, out.String())
+}
+
+func TestNewClientFromConfig_StrictEnv(t *testing.T) {
+	t.Setenv("GIT_BRANCH", "main")
+	setPipeConfig(t, map[string]any{"system": "Branch ${GIT_BRANCH}, project ${GPTUI_UNSET_PROJECT}."})
+
+	client, err := newClientFromConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "Branch main, project .", client.system)
+
+	viper.Set("strict-env", true)
+	_, err = newClientFromConfig()
+	assert.ErrorContains(t, err, "GPTUI_UNSET_PROJECT")
+}
+
+func TestPaginateOutput(t *testing.T) {
+	confirmed := 0
+	confirm := func() error {
+		confirmed++
+		return nil
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, PaginateOutput("1\n2\n3\n4\n5\n", 2, confirm, &out))
+	assert.Equal(t, "1\n2\n--- page 1/3 ---\n3\n4\n--- page 2/3 ---\n5\n--- page 3/3 ---\n", out.String())
+	assert.Equal(t, 2, confirmed)
+
+	// exact multiple of the page size
+	out.Reset()
+	confirmed = 0
+	assert.NoError(t, PaginateOutput("1\n2\n3\n4\n", 2, confirm, &out))
+	assert.Equal(t, "1\n2\n--- page 1/2 ---\n3\n4\n--- page 2/2 ---\n", out.String())
+	assert.Equal(t, 1, confirmed)
+
+	// a single page is written as is
+	out.Reset()
+	confirmed = 0
+	assert.NoError(t, PaginateOutput("1\n2\n", 2, confirm, &out))
+	assert.Equal(t, "1\n2\n", out.String())
+	assert.Zero(t, confirmed)
+}
+
+func TestPaginateOutput_ConfirmError(t *testing.T) {
+	var out bytes.Buffer
+	err := PaginateOutput("1\n2\n3\n", 1, func() error { return io.EOF }, &out)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, "1\n--- page 1/3 ---\n", out.String())
+}
+
+// cancelWriter cancels the context on the first write
+type cancelWriter struct {
+	bytes.Buffer
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return w.Buffer.Write(p)
+}
+
+func (w *cancelWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func TestRunPipe_Interrupted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`data: {"choices":[{"delta":{"content":"Partial"}}]}` + "\n\n"))
+		w.(http.Flusher).Flush()
+		// the rest of the response never arrives
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	setPipeConfig(t, map[string]any{"openai-api-base": server.URL, "model": "gpt-4", "stream": true})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := &cancelWriter{cancel: cancel}
+	err := RunPipe(ctx, "hello", out)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, "Partial\n", out.String())
+}
@@ -0,0 +1,204 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// pluginDescribeTimeout is the time a plugin program has to describe itself
+	pluginDescribeTimeout = 5 * time.Second
+	// pluginRunTimeout is the time a plugin program has to run a command
+	pluginRunTimeout = time.Minute
+)
+
+// Plugin handles inline commands which are not built in.
+//
+// The plugins of the plugins directory are programs. Run with --describe, a program prints
+// its name and commands as JSON, e.g. {"name":"jira","commands":["ticket"]}. A command runs
+// the program with the PluginRequest as JSON on its standard input, and the program prints
+// the PluginResponse as JSON on its standard output.
+type Plugin interface {
+	// Name identifies the plugin in the command palette and in plugins list
+	Name() string
+	// Commands are the names of the inline commands without the slash
+	Commands() []string
+	// Run runs the command of the request. It is called outside of the update loop.
+	Run(request PluginRequest) (PluginResponse, error)
+}
+
+// PluginRequest is an inline command run by a plugin
+type PluginRequest struct {
+	// Command is the name of the command without the slash
+	Command string `json:"command"`
+	// Args are the arguments of the command split on spaces
+	Args []string `json:"args"`
+	// Messages are the messages of the conversation
+	Messages []Message `json:"messages"`
+}
+
+// PluginResponse is the result of an inline command. Empty fields are ignored.
+type PluginResponse struct {
+	// Notice is shown below the conversation
+	Notice string `json:"notice,omitempty"`
+	// Input replaces the input
+	Input string `json:"input,omitempty"`
+	// Send is sent as a message of the user
+	Send string `json:"send,omitempty"`
+}
+
+// pluginResultMsg is the response of the plugin to an inline command, or the error running it
+type pluginResultMsg struct {
+	response PluginResponse
+	err      error
+}
+
+// execPlugin is a plugin program
+type execPlugin struct {
+	path     string
+	name     string
+	commands []string
+}
+
+func (p *execPlugin) Name() string       { return p.name }
+func (p *execPlugin) Commands() []string { return p.commands }
+
+// Run runs the program with the request on its standard input
+func (p *execPlugin) Run(request PluginRequest) (PluginResponse, error) {
+	input, err := json.Marshal(request)
+	if err != nil {
+		return PluginResponse{}, err
+	}
+	output, err := runPlugin(p.path, pluginRunTimeout, input)
+	if err != nil {
+		return PluginResponse{}, err
+	}
+	var response PluginResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		return PluginResponse{}, fmt.Errorf("plugin %s: invalid response: %w", p.name, err)
+	}
+	return response, nil
+}
+
+// runPlugin runs the program with the input and returns its standard output.
+// The error includes the standard error of the program if it fails.
+func runPlugin(path string, timeout time.Duration, input []byte, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); len(msg) > 0 {
+			return nil, fmt.Errorf("%s: %w: %s", filepath.Base(path), err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return output, nil
+}
+
+// openPlugin asks the program at path to describe itself
+func openPlugin(path string) (Plugin, error) {
+	output, err := runPlugin(path, pluginDescribeTimeout, nil, "--describe")
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		Name     string   `json:"name"`
+		Commands []string `json:"commands"`
+	}
+	if err := json.Unmarshal(output, &info); err != nil {
+		return nil, fmt.Errorf("%s: invalid description: %w", filepath.Base(path), err)
+	}
+	if len(info.Name) == 0 || len(info.Commands) == 0 {
+		return nil, fmt.Errorf("%s: the description has no name or no commands", filepath.Base(path))
+	}
+	return &execPlugin{path: path, name: info.Name, commands: info.Commands}, nil
+}
+
+// isExecutable reports whether the file is a program: executable on Unix, or
+// with the extension of a program on Windows
+func isExecutable(info os.FileInfo) bool {
+	if !info.Mode().IsRegular() {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return slices.Contains([]string{".exe", ".bat", ".cmd"}, strings.ToLower(filepath.Ext(info.Name())))
+	}
+	return info.Mode().Perm()&0111 != 0
+}
+
+// LoadPlugins describes the programs of the directory in the order of their names.
+// The programs which fail to describe themselves are skipped and reported by the error.
+func LoadPlugins(dir string) ([]Plugin, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var plugins []Plugin
+	var errs []error
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !isExecutable(info) {
+			continue
+		}
+		p, err := openPlugin(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to load plugin %w", err))
+			continue
+		}
+		plugins = append(plugins, p)
+	}
+	return plugins, errors.Join(errs...)
+}
+
+// pluginFor returns the plugin handling the command, the first one if several do
+func pluginFor(plugins []Plugin, name string) (Plugin, bool) {
+	for _, p := range plugins {
+		if slices.Contains(p.Commands(), name) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// pluginCmd returns a tea.Cmd which runs the command of the request with the plugin
+func pluginCmd(p Plugin, request PluginRequest) tea.Cmd {
+	return func() tea.Msg {
+		response, err := p.Run(request)
+		return pluginResultMsg{response: response, err: err}
+	}
+}
+
+// applyPluginResult shows the notice of the response, replaces the input and sends the message
+func (m *Model) applyPluginResult(msg pluginResultMsg) []tea.Cmd {
+	if msg.err != nil {
+		m.setNotice(warnStyle.Render(msg.err.Error()))
+		return nil
+	}
+	response := msg.response
+	if len(response.Notice) > 0 {
+		m.setNotice(response.Notice)
+	}
+	if len(response.Input) > 0 {
+		m.textarea.SetValue(response.Input)
+	}
+	if len(response.Send) > 0 {
+		return m.send(response.Send)
+	}
+	return nil
+}
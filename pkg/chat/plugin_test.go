@@ -0,0 +1,143 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPluginHelperProcess is run as the plugin program by the tests below
+func TestPluginHelperProcess(t *testing.T) {
+	mode := os.Getenv("GPTUI_PLUGIN_HELPER")
+	if len(mode) == 0 {
+		return
+	}
+	if slices.Contains(os.Args, "--describe") {
+		switch mode {
+		case "broken":
+			fmt.Println("not a description")
+		default:
+			fmt.Println(`{"name":"echo","commands":["echo","shout"]}`)
+		}
+		os.Exit(0)
+	}
+	var request PluginRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&request); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if request.Command == "echo" {
+		fmt.Fprintln(os.Stderr, "echo is broken")
+		os.Exit(1)
+	}
+	json.NewEncoder(os.Stdout).Encode(PluginResponse{
+		Notice: fmt.Sprintf("%s: %s (%d messages)", request.Command, request.Args[0], len(request.Messages)),
+		Input:  strings.ToUpper(strings.Join(request.Args, " ")),
+	})
+	os.Exit(0)
+}
+
+// writeTestPlugin writes a plugin program to the directory running TestPluginHelperProcess in the mode
+func writeTestPlugin(t *testing.T, dir, name, mode string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test plugins are shell scripts")
+	}
+	script := fmt.Sprintf("#!/bin/sh\nGPTUI_PLUGIN_HELPER=%s exec %q -test.run=TestPluginHelperProcess -- \"$@\"\n", mode, os.Args[0])
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(script), 0755))
+}
+
+// echoPlugin sets the arguments of its command as the notice
+type echoPlugin struct {
+	calls []string
+}
+
+func (p *echoPlugin) Name() string       { return "echo" }
+func (p *echoPlugin) Commands() []string { return []string{"echo", "shout"} }
+func (p *echoPlugin) Run(request PluginRequest) (PluginResponse, error) {
+	p.calls = append(p.calls, request.Command)
+	return PluginResponse{Notice: request.Command + ": " + request.Args[0]}, nil
+}
+
+func TestLoadPlugins(t *testing.T) {
+	dir := t.TempDir()
+	plugins, err := LoadPlugins(dir)
+	require.NoError(t, err)
+	assert.Empty(t, plugins)
+
+	writeTestPlugin(t, dir, "b", "echo")
+	writeTestPlugin(t, dir, "a", "echo")
+	// not executable
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0644))
+	plugins, err = LoadPlugins(dir)
+	require.NoError(t, err)
+	require.Len(t, plugins, 2)
+	assert.Equal(t, filepath.Join(dir, "a"), plugins[0].(*execPlugin).path)
+	assert.Equal(t, "echo", plugins[0].Name())
+	assert.Equal(t, []string{"echo", "shout"}, plugins[0].Commands())
+
+	response, err := plugins[0].Run(PluginRequest{Command: "shout", Args: []string{"hello", "world"}, Messages: []Message{{Role: "user", Content: "Hi"}}})
+	require.NoError(t, err)
+	assert.Equal(t, PluginResponse{Notice: "shout: hello (1 messages)", Input: "HELLO WORLD"}, response)
+
+	_, err = plugins[0].Run(PluginRequest{Command: "echo", Args: []string{"hello"}})
+	assert.ErrorContains(t, err, "echo is broken")
+}
+
+func TestLoadPlugins_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPlugin(t, dir, "broken", "broken")
+	writeTestPlugin(t, dir, "echo", "echo")
+	// the valid plugins load anyway
+	plugins, err := LoadPlugins(dir)
+	assert.ErrorContains(t, err, "failed to load plugin broken: invalid description")
+	require.Len(t, plugins, 1)
+	assert.Equal(t, "echo", plugins[0].Name())
+}
+
+func TestHandleCommand_Plugin(t *testing.T) {
+	plugin := &echoPlugin{}
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.plugins = []Plugin{plugin}
+
+	m.textarea.SetValue("/shout hello world")
+	model, cmd := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = model.(Model)
+	assert.Equal(t, "running /shout…", m.notice)
+	assert.Empty(t, m.client.history)
+	messages := batchMessages(cmd)
+	assert.Equal(t, []string{"shout"}, plugin.calls)
+	assert.Contains(t, messages, pluginResultMsg{response: PluginResponse{Notice: "shout: hello"}})
+
+	model, _ = m.Update(pluginResultMsg{response: PluginResponse{Notice: "shout: hello", Input: "HELLO"}})
+	m = model.(Model)
+	assert.Equal(t, "shout: hello", m.notice)
+	assert.Equal(t, "HELLO", m.textarea.Value())
+
+	model, _ = m.Update(pluginResultMsg{err: fmt.Errorf("echo is broken")})
+	m = model.(Model)
+	assert.Contains(t, m.notice, "echo is broken")
+	assert.Nil(t, m.err)
+
+	// commands of no plugin are sent as messages
+	_, ok := m.handleCommand("/unknown")
+	assert.False(t, ok)
+
+	titles := map[string]string{}
+	for _, item := range commandPaletteItems(m.plugins) {
+		titles[item.(paletteItem).title] = item.(paletteItem).description
+	}
+	assert.Equal(t, "plugin echo", titles["/echo"])
+	assert.Equal(t, "plugin echo", titles["/shout"])
+}
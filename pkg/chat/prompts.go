@@ -0,0 +1,156 @@
+package chat
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sahilm/fuzzy"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// placeholderPattern matches the {{placeholders}} of a prompt which are to be filled in
+	placeholderPattern = regexp.MustCompile(`\{\{[^{}]*\}\}`)
+	// placeholderStyle highlights the placeholders of the prompts
+	placeholderStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("#FAFAFA")).Background(lipgloss.Color("63"))
+	// promptSelectKeys insert the text of the selected prompt
+	promptSelectKeys = key.NewBinding(key.WithKeys("enter"))
+)
+
+// Prompt is a reusable message of the prompt library
+type Prompt struct {
+	Name string   `yaml:"name"`
+	Text string   `yaml:"text"`
+	Tags []string `yaml:"tags"`
+}
+
+// filterValue is the text of the prompt matched by the search, its name and tags
+func (p Prompt) filterValue() string {
+	return strings.Join(append([]string{p.Name}, p.Tags...), " ")
+}
+
+// PromptLibrary is a collection of prompts read from a YAML file
+type PromptLibrary struct {
+	Prompts []Prompt `yaml:"prompts"`
+}
+
+// LoadPromptLibrary reads the prompt library from the YAML file at path,
+// every prompt needs a name and a text.
+func LoadPromptLibrary(path string) (*PromptLibrary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var library PromptLibrary
+	if err := yaml.Unmarshal(data, &library); err != nil {
+		return nil, fmt.Errorf("invalid prompt library %s: %w", path, err)
+	}
+	for i, prompt := range library.Prompts {
+		if len(prompt.Name) == 0 || len(prompt.Text) == 0 {
+			return nil, fmt.Errorf("invalid prompt library %s: prompt %d needs a name and a text", path, i+1)
+		}
+	}
+	return &library, nil
+}
+
+// Search returns the prompts whose name and tags fuzzy match the query, best matches first.
+// All prompts are returned for an empty query.
+func (l *PromptLibrary) Search(query string) []Prompt {
+	if len(strings.TrimSpace(query)) == 0 {
+		return l.Prompts
+	}
+	targets := make([]string, len(l.Prompts))
+	for i, prompt := range l.Prompts {
+		targets[i] = prompt.filterValue()
+	}
+	var prompts []Prompt
+	for _, match := range fuzzy.Find(query, targets) {
+		prompts = append(prompts, l.Prompts[match.Index])
+	}
+	return prompts
+}
+
+// highlightPlaceholders renders the placeholders of the text with placeholderStyle
+func highlightPlaceholders(text string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		return placeholderStyle.Render(placeholder)
+	})
+}
+
+// promptItem is an entry of the prompt picker
+type promptItem struct {
+	prompt Prompt
+}
+
+func (i promptItem) Title() string { return i.prompt.Name }
+func (i promptItem) Description() string {
+	// the first line of the text with the tags
+	text, _, _ := strings.Cut(i.prompt.Text, "\n")
+	if len(i.prompt.Tags) > 0 {
+		text = "[" + strings.Join(i.prompt.Tags, ", ") + "] " + text
+	}
+	return highlightPlaceholders(text)
+}
+func (i promptItem) FilterValue() string { return i.prompt.filterValue() }
+
+// startPromptPicker opens the prompt picker with the filter focused
+func (m *Model) startPromptPicker() tea.Cmd {
+	if m.prompts == nil {
+		m.setNotice(errorStyle.Render("no prompt library, set one with --prompt-library"))
+		return nil
+	}
+	var items []list.Item
+	for _, prompt := range m.prompts.Prompts {
+		items = append(items, promptItem{prompt: prompt})
+	}
+	delegate := list.NewDefaultDelegate()
+	delegate.SetSpacing(0)
+	m.promptList = list.New(items, delegate, 0, 0)
+	m.promptList.Title = "Prompts"
+	m.promptList.SetShowStatusBar(false)
+	m.promptList.SetShowHelp(false)
+	m.promptList.SetSize(min(60, m.viewport.Width)-paletteStyle.GetHorizontalFrameSize(), max(m.viewport.Height-paletteStyle.GetVerticalFrameSize(), 1))
+	m.pickingPrompt = true
+	// start typing the filter right away
+	var cmd tea.Cmd
+	m.promptList, cmd = m.promptList.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("/")})
+	return cmd
+}
+
+// updatePromptPicker handles the keys of the open prompt picker
+func (m *Model) updatePromptPicker(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, paletteUpKeys):
+		m.promptList.CursorUp()
+	case key.Matches(msg, paletteDownKeys):
+		m.promptList.CursorDown()
+	case key.Matches(msg, promptSelectKeys):
+		m.pickingPrompt = false
+		item, ok := m.promptList.SelectedItem().(promptItem)
+		if !ok {
+			return nil
+		}
+		m.textarea.InsertString(item.prompt.Text)
+		if placeholders := placeholderPattern.FindAllString(item.prompt.Text, -1); len(placeholders) > 0 {
+			m.setNotice("Fill in " + highlightPlaceholders(strings.Join(placeholders, " ")))
+		}
+	case key.Matches(msg, m.keys.Esc, m.keys.Prompts):
+		m.pickingPrompt = false
+	default:
+		var cmd tea.Cmd
+		m.promptList, cmd = m.promptList.Update(msg)
+		return cmd
+	}
+	return nil
+}
+
+// promptPickerView renders the prompt picker centered over the conversation
+func (m Model) promptPickerView() string {
+	return lipgloss.Place(m.viewport.Width, m.viewport.Height, lipgloss.Center, lipgloss.Center, paletteStyle.Render(m.promptList.View()))
+}
@@ -0,0 +1,91 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const promptLibraryYAML = `prompts:
+  - name: Code review
+    text: "Review this {{language}} code:\n{{code}}"
+    tags: [go, review]
+  - name: Commit message
+    text: Write a commit message for this diff
+    tags: [git]
+  - name: Translate
+    text: Translate to {{language}}
+`
+
+func writePromptLibrary(t *testing.T, content string) string {
+	filePath := filepath.Join(t.TempDir(), "prompts.yaml")
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+	return filePath
+}
+
+func TestLoadPromptLibrary(t *testing.T) {
+	library, err := LoadPromptLibrary(writePromptLibrary(t, promptLibraryYAML))
+	require.NoError(t, err)
+	require.Len(t, library.Prompts, 3)
+	assert.Equal(t, Prompt{Name: "Code review", Text: "Review this {{language}} code:\n{{code}}", Tags: []string{"go", "review"}}, library.Prompts[0])
+
+	_, err = LoadPromptLibrary(writePromptLibrary(t, "prompts:\n  - name: No text\n"))
+	assert.ErrorContains(t, err, "prompt 1 needs a name and a text")
+	_, err = LoadPromptLibrary(writePromptLibrary(t, "prompts: {"))
+	assert.Error(t, err)
+	_, err = LoadPromptLibrary(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestPromptLibrary_Search(t *testing.T) {
+	library, err := LoadPromptLibrary(writePromptLibrary(t, promptLibraryYAML))
+	require.NoError(t, err)
+	names := func(prompts []Prompt) []string {
+		var names []string
+		for _, prompt := range prompts {
+			names = append(names, prompt.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"Code review", "Commit message", "Translate"}, names(library.Search("")))
+	assert.Equal(t, []string{"Code review"}, names(library.Search("crev")))
+	// the tags are searched as well
+	assert.Equal(t, []string{"Commit message"}, names(library.Search("git")))
+	assert.Empty(t, library.Search("xyz"))
+}
+
+func TestUpdate_PromptPicker(t *testing.T) {
+	library, err := LoadPromptLibrary(writePromptLibrary(t, promptLibraryYAML))
+	require.NoError(t, err)
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.prompts = library
+
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlUnderscore})
+	m = model.(Model)
+	require.True(t, m.pickingPrompt)
+	assert.Contains(t, m.View(), "Commit message")
+
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m = model.(Model)
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyDown})
+	m = model.(Model)
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = model.(Model)
+	assert.False(t, m.pickingPrompt)
+	assert.Equal(t, "Translate to {{language}}", m.textarea.Value())
+	assert.Contains(t, ansiPattern.ReplaceAllString(m.viewport.View(), ""), "Fill in {{language}}")
+}
+
+func TestHighlightPlaceholders(t *testing.T) {
+	highlighted := highlightPlaceholders("Review {{code}} in {{ language }}")
+	assert.Equal(t, "Review {{code}} in {{ language }}", ansiPattern.ReplaceAllString(highlighted, ""))
+	assert.Contains(t, highlighted, placeholderStyle.Render("{{code}}"))
+}
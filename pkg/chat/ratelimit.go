@@ -0,0 +1,78 @@
+package chat
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// RateLimitInfo is the rate limit state sent by the API in the x-ratelimit-* response headers.
+// Counts are -1 if the header is missing.
+type RateLimitInfo struct {
+	LimitRequests     int
+	LimitTokens       int
+	RemainingRequests int
+	RemainingTokens   int
+	ResetRequests     time.Time
+	ResetTokens       time.Time
+}
+
+// parseRateLimit parses the rate limit headers of a response received at now.
+// It returns false if the response has no remaining counts.
+func parseRateLimit(header http.Header, now time.Time) (RateLimitInfo, bool) {
+	count := func(name string) int {
+		n, err := strconv.Atoi(strings.TrimSpace(header.Get(name)))
+		if err != nil {
+			return -1
+		}
+		return n
+	}
+	info := RateLimitInfo{
+		LimitRequests:     count("x-ratelimit-limit-requests"),
+		LimitTokens:       count("x-ratelimit-limit-tokens"),
+		RemainingRequests: count("x-ratelimit-remaining-requests"),
+		RemainingTokens:   count("x-ratelimit-remaining-tokens"),
+		ResetRequests:     parseReset(header.Get("x-ratelimit-reset-requests"), now),
+		ResetTokens:       parseReset(header.Get("x-ratelimit-reset-tokens"), now),
+	}
+	return info, info.RemainingRequests >= 0 || info.RemainingTokens >= 0
+}
+
+// parseReset returns the time of a reset header, either an RFC 1123 date, a number of
+// seconds or a duration like 6m0s. It returns the zero time if the value is invalid.
+func parseReset(value string, now time.Time) time.Time {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return time.Time{}
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return now.Add(time.Duration(seconds * float64(time.Second)))
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(d)
+	}
+	return time.Time{}
+}
+
+// rateLimited reports whether no request can be sent before the requests reset
+func (r RateLimitInfo) rateLimited(now time.Time) bool {
+	return r.RemainingRequests == 0 && now.Before(r.ResetRequests)
+}
+
+// remainingStyle returns the color of a remaining count: green, amber below a quarter
+// of the limit and red below a tenth or at zero
+func remainingStyle(remaining, limit int) lipgloss.Style {
+	switch {
+	case remaining == 0 || limit > 0 && remaining*10 < limit:
+		return errorStyle
+	case limit > 0 && remaining*4 < limit:
+		return warnStyle
+	}
+	return okStyle
+}
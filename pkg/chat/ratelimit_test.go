@@ -0,0 +1,80 @@
+package chat
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	now := time.Date(2023, 11, 6, 14, 30, 0, 0, time.UTC)
+	header := http.Header{}
+	header.Set("x-ratelimit-limit-requests", "60")
+	header.Set("x-ratelimit-remaining-requests", "59")
+	header.Set("x-ratelimit-remaining-tokens", "89500")
+	header.Set("x-ratelimit-reset-requests", "Mon, 06 Nov 2023 14:32:05 GMT")
+	header.Set("x-ratelimit-reset-tokens", "12")
+
+	info, ok := parseRateLimit(header, now)
+	assert.True(t, ok)
+	assert.Equal(t, RateLimitInfo{
+		LimitRequests:     60,
+		LimitTokens:       -1,
+		RemainingRequests: 59,
+		RemainingTokens:   89500,
+		ResetRequests:     time.Date(2023, 11, 6, 14, 32, 5, 0, time.UTC),
+		ResetTokens:       now.Add(12 * time.Second),
+	}, info)
+
+	_, ok = parseRateLimit(http.Header{}, now)
+	assert.False(t, ok)
+}
+
+func TestParseReset(t *testing.T) {
+	now := time.Date(2023, 11, 6, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"Mon, 06 Nov 2023 14:32:05 GMT", time.Date(2023, 11, 6, 14, 32, 5, 0, time.UTC)},
+		{"125", now.Add(125 * time.Second)},
+		{"0.5", now.Add(500 * time.Millisecond)},
+		{"6m0s", now.Add(6 * time.Minute)},
+		{"20ms", now.Add(20 * time.Millisecond)},
+		{"", time.Time{}},
+		{"soon", time.Time{}},
+	}
+	for _, tt := range tests {
+		assert.True(t, tt.want.Equal(parseReset(tt.value, now)), tt.value)
+	}
+}
+
+func TestRemainingStyle(t *testing.T) {
+	assert.Equal(t, okStyle, remainingStyle(50, 60))
+	assert.Equal(t, warnStyle, remainingStyle(10, 60))
+	assert.Equal(t, errorStyle, remainingStyle(5, 60))
+	assert.Equal(t, errorStyle, remainingStyle(0, -1))
+	assert.Equal(t, okStyle, remainingStyle(3, -1))
+}
+
+func TestUpdate_RateLimited(t *testing.T) {
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+
+	reset := time.Now().Add(time.Minute)
+	model, _ := m.Update(RateLimitInfo{RemainingRequests: 0, RemainingTokens: 100, LimitRequests: 60, LimitTokens: -1, ResetRequests: reset})
+	m = model.(Model)
+	assert.Contains(t, m.statusView(), "⏱ Rate limited until "+reset.Format(time.TimeOnly))
+
+	m.textarea.SetValue("Hi")
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = model.(Model)
+	assert.False(t, m.waiting)
+	assert.Empty(t, m.client.history)
+	assert.Equal(t, "Hi", m.textarea.Value())
+}
@@ -0,0 +1,117 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	// minRating and maxRating are the bounds of the ratings of the responses
+	minRating = 1
+	maxRating = 5
+)
+
+// ratingStyle renders the stars of the rated responses
+var ratingStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
+
+// RateMessage sets the rating of the message at messageIndex of the session, from 1 to 5
+func RateMessage(session *Session, messageIndex, rating int) error {
+	if messageIndex < 0 || messageIndex >= len(session.Messages) {
+		return fmt.Errorf("message %d out of range, the session has %d messages", messageIndex+1, len(session.Messages))
+	}
+	if rating < minRating || rating > maxRating {
+		return fmt.Errorf("rating %d out of range %d-%d", rating, minRating, maxRating)
+	}
+	if session.Ratings == nil {
+		session.Ratings = map[int]int{}
+	}
+	session.Ratings[messageIndex] = rating
+	return nil
+}
+
+// ratingStars renders the rating as filled and empty stars, e.g. ★★★☆☆
+func ratingStars(rating int) string {
+	return strings.Repeat("★", rating) + strings.Repeat("☆", maxRating-rating)
+}
+
+// RatingStats returns the average of the ratings of the sessions and the number
+// of ratings by value, the count of rating r at index r-1
+func RatingStats(sessions []Session) (average float64, distribution [maxRating]int) {
+	var sum, n int
+	for _, session := range sessions {
+		for _, rating := range session.Ratings {
+			if rating < minRating || rating > maxRating {
+				continue
+			}
+			sum += rating
+			n++
+			distribution[rating-1]++
+		}
+	}
+	if n > 0 {
+		average = float64(sum) / float64(n)
+	}
+	return average, distribution
+}
+
+// FineTuningExample is a line of the JSONL fine-tuning export, a conversation
+// ending with a response of the assistant and its rating if it was rated
+type FineTuningExample struct {
+	Messages []Message `json:"messages"`
+	Rating   int       `json:"rating,omitempty"`
+}
+
+// FineTuningExamples returns an example per response of the session with the
+// messages up to the response, preceded by the system prompt of the session
+func FineTuningExamples(session Session) []FineTuningExample {
+	var prefix []Message
+	if len(session.Metadata.SystemPrompt) > 0 {
+		prefix = []Message{{Role: "system", Content: session.Metadata.SystemPrompt}}
+	}
+	var examples []FineTuningExample
+	for i, message := range session.Messages {
+		if message.Role != "assistant" {
+			continue
+		}
+		messages := append(prefix[:len(prefix):len(prefix)], session.Messages[:i+1]...)
+		examples = append(examples, FineTuningExample{Messages: apiMessages(messages), Rating: session.Ratings[i]})
+	}
+	return examples
+}
+
+// WriteFineTuningJSONL writes the fine-tuning examples of the session to w, one JSON object per line
+func WriteFineTuningJSONL(w io.Writer, session Session) error {
+	encoder := json.NewEncoder(w)
+	for _, example := range FineTuningExamples(session) {
+		if err := encoder.Encode(example); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rateMessage rates the message at index i of the history and saves the session
+func (m *Model) rateMessage(i, rating int) error {
+	session := Session{Messages: m.client.history}
+	if err := RateMessage(&session, i, rating); err != nil {
+		return err
+	}
+	// ratings are indexed by the position of the message in the session file, like notes
+	if m.ratings == nil {
+		m.ratings = map[int]int{}
+	}
+	m.ratings[m.historyOffset+i] = rating
+	return m.saveHistory()
+}
+
+// renderRating renders the stars below the message at index i of the history if it is rated
+func (m Model) renderRating(i int) string {
+	if rating, ok := m.ratings[m.historyOffset+i]; ok {
+		return ratingStyle.Render(ratingStars(rating)) + "\n"
+	}
+	return ""
+}
@@ -0,0 +1,123 @@
+package chat
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		index   int
+		rating  int
+		wantErr string
+	}{
+		{"lowest rating", 1, 1, ""},
+		{"highest rating", 1, 5, ""},
+		{"first message", 0, 3, ""},
+		{"rating too low", 1, 0, "rating 0 out of range 1-5"},
+		{"rating too high", 1, 6, "rating 6 out of range 1-5"},
+		{"negative index", -1, 3, "message 0 out of range, the session has 2 messages"},
+		{"index past the end", 2, 3, "message 3 out of range, the session has 2 messages"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := &Session{Messages: []Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}}}
+			err := RateMessage(session, tt.index, tt.rating)
+			if len(tt.wantErr) > 0 {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.Empty(t, session.Ratings)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, map[int]int{tt.index: tt.rating}, session.Ratings)
+		})
+	}
+
+	assert.EqualError(t, RateMessage(&Session{}, 0, 3), "message 1 out of range, the session has 0 messages")
+}
+
+func TestRatingStats(t *testing.T) {
+	average, distribution := RatingStats(nil)
+	assert.Zero(t, average)
+	assert.Equal(t, [5]int{}, distribution)
+
+	average, distribution = RatingStats([]Session{
+		{Ratings: map[int]int{1: 5, 3: 4}},
+		{},
+		{Ratings: map[int]int{1: 1, 5: 4, 7: 9}},
+	})
+	assert.InDelta(t, 3.5, average, 1e-9)
+	assert.Equal(t, [5]int{1, 0, 0, 2, 1}, distribution)
+}
+
+func TestWriteFineTuningJSONL(t *testing.T) {
+	session := Session{
+		Metadata: SessionMetadata{SystemPrompt: "Be brief"},
+		Ratings:  map[int]int{3: 2},
+		Messages: []Message{
+			{Role: "user", Content: "first question"},
+			{Role: "assistant", Content: "first answer"},
+			{Role: "user", Content: "second question"},
+			{Role: "assistant", Content: "second answer"},
+		},
+	}
+	var b bytes.Buffer
+	require.NoError(t, WriteFineTuningJSONL(&b, session))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, `{"messages":[{"role":"system","content":"Be brief"},{"role":"user","content":"first question"},{"role":"assistant","content":"first answer"}]}`, lines[0])
+	assert.Equal(t, `{"messages":[{"role":"system","content":"Be brief"},{"role":"user","content":"first question"},{"role":"assistant","content":"first answer"},{"role":"user","content":"second question"},{"role":"assistant","content":"second answer"}],"rating":2}`, lines[1])
+}
+
+func TestUpdate_Rate(t *testing.T) {
+	setTestHome(t)
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.client.history = []Message{
+		{Role: "user", Content: "first question"},
+		{Role: "assistant", Content: "first answer"},
+		{Role: "user", Content: "second question"},
+		{Role: "assistant", Content: "second answer"},
+	}
+
+	for _, input := range []string{"/rate 0", "/rate 6", "/rate good"} {
+		_, ok := m.handleCommand(input)
+		require.True(t, ok)
+		assert.Empty(t, m.ratings, input)
+	}
+	_, ok := m.handleCommand("/rate 4")
+	require.True(t, ok)
+	assert.Equal(t, map[int]int{3: 4}, m.ratings)
+
+	// rate the first answer in annotation mode
+	for _, msg := range []tea.KeyMsg{{Type: tea.KeyCtrlO}, {Type: tea.KeyRunes, Runes: []rune("k")}, {Type: tea.KeyRunes, Runes: []rune("2")}, {Type: tea.KeyEsc}} {
+		model, _ := m.Update(msg)
+		m = model.(Model)
+	}
+	assert.Equal(t, map[int]int{1: 2, 3: 4}, m.ratings)
+
+	content, err := m.renderMessages(m.client.history)
+	require.NoError(t, err)
+	view := ansiPattern.ReplaceAllString(content, "")
+	stars := strings.Index(view, "★★☆☆☆")
+	require.Positive(t, stars)
+	assert.Less(t, strings.Index(view, "first answer"), stars)
+	assert.Less(t, stars, strings.Index(view, "second question"))
+	assert.Contains(t, view, "★★★★☆")
+
+	// the ratings are saved with the session
+	dir, err := HistoryDir()
+	require.NoError(t, err)
+	session, err := LoadSession(filepath.Join(dir, m.sessionId+".json"))
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int{1: 2, 3: 4}, session.Ratings)
+}
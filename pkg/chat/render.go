@@ -0,0 +1,997 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/styles"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/glamour/ansi"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/imfing/gptui/pkg/rest"
+	"github.com/mattn/go-runewidth"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+var (
+	// lineNumberSeparatorStyle is the style of the separator between line numbers and content
+	lineNumberSeparatorStyle = lipgloss.NewStyle().Foreground(lipgloss.AdaptiveColor{Light: "250", Dark: "238"})
+	// deletedStyle and insertedStyle highlight the words changed by a regenerated response
+	deletedStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Strikethrough(true)
+	insertedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("42"))
+	// removedLineStyle and addedLineStyle are the styles of the lines of the unified diff of /diff
+	removedLineStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	addedLineStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("42"))
+	// diffPanelStyle is the style of the panels of the previous and the regenerated response
+	diffPanelStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("238")).Padding(0, 1)
+)
+
+// safeRender renders the Markdown content and recovers from renderer panics.
+// The plain content is returned together with the error if rendering fails.
+func safeRender(renderer *glamour.TermRenderer, content string) (output string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			output, err = content, fmt.Errorf("failed to render markdown: %v", r)
+		}
+	}()
+	output, err = renderer.Render(content)
+	if err != nil {
+		return content, err
+	}
+	return output, nil
+}
+
+// renderContent renders the Markdown content. If codeRenderer is set, fenced code
+// blocks are rendered with it separately from the text so that they are not wrapped.
+func renderContent(renderer, codeRenderer *glamour.TermRenderer, content string) (string, error) {
+	blocks := parseCodeBlocks(content)
+	if codeRenderer == nil || len(blocks) == 0 {
+		return safeRender(renderer, content)
+	}
+
+	var parts []string
+	render := func(r *glamour.TermRenderer, segment string) error {
+		if len(strings.TrimSpace(segment)) == 0 {
+			return nil
+		}
+		output, err := safeRender(r, segment)
+		parts = append(parts, strings.Trim(output, "\n"))
+		return err
+	}
+	start := 0
+	for _, block := range blocks {
+		if err := render(renderer, content[start:block.Start]); err != nil {
+			return content, err
+		}
+		if err := render(codeRenderer, content[block.Start:block.End]); err != nil {
+			return content, err
+		}
+		start = block.End
+	}
+	if err := render(renderer, content[start:]); err != nil {
+		return content, err
+	}
+	return "\n" + strings.Join(parts, "\n\n") + "\n\n", nil
+}
+
+// streamBoundary returns the offset up to which the Markdown blocks of the streamed
+// content are complete: the end of the last blank line or closing code fence outside
+// of a code block. The last line is ignored unless it is terminated, as it may still grow.
+func streamBoundary(content string) int {
+	boundary, offset := 0, 0
+	fenced := false
+	for {
+		i := strings.IndexByte(content[offset:], '\n')
+		if i < 0 {
+			return boundary
+		}
+		line := strings.TrimSpace(content[offset : offset+i])
+		offset += i + 1
+		switch {
+		case strings.HasPrefix(line, "```"):
+			fenced = !fenced
+			if !fenced {
+				boundary = offset
+			}
+		case !fenced && len(line) == 0:
+			boundary = offset
+		}
+	}
+}
+
+// CodeBlock is a fenced code block of Markdown content
+type CodeBlock struct {
+	// Language is the info string of the opening fence, e.g. python
+	Language string
+	// Lines are the lines of code between the fences
+	Lines []string
+	// Start and End are the offsets of the block in the content, fences included
+	Start, End int
+}
+
+// parseCodeBlocks returns the fenced code blocks of the Markdown content in order.
+// A code block left open runs to the end of the content.
+func parseCodeBlocks(content string) []CodeBlock {
+	var blocks []CodeBlock
+	var block CodeBlock
+	// fence is the opening fence of the current code block, empty outside of code blocks
+	var fence string
+	offset := 0
+	for _, line := range strings.Split(content, "\n") {
+		start := offset
+		offset += len(line) + 1
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case len(fence) == 0:
+			marker, info := splitFence(trimmed)
+			if len(marker) == 0 {
+				continue
+			}
+			language, _, _ := strings.Cut(info, " ")
+			fence, block = marker, CodeBlock{Language: language, Start: start}
+		case strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "":
+			// the closing fence is at least as long as the opening one, without info string
+			block.End = start + len(line)
+			blocks = append(blocks, block)
+			fence = ""
+		default:
+			block.Lines = append(block.Lines, line)
+		}
+	}
+	if len(fence) > 0 {
+		block.End = len(content)
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// Segment is a part of a response, either a TextSegment or a CodeSegment
+type Segment interface {
+	segment()
+}
+
+// TextSegment is the prose between the code blocks of a response
+type TextSegment struct {
+	Text string
+}
+
+// CodeSegment is a fenced code block of a response, without its fences
+type CodeSegment struct {
+	Language string
+	Code     string
+}
+
+func (TextSegment) segment() {}
+func (CodeSegment) segment() {}
+
+// ParseSegments splits the Markdown content into its prose and its fenced code blocks, in order.
+// Blank prose between code blocks is dropped, and a code block left open runs to the end.
+func ParseSegments(content string) []Segment {
+	var segments []Segment
+	addText := func(text string) {
+		if len(strings.TrimSpace(text)) > 0 {
+			segments = append(segments, TextSegment{Text: text})
+		}
+	}
+	start := 0
+	for _, block := range parseCodeBlocks(content) {
+		// the line breaks around the fences belong to them
+		text := content[start:block.Start]
+		if start > 0 {
+			text = strings.TrimPrefix(text, "\n")
+		}
+		addText(strings.TrimSuffix(text, "\n"))
+		segments = append(segments, CodeSegment{Language: block.Language, Code: strings.Join(block.Lines, "\n")})
+		start = block.End
+	}
+	if start < len(content) {
+		text := content[start:]
+		if start > 0 {
+			text = strings.TrimPrefix(text, "\n")
+		}
+		addText(text)
+	}
+	return segments
+}
+
+// splitFence returns the fence opening a code block, ``` or ~~~ or longer, and its info string.
+// The marker is empty if the line does not open a code block.
+func splitFence(line string) (marker, info string) {
+	if !strings.HasPrefix(line, "```") && !strings.HasPrefix(line, "~~~") {
+		return "", ""
+	}
+	n := len(line) - len(strings.TrimLeft(line, line[:1]))
+	marker, info = line[:n], strings.TrimSpace(line[n:])
+	// the info string of a backtick fence cannot contain backticks
+	if marker[0] == '`' && strings.Contains(info, "`") {
+		return "", ""
+	}
+	return marker, info
+}
+
+// header returns the summary of the code block shown in navigation mode, e.g. ▶ python (42 lines)
+func (b CodeBlock) header(collapsed bool) string {
+	language := b.Language
+	if len(language) == 0 {
+		language = "code"
+	}
+	arrow := "▼"
+	if collapsed {
+		arrow = "▶"
+	}
+	lines := "lines"
+	if len(b.Lines) == 1 {
+		lines = "line"
+	}
+	return fmt.Sprintf("%s %s (%d %s)", arrow, language, len(b.Lines), lines)
+}
+
+// collapseCodeBlocks adds a header to each code block of the content and replaces the collapsed
+// blocks with their first line. The blocks are numbered from first, and the block at the cursor
+// is marked.
+func collapseCodeBlocks(content string, first int, expanded map[int]bool, cursor int) string {
+	blocks := parseCodeBlocks(content)
+	var b strings.Builder
+	start := 0
+	for i, block := range blocks {
+		b.WriteString(content[start:block.Start])
+		id := first + i
+		header := block.header(!expanded[id])
+		if id == cursor {
+			header = "» " + header
+		}
+		fmt.Fprintf(&b, "**%s**\n\n", header)
+		if expanded[id] || len(block.Lines) == 0 {
+			b.WriteString(content[block.Start:block.End])
+		} else {
+			fmt.Fprintf(&b, "```%s\n%s\n```", block.Language, block.Lines[0])
+		}
+		start = block.End
+	}
+	b.WriteString(content[start:])
+	return b.String()
+}
+
+// renderedMessage is a message rendered to Markdown for the viewport
+type renderedMessage struct {
+	message Message
+	output  string
+	height  int
+}
+
+// messageCache caches rendered messages by their position in the history
+type messageCache struct {
+	renderer *glamour.TermRenderer
+	// images renders the images of assistant messages inline if set
+	images *InlineImageRenderer
+	// latexGeneration is the number of LaTeX sources rendered when the entries were rendered
+	latexGeneration int
+	entries         []renderedMessage
+}
+
+// render returns the rendered message at index i, it is only re-rendered
+// if the message or the renderer has changed since the last call.
+// The code renderer is replaced together with the renderer.
+func (c *messageCache) render(renderer, codeRenderer *glamour.TermRenderer, i int, message Message) (string, error) {
+	// the messages may show LaTeX sources which katex rendered since
+	if generation := currentLaTeXGeneration(); c.renderer != renderer || c.latexGeneration != generation {
+		c.renderer = renderer
+		c.latexGeneration = generation
+		c.entries = nil
+	}
+	if i < len(c.entries) && c.entries[i].message == message {
+		return c.entries[i].output, nil
+	}
+
+	content := message.Content
+	var images map[string]string
+	if message.Role == "assistant" {
+		content = replaceMathBlocks(content)
+		content, images = c.images.replaceImages(content)
+	}
+	output, err := renderContent(renderer, codeRenderer, content)
+	output = insertImages(output, images)
+	entry := renderedMessage{message: message, output: output, height: lipgloss.Height(output)}
+	if err != nil {
+		// try again on the next render
+		entry.message = Message{}
+	}
+	for len(c.entries) <= i {
+		c.entries = append(c.entries, renderedMessage{})
+	}
+	c.entries[i] = entry
+	return output, err
+}
+
+// addLineNumbers prefixes each line of the content with a right-aligned line number.
+// Lines wider than width are wrapped first so that every visual line is numbered.
+func addLineNumbers(content string, width int) string {
+	digits := len(fmt.Sprint(strings.Count(content, "\n") + 1))
+	if digits < 4 {
+		digits = 4
+	}
+	wrapWidth := width - digits - 2
+
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if wrapWidth > 0 && lipgloss.Width(line) > wrapWidth {
+			line = lipgloss.NewStyle().Width(wrapWidth).Render(line)
+		}
+		lines = append(lines, strings.Split(line, "\n")...)
+	}
+
+	separator := lineNumberSeparatorStyle.Render("│")
+	for i, line := range lines {
+		lines[i] = helpStyle.Render(fmt.Sprintf("%*d", digits, i+1)) + separator + " " + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ApplyCodeTheme returns the option setting the base style with the chroma theme for code blocks.
+// The theme must be registered in chroma, e.g. dracula, monokai or github.
+func ApplyCodeTheme(base ansi.StyleConfig, themeName string) (glamour.TermRendererOption, error) {
+	if _, ok := styles.Registry[themeName]; !ok {
+		return nil, fmt.Errorf("unknown code theme %q", themeName)
+	}
+	// the custom chroma colors take precedence over the theme
+	base.CodeBlock.Chroma = nil
+	base.CodeBlock.Theme = themeName
+	return glamour.WithStyles(base), nil
+}
+
+// maxLineWidth is the width at which lines are truncated before they are scrolled horizontally
+const maxLineWidth = 1 << 12
+
+// ansiPattern matches ANSI escape sequences
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]`)
+
+// visibleWidth returns the width of the line without escape sequences and trailing spaces
+func visibleWidth(line string) int {
+	return runewidth.StringWidth(strings.TrimRight(ansiPattern.ReplaceAllString(line, ""), " "))
+}
+
+// cutLine returns the columns of the line from offset to offset+width, keeping its escape sequences.
+// The last column is replaced by an arrow if the line continues beyond it.
+func cutLine(line string, offset, width int) string {
+	more := visibleWidth(line) > offset+width
+	if more {
+		width--
+	}
+
+	var b strings.Builder
+	col := 0
+	for len(line) > 0 {
+		if loc := ansiPattern.FindStringIndex(line); loc != nil && loc[0] == 0 {
+			b.WriteString(line[:loc[1]])
+			line = line[loc[1]:]
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(line)
+		line = line[size:]
+		w := runewidth.RuneWidth(r)
+		if col >= offset && col+w <= offset+width {
+			b.WriteRune(r)
+		}
+		col += w
+	}
+	if more {
+		b.WriteString(helpStyle.Render("→"))
+	}
+	return b.String()
+}
+
+const (
+	// searchHighlightStart and searchHighlightEnd turn bold and inverse video on and off,
+	// keeping the colors of the text around the match
+	searchHighlightStart = "\x1b[1m\x1b[7m"
+	searchHighlightEnd   = "\x1b[22m\x1b[27m"
+)
+
+// highlightInANSI highlights the occurrences of the query in the rendered text, ignoring case.
+// The query is matched against the text without the escape sequences, since glamour renders
+// each word in its own sequence, and the highlight is turned on again after the sequences
+// inside a match. Text containing an incomplete escape sequence or invalid UTF-8 is left
+// as is, and a match does not span it.
+func highlightInANSI(rendered, query string) string {
+	if len(query) == 0 {
+		return rendered
+	}
+	var b strings.Builder
+	// parts are the text and the escape sequences since the last text left as is
+	var parts []ansiPart
+	for len(rendered) > 0 {
+		text := rendered
+		var sequence string
+		if loc := ansiPattern.FindStringIndex(rendered); loc != nil {
+			text, sequence = rendered[:loc[0]], rendered[loc[0]:loc[1]]
+		}
+		if strings.ContainsRune(text, '\x1b') || !utf8.ValidString(text) {
+			highlightParts(&b, parts, query)
+			parts = nil
+			b.WriteString(text)
+		} else if len(text) > 0 {
+			parts = append(parts, ansiPart{text: text})
+		}
+		if len(sequence) > 0 {
+			parts = append(parts, ansiPart{text: sequence, sequence: true})
+		}
+		rendered = rendered[len(text)+len(sequence):]
+	}
+	highlightParts(&b, parts, query)
+	return b.String()
+}
+
+// ansiPart is text or an escape sequence of rendered text
+type ansiPart struct {
+	text     string
+	sequence bool
+}
+
+// highlightParts writes the parts with the occurrences of the query in their text highlighted
+func highlightParts(b *strings.Builder, parts []ansiPart, query string) {
+	var plain strings.Builder
+	for _, part := range parts {
+		if !part.sequence {
+			plain.WriteString(part.text)
+		}
+	}
+	matches := matchText(plain.String(), query)
+	// offset is the offset of the part in the plain text
+	offset, inside := 0, false
+	for _, part := range parts {
+		if part.sequence {
+			b.WriteString(part.text)
+			// the sequence may have reset the highlight
+			if inside {
+				b.WriteString(searchHighlightStart)
+			}
+			continue
+		}
+		text, written := part.text, 0
+		for len(matches) > 0 {
+			if !inside {
+				start := matches[0][0] - offset
+				if start >= len(text) {
+					break
+				}
+				b.WriteString(text[written:start])
+				b.WriteString(searchHighlightStart)
+				written, inside = start, true
+			}
+			end := matches[0][1] - offset
+			if end > len(text) {
+				break
+			}
+			b.WriteString(text[written:end])
+			b.WriteString(searchHighlightEnd)
+			written, inside = end, false
+			matches = matches[1:]
+		}
+		b.WriteString(text[written:])
+		offset += len(text)
+	}
+}
+
+// matchText returns the byte offsets of the start and end of the occurrences of the query
+// in the plain text, ignoring case
+func matchText(text, query string) [][2]int {
+	// offsets are the byte offsets of the runes of the text and of its end
+	var offsets []int
+	for i := range text {
+		offsets = append(offsets, i)
+	}
+	offsets = append(offsets, len(text))
+	n := utf8.RuneCountInString(query)
+
+	var matches [][2]int
+	for i := 0; i+n < len(offsets); {
+		if !strings.EqualFold(text[offsets[i]:offsets[i+n]], query) {
+			i++
+			continue
+		}
+		matches = append(matches, [2]int{offsets[i], offsets[i+n]})
+		i += n
+	}
+	return matches
+}
+
+// imageProtocol is a terminal graphics protocol for displaying images
+type imageProtocol int
+
+const (
+	noImageProtocol imageProtocol = iota
+	kittyImageProtocol
+)
+
+// detectImageProtocol returns the graphics protocol of the terminal from its environment variables.
+// Only the kitty graphics protocol is supported, sixel terminals show the images as text.
+func detectImageProtocol(getenv func(string) string) imageProtocol {
+	term := strings.ToLower(getenv("TERM"))
+	switch {
+	case strings.HasPrefix(term, "screen"), strings.HasPrefix(term, "tmux"):
+		// multiplexers do not pass the graphics through
+		return noImageProtocol
+	case strings.Contains(term, "kitty"), strings.Contains(term, "ghostty"),
+		len(getenv("KITTY_WINDOW_ID")) > 0, getenv("TERM_PROGRAM") == "ghostty":
+		return kittyImageProtocol
+	}
+	return noImageProtocol
+}
+
+var (
+	// markdownImagePattern matches the Markdown images of a message
+	markdownImagePattern = regexp.MustCompile(`!\[([^\]]*)\]\((https?://[^\s)]+)\)`)
+	// imageTokenPattern matches the tokens standing in for rendered images during Markdown rendering
+	imageTokenPattern = regexp.MustCompile(`GPTUIIMAGE\d+`)
+	// kittyDiacritics encode the row of an image cell in the kitty Unicode placeholders,
+	// see https://sw.kovidgoyal.net/kitty/graphics-protocol/#unicode-placeholders
+	kittyDiacritics = []rune{
+		0x0305, 0x030D, 0x030E, 0x0310, 0x0312, 0x033D, 0x033E, 0x033F, 0x0346, 0x034A,
+		0x034B, 0x034C, 0x0350, 0x0351, 0x0352, 0x0357, 0x035B, 0x0363, 0x0364, 0x0365,
+		0x0366, 0x0367, 0x0368, 0x0369, 0x036A, 0x036B, 0x036C, 0x036D, 0x036E, 0x036F,
+	}
+)
+
+const (
+	// kittyPlaceholder is the character displaying a cell of a kitty image
+	kittyPlaceholder = '\U0010EEEE'
+	// kittyChunkSize is the maximum size of the base64 payload of a kitty graphics command
+	kittyChunkSize = 4096
+	// maxImageSize is the maximum size of a fetched image in bytes
+	maxImageSize = 10 << 20
+	// imageCellWidth and imageCellHeight approximate the size of a terminal cell in pixels
+	imageCellWidth  = 10
+	imageCellHeight = 20
+)
+
+// InlineImageRenderer displays images in the viewport with the graphics protocol of the terminal.
+// Images are drawn with kitty Unicode placeholders, which are text that the viewport can wrap
+// and scroll.
+//
+// The images are fetched once a message showing them is rendered, and their data is sent
+// to the terminal by the view which displays their placeholders.
+type InlineImageRenderer struct {
+	protocol imageProtocol
+	// fetch returns the image at the URL
+	fetch func(url string) ([]byte, error)
+
+	mu       sync.Mutex
+	rendered map[string]string
+	// failed are the URLs of the images which could not be rendered, shown as text
+	failed map[string]bool
+	// pending are the URLs of the images waiting to be rendered, true once renderCmd runs them
+	pending map[string]bool
+	// transmits are the kitty commands of the rendered images not sent to the terminal yet
+	transmits []string
+	nextID    int
+}
+
+// NewInlineImageRenderer creates an InlineImageRenderer for the graphics protocol
+func NewInlineImageRenderer(protocol imageProtocol) *InlineImageRenderer {
+	return &InlineImageRenderer{
+		protocol: protocol,
+		fetch:    fetchImage,
+		rendered: map[string]string{},
+		failed:   map[string]bool{},
+		pending:  map[string]bool{},
+	}
+}
+
+// imageFallback is the text shown for an image which is not rendered
+func imageFallback(alt string) string {
+	return fmt.Sprintf("[image: %s]", alt)
+}
+
+// Render fetches the image and returns the text displaying it in at most maxWidth columns.
+// The fallback text is returned if the terminal supports no usable protocol, or if the
+// image fails to render, which is not tried again.
+func (r *InlineImageRenderer) Render(url, alt string, maxWidth int) (string, error) {
+	if r.protocol != kittyImageProtocol {
+		return imageFallback(alt), nil
+	}
+	r.mu.Lock()
+	output, ok := r.rendered[url]
+	r.mu.Unlock()
+	if ok {
+		return output, nil
+	}
+
+	encoded, cols, rows, err := r.encode(url, maxWidth)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, url)
+	if err != nil {
+		r.failed[url] = true
+		return imageFallback(alt), err
+	}
+	// the ID is the 256 color foreground of the placeholders
+	r.nextID = r.nextID%255 + 1
+	r.transmits = append(r.transmits, kittyTransmit(r.nextID, encoded, cols, rows))
+	output = kittyPlaceholders(r.nextID, cols, rows)
+	r.rendered[url] = output
+	return output, nil
+}
+
+// encode fetches the image and returns it as PNG with its size in cells
+func (r *InlineImageRenderer) encode(url string, maxWidth int) (data []byte, cols, rows int, err error) {
+	data, err = r.fetch(url)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	// kitty only decodes PNG itself
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		return nil, 0, 0, err
+	}
+	cols, rows = imageCells(img.Bounds().Dx(), img.Bounds().Dy(), maxWidth, len(kittyDiacritics))
+	return encoded.Bytes(), cols, rows, nil
+}
+
+// renderCmd returns a tea.Cmd which renders the images queued by replaceImages in the
+// background, or nil if none is queued
+func (r *InlineImageRenderer) renderCmd(maxWidth int) tea.Cmd {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	var urls []string
+	for url, running := range r.pending {
+		if !running {
+			r.pending[url] = true
+			urls = append(urls, url)
+		}
+	}
+	r.mu.Unlock()
+	if len(urls) == 0 {
+		return nil
+	}
+	return func() tea.Msg {
+		for _, url := range urls {
+			if _, err := r.Render(url, "", maxWidth); err != nil {
+				logger.Warn("failed to render image", "url", url, "error", err)
+			}
+		}
+		return imagesRenderedMsg{}
+	}
+}
+
+// flush writes the data of the rendered images to the terminal, before the view showing them
+func (r *InlineImageRenderer) flush(out io.Writer) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, transmit := range r.transmits {
+		io.WriteString(out, transmit)
+	}
+	r.transmits = nil
+}
+
+// imageCells returns the number of columns and rows of cells the image is scaled to
+func imageCells(width, height, maxCols, maxRows int) (cols, rows int) {
+	if width <= 0 || height <= 0 {
+		return 1, 1
+	}
+	cols = max(min((width+imageCellWidth-1)/imageCellWidth, maxCols), 1)
+	rows = max((cols*imageCellWidth*height+width*imageCellHeight-1)/(width*imageCellHeight), 1)
+	if rows > maxRows {
+		rows = maxRows
+		cols = max(min(cols, rows*imageCellHeight*width/(height*imageCellWidth)), 1)
+	}
+	return cols, rows
+}
+
+// kittyTransmit returns the kitty graphics commands transmitting the PNG image with the ID
+// and creating a virtual placement of cols x rows cells for the Unicode placeholders
+func kittyTransmit(id int, data []byte, cols, rows int) string {
+	payload := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for first := true; first || len(payload) > 0; first = false {
+		chunk := payload[:min(len(payload), kittyChunkSize)]
+		payload = payload[len(chunk):]
+		more := 0
+		if len(payload) > 0 {
+			more = 1
+		}
+		if first {
+			fmt.Fprintf(&b, "\x1b_Ga=t,f=100,t=d,i=%d,q=2,m=%d;%s\x1b\\", id, more, chunk)
+		} else {
+			fmt.Fprintf(&b, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+	fmt.Fprintf(&b, "\x1b_Ga=p,U=1,i=%d,c=%d,r=%d,q=2\x1b\\", id, cols, rows)
+	return b.String()
+}
+
+// kittyPlaceholders returns the lines of placeholders displaying the image with the ID.
+// The first cell of each line has the row and column diacritics, the following cells continue the row.
+func kittyPlaceholders(id, cols, rows int) string {
+	lines := make([]string, rows)
+	for row := range lines {
+		lines[row] = fmt.Sprintf("\x1b[38;5;%dm%c%c%c%s\x1b[39m", id, kittyPlaceholder, kittyDiacritics[row], kittyDiacritics[0],
+			strings.Repeat(string(kittyPlaceholder), cols-1))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// fetchImage downloads the image at the URL. Only https URLs of public addresses are fetched,
+// so that responses cannot make requests to the machine or its local network.
+func fetchImage(url string) ([]byte, error) {
+	if !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("GET %s: only https images are fetched", url)
+	}
+	client := rest.NewClient(rest.WithBaseURL(url), rest.WithTimeout(30*time.Second),
+		rest.WithTransport(rest.TransportOptions{DialControl: publicAddressOnly}))
+	req, err := client.NewRequest("")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: status code: %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxImageSize))
+}
+
+// publicAddressOnly refuses the connections to loopback, private, link-local and unspecified addresses
+func publicAddressOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("%s is not a public address", host)
+	}
+	return nil
+}
+
+// replaceImages is the hook applied to Markdown content before rendering. Images which have been
+// rendered are replaced with tokens mapped to their rendering, the others with the fallback text.
+// The https images which are not rendered yet are queued for renderCmd.
+// The content is returned unchanged if r is nil.
+func (r *InlineImageRenderer) replaceImages(content string) (string, map[string]string) {
+	if r == nil {
+		return content, nil
+	}
+	images := map[string]string{}
+	content = markdownImagePattern.ReplaceAllStringFunc(content, func(match string) string {
+		groups := markdownImagePattern.FindStringSubmatch(match)
+		url := groups[2]
+		r.mu.Lock()
+		output, ok := r.rendered[url]
+		if _, queued := r.pending[url]; !ok && !queued && !r.failed[url] &&
+			r.protocol == kittyImageProtocol && strings.HasPrefix(url, "https://") {
+			r.pending[url] = false
+		}
+		r.mu.Unlock()
+		if !ok {
+			return imageFallback(groups[1])
+		}
+		token := fmt.Sprintf("GPTUIIMAGE%d", len(images))
+		images[token] = output
+		return "\n\n" + token + "\n\n"
+	})
+	return content, images
+}
+
+// insertImages replaces the image tokens of the rendered content with the images,
+// indenting each line of an image like the token
+func insertImages(output string, images map[string]string) string {
+	if len(images) == 0 {
+		return output
+	}
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		loc := imageTokenPattern.FindStringIndex(line)
+		if loc == nil {
+			continue
+		}
+		image, ok := images[line[loc[0]:loc[1]]]
+		if !ok {
+			continue
+		}
+		indent := strings.Repeat(" ", visibleWidth(line[:loc[0]]))
+		lines[i] = indent + strings.ReplaceAll(image, "\n", "\n"+indent)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// wordTokenPattern matches the words and the whitespace between them
+var wordTokenPattern = regexp.MustCompile(`\s+|\S+`)
+
+const (
+	// surrogateStart and surrogateCount are the range of the UTF-16 surrogates, which are
+	// no valid runes of a string and are skipped when encoding tokens as runes
+	surrogateStart = 0xD800
+	surrogateCount = 0x800
+	// maxDiffTokens is the number of distinct tokens which can be encoded as runes
+	maxDiffTokens = unicode.MaxRune + 1 - surrogateCount
+)
+
+// tokenRune returns the rune encoding the token of the index, past the surrogates
+func tokenRune(i int) rune {
+	if i >= surrogateStart {
+		i += surrogateCount
+	}
+	return rune(i)
+}
+
+// tokenIndex returns the index of the token encoded by the rune
+func tokenIndex(r rune) int {
+	if r >= surrogateStart {
+		r -= surrogateCount
+	}
+	return int(r)
+}
+
+// wordDiff returns the word-level differences between old and new. Words and the
+// whitespace between them are encoded as runes, so that they are compared as a whole.
+// Texts of more distinct tokens than runes are diffed as a whole.
+func wordDiff(old, new string) []diffmatchpatch.Diff {
+	var tokens []string
+	index := map[string]rune{}
+	encode := func(text string) ([]rune, bool) {
+		var runes []rune
+		for _, token := range wordTokenPattern.FindAllString(text, -1) {
+			r, ok := index[token]
+			if !ok {
+				if len(tokens) == maxDiffTokens {
+					return nil, false
+				}
+				r = tokenRune(len(tokens))
+				index[token] = r
+				tokens = append(tokens, token)
+			}
+			runes = append(runes, r)
+		}
+		return runes, true
+	}
+	oldRunes, oldOK := encode(old)
+	newRunes, newOK := encode(new)
+	if !oldOK || !newOK {
+		return []diffmatchpatch.Diff{{Type: diffmatchpatch.DiffDelete, Text: old}, {Type: diffmatchpatch.DiffInsert, Text: new}}
+	}
+	dmp := diffmatchpatch.New()
+	diffs := dmp.DiffMainRunes(oldRunes, newRunes, false)
+	for i, diff := range diffs {
+		var text strings.Builder
+		for _, r := range diff.Text {
+			text.WriteString(tokens[tokenIndex(r)])
+		}
+		diffs[i].Text = text.String()
+	}
+	return diffs
+}
+
+// renderDiff renders the previous and the new response side by side in width columns.
+// Deleted words are struck through in red on the left, inserted words are green on the right.
+func renderDiff(old, new string, width int) string {
+	var left, right strings.Builder
+	for _, diff := range wordDiff(old, new) {
+		switch diff.Type {
+		case diffmatchpatch.DiffEqual:
+			left.WriteString(diff.Text)
+			right.WriteString(diff.Text)
+		case diffmatchpatch.DiffDelete:
+			left.WriteString(styleWords(deletedStyle, diff.Text))
+		case diffmatchpatch.DiffInsert:
+			right.WriteString(styleWords(insertedStyle, diff.Text))
+		}
+	}
+	panel := diffPanelStyle.Width(max(width/2-diffPanelStyle.GetHorizontalBorderSize(), 0))
+	return lipgloss.JoinHorizontal(lipgloss.Top,
+		panel.Render(helpStyle.Render("previous")+"\n"+left.String()),
+		panel.Render(helpStyle.Render("regenerated")+"\n"+right.String()),
+	)
+}
+
+// diffSegment is a part of a line of the unified diff, changed if it was deleted or inserted
+type diffSegment struct {
+	text    string
+	changed bool
+}
+
+// DiffText renders the word-level differences between old and new as a unified diff.
+// Lines with changes are shown in red prefixed with - as in old, then in green prefixed
+// with + as in new, with the changed words in bold. Unchanged lines are indented.
+func DiffText(old, new string) string {
+	var lines []string
+	var oldLines, newLines [][]diffSegment
+	var oldLine, newLine []diffSegment
+	changed := false
+	renderLine := func(prefix string, style lipgloss.Style, segments []diffSegment) string {
+		line := style.Render(prefix)
+		for _, segment := range segments {
+			if segment.changed && len(segment.text) > 0 {
+				line += style.Copy().Bold(true).Render(segment.text)
+			} else if len(segment.text) > 0 {
+				line += style.Render(segment.text)
+			}
+		}
+		return line
+	}
+	flush := func() {
+		oldLines, newLines = append(oldLines, oldLine), append(newLines, newLine)
+		if changed {
+			for _, segments := range oldLines {
+				lines = append(lines, renderLine("- ", removedLineStyle, segments))
+			}
+			for _, segments := range newLines {
+				lines = append(lines, renderLine("+ ", addedLineStyle, segments))
+			}
+		} else {
+			var text string
+			for _, segment := range oldLine {
+				text += segment.text
+			}
+			lines = append(lines, "  "+text)
+		}
+		oldLines, newLines, oldLine, newLine, changed = nil, nil, nil, nil, false
+	}
+	for _, diff := range wordDiff(old, new) {
+		for i, part := range strings.Split(diff.Text, "\n") {
+			if i > 0 {
+				// the line ends in the old text, the new text, or both
+				switch diff.Type {
+				case diffmatchpatch.DiffEqual:
+					flush()
+				case diffmatchpatch.DiffDelete:
+					oldLines, oldLine = append(oldLines, oldLine), nil
+				case diffmatchpatch.DiffInsert:
+					newLines, newLine = append(newLines, newLine), nil
+				}
+			}
+			switch diff.Type {
+			case diffmatchpatch.DiffEqual:
+				oldLine = append(oldLine, diffSegment{text: part})
+				newLine = append(newLine, diffSegment{text: part})
+			case diffmatchpatch.DiffDelete:
+				oldLine = append(oldLine, diffSegment{text: part, changed: true})
+				changed = true
+			case diffmatchpatch.DiffInsert:
+				newLine = append(newLine, diffSegment{text: part, changed: true})
+				changed = true
+			}
+		}
+	}
+	flush()
+	return strings.Join(lines, "\n")
+}
+
+// styleWords renders each line of the text with the style, so that the line breaks are kept
+func styleWords(style lipgloss.Style, text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if len(line) > 0 {
+			lines[i] = style.Render(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,605 @@
+package chat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/chroma"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/charmbracelet/bubbles/viewport"
+	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
+	"github.com/sergi/go-diff/diffmatchpatch"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSafeRender(t *testing.T) {
+	renderer, err := newGlamourRenderer(80)
+	assert.NoError(t, err)
+
+	output, err := safeRender(renderer, "# Hello")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "Hello")
+
+	// a nil renderer panics, the plain content is returned instead
+	output, err = safeRender(nil, "```go\nfmt.Println(")
+	assert.Error(t, err)
+	assert.Equal(t, "```go\nfmt.Println(", output)
+}
+
+func TestSafeRender_RightToLeft(t *testing.T) {
+	renderer, err := newGlamourRenderer(80)
+	assert.NoError(t, err)
+
+	// right-to-left text keeps its logical order, the terminal handles the layout
+	for _, words := range [][]string{{"مرحبا", "بالعالم"}, {"שלום", "עולם"}} {
+		output, err := safeRender(renderer, strings.Join(words, " "))
+		assert.NoError(t, err)
+		first, second := strings.Index(output, words[0]), strings.Index(output, words[1])
+		assert.True(t, first >= 0 && first < second)
+	}
+}
+
+func FuzzSafeRender(f *testing.F) {
+	f.Add([]byte("```go\nfunc main() {"))
+	f.Add([]byte("- a\n  - b\n    - c\n      - d"))
+	f.Add([]byte("| a | b |\n|---|"))
+
+	renderer, err := newGlamourRenderer(80)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		safeRender(renderer, string(data))
+	})
+}
+
+func TestAddLineNumbers(t *testing.T) {
+	content := "first\nsecond\n\nfourth"
+	lines := strings.Split(addLineNumbers(content, 80), "\n")
+
+	assert.Len(t, lines, 4)
+	for i, want := range []string{"first", "second", "", "fourth"} {
+		plain := stripANSI(lines[i])
+		assert.Equal(t, fmt.Sprintf("%4d│ %s", i+1, want), plain)
+	}
+}
+
+func TestAddLineNumbers_Wrapped(t *testing.T) {
+	content := strings.Repeat("word ", 10)
+	lines := strings.Split(addLineNumbers(content, 26), "\n")
+
+	// 20 columns are left for the content after the line number prefix
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(stripANSI(lines[2]), "   3│ "))
+}
+
+// stripANSI removes ANSI escape sequences from s
+func stripANSI(s string) string {
+	return regexp.MustCompile(`\x1b\[[0-9;]*m`).ReplaceAllString(s, "")
+}
+
+func TestMessageCache(t *testing.T) {
+	renderer, err := newGlamourRenderer(80)
+	assert.NoError(t, err)
+	cache := &messageCache{}
+
+	first, err := cache.render(renderer, nil, 0, Message{Role: "user", Content: "# Hello"})
+	assert.NoError(t, err)
+	assert.Equal(t, lipgloss.Height(first), cache.entries[0].height)
+
+	// unchanged messages are served from the cache
+	cache.entries[0].output = "cached"
+	output, _ := cache.render(renderer, nil, 0, Message{Role: "user", Content: "# Hello"})
+	assert.Equal(t, "cached", output)
+
+	// changed messages are rendered again
+	output, _ = cache.render(renderer, nil, 0, Message{Role: "user", Content: "# Bye"})
+	assert.Contains(t, output, "Bye")
+
+	// a new renderer invalidates the cache
+	other, err := newGlamourRenderer(40)
+	assert.NoError(t, err)
+	cache.entries[0].output = "cached"
+	output, _ = cache.render(other, nil, 0, Message{Role: "user", Content: "# Bye"})
+	assert.Contains(t, output, "Bye")
+}
+
+func BenchmarkRenderMessages(b *testing.B) {
+	renderer, err := newGlamourRenderer(80)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var messages []Message
+	for i := 0; i < 500; i++ {
+		messages = append(messages,
+			Message{Role: "user", Content: fmt.Sprintf("Question %d", i)},
+			Message{Role: "assistant", Content: fmt.Sprintf("Answer %d:\n\n```go\nfmt.Println(%d)\n```", i, i)},
+		)
+	}
+
+	b.Run("uncached", func(b *testing.B) {
+		m := Model{renderer: renderer}
+		for i := 0; i < b.N; i++ {
+			m.renderMessages(messages)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		m := Model{renderer: renderer, cache: &messageCache{}}
+		for i := 0; i < b.N; i++ {
+			m.renderMessages(messages)
+		}
+	})
+}
+
+func TestStreamBoundary(t *testing.T) {
+	assert.Equal(t, 0, streamBoundary("Hello"))
+	assert.Equal(t, 0, streamBoundary("Hello\n"))
+	assert.Equal(t, 7, streamBoundary("Hello\n\nWor"))
+	// blank lines inside an open code block are not boundaries
+	assert.Equal(t, 7, streamBoundary("Hello\n\n```go\na\n\nb"))
+	content := "Hello\n\n```go\na\n\nb\n```\nmore"
+	assert.Equal(t, strings.Index(content, "more"), streamBoundary(content))
+}
+
+func TestRenderStream_Incremental(t *testing.T) {
+	renderer, err := newGlamourRenderer(80)
+	require.NoError(t, err)
+	m := newTestModel(t)
+	m.renderer = renderer
+	m.client.history = []Message{{Role: "user", Content: "Hi"}}
+
+	m.streamDeltas = "First paragraph\n\n```go\nfmt.Println(1)\n"
+	m.renderStream()
+	assert.Equal(t, len("First paragraph\n\n"), m.lastRenderedOffset)
+	rendered := m.streamRendered
+	assert.Contains(t, ansiPattern.ReplaceAllString(rendered, ""), "First paragraph")
+
+	m.streamDeltas += "```\n\nDone"
+	m.renderStream()
+	assert.True(t, strings.HasPrefix(m.streamRendered, rendered), "rendered blocks are appended")
+	assert.Equal(t, strings.Index(m.streamDeltas, "Done"), m.lastRenderedOffset)
+	view := ansiPattern.ReplaceAllString(m.viewport.View(), "")
+	assert.Contains(t, view, "fmt.Println(1)")
+	assert.Contains(t, view, "Done")
+
+	m.resetStreamRender()
+	assert.Zero(t, m.lastRenderedOffset)
+	assert.Empty(t, m.streamRendered)
+}
+
+func BenchmarkRenderStream(b *testing.B) {
+	renderer, err := newGlamourRenderer(80)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var response strings.Builder
+	for i := 0; response.Len() < 10000; i++ {
+		fmt.Fprintf(&response, "Paragraph %d with some text to render.\n\n", i)
+		if i%5 == 0 {
+			fmt.Fprintf(&response, "```go\nfmt.Println(%d)\n```\n\n", i)
+		}
+	}
+	content := response.String()[:10000]
+	// stream the response in chunks of 20 bytes
+	const chunk = 20
+
+	b.Run("full", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m := Model{client: &Client{}, renderer: renderer, viewport: viewport.New(80, 20)}
+			for end := chunk; end <= len(content); end += chunk {
+				m.streamDeltas = content[:end]
+				m.renderMessages([]Message{{Role: "assistant", Content: m.streamDeltas}})
+			}
+		}
+	})
+	b.Run("incremental", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m := Model{client: &Client{}, renderer: renderer, viewport: viewport.New(80, 20)}
+			for end := chunk; end <= len(content); end += chunk {
+				m.streamDeltas = content[:end]
+				m.renderStream()
+			}
+		}
+	})
+}
+
+func TestApplyCodeTheme(t *testing.T) {
+	content := "```go\nfunc main() {}\n```"
+	render := func(opts ...glamour.TermRendererOption) string {
+		renderer, err := newGlamourRenderer(80, append(opts, glamour.WithColorProfile(termenv.TrueColor))...)
+		assert.NoError(t, err)
+		output, err := renderer.Render(content)
+		assert.NoError(t, err)
+		return output
+	}
+
+	opt, err := ApplyCodeTheme(DarkStyleConfig, "dracula")
+	assert.NoError(t, err)
+	dracula := render(opt)
+	assert.NotEqual(t, render(), dracula)
+	// the code block is rendered on the dracula background #282a36
+	background := styles.Get("dracula").Get(chroma.Background).Background
+	assert.Equal(t, "#282a36", background.String())
+	assert.Contains(t, stripANSI(dracula), "func main() {}")
+
+	_, err = ApplyCodeTheme(DarkStyleConfig, "no-such-theme")
+	assert.Error(t, err)
+}
+
+func TestCutLine(t *testing.T) {
+	assert.Equal(t, "cdef", cutLine("abcdef", 2, 4))
+	assert.Equal(t, "abc"+helpStyle.Render("→"), cutLine("abcdefgh", 0, 4))
+	assert.Equal(t, "\x1b[1mcd\x1b[0mef", cutLine("\x1b[1mabcd\x1b[0mef", 2, 4))
+	// trailing padding does not count as more content
+	assert.Equal(t, "cd  ", cutLine("abcd      ", 2, 4))
+}
+
+func TestRenderContent_CodeBlocksNotWrapped(t *testing.T) {
+	renderer, err := newGlamourRenderer(40)
+	assert.NoError(t, err)
+	codeRenderer, err := newGlamourRenderer(0)
+	assert.NoError(t, err)
+
+	long := strings.Repeat("abc ", 30)
+	content := "Run this:\n\n```sh\n" + long + "\n```\n\nThen " + strings.Repeat("word ", 20)
+	output, err := renderContent(renderer, codeRenderer, content)
+	assert.NoError(t, err)
+	assert.Contains(t, output, strings.TrimSpace(long))
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.Contains(line, "abc") {
+			assert.LessOrEqual(t, visibleWidth(line), 40)
+		}
+	}
+
+	wrapped, err := renderContent(renderer, nil, content)
+	assert.NoError(t, err)
+	assert.NotContains(t, wrapped, strings.TrimSpace(long))
+}
+
+func TestDetectImageProtocol(t *testing.T) {
+	for _, tt := range []struct {
+		env      map[string]string
+		expected imageProtocol
+	}{
+		{map[string]string{"TERM": "xterm-kitty", "COLORTERM": "truecolor"}, kittyImageProtocol},
+		{map[string]string{"TERM": "xterm-256color", "KITTY_WINDOW_ID": "1"}, kittyImageProtocol},
+		{map[string]string{"TERM": "xterm-ghostty"}, kittyImageProtocol},
+		// sixel is not supported
+		{map[string]string{"TERM": "foot"}, noImageProtocol},
+		{map[string]string{"TERM": "xterm-256color", "COLORTERM": "truecolor"}, noImageProtocol},
+		{map[string]string{"TERM": "tmux-256color", "KITTY_WINDOW_ID": "1"}, noImageProtocol},
+		{map[string]string{}, noImageProtocol},
+	} {
+		assert.Equal(t, tt.expected, detectImageProtocol(func(key string) string { return tt.env[key] }), tt.env)
+	}
+}
+
+func TestInlineImageRenderer_Render(t *testing.T) {
+	var data bytes.Buffer
+	require.NoError(t, png.Encode(&data, image.NewRGBA(image.Rect(0, 0, 40, 20))))
+	r := NewInlineImageRenderer(kittyImageProtocol)
+	fetched := 0
+	r.fetch = func(url string) ([]byte, error) {
+		fetched++
+		if strings.HasSuffix(url, "missing.png") {
+			return nil, errors.New("not found")
+		}
+		return data.Bytes(), nil
+	}
+
+	output, err := r.Render("https://example.com/cat.png", "cat", 80)
+	require.NoError(t, err)
+	assert.Equal(t, "\x1b[38;5;1m\U0010EEEE̅̅\U0010EEEE\U0010EEEE\U0010EEEE\x1b[39m", output)
+	assert.Equal(t, 4, visibleWidth(output))
+	// the image data waits for the view
+	var out bytes.Buffer
+	r.flush(&out)
+	assert.True(t, strings.HasPrefix(out.String(), "\x1b_Ga=t,f=100,t=d,i=1,q=2,m=0;"))
+	assert.True(t, strings.HasSuffix(out.String(), "\x1b_Ga=p,U=1,i=1,c=4,r=1,q=2\x1b\\"))
+	out.Reset()
+	r.flush(&out)
+	assert.Empty(t, out.String())
+
+	// rendered images are cached
+	_, err = r.Render("https://example.com/cat.png", "cat", 80)
+	require.NoError(t, err)
+	assert.Equal(t, 1, fetched)
+
+	// failed images are shown as text and not fetched again
+	output, err = r.Render("https://example.com/missing.png", "missing", 80)
+	assert.Error(t, err)
+	assert.Equal(t, "[image: missing]", output)
+	content, _ := r.replaceImages("![missing](https://example.com/missing.png)")
+	assert.Equal(t, "[image: missing]", content)
+	assert.Nil(t, r.renderCmd(80))
+
+	// images are text without a supported protocol
+	output, err = NewInlineImageRenderer(noImageProtocol).Render("https://example.com/cat.png", "cat", 80)
+	require.NoError(t, err)
+	assert.Equal(t, "[image: cat]", output)
+}
+
+func TestInlineImageRenderer_RenderCmd(t *testing.T) {
+	var data bytes.Buffer
+	require.NoError(t, png.Encode(&data, image.NewRGBA(image.Rect(0, 0, 40, 20))))
+	r := NewInlineImageRenderer(kittyImageProtocol)
+	var fetched []string
+	r.fetch = func(url string) ([]byte, error) {
+		fetched = append(fetched, url)
+		return data.Bytes(), nil
+	}
+
+	// the https images of the rendered content are queued once
+	r.replaceImages("![cat](https://example.com/cat.png) ![dog](http://example.com/dog.png)")
+	r.replaceImages("![cat](https://example.com/cat.png)")
+	cmd := r.renderCmd(80)
+	require.NotNil(t, cmd)
+	assert.Nil(t, r.renderCmd(80))
+	assert.Equal(t, imagesRenderedMsg{}, cmd())
+	assert.Equal(t, []string{"https://example.com/cat.png"}, fetched)
+
+	_, images := r.replaceImages("![cat](https://example.com/cat.png)")
+	assert.Len(t, images, 1)
+	assert.Nil(t, r.renderCmd(80))
+	assert.Nil(t, (*InlineImageRenderer)(nil).renderCmd(80))
+}
+
+func TestFetchImage_Refused(t *testing.T) {
+	_, err := fetchImage("http://example.com/cat.png")
+	assert.ErrorContains(t, err, "only https images are fetched")
+	for _, url := range []string{"https://127.0.0.1/cat.png", "https://10.0.0.1/cat.png", "https://169.254.169.254/cat.png", "https://[::1]/cat.png"} {
+		_, err = fetchImage(url)
+		assert.ErrorContains(t, err, "is not a public address", url)
+	}
+}
+
+func TestView_FlushesImages(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(w io.Writer) { terminalOutput = w }(terminalOutput)
+	terminalOutput = &buf
+	m := newTestModel(t)
+	m.textarea = newTextArea()
+	m.images = NewInlineImageRenderer(kittyImageProtocol)
+	m.images.transmits = []string{"\x1b_Ga=t;DATA\x1b\\"}
+
+	m.View()
+	assert.Equal(t, "\x1b_Ga=t;DATA\x1b\\", buf.String())
+	assert.Empty(t, m.images.transmits)
+}
+
+func TestImageCells(t *testing.T) {
+	cols, rows := imageCells(400, 200, 80, 30)
+	assert.Equal(t, 40, cols)
+	assert.Equal(t, 10, rows)
+	// scaled down to the width
+	cols, rows = imageCells(1600, 800, 80, 30)
+	assert.Equal(t, 80, cols)
+	assert.Equal(t, 20, rows)
+	// scaled down to the height
+	cols, rows = imageCells(100, 2000, 80, 30)
+	assert.Equal(t, 3, cols)
+	assert.Equal(t, 30, rows)
+}
+
+func TestMessageCache_Images(t *testing.T) {
+	renderer, err := newGlamourRenderer(80)
+	require.NoError(t, err)
+	images := NewInlineImageRenderer(kittyImageProtocol)
+	cache := &messageCache{images: images}
+	message := Message{Role: "assistant", Content: "Look:\n\n![a cat](https://example.com/cat.png)"}
+
+	output, err := cache.render(renderer, nil, 0, message)
+	require.NoError(t, err)
+	assert.Contains(t, ansiPattern.ReplaceAllString(output, ""), "[image: a cat]")
+
+	images.rendered["https://example.com/cat.png"] = "IMG1\nIMG2"
+	cache.entries = nil
+	output, err = cache.render(renderer, nil, 0, message)
+	require.NoError(t, err)
+	assert.NotContains(t, output, "GPTUIIMAGE")
+	assert.Regexp(t, `(?m)^( *)IMG1\n( *)IMG2`, output)
+}
+
+// codeBlocksFixture is a response with code blocks in several languages
+const codeBlocksFixture = "Here is the function in Python:\n\n" +
+	"```python\ndef add(a, b):\n    return a + b\n```\n\n" +
+	"And in Go:\n\n" +
+	"```go title=\"add.go\"\nfunc add(a, b int) int {\n\treturn a + b\n}\n```\n\n" +
+	"Run it with:\n\n" +
+	"  ```\n  go run add.go\n  ```\n"
+
+func TestParseCodeBlocks(t *testing.T) {
+	blocks := parseCodeBlocks(codeBlocksFixture)
+	require.Len(t, blocks, 3)
+
+	assert.Equal(t, "python", blocks[0].Language)
+	assert.Equal(t, []string{"def add(a, b):", "    return a + b"}, blocks[0].Lines)
+	assert.True(t, strings.HasPrefix(codeBlocksFixture[blocks[0].Start:], "```python"))
+	assert.Equal(t, "```", codeBlocksFixture[blocks[0].End-3:blocks[0].End])
+
+	assert.Equal(t, "go", blocks[1].Language)
+	assert.Equal(t, []string{"func add(a, b int) int {", "\treturn a + b", "}"}, blocks[1].Lines)
+
+	assert.Equal(t, "", blocks[2].Language)
+	assert.Equal(t, []string{"  go run add.go"}, blocks[2].Lines)
+
+	assert.Empty(t, parseCodeBlocks("no code here, only `inline` code"))
+}
+
+func TestParseSegments(t *testing.T) {
+	content := "Here is the function in Python:\n\n" +
+		"```python\ndef add(a, b):\n    return a + b\n```\n" +
+		"And in Go:\n" +
+		"```go title=\"add.go\"\nfunc add(a, b int) int {\n\n\treturn a + b\n}\n```\n\n" +
+		"~~~~sql\nSELECT '```';\n~~~~\n" +
+		"Run it with:\n\n" +
+		"```\n  go run add.go\n"
+
+	segments := ParseSegments(content)
+	require.Len(t, segments, 7)
+	assert.Equal(t, TextSegment{Text: "Here is the function in Python:\n"}, segments[0])
+	assert.Equal(t, CodeSegment{Language: "python", Code: "def add(a, b):\n    return a + b"}, segments[1])
+	assert.Equal(t, TextSegment{Text: "And in Go:"}, segments[2])
+	assert.Equal(t, CodeSegment{Language: "go", Code: "func add(a, b int) int {\n\n\treturn a + b\n}"}, segments[3])
+	// a fence of backticks does not close a block of tildes
+	assert.Equal(t, CodeSegment{Language: "sql", Code: "SELECT '```';"}, segments[4])
+	assert.Equal(t, TextSegment{Text: "Run it with:\n"}, segments[5])
+	// the unclosed block runs to the end
+	assert.Equal(t, CodeSegment{Code: "  go run add.go\n"}, segments[6])
+
+	assert.Equal(t, []Segment{TextSegment{Text: "only `inline` code"}}, ParseSegments("only `inline` code"))
+	assert.Empty(t, ParseSegments(""))
+}
+
+func TestAppendResponse_ParsesSegments(t *testing.T) {
+	m := newTestModel(t)
+	m.appendResponse(Message{Role: "assistant", Content: "Try:\n```sh\nls\n```"})
+	assert.Equal(t, []Segment{TextSegment{Text: "Try:"}, CodeSegment{Language: "sh", Code: "ls"}}, m.lastParsedResponse)
+}
+
+func TestCollapseCodeBlocks(t *testing.T) {
+	collapsed := collapseCodeBlocks(codeBlocksFixture, 5, map[int]bool{6: true}, 6)
+	assert.Contains(t, collapsed, "**▶ python (2 lines)**\n\n```python\ndef add(a, b):\n```")
+	assert.NotContains(t, collapsed, "return a + b\n```")
+	assert.Contains(t, collapsed, "**» ▼ go (3 lines)**\n\n```go title=\"add.go\"\nfunc add(a, b int) int {\n\treturn a + b\n}\n```")
+	assert.Contains(t, collapsed, "**▶ code (1 line)**")
+	assert.Contains(t, collapsed, "And in Go:")
+}
+
+func TestWordDiff(t *testing.T) {
+	diffs := wordDiff("The quick brown fox", "The slow brown fox jumps")
+	var deleted, inserted []string
+	for _, diff := range diffs {
+		switch diff.Type {
+		case diffmatchpatch.DiffDelete:
+			deleted = append(deleted, diff.Text)
+		case diffmatchpatch.DiffInsert:
+			inserted = append(inserted, diff.Text)
+		}
+	}
+	// whole words are replaced rather than the differing letters
+	assert.Equal(t, []string{"quick"}, deleted)
+	assert.Equal(t, []string{"slow", " jumps"}, inserted)
+}
+
+func TestWordDiff_ManyTokens(t *testing.T) {
+	// more distinct tokens than runes below the surrogates
+	words := make([]string, 60000)
+	for i := range words {
+		words[i] = fmt.Sprintf("w%d", i)
+	}
+	old := strings.Join(words, " ")
+	diffs := wordDiff(old, old+" end")
+	var before, after strings.Builder
+	for _, diff := range diffs {
+		if diff.Type != diffmatchpatch.DiffInsert {
+			before.WriteString(diff.Text)
+		}
+		if diff.Type != diffmatchpatch.DiffDelete {
+			after.WriteString(diff.Text)
+		}
+	}
+	assert.Equal(t, old, before.String())
+	assert.Equal(t, old+" end", after.String())
+}
+
+func TestRenderDiff(t *testing.T) {
+	lipgloss.SetColorProfile(termenv.ANSI)
+	defer lipgloss.SetColorProfile(termenv.Ascii)
+
+	output := renderDiff("Paris is the capital.", "Paris is the largest city.", 80)
+	assert.Contains(t, output, deletedStyle.Render("capital."))
+	assert.Contains(t, output, insertedStyle.Render("largest city."))
+	assert.NotContains(t, output, deletedStyle.Render("Paris"))
+
+	lines := strings.Split(ansiPattern.ReplaceAllString(output, ""), "\n")
+	for _, line := range lines {
+		assert.LessOrEqual(t, lipgloss.Width(line), 80)
+	}
+	// the previous response is on the left, the regenerated one on the right
+	assert.Less(t, strings.Index(lines[1], "previous"), strings.Index(lines[1], "regenerated"))
+	assert.Contains(t, lines[2], "capital.")
+	assert.Contains(t, lines[2], "largest city.")
+}
+
+func TestDiffText(t *testing.T) {
+	old := "func add(a, b int) int {\n\treturn a + b\n}"
+	new := "func add(a, b int) int {\n\treturn b + a\n}\n\nfunc sub(a, b int) int {\n\treturn a - b\n}"
+	assert.Equal(t, "  func add(a, b int) int {\n"+
+		"- \treturn a + b\n"+
+		"+ \treturn b + a\n"+
+		"+ }\n"+
+		"+ \n"+
+		"+ func sub(a, b int) int {\n"+
+		"+ \treturn a - b\n"+
+		"  }", DiffText(old, new))
+
+	assert.Equal(t, "  same\n  text", DiffText("same\ntext", "same\ntext"))
+	assert.Equal(t, "- gone\n+ ", DiffText("gone", ""))
+
+	lipgloss.SetColorProfile(termenv.ANSI)
+	defer lipgloss.SetColorProfile(termenv.Ascii)
+	output := DiffText("Paris is the capital.", "Paris is the largest city.")
+	assert.Contains(t, output, removedLineStyle.Render("- ")+removedLineStyle.Render("Paris is the ")+removedLineStyle.Copy().Bold(true).Render("capital."))
+	assert.Contains(t, output, addedLineStyle.Render("+ ")+addedLineStyle.Render("Paris is the ")+addedLineStyle.Copy().Bold(true).Render("largest city."))
+}
+
+func TestHighlightInANSI(t *testing.T) {
+	rendered := "\x1b[38;5;252mGo is fun\x1b[0m \x1b[1mgo\x1b[0m"
+	highlight := func(s string) string { return searchHighlightStart + s + searchHighlightEnd }
+	assert.Equal(t, "\x1b[38;5;252m"+highlight("Go")+" is fun\x1b[0m \x1b[1m"+highlight("go")+"\x1b[0m", highlightInANSI(rendered, "GO"))
+
+	// the parameters of the escape sequences are not matched
+	assert.Equal(t, "\x1b[38;5;252mtext\x1b[0m", highlightInANSI("\x1b[38;5;252mtext\x1b[0m", "38"))
+	assert.Equal(t, rendered, highlightInANSI(rendered, ""))
+	assert.Equal(t, highlight("Über")+" "+highlight("über"), highlightInANSI("Über über", "ÜBER"))
+
+	// the highlight is turned on again after the sequences inside the match
+	assert.Equal(t, "\x1b[1m"+highlight("a\x1b[0m"+searchHighlightStart+" b")+"\x1b[0m", highlightInANSI("\x1b[1ma\x1b[0m b\x1b[0m", "a b"))
+}
+
+func TestHighlightInANSI_Glamour(t *testing.T) {
+	renderer, err := newGlamourRenderer(80, glamour.WithColorProfile(termenv.ANSI256))
+	require.NoError(t, err)
+	rendered, err := renderer.Render("Go is a language.")
+	require.NoError(t, err)
+	// each word is in its own sequence
+	require.NotContains(t, rendered, "a language")
+
+	highlighted := highlightInANSI(rendered, "A LANGUAGE")
+	assert.Equal(t, 1, strings.Count(highlighted, searchHighlightEnd))
+	plain := ansiPattern.ReplaceAllString(highlighted, "")
+	assert.Contains(t, plain, "Go is a language.")
+	// the highlight is on from the start of the match to its end
+	start := strings.Index(highlighted, searchHighlightStart)
+	end := strings.Index(highlighted, searchHighlightEnd)
+	assert.Equal(t, "a language", ansiPattern.ReplaceAllString(highlighted[start:end], ""))
+	assert.True(t, strings.HasSuffix(highlighted[:end], searchHighlightStart+" language"))
+}
+
+func FuzzHighlightInANSI(f *testing.F) {
+	f.Add("\x1b[38;5;252mGo is fun\x1b[0m", "go")
+	f.Add("\x1b[1mbold\x1b[0m plain \x1b[3", "3")
+	f.Add("İstanbul istanbul", "i")
+	f.Fuzz(func(t *testing.T, rendered, query string) {
+		highlighted := highlightInANSI(rendered, query)
+		// the text is unchanged, none of its characters were taken into an escape sequence
+		assert.Equal(t, ansiPattern.ReplaceAllString(rendered, ""), ansiPattern.ReplaceAllString(highlighted, ""))
+		if strings.Contains(rendered, searchHighlightStart) || strings.Contains(rendered, searchHighlightEnd) {
+			return
+		}
+		// only the highlight was added
+		unhighlighted := strings.ReplaceAll(strings.ReplaceAll(highlighted, searchHighlightStart, ""), searchHighlightEnd, "")
+		assert.Equal(t, rendered, unhighlighted)
+	})
+}
@@ -0,0 +1,219 @@
+package chat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// replayMessageDelay is the pause between two replayed messages at 1x speed.
+	// Messages do not record when they were received, so every message gets the same pause.
+	replayMessageDelay = time.Second
+	// replayWordDelay is the interval between two streamed words at 1x speed
+	replayWordDelay = 30 * time.Millisecond
+)
+
+type replayKeymap struct {
+	Pause key.Binding
+	Next  key.Binding
+	Prev  key.Binding
+	Quit  key.Binding
+}
+
+func (k replayKeymap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Pause, k.Prev, k.Next, k.Quit}
+}
+
+func (k replayKeymap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{k.ShortHelp()}
+}
+
+var replayKeys = replayKeymap{
+	Pause: key.NewBinding(
+		key.WithKeys(" "),
+		key.WithHelp("space", "pause/resume"),
+	),
+	Next: key.NewBinding(
+		key.WithKeys("right"),
+		key.WithHelp("→", "next message"),
+	),
+	Prev: key.NewBinding(
+		key.WithKeys("left"),
+		key.WithHelp("←", "previous message"),
+	),
+	Quit: key.NewBinding(
+		key.WithKeys("q", "ctrl+c"),
+		key.WithHelp("q", "quit"),
+	),
+}
+
+// replayTickMsg advances the replay, ticks of an earlier seq are outdated
+type replayTickMsg struct {
+	seq int
+}
+
+// ReplayModel plays back a saved session in read-only mode
+type ReplayModel struct {
+	Model
+	messages []Message
+	// shown is the number of messages fully shown
+	shown int
+	// words is the number of words shown of the streamed message
+	words  int
+	speed  float64
+	paused bool
+	seq    int
+}
+
+// NewReplayModel creates a ReplayModel for the session file played at the speed
+func NewReplayModel(filePath string, speed float64) (ReplayModel, error) {
+	if speed <= 0 {
+		return ReplayModel{}, fmt.Errorf("invalid replay speed %v", speed)
+	}
+	session, err := LoadSession(filePath)
+	if err != nil {
+		return ReplayModel{}, err
+	}
+	renderer, err := newGlamourRenderer(50)
+	if err != nil {
+		return ReplayModel{}, err
+	}
+
+	m := Model{
+		client:   NewChatClient("", "", "", "", false, 0),
+		viewport: viewport.New(50, 10),
+		renderer: renderer,
+		cache:    &messageCache{},
+		help:     help.New(),
+		keys:     keys,
+	}
+	return ReplayModel{Model: m, messages: session.Messages, speed: speed}, nil
+}
+
+// ParseReplaySpeed parses speeds such as "2x" or "0.5x"
+func ParseReplaySpeed(s string) (float64, error) {
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(s, "x"), 64)
+	if err != nil || speed <= 0 {
+		return 0, fmt.Errorf("invalid replay speed %q", s)
+	}
+	return speed, nil
+}
+
+func (m ReplayModel) Init() tea.Cmd {
+	return tea.Batch(tea.EnterAltScreen, m.replayTickCmd())
+}
+
+func (m ReplayModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, replayKeys.Quit):
+			return m, tea.Quit
+		case key.Matches(msg, replayKeys.Pause):
+			m.paused = !m.paused
+			m.seq++
+			if !m.paused {
+				return m, m.replayTickCmd()
+			}
+			return m, nil
+		case key.Matches(msg, replayKeys.Next):
+			if m.shown < len(m.messages) {
+				m.shown++
+			}
+			m.words = 0
+			m.seq++
+			m.render()
+			return m, m.replayTickCmd()
+		case key.Matches(msg, replayKeys.Prev):
+			if m.words == 0 && m.shown > 0 {
+				m.shown--
+			}
+			m.words = 0
+			m.seq++
+			m.render()
+			return m, m.replayTickCmd()
+		}
+
+	case replayTickMsg:
+		if msg.seq != m.seq || m.paused || m.shown >= len(m.messages) {
+			return m, nil
+		}
+		next := m.messages[m.shown]
+		if next.Role == "assistant" && m.words < len(replayWords(next.Content)) {
+			// simulate the streaming of the response
+			m.words++
+		} else {
+			m.shown++
+			m.words = 0
+		}
+		m.render()
+		return m, m.replayTickCmd()
+
+	case tea.WindowSizeMsg:
+		model, cmd := m.Model.Update(msg)
+		m.Model = model.(Model)
+		m.render()
+		return m, cmd
+	}
+
+	// scroll the viewport, the input is read-only
+	var cmd tea.Cmd
+	m.viewport, cmd = m.viewport.Update(msg)
+	return m, cmd
+}
+
+func (m ReplayModel) View() string {
+	state := "▶"
+	if m.paused {
+		state = "⏸"
+	}
+	status := helpStyle.Render(fmt.Sprintf("%s %d/%d  %gx", state, m.shown, len(m.messages), m.speed))
+	return appStyle.Render(m.viewport.View() + "\n" + status + "\n\n" + m.help.View(replayKeys))
+}
+
+// render shows the replayed messages in the viewport like in a live session
+func (m *ReplayModel) render() {
+	m.client.history = m.messages[:m.shown]
+	if m.words > 0 {
+		words := replayWords(m.messages[m.shown].Content)
+		m.streamDeltas = strings.Join(words[:m.words], "")
+		m.renderStream()
+		return
+	}
+	m.streamDeltas = ""
+	content, _ := m.renderMessages(m.client.history)
+	m.viewport.SetContent(content)
+	m.viewport.GotoBottom()
+}
+
+// replayTickCmd returns a tea.Cmd which advances the replay after the delay of the next step
+func (m ReplayModel) replayTickCmd() tea.Cmd {
+	if m.paused || m.shown >= len(m.messages) {
+		return nil
+	}
+	seq := m.seq
+	return tea.Tick(m.replayDelay(), func(time.Time) tea.Msg {
+		return replayTickMsg{seq: seq}
+	})
+}
+
+// replayDelay returns the delay before the next step of the replay, scaled by the speed
+func (m ReplayModel) replayDelay() time.Duration {
+	delay := replayMessageDelay
+	if m.words > 0 {
+		delay = replayWordDelay
+	}
+	return time.Duration(float64(delay) / m.speed)
+}
+
+// replayWords splits the content into the words streamed one by one
+func replayWords(content string) []string {
+	return strings.SplitAfter(content, " ")
+}
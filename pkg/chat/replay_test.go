@@ -0,0 +1,86 @@
+package chat
+
+import (
+	"path"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestReplayModel(t *testing.T, speed float64) ReplayModel {
+	filePath := path.Join(t.TempDir(), "session.json")
+	session := &Session{Messages: []Message{
+		{Role: "user", Content: "Hello"},
+		{Role: "assistant", Content: "Hi there"},
+	}}
+	assert.NoError(t, SaveSession(filePath, session))
+	m, err := NewReplayModel(filePath, speed)
+	assert.NoError(t, err)
+	return m
+}
+
+func TestParseReplaySpeed(t *testing.T) {
+	for s, want := range map[string]float64{"1x": 1, "2x": 2, "0.5x": 0.5, "3": 3} {
+		speed, err := ParseReplaySpeed(s)
+		assert.NoError(t, err)
+		assert.Equal(t, want, speed)
+	}
+	for _, s := range []string{"fast", "0x", "-1x"} {
+		_, err := ParseReplaySpeed(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestReplayModel_Tick(t *testing.T) {
+	m := newTestReplayModel(t, 2)
+	tick := func() {
+		model, _ := m.Update(replayTickMsg{seq: m.seq})
+		m = model.(ReplayModel)
+	}
+
+	// messages are shown after the message delay scaled by the speed
+	assert.Equal(t, 500*time.Millisecond, m.replayDelay())
+	tick()
+	assert.Equal(t, 1, m.shown)
+	assert.Equal(t, 500*time.Millisecond, m.replayDelay())
+
+	// the assistant message is streamed word by word
+	tick()
+	assert.Equal(t, 1, m.shown)
+	assert.Equal(t, "Hi ", m.streamDeltas)
+	assert.Equal(t, 15*time.Millisecond, m.replayDelay())
+	tick()
+	assert.Equal(t, "Hi there", m.streamDeltas)
+	tick()
+	assert.Equal(t, 2, m.shown)
+	assert.Empty(t, m.streamDeltas)
+	assert.Nil(t, m.replayTickCmd())
+}
+
+func TestReplayModel_Controls(t *testing.T) {
+	m := newTestReplayModel(t, 1)
+	press := func(k tea.KeyMsg) {
+		model, _ := m.Update(k)
+		m = model.(ReplayModel)
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyRight})
+	assert.Equal(t, 1, m.shown)
+
+	// ticks scheduled before the step are outdated
+	model, _ := m.Update(replayTickMsg{seq: m.seq - 1})
+	assert.Equal(t, 1, model.(ReplayModel).shown)
+
+	press(tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(" ")})
+	assert.True(t, m.paused)
+	assert.Nil(t, m.replayTickCmd())
+	model, _ = m.Update(replayTickMsg{seq: m.seq})
+	assert.Equal(t, 1, model.(ReplayModel).shown)
+
+	press(tea.KeyMsg{Type: tea.KeyLeft})
+	assert.Equal(t, 0, m.shown)
+	press(tea.KeyMsg{Type: tea.KeyLeft})
+	assert.Equal(t, 0, m.shown)
+}
@@ -0,0 +1,43 @@
+package chat
+
+import (
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// searchDoneKeys close the search input, keeping the matches highlighted
+var searchDoneKeys = key.NewBinding(key.WithKeys("enter"))
+
+// startSearch opens the search input with the previous query
+func (m *Model) startSearch() tea.Cmd {
+	m.searching = true
+	m.searchInput = textinput.New()
+	m.searchInput.Prompt = "Search: "
+	m.searchInput.Placeholder = "text in the conversation, esc clears"
+	m.searchInput.SetValue(m.searchQuery)
+	cmd := m.searchInput.Focus()
+	m.setNotice(m.searchInput.View())
+	return cmd
+}
+
+// updateSearching handles the keys of the search input, the matches are highlighted as the query is typed
+func (m *Model) updateSearching(msg tea.KeyMsg) tea.Cmd {
+	var cmd tea.Cmd
+	switch {
+	case key.Matches(msg, searchDoneKeys):
+		m.searching = false
+		m.setNotice("")
+		return nil
+	case key.Matches(msg, m.keys.Esc, m.keys.Search):
+		m.searching = false
+		m.searchQuery = ""
+		m.setNotice("")
+		return nil
+	default:
+		m.searchInput, cmd = m.searchInput.Update(msg)
+		m.searchQuery = m.searchInput.Value()
+	}
+	m.setNotice(m.searchInput.View())
+	return cmd
+}
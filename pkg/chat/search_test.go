@@ -0,0 +1,44 @@
+package chat
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdate_Search(t *testing.T) {
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.client.history = []Message{{Role: "user", Content: "Which language?"}, {Role: "assistant", Content: "Go is a language"}}
+	m.setNotice("")
+
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlF})
+	m = model.(Model)
+	assert.True(t, m.searching)
+	for _, r := range "LANG" {
+		model, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		m = model.(Model)
+	}
+	assert.Equal(t, "LANG", m.searchQuery)
+	// the keys go to the search input rather than the message input
+	assert.Empty(t, m.textarea.Value())
+	assert.Contains(t, m.viewportView(), searchHighlightStart+"lang"+searchHighlightEnd+"uage?")
+	assert.Contains(t, m.viewportView(), searchHighlightStart+"lang"+searchHighlightEnd+"uage")
+
+	// enter keeps the matches highlighted, esc clears them
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = model.(Model)
+	assert.False(t, m.searching)
+	assert.Contains(t, m.viewportView(), searchHighlightStart)
+
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlF})
+	m = model.(Model)
+	assert.Equal(t, "LANG", m.searchInput.Value())
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyEsc})
+	m = model.(Model)
+	assert.False(t, m.searching)
+	assert.NotContains(t, m.viewportView(), searchHighlightStart)
+}
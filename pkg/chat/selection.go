@@ -0,0 +1,92 @@
+package chat
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+var (
+	// selectionUpKeys and selectionDownKeys move the cursor between messages in selection mode
+	selectionUpKeys   = key.NewBinding(key.WithKeys("up", "k"))
+	selectionDownKeys = key.NewBinding(key.WithKeys("down", "j"))
+	// selectionToggleKeys check or uncheck the message at the cursor
+	selectionToggleKeys = key.NewBinding(key.WithKeys(" "))
+	// selectionConfirmKeys keep the selection for the next request
+	selectionConfirmKeys = key.NewBinding(key.WithKeys("enter"))
+)
+
+// startSelection enters the selection mode with all messages checked and the cursor on the last one
+func (m *Model) startSelection() {
+	if len(m.client.history) == 0 {
+		m.setNotice(warnStyle.Render("no messages to select"))
+		return
+	}
+	m.selecting = true
+	m.selectionCursor = len(m.client.history) - 1
+	m.selectedMessages = map[int]bool{}
+	for i := range m.client.history {
+		m.selectedMessages[i] = true
+	}
+	m.setNotice(helpStyle.Render("Select the messages of the next request: ↑/↓ move, space toggles, enter confirms, esc cancels"))
+}
+
+// updateSelection handles the keys of the selection mode
+func (m *Model) updateSelection(msg tea.KeyMsg) tea.Cmd {
+	switch {
+	case key.Matches(msg, selectionUpKeys):
+		m.selectionCursor = max(m.selectionCursor-1, 0)
+	case key.Matches(msg, selectionDownKeys):
+		m.selectionCursor = min(m.selectionCursor+1, len(m.client.history)-1)
+	case key.Matches(msg, selectionToggleKeys):
+		m.selectedMessages[m.selectionCursor] = !m.selectedMessages[m.selectionCursor]
+	case key.Matches(msg, selectionConfirmKeys):
+		m.selecting = false
+		n := 0
+		for _, selected := range m.selectedMessages {
+			if selected {
+				n++
+			}
+		}
+		m.setNotice(fmt.Sprintf("%d of %d messages will be sent with the next request", n, len(m.client.history)))
+		return nil
+	case key.Matches(msg, m.keys.Esc, m.keys.Select):
+		m.selecting = false
+		m.selectedMessages = nil
+		m.setNotice("")
+		return nil
+	default:
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return cmd
+	}
+	m.setNotice(m.notice)
+	return nil
+}
+
+// selectionCheckbox returns the checkbox rendered before the message at index i
+func (m Model) selectionCheckbox(i int) string {
+	checkbox := "[ ] "
+	if m.selectedMessages[i] {
+		checkbox = "[x] "
+	}
+	if m.selecting && i == m.selectionCursor {
+		return senderStyle.Render("▸ " + checkbox)
+	}
+	return helpStyle.Render("  " + checkbox)
+}
+
+// selectHistory returns the messages of the history which are selected, all if selected is nil
+func selectHistory(history []Message, selected map[int]bool) []Message {
+	if selected == nil {
+		return history
+	}
+	var messages []Message
+	for i, message := range history {
+		if selected[i] {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
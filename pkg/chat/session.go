@@ -0,0 +1,241 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sessionTimeLayout is the layout of the timestamp used as session ID
+const sessionTimeLayout = "2006-01-02_15-04-05"
+
+// Session is a saved conversation
+type Session struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Pinned    bool      `json:"pinned,omitempty"`
+	// Model is the model of sessions saved before Metadata was added.
+	// Deprecated: use Metadata.Model, LoadSession moves it there.
+	Model    string          `json:"model,omitempty"`
+	Metadata SessionMetadata `json:"metadata"`
+	Tags     []string        `json:"tags,omitempty"`
+	// Notes are private notes by message index, they are not sent to the API
+	Notes map[int]string `json:"notes,omitempty"`
+	// Ratings are the ratings from 1 to 5 of the responses by message index
+	Ratings  map[int]int `json:"ratings,omitempty"`
+	Messages []Message   `json:"messages"`
+}
+
+// SessionMetadata records the settings a session was created with
+type SessionMetadata struct {
+	Model        string  `json:"model,omitempty"`
+	BaseURL      string  `json:"base_url,omitempty"`
+	Temperature  float32 `json:"temperature,omitempty"`
+	SystemPrompt string  `json:"system_prompt,omitempty"`
+	GptUIVersion string  `json:"gptui_version,omitempty"`
+}
+
+// changes describes the settings of the metadata which differ from the current ones,
+// ignoring the settings the metadata does not record
+func (md SessionMetadata) changes(current SessionMetadata) []string {
+	var changes []string
+	if len(md.Model) > 0 && md.Model != current.Model {
+		changes = append(changes, md.Model)
+	}
+	if len(md.BaseURL) > 0 && md.BaseURL != current.BaseURL {
+		changes = append(changes, md.BaseURL)
+	}
+	if md.Temperature != current.Temperature {
+		changes = append(changes, fmt.Sprintf("temperature %g", md.Temperature))
+	}
+	if len(md.SystemPrompt) > 0 && md.SystemPrompt != current.SystemPrompt {
+		changes = append(changes, "a different system message")
+	}
+	return changes
+}
+
+// HistoryDir returns the directory where sessions are saved
+func HistoryDir() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, "chat"), nil
+}
+
+// sessionIDFromPath returns the session ID from the file name
+func sessionIDFromPath(filePath string) string {
+	fileName := path.Base(filePath)
+	return strings.TrimSuffix(fileName, path.Ext(fileName))
+}
+
+// LoadSession reads a session from a JSON file.
+// Files containing only a list of messages are supported as well.
+func LoadSession(filePath string) (*Session, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+		if err := json.Unmarshal(data, &session.Messages); err != nil {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+
+	if err := session.setDefaults(filePath); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// setDefaults fills in the ID and creation time from the file if missing
+// and moves the legacy model into the metadata
+func (s *Session) setDefaults(filePath string) error {
+	if len(s.Metadata.Model) == 0 {
+		s.Metadata.Model = s.Model
+	}
+	s.Model = ""
+	if len(s.ID) == 0 {
+		s.ID = sessionIDFromPath(filePath)
+	}
+	if s.CreatedAt.IsZero() {
+		createdAt, err := time.ParseInLocation(sessionTimeLayout, s.ID, time.Local)
+		if err != nil {
+			info, err := os.Stat(filePath)
+			if err != nil {
+				return err
+			}
+			createdAt = info.ModTime()
+		}
+		s.CreatedAt = createdAt
+	}
+	return nil
+}
+
+// resolveSessionPath returns the path of the file of a new session in dir, named literal if set
+// or after the time now formatted with the layout pattern otherwise. If a file of that name
+// exists, _1, _2… is appended to the name until it is free.
+func resolveSessionPath(dir, pattern, literal string, now time.Time) (string, error) {
+	name := literal
+	if len(name) == 0 {
+		name = now.Format(pattern)
+	}
+	if len(strings.TrimSpace(name)) == 0 || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid session name %q", name)
+	}
+	filePath := path.Join(dir, name+".json")
+	for i := 1; ; i++ {
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			return filePath, nil
+		} else if err != nil {
+			return "", err
+		}
+		filePath = path.Join(dir, fmt.Sprintf("%s_%d.json", name, i))
+	}
+}
+
+// SaveSession writes the session to a JSON file
+func SaveSession(filePath string, session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0644)
+}
+
+// ListSessions returns the sessions saved in dir.
+// Pinned sessions come first, then sessions are sorted by creation time, newest first.
+func ListSessions(dir string) ([]Session, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []Session
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		session, err := LoadSession(path.Join(dir, entry.Name()))
+		if err != nil {
+			logger.Warn("skipping invalid session", "file", entry.Name(), "error", err)
+			continue
+		}
+		sessions = append(sessions, *session)
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		if sessions[i].Pinned != sessions[j].Pinned {
+			return sessions[i].Pinned
+		}
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+// TogglePin flips the pinned state of the session saved in historyDir
+func TogglePin(sessionID string, historyDir string) error {
+	filePath := path.Join(historyDir, fmt.Sprintf("%s.json", sessionID))
+	session, err := LoadSession(filePath)
+	if err != nil {
+		return err
+	}
+	session.Pinned = !session.Pinned
+	return SaveSession(filePath, session)
+}
+
+// PruneOptions configures which sessions PruneSessions deletes
+type PruneOptions struct {
+	// OlderThan is the minimum age of the sessions to delete
+	OlderThan time.Duration
+	// MinMessages keeps the sessions with at least this many messages
+	MinMessages int
+	// KeepPinned keeps the pinned sessions
+	KeepPinned bool
+	// DryRun only reports the sessions which would be deleted
+	DryRun bool
+}
+
+// PruneSessions deletes the sessions in dir matching the options and returns their file paths
+func PruneSessions(dir string, opts PruneOptions) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	cutoff := time.Now().Add(-opts.OlderThan)
+	var pruned []string
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		filePath := path.Join(dir, entry.Name())
+		session, err := LoadSession(filePath)
+		if err != nil {
+			logger.Warn("skipping invalid session", "file", entry.Name(), "error", err)
+			continue
+		}
+		if !session.CreatedAt.Before(cutoff) || len(session.Messages) >= opts.MinMessages {
+			continue
+		}
+		if opts.KeepPinned && session.Pinned {
+			continue
+		}
+		if !opts.DryRun {
+			if err := os.Remove(filePath); err != nil {
+				return pruned, err
+			}
+		}
+		pruned = append(pruned, filePath)
+	}
+	return pruned, nil
+}
@@ -0,0 +1,212 @@
+package chat
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTogglePin(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, id := range []string{"oldest", "middle", "newest"} {
+		session := &Session{ID: id, CreatedAt: now.Add(time.Duration(i) * time.Hour)}
+		assert.NoError(t, SaveSession(path.Join(dir, id+".json"), session))
+	}
+
+	sessions, err := ListSessions(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "newest", sessions[0].ID)
+
+	assert.NoError(t, TogglePin("oldest", dir))
+	sessions, err = ListSessions(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "oldest", sessions[0].ID)
+	assert.True(t, sessions[0].Pinned)
+	assert.Equal(t, "newest", sessions[1].ID)
+
+	assert.NoError(t, TogglePin("oldest", dir))
+	sessions, err = ListSessions(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "newest", sessions[0].ID)
+}
+
+func TestLoadSession_MessagesOnly(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "2023-05-01_10-00-00.json")
+	data := `[{"role":"user","content":"Hello"},{"role":"assistant","content":"Hi"}]`
+	assert.NoError(t, os.WriteFile(filePath, []byte(data), 0644))
+
+	session, err := LoadSession(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "2023-05-01_10-00-00", session.ID)
+	assert.Equal(t, time.Date(2023, 5, 1, 10, 0, 0, 0, time.Local), session.CreatedAt)
+	assert.Len(t, session.Messages, 2)
+}
+
+func TestPruneSessions(t *testing.T) {
+	now := time.Now()
+	fixtures := []Session{
+		{ID: "old-empty", CreatedAt: now.Add(-40 * 24 * time.Hour)},
+		{ID: "old-short", CreatedAt: now.Add(-40 * 24 * time.Hour), Messages: []Message{{Role: "user", Content: "Hi"}}},
+		{ID: "old-pinned", CreatedAt: now.Add(-40 * 24 * time.Hour), Pinned: true},
+		{ID: "new-empty", CreatedAt: now.Add(-time.Hour)},
+	}
+	setup := func(t *testing.T) string {
+		dir := t.TempDir()
+		for _, session := range fixtures {
+			session := session
+			assert.NoError(t, SaveSession(path.Join(dir, session.ID+".json"), &session))
+		}
+		return dir
+	}
+	ids := func(paths []string) []string {
+		var ids []string
+		for _, p := range paths {
+			ids = append(ids, sessionIDFromPath(p))
+		}
+		return ids
+	}
+	month := 30 * 24 * time.Hour
+
+	tests := []struct {
+		name string
+		opts PruneOptions
+		want []string
+	}{
+		{"empty sessions", PruneOptions{OlderThan: month, MinMessages: 1}, []string{"old-empty", "old-pinned"}},
+		{"short sessions", PruneOptions{OlderThan: month, MinMessages: 2}, []string{"old-empty", "old-pinned", "old-short"}},
+		{"keep pinned", PruneOptions{OlderThan: month, MinMessages: 1, KeepPinned: true}, []string{"old-empty"}},
+		{"recent sessions", PruneOptions{OlderThan: time.Minute, MinMessages: 1}, []string{"new-empty", "old-empty", "old-pinned"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := setup(t)
+			pruned, err := PruneSessions(dir, tt.opts)
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tt.want, ids(pruned))
+
+			sessions, err := ListSessions(dir)
+			assert.NoError(t, err)
+			assert.Len(t, sessions, len(fixtures)-len(tt.want))
+		})
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		dir := setup(t)
+		pruned, err := PruneSessions(dir, PruneOptions{OlderThan: month, MinMessages: 1, DryRun: true})
+		assert.NoError(t, err)
+		assert.Len(t, pruned, 2)
+
+		sessions, err := ListSessions(dir)
+		assert.NoError(t, err)
+		assert.Len(t, sessions, len(fixtures))
+	})
+}
+
+func TestSaveSession_Metadata(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "2023-05-01_10-00-00.json")
+	metadata := SessionMetadata{
+		Model:        "gpt-4",
+		BaseURL:      "http://localhost:8080/v1",
+		Temperature:  0.2,
+		SystemPrompt: "You are a pirate.",
+		GptUIVersion: "v0.5.0",
+	}
+	session := &Session{
+		ID:        "2023-05-01_10-00-00",
+		CreatedAt: time.Now(),
+		Metadata:  metadata,
+		Messages:  []Message{{Role: "user", Content: "Ahoy"}},
+	}
+	assert.NoError(t, SaveSession(filePath, session))
+
+	loaded, err := LoadSession(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, metadata, loaded.Metadata)
+
+	opened, _, err := openHistory(filePath, historyPageSize)
+	assert.NoError(t, err)
+	assert.Equal(t, metadata, opened.Metadata)
+}
+
+func TestLoadSession_LegacyModel(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "2023-05-01_10-00-00.json")
+	data := `{"id":"2023-05-01_10-00-00","model":"gpt-4","messages":[]}`
+	assert.NoError(t, os.WriteFile(filePath, []byte(data), 0644))
+
+	session, err := LoadSession(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, "gpt-4", session.Metadata.Model)
+	assert.Empty(t, session.Model)
+}
+
+func TestResolveSessionPath(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 3, 9, 14, 5, 30, 0, time.Local)
+
+	filePath, err := resolveSessionPath(dir, sessionTimeLayout, "", now)
+	assert.NoError(t, err)
+	assert.Equal(t, path.Join(dir, "2024-03-09_14-05-30.json"), filePath)
+	filePath, err = resolveSessionPath(dir, "session-20060102", "", now)
+	assert.NoError(t, err)
+	assert.Equal(t, path.Join(dir, "session-20240309.json"), filePath)
+
+	// the suffixes increment while the names are taken
+	for _, expected := range []string{"notes.json", "notes_1.json", "notes_2.json", "notes_3.json"} {
+		filePath, err := resolveSessionPath(dir, sessionTimeLayout, "notes", now)
+		assert.NoError(t, err)
+		assert.Equal(t, path.Join(dir, expected), filePath)
+		assert.NoError(t, os.WriteFile(filePath, []byte("{}"), 0644))
+	}
+	// the names of the pattern collide the same way
+	assert.NoError(t, os.WriteFile(path.Join(dir, "2024-03-09.json"), []byte("{}"), 0644))
+	filePath, err = resolveSessionPath(dir, "2006-01-02", "", now)
+	assert.NoError(t, err)
+	assert.Equal(t, path.Join(dir, "2024-03-09_1.json"), filePath)
+
+	for _, literal := range []string{"../escape", `a\b`, " "} {
+		_, err = resolveSessionPath(dir, sessionTimeLayout, literal, now)
+		assert.Error(t, err, literal)
+	}
+	_, err = resolveSessionPath(dir, "", "", now)
+	assert.Error(t, err)
+}
+
+func TestUpdate_ResumeSession(t *testing.T) {
+	dir := t.TempDir()
+	filePath := path.Join(dir, "notes.json")
+	assert.NoError(t, SaveSession(filePath, &Session{ID: "notes", CreatedAt: time.Now(), Messages: []Message{{Role: "user", Content: "hello"}}}))
+
+	for key, resumed := range map[string]bool{"y": true, "n": false} {
+		m := newTestModel(t)
+		m.keys = keys
+		m.textarea = newTextArea()
+		m.textarea.Focus()
+		m.sessionId = "notes_1"
+		m.pendingResume = filePath
+		model, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)})
+		m = model.(Model)
+		assert.Empty(t, m.pendingResume)
+		assert.Empty(t, m.textarea.Value())
+		if resumed {
+			assert.Equal(t, "notes", m.sessionId)
+			assert.Equal(t, []Message{{Role: "user", Content: "hello"}}, m.client.history)
+		} else {
+			assert.Equal(t, "notes_1", m.sessionId)
+			assert.Empty(t, m.client.history)
+		}
+	}
+
+	// the quit key is not taken as an answer
+	setTestHome(t)
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.pendingResume = filePath
+	_, cmd := m.Update(tea.KeyMsg{Type: tea.KeyCtrlC})
+	assert.Contains(t, batchMessages(cmd), tea.Quit())
+}
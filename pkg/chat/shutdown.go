@@ -0,0 +1,55 @@
+package chat
+
+import (
+	"context"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// shutdownMsg is sent when the process is asked to terminate, e.g. by SIGTERM
+type shutdownMsg struct{}
+
+// WithShutdown returns the model which quits gracefully when ctx is done,
+// saving the history and closing the client as if ctrl+c was pressed.
+func (m Model) WithShutdown(ctx context.Context) Model {
+	m.shutdown = ctx.Done()
+	return m
+}
+
+// waitShutdownCmd returns a tea.Cmd which waits until done is closed
+func waitShutdownCmd(done <-chan struct{}) tea.Cmd {
+	return func() tea.Msg {
+		<-done
+		return shutdownMsg{}
+	}
+}
+
+// quit stops speaking, saves the draft, closes the clients and restores the window title
+func (m *Model) quit() tea.Cmd {
+	if m.cancelSpeech != nil {
+		m.cancelSpeech()
+	}
+	if m.recorder != nil {
+		m.recorder.kill()
+	}
+	removeTempAudioFiles()
+	if m.saveDrafts {
+		if err := saveDraft(m.sessionId, m.textarea.Value()); err != nil {
+			logger.Error("failed to save draft", "error", err)
+		}
+	}
+	m.client.Close()
+	for _, pane := range m.sessions {
+		pane.client.Close()
+	}
+	for _, t := range m.tabs {
+		t.client.Close()
+	}
+	if m.workspace != nil {
+		m.workspace.Close()
+	}
+	if m.windowTitle {
+		clearWindowTitle()
+	}
+	return tea.Quit
+}
@@ -0,0 +1,41 @@
+//go:build unix
+
+package chat
+
+import (
+	"context"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate_ShutdownOnSIGTERM(t *testing.T) {
+	defer func(f func() (string, error)) { userConfigDir = f }(userConfigDir)
+	setTestHome(t)
+	configDir := t.TempDir()
+	userConfigDir = func() (string, error) { return configDir, nil }
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	m := newTestModel(t).WithShutdown(ctx)
+	m.client.history = []Message{{Role: "user", Content: "Hello"}, {Role: "assistant", Content: "Hi"}}
+
+	require.NoError(t, syscall.Kill(syscall.Getpid(), syscall.SIGTERM))
+	msg := waitShutdownCmd(m.shutdown)()
+	assert.Equal(t, shutdownMsg{}, msg)
+
+	_, cmd := m.Update(msg)
+	require.NotNil(t, cmd)
+	assert.Equal(t, tea.Quit(), cmd())
+
+	sessions, err := ListSessions(filepath.Join(configDir, appName, "chat"))
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, m.client.history, sessions[0].Messages)
+}
@@ -0,0 +1,184 @@
+package chat
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxSuggestions is the number of corrections suggested for a misspelled word
+const maxSuggestions = 5
+
+// embeddedDictionary is the built-in word list, see en_US.dic.license for its source and license
+//
+//go:embed en_US.dic
+var embeddedDictionary []byte
+
+// SpellChecker checks words against a Hunspell-style dictionary.
+// Affix flags are ignored, so the dictionary should list every word form.
+type SpellChecker struct {
+	words map[string]bool
+}
+
+// NewSpellChecker parses the dictionary, a word per line optionally preceded by a word count line
+func NewSpellChecker(dictionary []byte) *SpellChecker {
+	words := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(dictionary))
+	for first := true; scanner.Scan(); first = false {
+		line := strings.TrimSpace(scanner.Text())
+		if first {
+			if _, err := strconv.Atoi(line); err == nil {
+				continue
+			}
+		}
+		word, _, _ := strings.Cut(line, "/")
+		if len(word) > 0 {
+			words[strings.ToLower(word)] = true
+		}
+	}
+	return &SpellChecker{words: words}
+}
+
+// loadSpellChecker returns a SpellChecker for the dictionary file, or for the embedded dictionary if filePath is empty
+func loadSpellChecker(filePath string) (*SpellChecker, error) {
+	if len(filePath) == 0 {
+		return NewSpellChecker(embeddedDictionary), nil
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return NewSpellChecker(data), nil
+}
+
+// Check reports whether the word is spelled correctly.
+// Words with digits and all-caps acronyms are always accepted.
+func (s *SpellChecker) Check(word string) bool {
+	word = strings.Trim(word, "'")
+	if len(word) == 0 || strings.IndexFunc(word, unicode.IsDigit) >= 0 {
+		return true
+	}
+	if len(word) > 1 && strings.ToUpper(word) == word {
+		return true
+	}
+	lower := strings.ToLower(word)
+	return s.words[lower] || s.words[strings.TrimSuffix(lower, "'s")]
+}
+
+// Suggestions returns up to maxSuggestions dictionary words within an edit distance of 2,
+// closest first. The capitalization of the first letter is kept.
+func (s *SpellChecker) Suggestions(word string) []string {
+	lower := strings.ToLower(strings.Trim(word, "'"))
+	if len(lower) == 0 {
+		return nil
+	}
+	type candidate struct {
+		word     string
+		distance int
+	}
+	var candidates []candidate
+	length := len([]rune(lower))
+	for w := range s.words {
+		if diff := len([]rune(w)) - length; diff > 2 || diff < -2 {
+			continue
+		}
+		if d := editDistance(lower, w); d > 0 && d <= 2 {
+			candidates = append(candidates, candidate{w, d})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].word < candidates[j].word
+	})
+
+	var suggestions []string
+	capitalized := unicode.IsUpper([]rune(word)[0])
+	for _, c := range candidates[:min(len(candidates), maxSuggestions)] {
+		if capitalized {
+			r := []rune(c.word)
+			r[0] = unicode.ToUpper(r[0])
+			c.word = string(r)
+		}
+		suggestions = append(suggestions, c.word)
+	}
+	return suggestions
+}
+
+// Misspelled returns the distinct misspelled words of the text in order of appearance
+func (s *SpellChecker) Misspelled(text string) []string {
+	var misspelled []string
+	seen := map[string]bool{}
+	for _, word := range splitWords(text) {
+		if !seen[word] && !s.Check(word) {
+			misspelled = append(misspelled, word)
+		}
+		seen[word] = true
+	}
+	return misspelled
+}
+
+// isWordRune reports whether r is part of a word for spell checking
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\''
+}
+
+// splitWords returns the words of the text
+func splitWords(text string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool { return !isWordRune(r) }) {
+		if word = strings.Trim(word, "'"); len(word) > 0 {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// wordAt returns the word of the line around the rune column col
+func wordAt(line string, col int) string {
+	runes := []rune(line)
+	if col > len(runes) {
+		col = len(runes)
+	}
+	start, end := col, col
+	for start > 0 && isWordRune(runes[start-1]) {
+		start--
+	}
+	for end < len(runes) && isWordRune(runes[end]) {
+		end++
+	}
+	return strings.Trim(string(runes[start:end]), "'")
+}
+
+// editDistance returns the Damerau-Levenshtein distance between a and b,
+// counting a transposition of adjacent letters as one edit
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
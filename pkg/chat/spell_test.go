@@ -0,0 +1,71 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpellChecker_Check(t *testing.T) {
+	s := NewSpellChecker(embeddedDictionary)
+	for _, word := range []string{"hello", "Hello", "received", "don't", "world's", "API", "v2", "123"} {
+		assert.True(t, s.Check(word), word)
+	}
+	for _, word := range []string{"recieve", "teh", "Wrold"} {
+		assert.False(t, s.Check(word), word)
+	}
+}
+
+func TestSpellChecker_Suggestions(t *testing.T) {
+	s := NewSpellChecker([]byte("5\nreceive/SM\nrecipe\nthe\nten\ntea\n"))
+	assert.Equal(t, []string{"receive", "recipe"}, s.Suggestions("recieve"))
+	assert.Equal(t, []string{"tea", "ten", "the"}, s.Suggestions("teh"))
+	assert.Equal(t, []string{"The"}, s.Suggestions("Thw")[:1])
+	assert.Empty(t, s.Suggestions("xyzzyplugh"))
+}
+
+func TestSpellChecker_Misspelled(t *testing.T) {
+	s := NewSpellChecker(embeddedDictionary)
+	assert.Equal(t, []string{"recieve", "teh"}, s.Misspelled("I recieve teh mail, teh end"))
+	assert.Empty(t, s.Misspelled("Hello world"))
+}
+
+func TestLoadSpellChecker_DictFile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "custom.dic")
+	require.NoError(t, os.WriteFile(filePath, []byte("2\ngptui\nchat/S\n"), 0644))
+
+	s, err := loadSpellChecker(filePath)
+	require.NoError(t, err)
+	assert.True(t, s.Check("gptui"))
+	assert.True(t, s.Check("chat"))
+	assert.False(t, s.Check("hello"))
+
+	_, err = loadSpellChecker(filepath.Join(t.TempDir(), "missing.dic"))
+	assert.Error(t, err)
+}
+
+func TestWordAt(t *testing.T) {
+	assert.Equal(t, "world", wordAt("hello world!", 8))
+	assert.Equal(t, "hello", wordAt("hello world!", 5))
+	assert.Equal(t, "don't", wordAt("I don't", 7))
+	assert.Equal(t, "", wordAt("a  b", 2))
+}
+
+func TestUpdate_SpellingSuggestions(t *testing.T) {
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.spellChecker = NewSpellChecker([]byte("hello\nworld\n"))
+	m.textarea.SetValue("hello wrold")
+
+	assert.Contains(t, m.statusView(), "wrold")
+
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlAt})
+	m = model.(Model)
+	assert.Contains(t, m.notice, "world")
+}
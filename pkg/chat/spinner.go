@@ -0,0 +1,57 @@
+package chat
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	// spinnerMinInterval is the tick interval of the spinner when a request starts
+	spinnerMinInterval = 100 * time.Millisecond
+	// spinnerMaxInterval is the tick interval the spinner slows down to, and ticks at while idle
+	spinnerMaxInterval = 2 * time.Second
+	// spinnerSlowdownPeriod is the time after which the tick interval doubles
+	spinnerSlowdownPeriod = 5 * time.Second
+)
+
+// spinnerInterval returns the tick interval of the spinner after waiting for elapsed,
+// which doubles every spinnerSlowdownPeriod to spare the CPU during long requests
+func spinnerInterval(elapsed time.Duration) time.Duration {
+	interval := spinnerMinInterval
+	for i := elapsed / spinnerSlowdownPeriod; i > 0 && interval < spinnerMaxInterval; i-- {
+		interval *= 2
+	}
+	return min(interval, spinnerMaxInterval)
+}
+
+// startWaiting shows the spinner for a new request, ticking at its fastest again
+func (m *Model) startWaiting() tea.Cmd {
+	m.waiting = true
+	m.waitStart = time.Now()
+	m.spinner.Spinner.FPS = spinnerMinInterval
+	// the pending tick of the idle spinner is dropped for this one
+	return m.spinner.Tick
+}
+
+// tickSpinner advances the spinner and schedules its next tick after the interval
+// for the time the request has been waiting
+func (m *Model) tickSpinner(msg spinner.TickMsg) tea.Cmd {
+	m.spinner.Spinner.FPS = spinnerMaxInterval
+	if m.waiting {
+		m.spinner.Spinner.FPS = spinnerInterval(time.Since(m.waitStart))
+	}
+	var cmd tea.Cmd
+	m.spinner, cmd = m.spinner.Update(msg)
+	return cmd
+}
+
+// spinnerView renders the spinner with the time the request has been waiting, e.g. ⠋ sending... (12s)
+func (m Model) spinnerView() string {
+	if m.waitStart.IsZero() {
+		return m.spinner.View() + " sending..."
+	}
+	return fmt.Sprintf("%s sending... (%ds)", m.spinner.View(), int(time.Since(m.waitStart).Seconds()))
+}
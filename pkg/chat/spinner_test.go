@@ -0,0 +1,48 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpinnerInterval(t *testing.T) {
+	for elapsed, interval := range map[time.Duration]time.Duration{
+		0:                       100 * time.Millisecond,
+		4999 * time.Millisecond: 100 * time.Millisecond,
+		5 * time.Second:         200 * time.Millisecond,
+		10 * time.Second:        400 * time.Millisecond,
+		15 * time.Second:        800 * time.Millisecond,
+		20 * time.Second:        1600 * time.Millisecond,
+		25 * time.Second:        2 * time.Second,
+		time.Hour:               2 * time.Second,
+	} {
+		assert.Equal(t, interval, spinnerInterval(elapsed), elapsed)
+	}
+}
+
+func TestTickSpinner_Adaptive(t *testing.T) {
+	m := newTestModel(t)
+	m.spinner = spinner.New()
+
+	// the idle spinner ticks at the slowest rate
+	m.tickSpinner(spinner.TickMsg{})
+	assert.Equal(t, spinnerMaxInterval, m.spinner.Spinner.FPS)
+
+	assert.NotNil(t, m.startWaiting())
+	assert.True(t, m.waiting)
+	assert.Equal(t, spinnerMinInterval, m.spinner.Spinner.FPS)
+	assert.Regexp(t, `sending\.\.\. \(0s\)$`, m.spinnerView())
+
+	m.waitStart = time.Now().Add(-12 * time.Second)
+	m.tickSpinner(spinner.TickMsg{})
+	assert.Equal(t, 400*time.Millisecond, m.spinner.Spinner.FPS)
+	assert.Regexp(t, `sending\.\.\. \(12s\)$`, m.spinnerView())
+
+	// a new request starts from the fastest rate again
+	m.startWaiting()
+	m.tickSpinner(spinner.TickMsg{})
+	assert.Equal(t, spinnerMinInterval, m.spinner.Spinner.FPS)
+}
@@ -0,0 +1,39 @@
+package chat
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+var (
+	// timeNow returns the current time, replaced in tests
+	timeNow = time.Now
+	// startupOutput receives the time to interactive printed with --benchmark-startup
+	startupOutput io.Writer = os.Stderr
+)
+
+// markReady records the time to interactive when the first window size is received.
+// With --benchmark-startup, the returned tea.Cmd prints it and quits.
+func (m *Model) markReady() tea.Cmd {
+	if m.tti > 0 || m.startTime.IsZero() {
+		return nil
+	}
+	m.tti = max(timeNow().Sub(m.startTime), time.Nanosecond)
+	logger.Info("TUI ready", "tti_ms", m.tti.Milliseconds())
+	if !m.benchmarkStartup {
+		return nil
+	}
+	return tea.Sequence(tea.ExitAltScreen, startupReportCmd(m.tti))
+}
+
+// startupReportCmd returns a tea.Cmd which prints the time to interactive and quits
+func startupReportCmd(tti time.Duration) tea.Cmd {
+	return func() tea.Msg {
+		fmt.Fprintf(startupOutput, "time to interactive: %d ms\n", tti.Milliseconds())
+		return tea.Quit()
+	}
+}
@@ -0,0 +1,51 @@
+package chat
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdate_TimeToInteractive(t *testing.T) {
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	start := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	now := start
+	timeNow = func() time.Time { return now }
+
+	m := newTestModel(t)
+	m.textarea = newTextArea()
+	m.startTime = timeNow()
+
+	now = start.Add(250 * time.Millisecond)
+	model, _ := m.Update(tea.WindowSizeMsg{Width: 80, Height: 40})
+	m = model.(Model)
+	assert.Equal(t, 250*time.Millisecond, m.tti)
+
+	// only the first window size counts
+	now = start.Add(time.Second)
+	model, _ = m.Update(tea.WindowSizeMsg{Width: 100, Height: 40})
+	m = model.(Model)
+	assert.Equal(t, 250*time.Millisecond, m.tti)
+}
+
+func TestMarkReady_BenchmarkStartup(t *testing.T) {
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	defer func(w io.Writer) { startupOutput = w }(startupOutput)
+	start := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return start.Add(1500 * time.Millisecond) }
+	var out bytes.Buffer
+	startupOutput = &out
+
+	m := Model{startTime: start}
+	assert.Nil(t, m.markReady())
+	assert.Equal(t, 1500*time.Millisecond, m.tti)
+
+	m = Model{startTime: start, benchmarkStartup: true}
+	assert.NotNil(t, m.markReady())
+	assert.Equal(t, tea.Quit(), startupReportCmd(m.tti)())
+	assert.Equal(t, "time to interactive: 1500 ms\n", out.String())
+}
@@ -0,0 +1,37 @@
+package chat
+
+import "sync"
+
+// storageBackend serializes the access to session files, so that a session saved from
+// several goroutines at once is not corrupted and is not read while it is written
+type storageBackend struct {
+	mu sync.RWMutex
+}
+
+// sessionStorage is the storage of the sessions of the TUI
+var sessionStorage = &storageBackend{}
+
+// save writes the session to the file. If loader is set, the first pending messages
+// of the file which are not loaded are kept, and the loader is updated to the saved file.
+func (s *storageBackend) save(filePath string, session *Session, loader *historyLoader, pending int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if loader != nil {
+		return loader.save(filePath, session, pending)
+	}
+	return SaveSession(filePath, session)
+}
+
+// open reads the session file with the last pageSize messages
+func (s *storageBackend) open(filePath string, pageSize int) (*Session, *historyLoader, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return openHistory(filePath, pageSize)
+}
+
+// messages reads the messages in the range [from, to) of the loader
+func (s *storageBackend) messages(loader *historyLoader, from, to int) ([]Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return loader.messages(from, to)
+}
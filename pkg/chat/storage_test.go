@@ -0,0 +1,52 @@
+package chat
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveHistory_Concurrent(t *testing.T) {
+	configHome := t.TempDir()
+	defer func(f func() (string, error)) { userConfigDir = f }(userConfigDir)
+	setTestHome(t)
+	userConfigDir = func() (string, error) { return configHome, nil }
+
+	dir, err := HistoryDir()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	filePath := path.Join(dir, "fixture.json")
+	writeSessionFixture(t, filePath, 120)
+
+	m := newTestModel(t)
+	require.NoError(t, m.loadHistory(filePath))
+	require.Equal(t, 70, m.historyOffset)
+
+	// run with -race to detect unsynchronized access to the session file and the loader
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, m.saveHistory())
+		}()
+		go func() {
+			defer wg.Done()
+			_, _, err := sessionStorage.open(filePath, historyPageSize)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	saved, err := LoadSession(filePath)
+	require.NoError(t, err)
+	require.Len(t, saved.Messages, 120)
+	for i, msg := range saved.Messages {
+		assert.Equal(t, fmt.Sprintf("message %d", i), msg.Content)
+	}
+}
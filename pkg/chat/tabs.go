@@ -0,0 +1,290 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-runewidth"
+)
+
+var (
+	// tabStyle and activeTabStyle are the styles of the titles in the tab bar
+	tabStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("241")).Padding(0, 1)
+	activeTabStyle = lipgloss.NewStyle().Background(lipgloss.Color("63")).Foreground(lipgloss.Color("#FAFAFA")).Padding(0, 1)
+	// maxTabTitleWidth is the width at which the titles in the tab bar are truncated
+	maxTabTitleWidth = 20
+)
+
+// TabState is the conversation of a tab. The conversation of the active tab
+// is held by the Model and stored back into its TabState when switching tabs.
+type TabState struct {
+	client             *Client
+	cache              *messageCache
+	viewport           viewport.Model
+	input              string
+	streamDeltas       string
+	lastRenderedOffset int
+	streamRendered     string
+	streamPrefix       string
+	streamBuffer       []CompletionStreamResponse
+	flushScheduled     bool
+	sessionId          string
+	createdAt          time.Time
+	pinned             bool
+	title              string
+	tags               []string
+	notes              map[int]string
+	ratings            map[int]int
+	markedRoles        map[string]string
+	historyLoader      *historyLoader
+	historyOffset      int
+	waiting            bool
+	lastTruncated      bool
+	lastParsedResponse []Segment
+	emptyRetries       int
+	prevResponse       string
+	showDiff           bool
+	pendingMessages    []string
+	bulkTotal          int
+	attachments        []string
+	rateLimit          *RateLimitInfo
+	pendingCacheKey    string
+	cached             bool
+	err                error
+}
+
+// tabMsg wraps a message of the conversation of the tab at index
+type tabMsg struct {
+	index int
+	msg   tea.Msg
+}
+
+// tabCmd returns a tea.Cmd which wraps the messages of the conversation returned by cmd
+// for the tab at index, so that they reach the tab while another one is active
+func tabCmd(index int, cmd tea.Cmd) tea.Cmd {
+	if cmd == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		switch msg := cmd().(type) {
+		case tea.BatchMsg:
+			batch := make(tea.BatchMsg, len(msg))
+			for i, cmd := range msg {
+				batch[i] = tabCmd(index, cmd)
+			}
+			return batch
+		default:
+			if conversationMsg(msg) {
+				return tabMsg{index: index, msg: msg}
+			}
+			return msg
+		}
+	}
+}
+
+// conversationMsg reports whether the message belongs to the conversation of a tab
+func conversationMsg(msg tea.Msg) bool {
+	switch msg.(type) {
+	case CompletionResponse, *CompletionResponse, CompletionStreamResponse, fallbackMsg, cachedMsg,
+		compactMsg, flushStreamMsg, RateLimitInfo, rateLimitResetMsg, evalResultMsg, imagesMsg, pluginResultMsg, error:
+		return true
+	}
+	return false
+}
+
+// updateTabs routes the message to the tab it belongs to. The messages of the
+// conversations of inactive tabs are handled with their tab switched in.
+func (m Model) updateTabs(msg tea.Msg) (tea.Model, tea.Cmd) {
+	index := m.activeTab
+	if t, ok := msg.(tabMsg); ok {
+		index, msg = t.index, t.msg
+	} else if conversationMsg(msg) {
+		// the commands started before the first tab was opened are not wrapped
+		index = 0
+	}
+	if index == m.activeTab {
+		model, cmd := m.update(msg)
+		return model, tabCmd(index, cmd)
+	}
+
+	active := m.activeTab
+	m.switchTab(index)
+	model, cmd := m.update(msg)
+	m = model.(Model)
+	m.switchTab(active)
+	m.updateWindowTitle()
+	return m, tabCmd(index, cmd)
+}
+
+// saveTab returns the conversation held by the model
+func (m Model) saveTab() TabState {
+	return TabState{
+		client:             m.client,
+		cache:              m.cache,
+		viewport:           m.viewport,
+		streamDeltas:       m.streamDeltas,
+		lastRenderedOffset: m.lastRenderedOffset,
+		streamRendered:     m.streamRendered,
+		streamPrefix:       m.streamPrefix,
+		streamBuffer:       m.streamBuffer,
+		flushScheduled:     m.flushScheduled,
+		sessionId:          m.sessionId,
+		createdAt:          m.createdAt,
+		pinned:             m.pinned,
+		title:              m.title,
+		tags:               m.tags,
+		notes:              m.notes,
+		ratings:            m.ratings,
+		markedRoles:        m.markedRoles,
+		historyLoader:      m.historyLoader,
+		historyOffset:      m.historyOffset,
+		waiting:            m.waiting,
+		lastTruncated:      m.lastTruncated,
+		lastParsedResponse: m.lastParsedResponse,
+		emptyRetries:       m.emptyRetries,
+		prevResponse:       m.prevResponse,
+		showDiff:           m.showDiff,
+		pendingMessages:    m.pendingMessages,
+		bulkTotal:          m.bulkTotal,
+		attachments:        m.attachments,
+		rateLimit:          m.rateLimit,
+		pendingCacheKey:    m.pendingCacheKey,
+		cached:             m.cached,
+		err:                m.err,
+	}
+}
+
+// switchTab stores the conversation of the active tab and loads the one of the tab at index.
+// The viewport keeps its size, which is only kept up to date for the active tab.
+func (m *Model) switchTab(index int) {
+	m.tabs[m.activeTab] = m.saveTab()
+	t := m.tabs[index]
+	width, height := m.viewport.Width, m.viewport.Height
+	m.client = t.client
+	m.cache = t.cache
+	m.viewport = t.viewport
+	m.viewport.Width, m.viewport.Height = width, height
+	m.streamDeltas = t.streamDeltas
+	m.lastRenderedOffset = t.lastRenderedOffset
+	m.streamRendered = t.streamRendered
+	m.streamPrefix = t.streamPrefix
+	m.streamBuffer = t.streamBuffer
+	m.flushScheduled = t.flushScheduled
+	m.sessionId = t.sessionId
+	m.createdAt = t.createdAt
+	m.pinned = t.pinned
+	m.title = t.title
+	m.tags = t.tags
+	m.notes = t.notes
+	m.ratings = t.ratings
+	m.markedRoles = t.markedRoles
+	m.historyLoader = t.historyLoader
+	m.historyOffset = t.historyOffset
+	m.waiting = t.waiting
+	m.lastTruncated = t.lastTruncated
+	m.lastParsedResponse = t.lastParsedResponse
+	m.emptyRetries = t.emptyRetries
+	m.prevResponse = t.prevResponse
+	m.showDiff = t.showDiff
+	m.pendingMessages = t.pendingMessages
+	m.bulkTotal = t.bulkTotal
+	m.attachments = t.attachments
+	m.rateLimit = t.rateLimit
+	m.pendingCacheKey = t.pendingCacheKey
+	m.cached = t.cached
+	m.err = t.err
+	m.activeTab = index
+}
+
+// selectTab makes the tab at index the active one, keeping the unsent input of each tab
+func (m *Model) selectTab(index int) {
+	if index == m.activeTab || index < 0 || index >= len(m.tabs) {
+		return
+	}
+	previous, input := m.activeTab, m.textarea.Value()
+	m.switchTab(index)
+	m.tabs[previous].input = input
+	m.textarea.SetValue(m.tabs[index].input)
+	// the tab may have been rendered at another width
+	if !m.waiting && len(m.client.history) > 0 {
+		content, _ := m.renderMessages(m.client.history)
+		m.viewport.SetContent(content)
+		m.viewport.GotoBottom()
+	}
+}
+
+// cycleTab activates the next tab, or the previous one if delta is negative
+func (m *Model) cycleTab(delta int) {
+	if len(m.tabs) > 0 {
+		m.selectTab((m.activeTab + delta + len(m.tabs)) % len(m.tabs))
+	}
+}
+
+// newTab opens a conversation with a new client configured by the chat flags in a new tab
+func (m *Model) newTab() tea.Cmd {
+	client, err := newClientFromConfig()
+	if err != nil {
+		m.setNotice(errorStyle.Render(fmt.Sprintf("error: %v", err)))
+		return nil
+	}
+	if len(m.tabs) == 0 {
+		// the tab bar takes a line of the conversation
+		m.tabs = []TabState{m.saveTab()}
+		m.viewport.Height--
+	}
+	now := timeNow()
+	sessionId := now.Format(sessionTimeLayout)
+	for _, t := range m.tabs {
+		if t.sessionId == sessionId || strings.HasPrefix(t.sessionId, sessionId+"-") {
+			sessionId = fmt.Sprintf("%s-%d", now.Format(sessionTimeLayout), len(m.tabs)+1)
+			break
+		}
+	}
+	vp := viewport.New(m.viewport.Width, m.viewport.Height)
+	vp.SetContent(m.welcome)
+	m.tabs = append(m.tabs, TabState{
+		client:    client,
+		cache:     &messageCache{images: m.images},
+		viewport:  vp,
+		sessionId: sessionId,
+		createdAt: now,
+	})
+	index := len(m.tabs) - 1
+	m.selectTab(index)
+	return tabCmd(index, waitRateLimitCmd(client))
+}
+
+// tabTitle returns the title of the session of the tab, or its ID if it has no title
+func (t TabState) tabTitle() string {
+	if len(t.title) > 0 {
+		return t.title
+	}
+	return t.sessionId
+}
+
+// tabBarView renders the numbered titles of the tabs, the active one highlighted.
+// The titles are truncated to share the width of the conversation.
+func (m Model) tabBarView() string {
+	var titles []string
+	for i, t := range m.tabs {
+		if i == m.activeTab {
+			t = m.saveTab()
+		}
+		number := fmt.Sprintf("%d ", i+1)
+		width := (m.viewport.Width-len(m.tabs)+1)/len(m.tabs) - tabStyle.GetHorizontalFrameSize() - len(number)
+		title := number + runewidth.Truncate(t.tabTitle(), min(width, maxTabTitleWidth), "…")
+		if t.waiting {
+			title += " " + m.spinner.View()
+		}
+		if i == m.activeTab {
+			titles = append(titles, activeTabStyle.Render(title))
+		} else {
+			titles = append(titles, tabStyle.Render(title))
+		}
+	}
+	return lipgloss.NewStyle().MaxWidth(m.viewport.Width).Render(strings.Join(titles, " "))
+}
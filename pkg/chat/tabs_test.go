@@ -0,0 +1,140 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdate_Tabs(t *testing.T) {
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	timeNow = func() time.Time { return time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC) }
+
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.sessionId = "first"
+	m.title = "Go generics"
+	m.client.history = []Message{{Role: "user", Content: "Hello"}}
+	m.textarea.SetValue("unsent")
+
+	for i := 0; i < 4; i++ {
+		model, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("t"), Alt: true})
+		m = model.(Model)
+	}
+	require.Len(t, m.tabs, 5)
+	assert.Equal(t, 4, m.activeTab)
+	assert.Empty(t, m.client.history)
+	assert.Empty(t, m.textarea.Value())
+	// the tab bar takes a line of the conversation
+	assert.Equal(t, 19, m.viewport.Height)
+
+	// tabs opened in the same second get distinct sessions
+	ids := map[string]bool{}
+	for i := range m.tabs {
+		if i == m.activeTab {
+			ids[m.sessionId] = true
+		} else {
+			ids[m.tabs[i].sessionId] = true
+		}
+	}
+	assert.Len(t, ids, 5)
+
+	bar := ansiPattern.ReplaceAllString(m.tabBarView(), "")
+	assert.Contains(t, bar, "1 Go generics")
+	// the titles share the width of the conversation
+	assert.Contains(t, bar, "5 2023-05-01…")
+	assert.LessOrEqual(t, lipgloss.Width(bar), m.viewport.Width)
+	assert.Contains(t, ansiPattern.ReplaceAllString(m.View(), ""), "1 Go generics")
+
+	// the next tab wraps around to the first one, which keeps its history and input
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("n"), Alt: true})
+	m = model.(Model)
+	assert.Equal(t, 0, m.activeTab)
+	assert.Equal(t, "first", m.sessionId)
+	assert.Equal(t, []Message{{Role: "user", Content: "Hello"}}, m.client.history)
+	assert.Equal(t, "unsent", m.textarea.Value())
+
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("N"), Alt: true})
+	m = model.(Model)
+	assert.Equal(t, 4, m.activeTab)
+	assert.Empty(t, m.client.history)
+}
+
+func TestUpdate_TabStreamsInBackground(t *testing.T) {
+	setTestHome(t)
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.waiting = true
+	first := m.client
+
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("t"), Alt: true})
+	m = model.(Model)
+	require.Equal(t, 1, m.activeTab)
+
+	// the deltas of the first tab arrive while the second one is active
+	for _, delta := range []string{"Hel", "lo"} {
+		model, _ = m.Update(tabMsg{index: 0, msg: CompletionStreamResponse{Choices: []CompletionStreamChoice{{Delta: CompletionStreamDelta{Content: delta}}}}})
+		m = model.(Model)
+	}
+	model, _ = m.Update(tabMsg{index: 0, msg: CompletionStreamResponse{Choices: []CompletionStreamChoice{{FinishReason: "stop"}}}})
+	m = model.(Model)
+	model, _ = m.Update(tabMsg{index: 0, msg: flushStreamMsg{}})
+	m = model.(Model)
+
+	assert.Equal(t, 1, m.activeTab)
+	assert.Empty(t, m.client.history)
+	assert.False(t, m.tabs[0].waiting)
+	assert.Equal(t, []Message{{Role: "assistant", Content: "Hello"}}, first.history)
+}
+
+func TestUpdate_TabStreamStartedBeforeFirstTab(t *testing.T) {
+	setTestHome(t)
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.waiting = true
+	first := m.client
+	delta := func(content, finishReason string) CompletionStreamResponse {
+		return CompletionStreamResponse{Choices: []CompletionStreamChoice{{Delta: CompletionStreamDelta{Content: content}, FinishReason: finishReason}}}
+	}
+
+	// the first delta arrives before the tabs are opened, its command waits for the next one
+	model, cmd := m.Update(delta("Hel", ""))
+	m = model.(Model)
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("t"), Alt: true})
+	m = model.(Model)
+	require.Equal(t, 1, m.activeTab)
+
+	for _, event := range []CompletionStreamResponse{delta("lo", ""), delta("", "stop")} {
+		go func(event CompletionStreamResponse) { first.events <- event }(event)
+		for _, msg := range batchMessages(cmd) {
+			model, cmd = m.Update(msg)
+			m = model.(Model)
+		}
+	}
+
+	assert.Equal(t, 1, m.activeTab)
+	assert.False(t, m.waiting)
+	assert.Empty(t, m.streamDeltas)
+	assert.Empty(t, m.client.history)
+	assert.False(t, m.tabs[0].waiting)
+	assert.Equal(t, []Message{{Role: "assistant", Content: "Hello"}}, first.history)
+}
+
+func TestTabCmd(t *testing.T) {
+	resp := CompletionStreamResponse{Choices: []CompletionStreamChoice{{Delta: CompletionStreamDelta{Content: "Hi"}}}}
+	msg := tabCmd(2, func() tea.Msg { return resp })()
+	assert.Equal(t, tabMsg{index: 2, msg: resp}, msg)
+	assert.Equal(t, tabMsg{index: 2, msg: evalResultMsg{output: "4"}}, tabCmd(2, func() tea.Msg { return evalResultMsg{output: "4"} })())
+
+	// other messages are not part of the conversation
+	assert.Equal(t, tea.KeyMsg{Type: tea.KeyEnter}, tabCmd(2, func() tea.Msg { return tea.KeyMsg{Type: tea.KeyEnter} })())
+	assert.Nil(t, tabCmd(2, nil))
+}
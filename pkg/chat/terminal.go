@@ -0,0 +1,174 @@
+package chat
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/muesli/termenv"
+	"golang.org/x/term"
+)
+
+// terminalOutput receives the escape sequences controlling the terminal, replaced in tests
+var terminalOutput io.Writer = os.Stdout
+
+// bellThreshold is the time without a key press after which the user is assumed
+// not to watch the terminal, so the bell announces completed responses
+const bellThreshold = 5 * time.Second
+
+// windowTitleSupported reports whether the terminal supports setting the window title with OSC 2
+func windowTitleSupported(getenv func(string) string) bool {
+	switch getenv("TERM_PROGRAM") {
+	case "iTerm.app", "Apple_Terminal", "WezTerm", "vscode", "Hyper", "ghostty", "tmux":
+		return true
+	}
+	term := strings.ToLower(getenv("TERM"))
+	for _, prefix := range []string{"xterm", "screen", "tmux", "rxvt", "alacritty", "kitty", "foot", "wezterm", "konsole", "gnome", "vte", "st-"} {
+		if strings.HasPrefix(term, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeTitle removes the control characters which would end the escape sequence early
+func sanitizeTitle(title string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, title)
+}
+
+// setWindowTitle sets the title of the terminal window
+func setWindowTitle(title string) {
+	fmt.Fprintf(terminalOutput, "\x1b]2;%s\x07", sanitizeTitle(title))
+}
+
+// setIconName sets the icon name of the terminal window, shown in the tab by some terminals
+func setIconName(name string) {
+	fmt.Fprintf(terminalOutput, "\x1b]1;%s\x07", sanitizeTitle(name))
+}
+
+// clearWindowTitle restores the default title of the terminal window
+func clearWindowTitle() {
+	fmt.Fprint(terminalOutput, "\x1b]2;\x07")
+}
+
+// updateWindowTitle sets the window title to the session title and the icon name to the model
+// when they have changed since they were last set
+func (m *Model) updateWindowTitle() {
+	if !m.windowTitle {
+		return
+	}
+	if len(m.title) > 0 && m.title != m.shownTitle {
+		setWindowTitle(m.title)
+		m.shownTitle = m.title
+	}
+	if m.client.model != m.shownIconName {
+		setIconName(m.client.model)
+		m.shownIconName = m.client.model
+	}
+}
+
+// shouldBell reports whether no key has been pressed for longer than the threshold
+func shouldBell(lastKeypress time.Time, threshold time.Duration) bool {
+	return timeNow().Sub(lastKeypress) > threshold
+}
+
+// ringBell rings the terminal bell, which some terminals turn into a notification
+func ringBell() {
+	fmt.Fprint(terminalOutput, "\a")
+}
+
+// notifyCompletion rings the bell for a completed response if enabled and the user seems away
+func (m Model) notifyCompletion() {
+	if m.bell && shouldBell(m.lastKeypress, bellThreshold) {
+		ringBell()
+	}
+}
+
+// backgroundQueryTimeout is how long the terminal has to answer the background color query
+const backgroundQueryTimeout = 200 * time.Millisecond
+
+// queryTerminalBackground asks the terminal for its background color with OSC 11
+// and reads the answer from the terminal in raw mode
+func queryTerminalBackground() (r, g, b uint16, err error) {
+	tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer tty.Close()
+	// terminals which do not support the query never answer
+	if err := tty.SetReadDeadline(time.Now().Add(backgroundQueryTimeout)); err != nil {
+		return 0, 0, 0, err
+	}
+	state, err := term.MakeRaw(int(tty.Fd()))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer term.Restore(int(tty.Fd()), state)
+
+	if _, err := io.WriteString(tty, "\x1b]11;?\x07"); err != nil {
+		return 0, 0, 0, err
+	}
+	// the answer ends with BEL or ST
+	var response []byte
+	buf := make([]byte, 64)
+	for !bytes.HasSuffix(response, []byte("\x07")) && !bytes.HasSuffix(response, []byte("\x1b\\")) {
+		n, err := tty.Read(buf)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		response = append(response, buf[:n]...)
+	}
+	return parseOSCColor(string(response))
+}
+
+// parseOSCColor parses the color of an OSC 11 answer like \x1b]11;rgb:RRRR/GGGG/BBBB\x07.
+// The components have one to four hex digits and are scaled to 16 bits.
+func parseOSCColor(response string) (r, g, b uint16, err error) {
+	_, color, ok := strings.Cut(response, "rgb:")
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("unexpected background color answer %q", response)
+	}
+	color = strings.TrimRight(color, "\x07\x1b\\")
+	parts := strings.Split(color, "/")
+	if len(parts) != 3 {
+		return 0, 0, 0, fmt.Errorf("unexpected background color answer %q", response)
+	}
+	var rgb [3]uint16
+	for i, part := range parts {
+		if len(part) == 0 || len(part) > 4 {
+			return 0, 0, 0, fmt.Errorf("unexpected background color answer %q", response)
+		}
+		v, err := strconv.ParseUint(part, 16, 16)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("unexpected background color answer %q: %w", response, err)
+		}
+		rgb[i] = uint16(v * 0xffff / (1<<(4*len(part)) - 1))
+	}
+	return rgb[0], rgb[1], rgb[2], nil
+}
+
+// luminance returns the relative luminance of the color between 0 for black and 1 for white
+func luminance(r, g, b uint16) float64 {
+	return (0.2126*float64(r) + 0.7152*float64(g) + 0.0722*float64(b)) / 0xffff
+}
+
+// hasDarkBackground reports whether the background of the terminal is dark. The terminal is
+// asked once; if it does not answer, $COLORFGBG is checked by termenv instead.
+var hasDarkBackground = sync.OnceValue(func() bool {
+	r, g, b, err := queryTerminalBackground()
+	if err != nil {
+		logger.Debug("failed to query the terminal background", "error", err)
+		return termenv.HasDarkBackground()
+	}
+	return luminance(r, g, b) < 0.5
+})
@@ -0,0 +1,131 @@
+package chat
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowTitleSupported(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(key string) string { return vars[key] }
+	}
+	assert.True(t, windowTitleSupported(env(map[string]string{"TERM": "xterm-256color"})))
+	assert.True(t, windowTitleSupported(env(map[string]string{"TERM": "screen"})))
+	assert.True(t, windowTitleSupported(env(map[string]string{"TERM_PROGRAM": "iTerm.app", "TERM": "unknown"})))
+	assert.False(t, windowTitleSupported(env(map[string]string{"TERM": "linux"})))
+	assert.False(t, windowTitleSupported(env(map[string]string{"TERM": "dumb"})))
+	assert.False(t, windowTitleSupported(env(nil)))
+}
+
+func TestWindowTitle(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(w io.Writer) { terminalOutput = w }(terminalOutput)
+	terminalOutput = &buf
+
+	setWindowTitle("Go\x07 generics")
+	setIconName("gpt-4")
+	clearWindowTitle()
+	assert.Equal(t, "\x1b]2;Go generics\x07\x1b]1;gpt-4\x07\x1b]2;\x07", buf.String())
+}
+
+func TestUpdate_WindowTitle(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(w io.Writer) { terminalOutput = w }(terminalOutput)
+	terminalOutput = &buf
+	setTestHome(t)
+
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.windowTitle = true
+
+	m.textarea.SetValue("/title Go generics")
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = model.(Model)
+	assert.Equal(t, "\x1b]2;Go generics\x07\x1b]1;gpt-3.5-turbo\x07", buf.String())
+
+	// the sequences are only written again when the title changes
+	buf.Reset()
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	m = model.(Model)
+	assert.Empty(t, buf.String())
+
+	m.Update(tea.KeyMsg{Type: tea.KeyCtrlC})
+	assert.Equal(t, "\x1b]2;\x07", buf.String())
+}
+
+func TestShouldBell(t *testing.T) {
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	now := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+
+	assert.False(t, shouldBell(now, bellThreshold))
+	assert.False(t, shouldBell(now.Add(-5*time.Second), bellThreshold))
+	assert.True(t, shouldBell(now.Add(-6*time.Second), bellThreshold))
+	assert.True(t, shouldBell(time.Time{}, bellThreshold), "no key pressed yet")
+}
+
+func TestUpdate_BellOnCompletion(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(w io.Writer) { terminalOutput = w }(terminalOutput)
+	terminalOutput = &buf
+	defer func(f func() time.Time) { timeNow = f }(timeNow)
+	now := time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	setTestHome(t)
+
+	m := newTestModel(t)
+	m.bell = true
+	m.lastKeypress = now.Add(-time.Minute)
+	delta := func(content, finishReason string) CompletionStreamResponse {
+		return CompletionStreamResponse{Choices: []CompletionStreamChoice{{Delta: CompletionStreamDelta{Content: content}, FinishReason: finishReason}}}
+	}
+
+	// the bell does not ring while streaming
+	model, _ := m.Update(delta("Hello", ""))
+	m = model.(Model)
+	assert.Empty(t, buf.String())
+
+	model, _ = m.Update(delta("", "stop"))
+	m = model.(Model)
+	assert.Equal(t, "\a", buf.String())
+
+	// the user is watching after a recent key press
+	buf.Reset()
+	m.lastKeypress = now.Add(-time.Second)
+	m.Update(delta("", "stop"))
+	assert.Empty(t, buf.String())
+}
+
+func TestParseOSCColor(t *testing.T) {
+	r, g, b, err := parseOSCColor("\x1b]11;rgb:1e1e/2020/ffff\x07")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{0x1e1e, 0x2020, 0xffff}, []uint16{r, g, b})
+
+	// components with fewer digits are scaled, the answer may end with ST
+	r, g, b, err = parseOSCColor("\x1b]11;rgb:f/80/000\x1b\\")
+	assert.NoError(t, err)
+	assert.Equal(t, []uint16{0xffff, 0x8080, 0}, []uint16{r, g, b})
+
+	for _, response := range []string{"", "\x1b]11;rgb:ffff/ffff\x07", "\x1b]11;rgb:gg/00/00\x07", "\x1b]11;rgb:12345/0/0\x07"} {
+		_, _, _, err := parseOSCColor(response)
+		assert.Error(t, err, response)
+	}
+}
+
+func TestLuminance(t *testing.T) {
+	assert.InDelta(t, 0, luminance(0, 0, 0), 1e-9)
+	assert.InDelta(t, 1, luminance(0xffff, 0xffff, 0xffff), 1e-9)
+	// green weighs the most, blue the least
+	assert.Greater(t, luminance(0, 0xffff, 0), 0.5)
+	assert.Less(t, luminance(0, 0, 0xffff), 0.5)
+	// Solarized dark and light backgrounds
+	assert.Less(t, luminance(0x0000, 0x2b2b, 0x3636), 0.5)
+	assert.Greater(t, luminance(0xfdfd, 0xf6f6, 0xe3e3), 0.5)
+}
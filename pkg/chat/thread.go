@@ -0,0 +1,137 @@
+package chat
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// threadConnector joins a reply to the message it replies to
+const threadConnector = "┗ "
+
+// MessageNode is a message of the conversation with the replies to it
+type MessageNode struct {
+	Message Message
+	// Index is the position of the message in the conversation, -1 for the root
+	Index    int
+	Children []*MessageNode
+}
+
+// buildMessageTree returns the messages as a tree under a root without message. The ID of a
+// message is its position in the conversation from 1, the messages without ParentID or with
+// the ID of a message which does not precede them are children of the root.
+func buildMessageTree(messages []Message) *MessageNode {
+	return messageTree(messages, 0)
+}
+
+// messageTree builds the tree of the messages following offset older messages of the session
+func messageTree(messages []Message, offset int) *MessageNode {
+	root := &MessageNode{Index: -1}
+	nodes := map[string]*MessageNode{}
+	for i, message := range messages {
+		node := &MessageNode{Message: message, Index: i}
+		parent, ok := root, false
+		if message.ParentID != nil {
+			parent, ok = nodes[*message.ParentID]
+			if !ok {
+				parent = root
+			}
+		}
+		parent.Children = append(parent.Children, node)
+		nodes[messageID(offset+i)] = node
+	}
+	return root
+}
+
+// depths returns the depth of the messages below the root by index, 0 for the top-level ones
+func (n *MessageNode) depths() map[int]int {
+	depths := map[int]int{}
+	var walk func(node *MessageNode, depth int)
+	walk = func(node *MessageNode, depth int) {
+		for _, child := range node.Children {
+			depths[child.Index] = depth
+			walk(child, depth+1)
+		}
+	}
+	walk(n, 0)
+	return depths
+}
+
+// messageID returns the ID of the message at position i of the session
+func messageID(i int) string {
+	return strconv.Itoa(i + 1)
+}
+
+// indentReply indents the rendered message under its parent, depth levels deep
+func indentReply(rendered string, depth int) string {
+	if depth == 0 {
+		return rendered
+	}
+	indent := strings.Repeat("  ", depth)
+	lines := strings.Split(rendered, "\n")
+	for i, line := range lines {
+		if i == 0 {
+			lines[i] = strings.Repeat("  ", depth-1) + threadConnector + line
+		} else if len(line) > 0 {
+			lines[i] = indent + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Threaded returns whether a message of the session replies to an earlier one
+func (s Session) Threaded() bool {
+	for _, message := range s.Messages {
+		if message.ParentID != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// apiMessages returns the messages without their threading, which the API does not accept
+func apiMessages(messages []Message) []Message {
+	stripped := make([]Message, len(messages))
+	for i, message := range messages {
+		message.ParentID = nil
+		stripped[i] = message
+	}
+	return stripped
+}
+
+// MarshalJSON encodes the request with the messages stripped of their threading
+func (r CompletionRequest) MarshalJSON() ([]byte, error) {
+	type request CompletionRequest
+	req := request(r)
+	req.Messages = apiMessages(r.Messages)
+	return json.Marshal(req)
+}
+
+// replyTo sets the message the next message replies to from its ID
+func (m *Model) replyTo(id string) bool {
+	n, err := strconv.Atoi(id)
+	if err != nil || n < 1 || n > m.historyOffset+len(m.client.history) {
+		return false
+	}
+	m.replyParent = id
+	return true
+}
+
+// appendResponse appends the response to the history, threaded under the message
+// it answers if that one is a reply
+func (m *Model) appendResponse(message Message) {
+	if n := len(m.client.history); n > 0 && m.client.history[n-1].ParentID != nil {
+		id := messageID(m.historyOffset + n - 1)
+		message.ParentID = &id
+	}
+	m.client.history = append(m.client.history, message)
+	m.lastParsedResponse = ParseSegments(message.Content)
+}
+
+// parseLastResponse parses the last response again after the history changed
+func (m *Model) parseLastResponse() {
+	m.lastParsedResponse = nil
+	if i := m.nextAssistantMessage(len(m.client.history), -1); i >= 0 {
+		m.lastParsedResponse = ParseSegments(m.client.history[i].Content)
+	}
+}
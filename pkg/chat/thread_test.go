@@ -0,0 +1,107 @@
+package chat
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parentID(id string) *string {
+	return &id
+}
+
+func TestBuildMessageTree(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "1"},
+		{Role: "assistant", Content: "2"},
+		{Role: "user", Content: "3", ParentID: parentID("2")},
+		{Role: "assistant", Content: "4", ParentID: parentID("3")},
+		{Role: "user", Content: "5", ParentID: parentID("2")},
+		{Role: "user", Content: "6", ParentID: parentID("4")},
+		{Role: "user", Content: "7"},
+		// replies to unknown or later messages are top-level
+		{Role: "user", Content: "8", ParentID: parentID("9")},
+		{Role: "user", Content: "9", ParentID: parentID("x")},
+	}
+	root := buildMessageTree(messages)
+	assert.Equal(t, -1, root.Index)
+
+	var contents func(nodes []*MessageNode) []string
+	contents = func(nodes []*MessageNode) []string {
+		var c []string
+		for _, node := range nodes {
+			c = append(c, node.Message.Content)
+		}
+		return c
+	}
+	assert.Equal(t, []string{"1", "2", "7", "8", "9"}, contents(root.Children))
+	second := root.Children[1]
+	assert.Equal(t, []string{"3", "5"}, contents(second.Children))
+	assert.Equal(t, []string{"4"}, contents(second.Children[0].Children))
+	assert.Equal(t, []string{"6"}, contents(second.Children[0].Children[0].Children))
+	assert.Equal(t, 5, second.Children[0].Children[0].Children[0].Index)
+
+	assert.Equal(t, map[int]int{0: 0, 1: 0, 2: 1, 3: 2, 4: 1, 5: 3, 6: 0, 7: 0, 8: 0}, root.depths())
+
+	// the IDs of the messages follow the older messages which are not loaded
+	root = messageTree([]Message{{Content: "11"}, {Content: "12", ParentID: parentID("11")}}, 10)
+	assert.Equal(t, map[int]int{0: 0, 1: 1}, root.depths())
+
+	assert.Empty(t, buildMessageTree(nil).Children)
+}
+
+func TestIndentReply(t *testing.T) {
+	assert.Equal(t, "You\nhello\n", indentReply("You\nhello\n", 0))
+	assert.Equal(t, "┗ You\n  hello\n", indentReply("You\nhello\n", 1))
+	assert.Equal(t, "  ┗ You\n    hello\n\n    bye", indentReply("You\nhello\n\nbye", 2))
+}
+
+func TestCompletionRequest_MarshalJSON(t *testing.T) {
+	messages := []Message{{Role: "user", Content: "hi"}, {Role: "user", Content: "more", ParentID: parentID("1")}}
+	data, err := json.Marshal(&CompletionRequest{Model: "gpt-4", Messages: messages})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"model":"gpt-4","messages":[{"role":"user","content":"hi"},{"role":"user","content":"more"}]}`, string(data))
+	// the threading is kept in the history
+	assert.Equal(t, "1", *messages[1].ParentID)
+
+	assert.True(t, Session{Messages: messages}.Threaded())
+	assert.False(t, Session{Messages: messages[:1]}.Threaded())
+}
+
+func TestHandleCommand_ReplyTo(t *testing.T) {
+	setTestHome(t)
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.client.stream = false
+	m.client.history = []Message{{Role: "user", Content: "first question"}, {Role: "assistant", Content: "first answer"}}
+
+	for _, input := range []string{"/reply-to", "/reply-to 0", "/reply-to 3", "/reply-to x"} {
+		m.handleCommand(input)
+		assert.Empty(t, m.replyParent, input)
+		assert.Contains(t, m.notice, "usage: /reply-to <1-2>", input)
+	}
+	m.handleCommand("/reply-to 2")
+	assert.Equal(t, "2", m.replyParent)
+
+	m.send("follow-up")
+	assert.Empty(t, m.replyParent)
+	require.Len(t, m.client.history, 3)
+	assert.Equal(t, "2", *m.client.history[2].ParentID)
+
+	// the response is threaded under the reply
+	model, _ := m.Update(CompletionResponse{Choices: []CompletionChoice{{Message: Message{Role: "assistant", Content: "second answer"}, FinishReason: "stop"}}})
+	m = model.(Model)
+	require.Len(t, m.client.history, 4)
+	assert.Equal(t, "3", *m.client.history[3].ParentID)
+
+	content, err := m.renderMessages(m.client.history)
+	require.NoError(t, err)
+	lines := strings.Split(ansiPattern.ReplaceAllString(content, ""), "\n")
+	assert.Contains(t, lines, "┗ "+senderStyle.Render(userName))
+	assert.Contains(t, lines, "  ┗ "+chatStyle.Render(chatGPTName))
+}
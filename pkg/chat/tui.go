@@ -1,21 +1,24 @@
 package chat
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/list"
 	"github.com/charmbracelet/bubbles/spinner"
 	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/charmbracelet/bubbles/viewport"
 	"github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/glamour/ansi"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/muesli/termenv"
 	"github.com/spf13/viper"
-	"log"
 	"os"
 	"path"
+	"path/filepath"
 	"strings"
 	"time"
 )
@@ -28,16 +31,63 @@ var (
 	spinnerStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("63")).MarginTop(4)
 	helpStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
 	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	warnStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
+	okStyle       = lipgloss.NewStyle().Foreground(lipgloss.Color("42"))
+	systemStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("245")).Italic(true).Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("238")).Padding(0, 1)
+
+	// langMismatchStyle borders responses which are not in the expected language
+	langMismatchStyle = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("214"))
+	// misspelledStyle underlines the misspelled words of the input
+	misspelledStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Underline(true)
 )
 
 var (
 	textAreaHeight = 4
 	chatGPTName    = "ChatGPT"
 	userName       = "You"
+	systemName     = "System"
+	truncatedHint  = "… [response truncated: increase --max-tokens]"
+	// scrollUpKeys load older messages when the viewport is at the top
+	scrollUpKeys = key.NewBinding(key.WithKeys("up", "pgup"))
+	// minWordWrapWidth is the narrowest width Markdown is wrapped at
+	minWordWrapWidth = 20
+	// hscrollStep is the number of columns scrolled horizontally per key press
+	hscrollStep = 8
+	// a warning is shown for system messages taking systemWarnShare of the context window
+	// when the history uses systemWarnUtilization of it
+	systemWarnShare       = 0.1
+	systemWarnUtilization = 0.7
+	// the token budget banner turns red above tokenWarnCritical of the context window
+	tokenWarnCritical = 0.95
+	// separatorStyles are the built-in separators between messages
+	separatorStyles = map[string]string{
+		"line":   "───",
+		"dots":   "···",
+		"arrows": ">>>",
+	}
+	// maxMisspelledShown is the number of misspelled words listed in the status bar
+	maxMisspelledShown = 3
+	// duplicateWindow is the number of recent user messages checked for duplicates
+	duplicateWindow = 20
+	// maxEmptyRetries is the number of times a request is sent again after an empty response
+	maxEmptyRetries = 2
+	// errEmptyResponse is shown when the retries of a request answered without content are exhausted
+	errEmptyResponse = errors.New("empty response")
+	// themeOrder is the order in which the theme key cycles through themeStyles
+	themeOrder  = []string{"light", "dark", "ascii", "dracula"}
+	themeStyles = map[string]ansi.StyleConfig{
+		"light":   LightStyleConfig,
+		"dark":    DarkStyleConfig,
+		"ascii":   glamour.ASCIIStyleConfig,
+		"dracula": glamour.DraculaStyleConfig,
+	}
 )
 
 type keymap struct {
-	Help, Esc, Quit, Send, Multiline key.Binding
+	Help, Esc, Quit, Send, Multiline, Resend, LineNumbers, Record, Speak, Theme key.Binding
+	ScrollLeft, ScrollRight, Cancel, Suggest, Select, Annotate, Navigate, Diff  key.Binding
+	Search                                                                      key.Binding
+	Palette, Prompts, NewTab, NextTab, PrevTab                                  key.Binding
 }
 
 var keys = keymap{
@@ -57,6 +107,84 @@ var keys = keymap{
 		key.WithKeys("ctrl+l"),
 		key.WithHelp("ctrl+l", "toggle multi-line"),
 	),
+	LineNumbers: key.NewBinding(
+		key.WithKeys("ctrl+n"),
+		key.WithHelp("ctrl+n", "toggle line numbers"),
+	),
+	Record: key.NewBinding(
+		key.WithKeys("ctrl+w"),
+		key.WithHelp("ctrl+w", "start/stop recording"),
+	),
+	Speak: key.NewBinding(
+		key.WithKeys("alt+p"),
+		key.WithHelp("alt+p", "read aloud"),
+	),
+	Palette: key.NewBinding(
+		key.WithKeys("ctrl+p"),
+		key.WithHelp("ctrl+p", "command palette"),
+	),
+	Theme: key.NewBinding(
+		key.WithKeys("ctrl+t"),
+		key.WithHelp("ctrl+t", "cycle theme"),
+	),
+	ScrollLeft: key.NewBinding(
+		key.WithKeys("ctrl+left"),
+		key.WithHelp("ctrl+←", "scroll left"),
+	),
+	ScrollRight: key.NewBinding(
+		key.WithKeys("ctrl+right"),
+		key.WithHelp("ctrl+→", "scroll right"),
+	),
+	Cancel: key.NewBinding(
+		key.WithKeys("ctrl+k"),
+		key.WithHelp("ctrl+k", "discard queued"),
+	),
+	Suggest: key.NewBinding(
+		key.WithKeys("ctrl+@"),
+		key.WithHelp("ctrl+space", "spelling suggestions"),
+	),
+	Select: key.NewBinding(
+		key.WithKeys("ctrl+s"),
+		key.WithHelp("ctrl+s", "select context"),
+	),
+	Annotate: key.NewBinding(
+		key.WithKeys("ctrl+o"),
+		key.WithHelp("ctrl+o", "annotate responses"),
+	),
+	Navigate: key.NewBinding(
+		// ctrl+j is the line feed of pasted text
+		key.WithKeys("ctrl+g"),
+		key.WithHelp("ctrl+g", "navigate code blocks"),
+	),
+	Diff: key.NewBinding(
+		key.WithKeys("alt+r"),
+		key.WithHelp("alt+r", "toggle regenerate diff"),
+	),
+	Search: key.NewBinding(
+		key.WithKeys("ctrl+f"),
+		key.WithHelp("ctrl+f", "search"),
+	),
+	Prompts: key.NewBinding(
+		// terminals send ctrl+/ as ctrl+_
+		key.WithKeys("ctrl+_"),
+		key.WithHelp("ctrl+/", "insert prompt"),
+	),
+	NewTab: key.NewBinding(
+		key.WithKeys("alt+t"),
+		key.WithHelp("alt+t", "new tab"),
+	),
+	NextTab: key.NewBinding(
+		key.WithKeys("alt+n"),
+		key.WithHelp("alt+n", "next tab"),
+	),
+	PrevTab: key.NewBinding(
+		key.WithKeys("alt+N"),
+		key.WithHelp("alt+N", "previous tab"),
+	),
+	Resend: key.NewBinding(
+		key.WithKeys("ctrl+r"),
+		key.WithHelp("ctrl+r", "regenerate"),
+	),
 	Quit: key.NewBinding(
 		key.WithKeys("ctrl+c"),
 		key.WithHelp("ctrl+c", "quit"),
@@ -66,54 +194,426 @@ var keys = keymap{
 // ShortHelp returns keybindings to be shown in the mini help view. It's part
 // of the key.Map interface.
 func (k keymap) ShortHelp() []key.Binding {
-	return []key.Binding{k.Help, k.Send, k.Quit}
+	return []key.Binding{k.Help, k.Send, k.Palette, k.Quit}
 }
 
 // FullHelp returns keybindings for the expanded help view. It's part of the
 // key.Map interface.
 func (k keymap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{k.Help, k.Send, k.Quit},
-		{k.Multiline, k.Esc},
+		{k.Help, k.Send, k.Palette, k.Prompts, k.Quit},
+		{k.Multiline, k.LineNumbers, k.Resend, k.Record, k.Speak, k.Theme, k.Esc},
+		{k.ScrollLeft, k.ScrollRight, k.Cancel, k.Suggest, k.Select, k.Annotate, k.Navigate, k.Diff},
+		{k.Search, k.NewTab, k.NextTab, k.PrevTab},
 	}
 }
 
 // Model stores the state
 type Model struct {
 	client       *Client
+	tokenCounter *TokenCounter
+	tokens       *tokenCache
 	viewport     viewport.Model
 	textarea     textarea.Model
 	spinner      spinner.Model
 	renderer     *glamour.TermRenderer
+	cache        *messageCache
 	help         help.Model
 	keys         keymap
 	streamDeltas string
-	sessionId    string
-	multiline    bool
-	waiting      bool
-	width        int
-	height       int
-	err          error
+	// lastRenderedOffset is the end of the complete blocks of streamDeltas rendered
+	// into streamRendered, the rest of the stream is shown as plain text
+	lastRenderedOffset  int
+	streamRendered      string
+	streamPrefix        string
+	streamBuffer        []CompletionStreamResponse
+	flushScheduled      bool
+	streamFlushInterval time.Duration
+	sessionId           string
+	createdAt           time.Time
+	pinned              bool
+	title               string
+	windowTitle         bool
+	shownTitle          string
+	shownIconName       string
+	tags                []string
+	historyLoader       *historyLoader
+	historyOffset       int
+	multiline           bool
+	autoMultilinePaste  bool
+	waiting             bool
+	lastParsedResponse  []Segment
+	showLineNumbers     bool
+	recorder            *recorder
+	transcribing        bool
+	tts                 bool
+	ttsVoice            string
+	cancelSpeech        context.CancelFunc
+	speechID            int
+	imageSize           string
+	imageN              int
+	compactThreshold    int
+	crashReport         string
+	showContextBar      bool
+	showHeader          bool
+	tokenWarnAt         int
+	tokenWarnVisible    bool
+	markedRoles         map[string]string
+	selecting           bool
+	selectionCursor     int
+	selectedMessages    map[int]bool
+	notes               map[int]string
+	ratings             map[int]int
+	annotating          bool
+	noteCursor          int
+	noteInput           textinput.Model
+	navigating          bool
+	searching           bool
+	searchInput         textinput.Model
+	searchQuery         string
+	mentioning          bool
+	mentionDismissed    bool
+	mentionQuery        string
+	mentionColumn       int
+	mentionList         list.Model
+	sessions            []SessionPane
+	showPalette         bool
+	palette             list.Model
+	prompts             *PromptLibrary
+	plugins             []Plugin
+	pickingPrompt       bool
+	promptList          list.Model
+	mdnsDiscover        bool
+	pickingServer       bool
+	serverList          list.Model
+	personas            map[string]string
+	codeCursor          int
+	expandedBlocks      map[int]bool
+	fallbackModel       string
+	themeName           string
+	codeRenderer        *glamour.TermRenderer
+	hscroll             bool
+	hscrollOffset       int
+	codeTheme           string
+	attachments         []string
+	replyParent         string
+	emptyRetries        int
+	pendingRestore      *restoreMsg
+	pendingMetadata     *SessionMetadata
+	pendingResume       string
+	duplicateCheck      bool
+	pendingDuplicate    string
+	pendingMessages     []string
+	bulkTotal           int
+	prevResponse        string
+	startTime           time.Time
+	tti                 time.Duration
+	benchmarkStartup    bool
+	bell                bool
+	lastKeypress        time.Time
+	pasteText           string
+	pasteValue          string
+	pasteSeq            int
+	lastPasteKey        time.Time
+	shutdown            <-chan struct{}
+	workspace           *workspaceWatcher
+	tabs                []TabState
+	activeTab           int
+	showDiff            bool
+	saveDrafts          bool
+	systemExpanded      bool
+	welcome             string
+	version             string
+	wordWrapMargin      int
+	maxHistoryMemory    int
+	allowGoEval         bool
+	warnInputTokens     int
+	inputSeq            int
+	inputTokens         int
+	waitStart           time.Time
+	lang                string
+	langMessageID       string
+	langMismatch        bool
+	expectedLang        string
+	noWordWrap          bool
+	separator           string
+	spellChecker        *SpellChecker
+	responseCache       *ResponseCache
+	images              *InlineImageRenderer
+	pendingCacheKey     string
+	cached              bool
+	rateLimit           *RateLimitInfo
+	animating           bool
+	editingSystem       bool
+	notice              string
+	// lastTruncated is set when the last response was cut by max_tokens
+	lastTruncated bool
+	width         int
+	height        int
+	err           error
 }
 
 func (m Model) Init() tea.Cmd {
-	return tea.Batch(
+	commands := []tea.Cmd{
 		textarea.Blink,
 		tea.EnterAltScreen,
 		m.spinner.Tick,
-	)
+	}
+	if len(m.crashReport) > 0 {
+		commands = append(commands, restoreCmd(m.crashReport))
+	}
+	if m.animating {
+		commands = append(commands, func() tea.Msg { return welcomeTickMsg{frame: 0} })
+	}
+	commands = append(commands, waitRateLimitCmd(m.client))
+	if m.bulkTotal > 0 {
+		commands = append(commands, func() tea.Msg { return bulkStartMsg{} })
+	}
+	if m.shutdown != nil {
+		commands = append(commands, waitShutdownCmd(m.shutdown))
+	}
+	if m.workspace != nil {
+		commands = append(commands, m.workspace.waitCmd())
+	}
+	if m.mdnsDiscover {
+		commands = append(commands, discoverServersCmd())
+	}
+	// the math blocks of the restored history
+	commands = append(commands, renderMathCmd())
+	return tea.Batch(commands...)
 }
 
 func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	input := m.textarea.Value()
+	var model tea.Model
+	var cmd tea.Cmd
+	if len(m.tabs) > 0 {
+		model, cmd = m.updateTabs(msg)
+	} else {
+		model, cmd = m.update(msg)
+	}
+	// render the math blocks of the rendered messages with katex
+	if mathCmd := renderMathCmd(); mathCmd != nil {
+		cmd = tea.Batch(cmd, mathCmd)
+	}
+	// fetch the images of the rendered messages
+	if updated, ok := model.(Model); ok {
+		if imagesCmd := updated.images.renderCmd(max(updated.viewport.Width-4, 1)); imagesCmd != nil {
+			cmd = tea.Batch(cmd, imagesCmd)
+		}
+	}
+	// count the tokens of the input once the typing pauses
+	if updated, ok := model.(Model); ok && updated.textarea.Value() != input {
+		tokensCmd := updated.inputChanged()
+		return updated, tea.Batch(cmd, tokensCmd)
+	}
+	return model, cmd
+}
+
+func (m Model) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var (
 		tiCmd    tea.Cmd
 		vpCmd    tea.Cmd
 		commands []tea.Cmd
 	)
 
+	// save the session before the program recovers from the panic
+	defer func() {
+		if r := recover(); r != nil {
+			if filePath, err := m.writeCrashReport(r); err != nil {
+				logger.Error("failed to write crash report", "error", err)
+			} else {
+				logger.Error("crashed", "error", r, "report", filePath)
+			}
+			panic(r)
+		}
+	}()
+
+	if _, ok := msg.(tea.KeyMsg); ok {
+		m.lastKeypress = timeNow()
+	}
+
+	// answer the restore prompt before the key reaches the textarea
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.pendingRestore != nil {
+		if keyMsg.String() == "y" || keyMsg.String() == "Y" {
+			m.restore(m.pendingRestore.report)
+			if err := m.saveHistory(); err != nil {
+				logger.Error("failed to save restored session", "error", err)
+			}
+		}
+		if err := os.Remove(m.pendingRestore.filePath); err != nil {
+			logger.Warn("failed to remove crash report", "path", m.pendingRestore.filePath, "error", err)
+		}
+		m.pendingRestore = nil
+		m.setNotice("")
+		return m, nil
+	}
+
+	// answer the prompt to resume the session of the same name, the quit key still quits
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && len(m.pendingResume) > 0 && !key.Matches(keyMsg, m.keys.Quit) {
+		filePath := m.pendingResume
+		m.pendingResume = ""
+		m.setNotice("")
+		if keyMsg.String() == "y" || keyMsg.String() == "Y" {
+			if err := m.loadHistory(filePath); err != nil {
+				m.err = err
+				return m, nil
+			}
+			content, _ := m.renderMessages(m.client.history)
+			m.viewport.SetContent(content)
+			m.viewport.GotoBottom()
+		}
+		return m, nil
+	}
+
+	// answer the prompt to switch to the settings the loaded session was created with
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.pendingMetadata != nil {
+		if keyMsg.String() == "y" || keyMsg.String() == "Y" {
+			m.applyMetadata(*m.pendingMetadata)
+		}
+		m.pendingMetadata = nil
+		m.setNotice("")
+		return m, nil
+	}
+
+	// answer the duplicate prompt, the message goes back to the textarea unless confirmed
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && len(m.pendingDuplicate) > 0 {
+		input := m.pendingDuplicate
+		m.pendingDuplicate = ""
+		m.setNotice("")
+		if keyMsg.String() == "y" || keyMsg.String() == "Y" {
+			return m, tea.Batch(m.send(input)...)
+		}
+		m.textarea.SetValue(input)
+		return m, nil
+	}
+
+	// move between the messages and check them in selection mode
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.selecting && !key.Matches(keyMsg, m.keys.Quit) {
+		return m, m.updateSelection(keyMsg)
+	}
+
+	// move between the responses and edit their notes in annotation mode
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.annotating && !key.Matches(keyMsg, m.keys.Quit) {
+		return m, m.updateAnnotating(keyMsg)
+	}
+
+	// move between the code blocks and expand them in navigation mode
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.navigating && !key.Matches(keyMsg, m.keys.Quit) {
+		return m, m.updateNavigating(keyMsg)
+	}
+
+	// type the text to highlight in the conversation
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.searching && !key.Matches(keyMsg, m.keys.Quit) {
+		return m, m.updateSearching(keyMsg)
+	}
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && key.Matches(keyMsg, m.keys.Search) {
+		return m, m.startSearch()
+	}
+
+	// pick an inline command or key binding from the command palette
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.showPalette && !key.Matches(keyMsg, m.keys.Quit) {
+		return m, m.updatePalette(keyMsg)
+	}
+	if matches, ok := msg.(list.FilterMatchesMsg); ok {
+		if m.pickingPrompt {
+			m.promptList, _ = m.promptList.Update(matches)
+		} else {
+			m.palette, _ = m.palette.Update(matches)
+		}
+		return m, nil
+	}
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && key.Matches(keyMsg, m.keys.Palette) {
+		return m, m.startPalette()
+	}
+
+	// pick a server discovered on the local network
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.pickingServer && !key.Matches(keyMsg, m.keys.Quit) {
+		m.updateServerPicker(keyMsg)
+		return m, nil
+	}
+
+	// pick a prompt of the prompt library to insert
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.pickingPrompt && !key.Matches(keyMsg, m.keys.Quit) {
+		return m, m.updatePromptPicker(keyMsg)
+	}
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && key.Matches(keyMsg, m.keys.Prompts) {
+		return m, m.startPromptPicker()
+	}
+
+	// pick a model or persona from the open mention dropdown
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && m.mentioning && m.updateMentioning(keyMsg) {
+		return m, nil
+	}
+
+	// files dropped onto the terminal are pasted as file URIs
+	if end, ok := msg.(pasteEndMsg); ok {
+		m.endPaste(end.seq)
+		return m, nil
+	}
+	var pasteCmd tea.Cmd
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		var handled bool
+		if pasteCmd, handled = m.updatePaste(keyMsg); handled {
+			return m, pasteCmd
+		}
+	}
+
+	// the message is sent to every session in multi-session mode
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && len(m.sessions) > 0 && key.Matches(keyMsg, m.keys.Send) && !m.multiline {
+		input := m.textarea.Value()
+		m.textarea.Reset()
+		if len(strings.TrimSpace(input)) == 0 {
+			return m, nil
+		}
+		return m, tea.Batch(m.sendAll(input)...)
+	}
+
+	// sending is disabled until the request rate limit resets
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && key.Matches(keyMsg, m.keys.Send) && !m.multiline && m.rateLimited() {
+		m.setNotice(errorStyle.Render(m.rateLimitedView()))
+		return m, nil
+	}
+
+	// the alt key bindings would be typed into the textarea
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && key.Matches(keyMsg, m.keys.NewTab, m.keys.NextTab, m.keys.PrevTab) {
+		switch {
+		case key.Matches(keyMsg, m.keys.NewTab):
+			cmd := m.newTab()
+			return m, cmd
+		case key.Matches(keyMsg, m.keys.NextTab):
+			m.cycleTab(1)
+		default:
+			m.cycleTab(-1)
+		}
+		return m, nil
+	}
+	if keyMsg, ok := msg.(tea.KeyMsg); ok && key.Matches(keyMsg, m.keys.Diff, m.keys.Speak) {
+		switch {
+		case key.Matches(keyMsg, m.keys.Diff):
+			if len(m.prevResponse) > 0 {
+				m.showDiff = !m.showDiff
+				m.setNotice(m.notice)
+			}
+		case m.cancelSpeech != nil:
+			// stop the current playback
+			m.cancelSpeech()
+			m.cancelSpeech = nil
+		default:
+			if n := len(m.client.history); n > 0 && m.client.history[n-1].Role == "assistant" {
+				cmd := m.speak(m.client.history[n-1].Content)
+				return m, cmd
+			}
+		}
+		return m, nil
+	}
+
 	m.textarea, tiCmd = m.textarea.Update(msg)
 	m.viewport, vpCmd = m.viewport.Update(msg)
-	commands = []tea.Cmd{tiCmd, vpCmd}
+	commands = []tea.Cmd{tiCmd, vpCmd, pasteCmd}
+	if _, ok := msg.(tea.KeyMsg); ok {
+		m.updateMention()
+	}
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
@@ -124,29 +624,100 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case key.Matches(msg, m.keys.Esc):
 			return m, tea.ExitAltScreen
 		case key.Matches(msg, m.keys.Quit):
-			return m, tea.Quit
+			cmd := m.quit()
+			return m, cmd
 		case key.Matches(msg, m.keys.Multiline):
-			// toggle multiline
-			m.multiline = !m.multiline
-			m.textarea.ShowLineNumbers = m.multiline
-			// refresh textarea width
-			m.textarea.SetWidth(m.width - appStyle.GetHorizontalFrameSize())
-		case key.Matches(msg, m.keys.Send):
-			if !m.multiline && !m.waiting {
-				m.client.history = append(m.client.history, Message{Role: "user", Content: m.textarea.Value()})
+			m.setMultiline(!m.multiline)
+		case key.Matches(msg, m.keys.LineNumbers):
+			// toggle line numbers
+			m.showLineNumbers = !m.showLineNumbers
+			if !m.waiting && len(m.client.history) > 0 {
 				content, _ := m.renderMessages(m.client.history)
 				m.viewport.SetContent(content)
-
-				req := newCompletionRequest(m.client)
-				commands = append(commands, createCompletionCmd(m.client, req))
-				if m.client.stream {
-					commands = append(commands, waitEventsCmd(m.client))
+			}
+		case m.hscroll && key.Matches(msg, m.keys.ScrollLeft):
+			m.hscrollOffset = max(m.hscrollOffset-hscrollStep, 0)
+		case m.hscroll && key.Matches(msg, m.keys.ScrollRight):
+			m.hscrollOffset = min(m.hscrollOffset+hscrollStep, m.maxHScrollOffset())
+		case key.Matches(msg, m.keys.Theme):
+			m.cycleTheme()
+		case key.Matches(msg, m.keys.Record):
+			if m.recorder != nil {
+				if err := m.recorder.stop(); err != nil {
+					m.setNotice(warnStyle.Render("⚠ failed to stop recording: " + err.Error()))
 				}
-
+			} else if !m.transcribing {
+				r, err := startRecording()
+				if err != nil {
+					m.setNotice(warnStyle.Render("⚠ failed to start recording: " + err.Error()))
+					return m, nil
+				}
+				m.recorder = r
+				commands = append(commands, waitRecordingCmd(r))
+			}
+		case key.Matches(msg, scrollUpKeys):
+			if m.viewport.AtTop() && m.historyOffset > 0 && !m.waiting {
+				if err := m.loadOlderMessages(); err != nil {
+					m.err = err
+					return m, nil
+				}
+			}
+		case key.Matches(msg, m.keys.Send) && !m.multiline && m.waiting:
+			m.enqueue(m.textarea.Value())
+			m.textarea.Reset()
+		case key.Matches(msg, m.keys.Cancel):
+			if n := len(m.pendingMessages); n > 0 {
+				m.pendingMessages = nil
+				m.setNotice(fmt.Sprintf("%d queued messages discarded", n))
+			}
+		case key.Matches(msg, m.keys.Send):
+			if !m.multiline && !m.waiting {
+				input := m.textarea.Value()
 				m.textarea.Reset()
-				m.viewport.GotoBottom()
-				// set waiting to true so spinner will be visible
-				m.waiting = true
+				m.notice = ""
+				if m.editingSystem {
+					m.editingSystem = false
+					m.client.system = strings.TrimSpace(input)
+					m.setNotice("System message updated")
+				} else if cmd, ok := m.handleCommand(input); ok {
+					commands = append(commands, cmd)
+				} else {
+					if n := duplicateDistance(m.client.history, input, duplicateWindow); m.duplicateCheck && n > 0 {
+						m.pendingDuplicate = input
+						m.setNotice(warnStyle.Render(fmt.Sprintf("⚠ You sent this message %d messages ago. Send again? [y/N]", n)))
+					} else {
+						commands = append(commands, m.send(input)...)
+					}
+				}
+			}
+		case key.Matches(msg, m.keys.Suggest) && m.spellChecker != nil:
+			m.showSpellingSuggestions()
+		case key.Matches(msg, m.keys.Select) && !m.waiting:
+			m.startSelection()
+		case key.Matches(msg, m.keys.Annotate) && !m.waiting:
+			m.startAnnotating()
+		case key.Matches(msg, m.keys.Navigate) && !m.waiting:
+			m.startNavigating()
+		case key.Matches(msg, m.keys.Resend):
+			if m.lastTruncated && !m.waiting {
+				// drop the truncated response and ask again with doubled max tokens
+				last := m.client.history[len(m.client.history)-1]
+				m.client.history = m.client.history[:len(m.client.history)-1]
+				maxTokens := m.client.maxTokens
+				if maxTokens == 0 {
+					maxTokens = m.tokenCounter.Count(last.Content)
+				}
+				m.client.maxTokens = maxTokens * 2
+				m.lastTruncated = false
+				m.parseLastResponse()
+				commands = append(commands, m.sendCompletion()...)
+			} else if n := len(m.client.history); n > 0 && m.client.history[n-1].Role == "assistant" && !m.waiting {
+				// drop the response and ask again, the new one is compared with it
+				m.prevResponse = m.client.history[n-1].Content
+				m.showDiff = true
+				m.client.history = m.client.history[:n-1]
+				m.parseLastResponse()
+				commands = append(commands, m.sendCompletion()...)
 			}
 		}
 
@@ -155,6 +726,18 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		h := appStyle.GetHorizontalFrameSize()
 		m.viewport.Width = msg.Width - h
 		m.viewport.Height = msg.Height - (8 + textAreaHeight)
+		if m.showContextBar {
+			m.viewport.Height--
+		}
+		if m.tokenWarnVisible {
+			m.viewport.Height--
+		}
+		if len(m.tabs) > 0 {
+			m.viewport.Height--
+		}
+		if m.showHeader {
+			m.viewport.Height -= headerHeight
+		}
 		m.textarea.SetWidth(msg.Width - h)
 
 		if m.viewport.Height <= 0 {
@@ -162,7 +745,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 
-		m.renderer, _ = newGlamourRenderer(msg.Width - h - 2)
+		m.setRenderer()
+		m.layoutPanes()
+		commands = append(commands, m.markReady())
 
 		// re-render the conversation
 		if !m.waiting && len(m.client.history) > 0 {
@@ -171,44 +756,278 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.viewport.GotoBottom()
 		}
 
+	case recordingDoneMsg:
+		m.recorder = nil
+		if msg.err != nil {
+			removeTempAudio(msg.file)
+			m.setNotice(warnStyle.Render("⚠ recording failed: " + msg.err.Error()))
+			return m, nil
+		}
+		m.transcribing = true
+		commands = append(commands, transcribeCmd(m.client, msg.file))
+
+	case inputTokensMsg:
+		m.countInputTokens(msg)
+
+	case serversDiscoveredMsg:
+		m.startServerPicker(msg)
+
+	case evalResultMsg:
+		m.waiting = false
+		m.appendEvalOutput(msg.output)
+
+	case pluginResultMsg:
+		commands = append(commands, m.applyPluginResult(msg)...)
+
+	case mathRenderedMsg:
+		// keep the scroll position, the rendered math may change the height of the messages
+		content, _ := m.renderMessages(m.client.history)
+		m.viewport.SetContent(content)
+
+	case mathNoticeMsg:
+		output, _ := safeRender(m.renderer, string(msg))
+		m.setNotice(output)
+
+	case imagesMsg:
+		m.waiting = false
+		var lines []string
+		for _, filePath := range msg {
+			lines = append(lines, "🖼 Image saved: "+shortenHome(filePath))
+		}
+		m.setNotice(strings.Join(lines, "\n"))
+		commands = append(commands, openFilesCmd(msg))
+
+	case fallbackMsg:
+		m.client.model = msg.model
+		m.setNotice(warnStyle.Render("⚠ Switched to fallback model: " + msg.model))
+		if msg.resp != nil {
+			return m.Update(*msg.resp)
+		}
+
+	case imagesRenderedMsg:
+		// the cached messages show the images as text
+		m.cache.entries = nil
+		content, _ := m.renderMessages(m.client.history)
+		m.viewport.SetContent(content)
+
+	case cachedMsg:
+		m.cached = true
+		return m.Update(*msg.resp)
+
+	case restoreMsg:
+		m.pendingRestore = &msg
+		m.setNotice(warnStyle.Render("⚠ Crashed session found. Restore? [y/N]"))
+
+	case languageMsg:
+		m.langMismatch = len(m.expectedLang) > 0 && msg.code != m.expectedLang
+		m.langMessageID = msg.id
+		changed := len(m.lang) > 0 && msg.code != m.lang
+		m.lang = msg.code
+		if changed {
+			m.notice = "🌐 language changed to " + msg.name
+		}
+		// the next response may already be streaming
+		if !m.waiting {
+			m.setNotice(m.notice)
+		}
+
+	case welcomeTickMsg:
+		commands = append(commands, m.showWelcomeFrame(msg.frame))
+
+	case compactMsg:
+		m.waiting = false
+		before := m.historyTokens(m.client.history)
+		m.client.history = msg
+		m.parseLastResponse()
+		// the compacted history replaces the whole session file
+		m.historyLoader = nil
+		m.historyOffset = 0
+		if err := m.saveHistory(); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.setNotice(fmt.Sprintf("History compacted: %d → %d tokens", before, m.historyTokens(m.client.history)))
+		commands = append(commands, m.dequeue()...)
+
+	case speechDoneMsg:
+		if msg.id == m.speechID {
+			m.cancelSpeech = nil
+		}
+		if msg.err != nil {
+			logger.Error("failed to read response aloud", "error", msg.err)
+			m.setNotice(warnStyle.Render("⚠ text to speech failed: " + msg.err.Error()))
+		}
+
+	case transcriptionMsg:
+		m.transcribing = false
+		// the recording can be made again, the error is not kept
+		if msg.err != nil {
+			m.setNotice(warnStyle.Render("⚠ transcription failed: " + msg.err.Error()))
+			break
+		}
+		m.textarea.InsertString(msg.text)
+
 	case spinner.TickMsg:
-		var cmd tea.Cmd
-		m.spinner, cmd = m.spinner.Update(msg)
-		commands = append(commands, cmd)
+		cmd := m.tickSpinner(msg)
+		commands = append(commands, cmd, m.updatePaneSpinners(msg))
+
+	case paneMsg:
+		commands = append(commands, m.updatePane(msg.index, msg.msg))
+
+	case *CompletionResponse:
+		return m.update(*msg)
 
 	case CompletionResponse:
+		if len(msg.Choices) == 0 || len(msg.Choices[0].Message.Content) == 0 {
+			// the API occasionally answers with no content, the request is sent again
+			if m.emptyRetries < maxEmptyRetries {
+				m.emptyRetries++
+				logger.Debug("retrying empty response", "attempt", m.emptyRetries)
+				commands = append(commands, m.sendCompletion()...)
+				break
+			}
+			m.emptyRetries = 0
+			m.waiting = false
+			m.err = errEmptyResponse
+			return m, nil
+		}
+		m.emptyRetries = 0
 		m.waiting = false
+		m.notifyCompletion()
 		choice := msg.Choices[0]
-		m.client.history = append(m.client.history, choice.Message)
+		m.appendResponse(choice.Message)
+		if err := m.archiveHistory(); err != nil {
+			logger.Error("failed to archive history", "error", err)
+		}
+		m.lastTruncated = isTruncated(choice.FinishReason)
+		if choice.FinishReason == "stop" {
+			m.cacheResponse(msg)
+		}
 		content, _ := m.renderMessages(m.client.history)
 
 		m.saveHistory()
+		if m.tts {
+			commands = append(commands, m.speak(choice.Message.Content))
+		}
+		if m.shouldCompact() {
+			commands = append(commands, m.compact())
+		}
 
 		m.viewport.SetContent(content)
 		m.viewport.GotoBottom()
+		commands = append(commands, detectLanguageCmd(messageID(m.historyOffset+len(m.client.history)-1), choice.Message.Content))
+		commands = append(commands, m.dequeue()...)
 
 	case CompletionStreamResponse:
+		// events without choices, e.g. the usage, carry no content
+		if len(msg.Choices) == 0 {
+			commands = append(commands, waitEventsCmd(m.client))
+			break
+		}
 		choice := msg.Choices[0]
-		if choice.FinishReason == "stop" {
+		if len(choice.FinishReason) > 0 {
+			m.flushStream()
+			if len(m.streamDeltas) == 0 {
+				// the API occasionally streams no content, the request is sent again
+				m.resetStreamRender()
+				if m.emptyRetries < maxEmptyRetries {
+					m.emptyRetries++
+					logger.Debug("retrying empty response", "attempt", m.emptyRetries)
+					commands = append(commands, m.sendCompletion()...)
+					break
+				}
+				m.emptyRetries = 0
+				m.waiting = false
+				m.err = errEmptyResponse
+				return m, nil
+			}
+			m.emptyRetries = 0
 			m.waiting = false
+			m.notifyCompletion()
 			// save stream response to client history
-			m.client.history = append(m.client.history, Message{Role: "assistant", Content: m.streamDeltas})
+			m.appendResponse(Message{Role: "assistant", Content: m.streamDeltas})
+			if err := m.archiveHistory(); err != nil {
+				logger.Error("failed to archive history", "error", err)
+			}
+			if choice.FinishReason == "stop" {
+				commands = append(commands, detectLanguageCmd(messageID(m.historyOffset+len(m.client.history)-1), m.streamDeltas))
+				m.cacheResponse(CompletionResponse{Choices: []CompletionChoice{{
+					Message:      Message{Role: "assistant", Content: m.streamDeltas},
+					FinishReason: choice.FinishReason,
+				}}})
+			}
+			if m.tts {
+				commands = append(commands, m.speak(m.streamDeltas))
+			}
 			// reset stream message
 			m.streamDeltas = ""
+			m.resetStreamRender()
+			m.lastTruncated = isTruncated(choice.FinishReason)
+			content, _ := m.renderMessages(m.client.history)
+			m.viewport.SetContent(content)
+			m.viewport.GotoBottom()
 
 			m.saveHistory()
+			if m.shouldCompact() {
+				commands = append(commands, m.compact())
+			}
+			commands = append(commands, m.dequeue()...)
 		} else {
 			// waiting for next event message
 			commands = append(commands, waitEventsCmd(m.client))
 			if len(choice.Delta.Content) > 0 {
-				m.streamDeltas += choice.Delta.Content
-				delta, _ := m.renderer.Render(m.streamDeltas)
-				output := chatStyle.Render(chatGPTName) + "\n" + delta + "\n"
-				history, _ := m.renderMessages(m.client.history)
-				m.viewport.SetContent(history + output)
-				m.viewport.GotoBottom()
+				m.streamBuffer = append(m.streamBuffer, msg)
+				if m.streamFlushInterval <= 0 {
+					m.flushStream()
+					m.renderStream()
+				} else if !m.flushScheduled {
+					m.flushScheduled = true
+					commands = append(commands, flushStreamCmd(m.streamFlushInterval))
+				}
+			}
+		}
+
+	case RateLimitInfo:
+		m.rateLimit = &msg
+		commands = append(commands, waitRateLimitCmd(m.client))
+		if m.rateLimited() {
+			commands = append(commands, tea.Tick(time.Until(msg.ResetRequests), func(time.Time) tea.Msg {
+				return rateLimitResetMsg{}
+			}))
+		}
+
+	case rateLimitResetMsg:
+		if m.rateLimit != nil && !m.rateLimited() {
+			m.rateLimit = nil
+			m.setNotice("")
+		}
+
+	case workspaceChangedMsg:
+		m.setNotice(fmt.Sprintf("📁 workspace updated: %s", string(msg)))
+		commands = append(commands, m.workspace.waitCmd())
+
+	case shutdownMsg:
+		if len(m.client.history) > 0 {
+			if err := m.saveHistory(); err != nil {
+				logger.Error("failed to save history", "error", err)
 			}
 		}
+		cmd := m.quit()
+		return m, cmd
+
+	case bulkStartMsg:
+		commands = append(commands, m.dequeue()...)
+
+	case flushStreamMsg:
+		m.flushScheduled = false
+		if len(m.streamBuffer) > 0 {
+			m.flushStream()
+			m.renderStream()
+		}
+
+	// the valid events of the stream were shown
+	case *StreamError:
+		m.setNotice(warnStyle.Render("⚠ " + msg.Error()))
 
 	// handle errors just like any other message
 	case error:
@@ -216,22 +1035,47 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
+	m.updateTokenWarning(msg)
+	m.updateWindowTitle()
+
 	return m, tea.Batch(commands...)
 }
 
 // View renders the UI
 func (m Model) View() string {
+	// the data of the images is sent to the terminal before the frame showing their placeholders
+	m.images.flush(terminalOutput)
 	var s string
-	s += m.viewport.View() + "\n\n"
+	if len(m.tabs) > 0 {
+		s += m.tabBarView() + "\n"
+	}
+	if m.showHeader {
+		s += m.headerView() + "\n"
+	}
+	if m.showPalette {
+		s += m.paletteView() + "\n"
+	} else if m.pickingPrompt {
+		s += m.promptPickerView() + "\n"
+	} else if m.pickingServer {
+		s += m.serverPickerView() + "\n"
+	} else if len(m.sessions) > 0 {
+		s += m.panesView() + "\n"
+	} else if m.mentioning {
+		s += m.mentionView(m.viewportView()) + "\n"
+	} else {
+		s += m.viewportView() + "\n"
+	}
+	if m.showContextBar {
+		s += m.contextBarView() + "\n"
+	}
+	s += m.statusView() + "\n"
+	if m.tokenWarnVisible {
+		s += m.tokenWarningView() + "\n"
+	}
 
 	if m.err == nil {
-		if !m.waiting {
-			// textarea
-			s += m.textarea.View() + "\n"
-		} else {
-			// spinner
-			s += m.spinner.View() + " sending...\n\n"
-		}
+		// the textarea stays visible while waiting to queue messages
+		s += m.inputView() + "\n"
 		// help view
 		s += m.help.View(m.keys)
 	} else {
@@ -242,19 +1086,473 @@ func (m Model) View() string {
 	return appStyle.Render(s)
 }
 
-// newGlamourRenderer creates new glamour Markdown renderer with given wordWrap width
-func newGlamourRenderer(wordWrap int) (*glamour.TermRenderer, error) {
-	glamourStyle := LightStyleConfig
-	if termenv.HasDarkBackground() {
-		glamourStyle = DarkStyleConfig
+// viewportView renders the viewport shifted by the horizontal scroll offset.
+// Lines extending beyond the right edge end with an arrow.
+func (m Model) viewportView() string {
+	if !m.hscroll {
+		return highlightInANSI(m.viewport.View(), m.searchQuery)
+	}
+	wide := m.viewport
+	wide.Width = maxLineWidth
+	lines := strings.Split(wide.View(), "\n")
+	for i, line := range lines {
+		lines[i] = cutLine(line, m.hscrollOffset, m.viewport.Width)
+	}
+	return highlightInANSI(strings.Join(lines, "\n"), m.searchQuery)
+}
+
+// maxHScrollOffset returns the offset at which the widest visible line ends at the right edge
+func (m Model) maxHScrollOffset() int {
+	wide := m.viewport
+	wide.Width = maxLineWidth
+	width := 0
+	for _, line := range strings.Split(wide.View(), "\n") {
+		width = max(width, visibleWidth(line))
+	}
+	return max(width-m.viewport.Width, 0)
+}
+
+// statusView renders the status bar between the viewport and the input
+func (m Model) statusView() string {
+	var icons []string
+	if m.recorder != nil {
+		icons = append(icons, errorStyle.Render("● recording"))
+	}
+	if m.transcribing {
+		icons = append(icons, helpStyle.Render("transcribing..."))
+	}
+	if m.lastTruncated {
+		icons = append(icons, warnStyle.Render("✂ truncated"))
+	}
+	if m.waiting {
+		icons = append(icons, m.spinnerView())
+	}
+	if m.bulkTotal > 0 && (m.waiting || len(m.pendingMessages) > 0) {
+		icons = append(icons, helpStyle.Render(fmt.Sprintf("Message %d/%d", max(m.bulkTotal-len(m.pendingMessages), 1), m.bulkTotal)))
+	} else if n := len(m.pendingMessages); n > 0 {
+		icons = append(icons, helpStyle.Render(fmt.Sprintf("[+%d queued]", n)))
+	}
+	if m.cached {
+		icons = append(icons, helpStyle.Render("[cached]"))
+	}
+	if m.rateLimited() {
+		icons = append(icons, errorStyle.Render(m.rateLimitedView()))
+	} else if r := m.rateLimit; r != nil {
+		if r.RemainingRequests >= 0 {
+			icons = append(icons, remainingStyle(r.RemainingRequests, r.LimitRequests).Render(fmt.Sprintf("%s req", formatThousands(r.RemainingRequests))))
+		}
+		if r.RemainingTokens >= 0 {
+			icons = append(icons, remainingStyle(r.RemainingTokens, r.LimitTokens).Render(fmt.Sprintf("%s tok", formatThousands(r.RemainingTokens))))
+		}
+	}
+	if m.spellChecker != nil {
+		if misspelled := m.spellChecker.Misspelled(m.textarea.Value()); len(misspelled) > 0 {
+			words := make([]string, 0, maxMisspelledShown)
+			for _, word := range misspelled[:min(len(misspelled), maxMisspelledShown)] {
+				words = append(words, misspelledStyle.Render(word))
+			}
+			if n := len(misspelled) - maxMisspelledShown; n > 0 {
+				words = append(words, helpStyle.Render(fmt.Sprintf("+%d", n)))
+			}
+			icons = append(icons, "✗ "+strings.Join(words, " "))
+		}
+	}
+	if len(m.lang) > 0 {
+		icons = append(icons, helpStyle.Render("lang: "+m.lang))
+	}
+	if len(m.themeName) > 0 {
+		icons = append(icons, helpStyle.Render("theme: "+m.themeName))
+	}
+	return strings.Join(icons, " ")
+}
+
+// contextBarView renders the utilization of the context window by the history
+func (m Model) contextBarView() string {
+	window := contextWindow(m.client.model)
+	if window == 0 {
+		return helpStyle.Render("context window unknown")
+	}
+	ratio := m.historyUtilization(m.client.model)
+	label := fmt.Sprintf(" %3.0f%% of %d tokens", ratio*100, window)
+
+	width := m.viewport.Width - lipgloss.Width(label)
+	if width < 0 {
+		width = 0
+	}
+	filled := int(ratio * float64(width))
+	style := okStyle
+	if ratio >= 0.9 {
+		style = errorStyle
+	} else if ratio >= 0.7 {
+		style = warnStyle
+	}
+	return style.Render(strings.Repeat("█", filled)) +
+		helpStyle.Render(strings.Repeat("░", width-filled)+label)
+}
+
+// updateTokenWarning shows the banner when the context utilization exceeds the warning
+// threshold, taking a line from the viewport. Below the threshold, a key dismisses it.
+func (m *Model) updateTokenWarning(msg tea.Msg) {
+	if m.tokenWarnAt <= 0 {
+		return
+	}
+	visible := m.tokenWarnVisible
+	if m.historyUtilization(m.client.model)*100 > float64(m.tokenWarnAt) {
+		visible = true
+	} else if _, ok := msg.(tea.KeyMsg); ok {
+		visible = false
+	}
+	if visible == m.tokenWarnVisible {
+		return
 	}
-	renderer, err := glamour.NewTermRenderer(
-		glamour.WithStyles(glamourStyle),
+
+	m.tokenWarnVisible = visible
+	atBottom := m.viewport.AtBottom()
+	if visible {
+		m.viewport.Height--
+	} else {
+		m.viewport.Height++
+	}
+	if atBottom {
+		m.viewport.GotoBottom()
+	}
+}
+
+// tokenWarningView renders the banner warning that the context window is nearly full
+func (m Model) tokenWarningView() string {
+	ratio := m.historyUtilization(m.client.model)
+	style := warnStyle
+	if ratio >= tokenWarnCritical {
+		style = errorStyle
+	}
+	return style.Render(fmt.Sprintf("⚠ Context at %.0f%% — consider /compact or /clear", ratio*100))
+}
+
+// modelInfoView returns the context window of the model and how much of it the history uses
+func (m Model) modelInfoView(model string) (string, bool) {
+	info, ok := lookupModelInfo(model)
+	if !ok || info.ContextWindow == 0 {
+		return "", false
+	}
+	used := m.historyTokens(m.client.history)
+	ratio := m.historyUtilization(model)
+	return fmt.Sprintf("Context: %s tokens │ Used: %s (%.1f%%)",
+		formatThousands(info.ContextWindow), formatThousands(used), ratio*100), true
+}
+
+// bulkStartMsg is sent on start to send the first of the messages read with --file
+type bulkStartMsg struct{}
+
+// flushStreamMsg is sent when the buffered stream deltas should be rendered
+type flushStreamMsg struct{}
+
+// flushStreamCmd returns a tea.Cmd which sends flushStreamMsg after the interval
+func flushStreamCmd(interval time.Duration) tea.Cmd {
+	return tea.Tick(interval, func(time.Time) tea.Msg {
+		return flushStreamMsg{}
+	})
+}
+
+// flushStream appends all buffered stream deltas to the stream message
+func (m *Model) flushStream() {
+	for _, resp := range m.streamBuffer {
+		m.streamDeltas += resp.Choices[0].Delta.Content
+	}
+	m.streamBuffer = nil
+}
+
+// renderSystemMessage renders the system message as plain text in a box, collapsed to its
+// first line unless the system messages are expanded. A warning is added if the context
+// window is nearly full and the message takes a large share of it.
+func (m Model) renderSystemMessage(content string) string {
+	text := "⚙ " + content
+	if first, _, multiline := strings.Cut(content, "\n"); multiline && !m.systemExpanded {
+		text = "⚙ " + first + " …"
+	}
+	output := systemStyle.Width(max(m.viewport.Width-systemStyle.GetHorizontalBorderSize(), 0)).Render(text) + "\n"
+
+	if window := contextWindow(m.client.model); window > 0 {
+		share := float64(m.tokens.count(m.tokenCounter, content)) / float64(window)
+		if share >= systemWarnShare && m.historyUtilization(m.client.model) >= systemWarnUtilization {
+			output += warnStyle.Render(fmt.Sprintf("⚠ System message uses %.0f%% of context", share*100)) + "\n"
+		}
+	}
+	return output
+}
+
+// renderStream renders the conversation with the partial stream message.
+// Only the blocks completed since the last call are rendered and appended, the
+// conversation is rendered in full if the stream is not the last item shown.
+func (m *Model) renderStream() {
+	if len(m.pendingMessages) > 0 || len(m.notice) > 0 || m.showLineNumbers || m.navigating {
+		n := len(m.client.history)
+		messages := append(m.client.history[:n:n], Message{Role: "assistant", Content: m.streamDeltas})
+		content, _ := m.renderMessages(messages)
+		m.viewport.SetContent(content)
+		m.viewport.GotoBottom()
+		return
+	}
+	if len(m.streamPrefix) == 0 {
+		m.streamPrefix = m.renderStreamPrefix()
+	}
+	if boundary := m.lastRenderedOffset + streamBoundary(m.streamDeltas[m.lastRenderedOffset:]); boundary > m.lastRenderedOffset {
+		output, err := renderContent(m.renderer, m.codeRenderer, replaceMathBlocks(m.streamDeltas[m.lastRenderedOffset:boundary]))
+		if err != nil {
+			logger.Warn("falling back to plain text", "error", err)
+		}
+		if output = strings.Trim(output, "\n"); len(output) > 0 {
+			m.streamRendered += "\n" + output + "\n"
+		}
+		m.lastRenderedOffset = boundary
+	}
+	width := m.viewport.Width
+	if !m.noWordWrap {
+		width = wordWrapWidth(m.viewport.Width, m.wordWrapMargin)
+	}
+	tail := lipgloss.NewStyle().Width(width).Render(m.streamDeltas[m.lastRenderedOffset:])
+	m.viewport.SetContent(m.streamPrefix + m.streamRendered + "\n" + tail)
+	m.viewport.GotoBottom()
+}
+
+// renderStreamPrefix renders the history followed by the author of the stream message
+func (m Model) renderStreamPrefix() string {
+	prefix, _ := m.renderMessages(m.client.history)
+	if len(prefix) > 0 {
+		prefix += "\n"
+		if len(m.separator) > 0 {
+			prefix += lipgloss.NewStyle().Width(m.viewport.Width).Align(lipgloss.Center).Render(m.separator) + "\n\n"
+		}
+	}
+	return prefix + chatStyle.Render(chatGPTName) + "\n"
+}
+
+// resetStreamRender discards the incremental rendering of the stream message
+func (m *Model) resetStreamRender() {
+	m.lastRenderedOffset = 0
+	m.streamRendered = ""
+	m.streamPrefix = ""
+}
+
+// setMultiline switches between sending with enter and entering line breaks
+func (m *Model) setMultiline(multiline bool) {
+	m.multiline = multiline
+	m.textarea.ShowLineNumbers = multiline
+	// refresh textarea width
+	m.textarea.SetWidth(m.width - appStyle.GetHorizontalFrameSize())
+}
+
+// setNotice shows the notice below the conversation until the next message is sent
+func (m *Model) setNotice(notice string) {
+	m.notice = notice
+	content, _ := m.renderMessages(m.client.history)
+	m.viewport.SetContent(content)
+	m.viewport.GotoBottom()
+}
+
+// showSpellingSuggestions shows the corrections of the misspelled word at the cursor as a notice
+func (m *Model) showSpellingSuggestions() {
+	lines := strings.Split(m.textarea.Value(), "\n")
+	row := m.textarea.Line()
+	if row >= len(lines) {
+		return
+	}
+	info := m.textarea.LineInfo()
+	word := wordAt(lines[row], info.StartColumn+info.ColumnOffset)
+	if len(word) == 0 || m.spellChecker.Check(word) {
+		m.setNotice("")
+		return
+	}
+	suggestions := m.spellChecker.Suggestions(word)
+	if len(suggestions) == 0 {
+		m.setNotice(helpStyle.Render(fmt.Sprintf("No suggestions for %q", word)))
+		return
+	}
+	m.setNotice(fmt.Sprintf("%s → %s", misspelledStyle.Render(word), strings.Join(suggestions, ", ")))
+}
+
+// send appends the input with the attachments to the history and requests the completion.
+// The input goes back to the textarea if it does not fit in the context with the system messages.
+func (m *Model) send(input string) []tea.Cmd {
+	content := input
+	if len(m.attachments) > 0 {
+		content = strings.Join(append([]string{input}, m.attachments...), "\n\n")
+	}
+	if tokens := m.systemTokens() + m.tokenCounter.Count(content); tokens > m.client.maxContextLength {
+		m.textarea.SetValue(input)
+		m.setNotice(warnStyle.Render(fmt.Sprintf("⚠ The message does not fit in the context: %d tokens with the system message and the attachments, --max-context-length is %d",
+			tokens, m.client.maxContextLength)))
+		return nil
+	}
+	m.attachments = nil
+	message := Message{Role: "user", Content: content}
+	if len(m.replyParent) > 0 {
+		parent := m.replyParent
+		message.ParentID = &parent
+		m.replyParent = ""
+	}
+	m.client.history = append(m.client.history, message)
+	m.lastTruncated = false
+	m.emptyRetries = 0
+	m.prevResponse = ""
+	if m.saveDrafts {
+		if err := removeDraft(m.sessionId); err != nil {
+			logger.Warn("failed to remove draft", "error", err)
+		}
+	}
+	return m.sendCompletion()
+}
+
+// systemTokens returns the number of tokens of the system messages sent with every request
+func (m Model) systemTokens() int {
+	tokens := m.tokenCounter.Count(m.client.system)
+	for _, message := range m.client.history {
+		if message.Role == "system" {
+			tokens += m.tokenCounter.Count(message.Content)
+		}
+	}
+	return tokens
+}
+
+// enqueue buffers the input to be sent after the current response
+func (m *Model) enqueue(input string) {
+	if len(strings.TrimSpace(input)) == 0 {
+		return
+	}
+	m.pendingMessages = append(m.pendingMessages, input)
+	if len(m.streamDeltas) > 0 {
+		m.renderStream()
+		return
+	}
+	content, _ := m.renderMessages(m.client.history)
+	m.viewport.SetContent(content)
+	m.viewport.GotoBottom()
+}
+
+// dequeue sends the queued messages until one of them waits for a response.
+// The messages of --file are done once the queue is empty and nothing is waited for.
+func (m *Model) dequeue() []tea.Cmd {
+	if !m.waiting && len(m.pendingMessages) == 0 {
+		m.bulkTotal = 0
+	}
+	var commands []tea.Cmd
+	for !m.waiting && len(m.pendingMessages) > 0 {
+		input := m.pendingMessages[0]
+		m.pendingMessages = m.pendingMessages[1:]
+		if cmd, ok := m.handleCommand(input); ok {
+			commands = append(commands, cmd)
+			continue
+		}
+		commands = append(commands, m.send(input)...)
+	}
+	return commands
+}
+
+// attach adds the files to the next message
+func (m *Model) attach(paths []string) {
+	blocks, err := resolveAttachments(paths)
+	if err != nil {
+		m.setNotice(errorStyle.Render(err.Error()))
+		return
+	}
+	m.attachments = append(m.attachments, blocks...)
+	var lines []string
+	for _, filePath := range paths {
+		lines = append(lines, "📎 "+filepath.Base(filePath)+" attached")
+	}
+	m.setNotice(strings.Join(lines, "\n"))
+}
+
+// speak returns the command reading the text aloud, replacing the current playback
+func (m *Model) speak(text string) tea.Cmd {
+	if m.cancelSpeech != nil {
+		m.cancelSpeech()
+	}
+	var ctx context.Context
+	ctx, m.cancelSpeech = context.WithCancel(context.Background())
+	m.speechID++
+	return speakCmd(ctx, m.speechID, m.client, text, m.ttsVoice)
+}
+
+// newGlamourRenderer creates new glamour Markdown renderer with given wordWrap width
+func newGlamourRenderer(wordWrap int, opts ...glamour.TermRendererOption) (*glamour.TermRenderer, error) {
+	opts = append([]glamour.TermRendererOption{
+		glamour.WithStyles(defaultGlamourStyle()),
 		glamour.WithWordWrap(wordWrap),
-	)
+	}, opts...)
+	renderer, err := glamour.NewTermRenderer(opts...)
 	return renderer, err
 }
 
+// rendererStyle returns the option setting the style of the current theme with the code theme applied
+func (m Model) rendererStyle() glamour.TermRendererOption {
+	style, ok := themeStyles[m.themeName]
+	if !ok {
+		style = defaultGlamourStyle()
+	}
+	if len(m.codeTheme) > 0 {
+		if opt, err := ApplyCodeTheme(style, m.codeTheme); err == nil {
+			return opt
+		}
+	}
+	return glamour.WithStyles(style)
+}
+
+// wordWrapWidth returns the width at which the Markdown of the viewport is wrapped.
+// The margin leaves room for the padding of the rendered blocks.
+func wordWrapWidth(viewportWidth, margin int) int {
+	return max(viewportWidth-margin, minWordWrapWidth)
+}
+
+// setRenderer creates the renderers of the current theme for the width of the viewport.
+// Code blocks are not wrapped if horizontal scrolling is enabled.
+func (m *Model) setRenderer() error {
+	wordWrap := 0
+	if !m.noWordWrap {
+		wordWrap = wordWrapWidth(m.viewport.Width, m.wordWrapMargin)
+	}
+	renderer, err := newGlamourRenderer(wordWrap, m.rendererStyle())
+	if err != nil {
+		return err
+	}
+	m.renderer, m.codeRenderer = renderer, nil
+	// the stream rendered so far was wrapped for the previous renderer
+	m.resetStreamRender()
+	if m.hscroll {
+		if m.codeRenderer, err = newGlamourRenderer(0, m.rendererStyle()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cycleTheme switches to the next theme of themeOrder and re-renders the conversation
+func (m *Model) cycleTheme() {
+	next := 0
+	for i, name := range themeOrder {
+		if name == m.themeName {
+			next = (i + 1) % len(themeOrder)
+		}
+	}
+	m.themeName = themeOrder[next]
+
+	if err := m.setRenderer(); err != nil {
+		m.err = err
+		return
+	}
+	if !m.waiting {
+		content, _ := m.renderMessages(m.client.history)
+		m.viewport.SetContent(content)
+	}
+}
+
+// defaultGlamourStyle returns the style matching the terminal background
+func defaultGlamourStyle() ansi.StyleConfig {
+	if hasDarkBackground() {
+		return DarkStyleConfig
+	}
+	return LightStyleConfig
+}
+
 // newTextArea creates a text area model
 func newTextArea() textarea.Model {
 	t := textarea.New()
@@ -266,36 +1564,149 @@ func newTextArea() textarea.Model {
 	t.FocusedStyle.Base = textAreaStyle
 	t.ShowLineNumbers = false
 	t.KeyMap.DeleteCharacterBackward = key.NewBinding(key.WithKeys("backspace"))
+	t.KeyMap.LineNext = key.NewBinding(key.WithKeys("down"))
+	t.KeyMap.LinePrevious = key.NewBinding(key.WithKeys("up"))
+	t.KeyMap.DeleteWordBackward = key.NewBinding(key.WithKeys("alt+backspace"))
+	t.KeyMap.TransposeCharacterBackward = key.NewBinding(key.WithDisabled())
+	t.KeyMap.DeleteAfterCursor = key.NewBinding(key.WithDisabled())
 	t.Blur()
 	return t
 }
 
+// newClientFromConfig creates the Client configured by the chat flags
+func newClientFromConfig() (*Client, error) {
+	system := viper.GetString("system")
+	if missing := missingEnvVars(system); viper.GetBool("strict-env") && len(missing) > 0 {
+		return nil, fmt.Errorf("environment variables of the system message are not set: %s", strings.Join(missing, ", "))
+	}
+	client := NewChatClient(
+		viper.GetString("openai-api-base"),
+		viper.GetString("openai-api-key"),
+		viper.GetString("model"),
+		expandEnvVars(system),
+		viper.GetBool("stream"),
+		viper.GetInt("max-context-length"),
+	)
+	client.maxTokens = viper.GetInt("max-tokens")
+	client.temperature = float32(viper.GetFloat64("temperature"))
+	client.whisperModel = viper.GetString("whisper-model")
+	client.contextPrefix = viper.GetString("context-prefix")
+	client.contextSuffix = viper.GetString("context-suffix")
+	switch format := viper.GetString("stream-format"); format {
+	case streamFormatAuto, streamFormatSSE, streamFormatNDJSON, "":
+		client.streamFormat = format
+	default:
+		return nil, fmt.Errorf("unknown stream format %q", format)
+	}
+	switch backend := viper.GetString("backend"); backend {
+	case "openai", "":
+	case "llamacpp":
+		client.backend = &LlamaCppBackend{ModelPath: viper.GetString("model-path")}
+		client.stream = true
+	case "assistant":
+		client.backend = NewAssistantBackend(client, viper.GetString("assistant-id"), viper.GetString("thread-id"))
+		client.stream = true
+	default:
+		return nil, fmt.Errorf("unknown backend %q", backend)
+	}
+	return client, nil
+}
+
+// exitOnError logs the error of the configuration and exits. The error is printed too,
+// as the logger discards the records unless a log file is set.
+func exitOnError(msg string, err error, args ...any) {
+	logger.Error(msg, append(args, "error", err)...)
+	fmt.Fprintf(os.Stderr, "error: %s: %v\n", msg, err)
+	os.Exit(1)
+}
+
 // NewModel creates a new chat tui model
 func NewModel() Model {
+	startTime := timeNow()
 	ta := newTextArea()
 	ta.SetWidth(50)
 	ta.SetHeight(textAreaHeight)
 	ta.Focus()
 
-	// read message from flag or pipe
+	// read message from flag or pipe, or restore the draft of the previous session
+	var notice string
+	saveDrafts := !viper.GetBool("no-draft")
 	if msg := viper.GetString("message"); len(msg) > 0 {
 		ta.SetValue(msg)
+	} else if saveDrafts {
+		if draftFile, draft := findDraft(); len(draftFile) > 0 {
+			ta.SetValue(draft)
+			// the draft belongs to this session now
+			if err := os.Remove(draftFile); err != nil {
+				logger.Warn("failed to remove draft", "path", draftFile, "error", err)
+			}
+			notice = "📝 Draft restored from previous session"
+		}
 	}
 
 	chatModel := viper.GetString("model")
+	tokenCounter, err := NewTokenCounter(chatModel)
+	if err != nil {
+		exitOnError("failed to load tokenizer", err, "model", chatModel)
+	}
+
+	// attach the files of the workspace, watching them for changes
+	var workspace WorkspaceLoader
+	var attached workspaceAttachments
+	if dir := viper.GetString("workspace-dir"); len(dir) > 0 {
+		// the attachments leave a quarter of the context to the question and the system message
+		maxContextLength := viper.GetInt("max-context-length")
+		workspace = WorkspaceLoader{
+			Dir:         dir,
+			Extensions:  viper.GetStringSlice("workspace-ext"),
+			MaxFiles:    viper.GetInt("workspace-max-files"),
+			MaxFileSize: viper.GetInt64("workspace-max-file-size"),
+			MaxTokens:   max(maxContextLength*3/4-tokenCounter.Count(viper.GetString("system")), 1),
+			Counter:     tokenCounter,
+		}
+		if attached, err = workspace.load(); err != nil {
+			exitOnError("failed to load workspace", err, "path", dir)
+		}
+		notice = fmt.Sprintf("📎 %d files of %s attached", len(attached.files), dir)
+		if len(attached.binary) > 0 {
+			notice += "\n" + warnStyle.Render(fmt.Sprintf("⚠ %d binary files skipped: %s", len(attached.binary), strings.Join(attached.binary, ", ")))
+		}
+		if len(attached.overBudget) > 0 {
+			notice += "\n" + warnStyle.Render(fmt.Sprintf("⚠ %d files skipped, they do not fit in --max-context-length %d: %s",
+				len(attached.overBudget), maxContextLength, strings.Join(attached.overBudget, ", ")))
+		}
+	}
+
 	baseURL := viper.GetString("openai-api-base")
-	token := viper.GetString("openai-api-key")
-	system := viper.GetString("system")
 	history := viper.GetString("history")
-	maxContextLength := viper.GetInt("max-context-length")
 	stream := viper.GetBool("stream")
 
-	sessionId := time.Now().Format("2006-01-02_15-04-05")
+	now := time.Now()
+	historyDir, err := HistoryDir()
+	if err != nil {
+		exitOnError("failed to find the history directory", err)
+	}
+	sessionName := viper.GetString("session-name")
+	sessionPath, err := resolveSessionPath(historyDir, viper.GetString("session-name-pattern"), sessionName, now)
+	if err != nil {
+		exitOnError("invalid session name", err)
+	}
+	sessionId := sessionIDFromPath(sessionPath)
+	if len(sessionName) == 0 {
+		sessionName = now.Format(viper.GetString("session-name-pattern"))
+	}
+	// offer to resume the session of the same name instead of starting the suffixed one,
+	// e.g. the session of the day with the pattern 2006-01-02
+	var pendingResume string
+	if resumePath := path.Join(historyDir, sessionName+".json"); len(history) == 0 && resumePath != sessionPath {
+		pendingResume = resumePath
+	}
 
-	welcomeMessage := fmt.Sprintf("%s\n\n%s\n%s",
-		"ChatGPT Terminal UI",
-		helpStyle.Render("Model: "+chatModel+"\n"),
-		"Type a message and press Enter to send.")
+	welcomeMessage := welcomeText(viper.GetString("version"), chatModel, baseURL, stream)
+	if len(notice) > 0 {
+		welcomeMessage += "\n\n" + notice
+	}
+	animating := viper.GetBool("welcome-animation") || isFirstLaunch()
 
 	// init viewport where the conversations will be displayed
 	vp := viewport.New(50, 10)
@@ -303,67 +1714,318 @@ func NewModel() Model {
 
 	s := spinner.New(spinner.WithStyle(spinnerStyle))
 
-	client := NewChatClient(baseURL, token, chatModel, system, stream, maxContextLength)
+	if modelInfoFile := viper.GetString("model-info-file"); len(modelInfoFile) > 0 {
+		if err := loadModelInfoFile(modelInfoFile); err != nil {
+			exitOnError("failed to load model info", err, "path", modelInfoFile)
+		}
+	}
+
+	codeTheme := viper.GetString("code-theme")
+	if len(codeTheme) > 0 {
+		if _, err := ApplyCodeTheme(defaultGlamourStyle(), codeTheme); err != nil {
+			exitOnError("failed to apply code theme", err, "theme", codeTheme)
+		}
+	}
+	themeName := "light"
+	if hasDarkBackground() {
+		themeName = "dark"
+	}
+
+	var spellChecker *SpellChecker
+	if viper.GetBool("spell-check") {
+		dictFile := viper.GetString("dict-file")
+		if spellChecker, err = loadSpellChecker(dictFile); err != nil {
+			exitOnError("failed to load dictionary", err, "path", dictFile)
+		}
+	}
+
+	var prompts *PromptLibrary
+	if promptLibrary := viper.GetString("prompt-library"); len(promptLibrary) > 0 {
+		if prompts, err = LoadPromptLibrary(promptLibrary); err != nil {
+			exitOnError("failed to load prompt library", err, "path", promptLibrary)
+		}
+	}
+
+	var plugins []Plugin
+	if pluginsDir := viper.GetString("plugins-dir"); len(pluginsDir) > 0 {
+		// the plugins which loaded are usable, the others are only reported
+		var pluginsErr error
+		if plugins, pluginsErr = LoadPlugins(pluginsDir); pluginsErr != nil {
+			logger.Warn("failed to load plugins", "path", pluginsDir, "error", pluginsErr)
+			notice = warnStyle.Render("⚠ " + strings.ReplaceAll(pluginsErr.Error(), "\n", "\n⚠ "))
+		}
+	}
+
+	client, err := newClientFromConfig()
+	if err != nil {
+		exitOnError("failed to create client", err)
+	}
+	if attached.watcher != nil {
+		system := workspace.SystemMessage(attached.files)
+		if len(client.system) > 0 {
+			system += "\n\n" + client.system
+		}
+		client.system = system
+	}
+	separator := viper.GetString("separator")
+	if style := viper.GetString("separator-style"); len(separator) == 0 && len(style) > 0 {
+		var ok bool
+		if separator, ok = separatorStyles[style]; !ok {
+			err := fmt.Errorf("unknown separator style %q, available: line, dots, arrows", style)
+			exitOnError("invalid separator style", err)
+		}
+	}
+	var bulkMessages []string
+	if filePath := viper.GetString("file"); len(filePath) > 0 {
+		if bulkMessages, err = LoadMessages(filePath, viper.GetString("file-delimiter")); err != nil {
+			exitOnError("failed to read messages", err, "path", filePath)
+		}
+	}
+	var sessions []SessionPane
+	if n := viper.GetInt("multi-session"); n > 1 {
+		if sessions, err = newSessionPanes(n, viper.GetStringSlice("multi-system")); err != nil {
+			exitOnError("failed to create sessions", err)
+		}
+	}
+	var images *InlineImageRenderer
+	if viper.GetBool("inline-images") {
+		images = NewInlineImageRenderer(detectImageProtocol(os.Getenv))
+	}
+	var responseCache *ResponseCache
+	if ttl := viper.GetDuration("cache-ttl"); ttl > 0 {
+		responseCache = NewResponseCache(ttl)
+	}
 	m := Model{
-		textarea:  ta,
-		viewport:  vp,
-		spinner:   s,
-		help:      help.New(),
-		keys:      keys,
-		sessionId: sessionId,
-		client:    client,
+		textarea:            ta,
+		viewport:            vp,
+		spinner:             s,
+		help:                help.New(),
+		keys:                keys,
+		sessionId:           sessionId,
+		createdAt:           now,
+		client:              client,
+		cache:               &messageCache{images: images},
+		tokenCounter:        tokenCounter,
+		tokens:              &tokenCache{},
+		showLineNumbers:     viper.GetBool("line-numbers"),
+		tts:                 viper.GetBool("tts"),
+		ttsVoice:            viper.GetString("tts-voice"),
+		imageSize:           viper.GetString("image-size"),
+		imageN:              viper.GetInt("image-n"),
+		compactThreshold:    viper.GetInt("compact-threshold"),
+		crashReport:         findCrashReport(),
+		showContextBar:      !viper.GetBool("no-context-bar"),
+		showHeader:          !viper.GetBool("no-header"),
+		tokenWarnAt:         viper.GetInt("token-warn-at"),
+		windowTitle:         !viper.GetBool("no-window-title") && windowTitleSupported(os.Getenv),
+		duplicateCheck:      !viper.GetBool("no-duplicate-check"),
+		hscroll:             !viper.GetBool("no-hscroll"),
+		allowGoEval:         viper.GetBool("allow-go-eval"),
+		warnInputTokens:     viper.GetInt("warn-input-tokens"),
+		mdnsDiscover:        viper.GetBool("mdns-discover"),
+		saveDrafts:          saveDrafts,
+		wordWrapMargin:      viper.GetInt("word-wrap-margin"),
+		maxHistoryMemory:    viper.GetInt("max-history-memory"),
+		noWordWrap:          viper.GetBool("no-word-wrap"),
+		separator:           separator,
+		spellChecker:        spellChecker,
+		autoMultilinePaste:  viper.GetBool("auto-multiline-paste"),
+		responseCache:       responseCache,
+		images:              images,
+		expectedLang:        strings.ToLower(viper.GetString("expected-lang")),
+		notice:              notice,
+		welcome:             welcomeMessage,
+		version:             viper.GetString("version"),
+		animating:           animating,
+		fallbackModel:       viper.GetString("fallback-model"),
+		themeName:           themeName,
+		codeTheme:           codeTheme,
+		streamFlushInterval: viper.GetDuration("stream-flush-interval"),
+		mentionList:         newMentionList(),
+		pendingMessages:     bulkMessages,
+		bulkTotal:           len(bulkMessages),
+		startTime:           startTime,
+		sessions:            sessions,
+		benchmarkStartup:    viper.GetBool("benchmark-startup"),
+		bell:                viper.GetBool("bell"),
+		personas:            viper.GetStringMapString("persona"),
+		prompts:             prompts,
+		plugins:             plugins,
+		attachments:         attached.blocks,
+		workspace:           attached.watcher,
+		pendingResume:       pendingResume,
+	}
+	if len(pendingResume) > 0 {
+		m.notice = warnStyle.Render(fmt.Sprintf("⚠ Session %s exists. Resume it? [y/N]", sessionName))
 	}
 
 	// restore history if necessary
 	if len(history) > 0 {
 		err := m.loadHistory(history)
 		if err != nil {
-			log.Fatal(err)
+			exitOnError("failed to load history", err, "path", history)
 		}
-		fileName := path.Base(history)
-		m.sessionId = strings.TrimSuffix(fileName, path.Ext(fileName))
 	}
 	return m
 }
 
 // newCompletionRequest creates new CompletionRequest
-func newCompletionRequest(client *Client) *CompletionRequest {
+// Only the messages of the history at the selected indices are sent, unless selected is nil.
+func newCompletionRequest(client *Client, counter *TokenCounter, selected map[int]bool) *CompletionRequest {
+	history := selectHistory(client.history, selected)
 	var messages []Message
 	totalTokenCount := 0
 
 	// add system message if specified
 	if len(client.system) > 0 {
 		messages = append(messages, Message{Role: "system", Content: client.system})
-		totalTokenCount += countTokens(client.system)
+		totalTokenCount += counter.Count(client.system)
 	}
 
-	// append previous conversations from history
+	// system messages of the history are sent first, regardless of their position
+	for _, message := range history {
+		if message.Role == "system" {
+			messages = append(messages, message)
+			totalTokenCount += counter.Count(message.Content)
+		}
+	}
+
+	// append previous conversations from history, the latest message is sent even if it does not fit
 	var i int
-	for i = len(client.history) - 1; i >= 0; i-- {
-		if client.history[i].Role == "system" {
-			break
+	latest := true
+	for i = len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "system" {
+			continue
 		}
-		tokenCount := countTokens(client.history[i].Content)
-		if totalTokenCount+tokenCount <= client.maxContextLength {
+		tokenCount := counter.Count(history[i].Content)
+		if totalTokenCount+tokenCount <= client.maxContextLength || latest {
+			latest = false
 			totalTokenCount += tokenCount
 		} else {
 			break
 		}
 	}
 
-	messages = append(messages, client.history[i+1:]...)
-	return &CompletionRequest{Model: client.model, Messages: messages}
+	for _, message := range history[i+1:] {
+		switch message.Role {
+		case "system":
+			continue
+		case "user":
+			message.Content = injectContext(client, message.Content)
+		}
+		messages = append(messages, message)
+	}
+	return &CompletionRequest{Model: client.model, Messages: messages, MaxTokens: client.maxTokens, Temperature: client.temperature}
+}
+
+// injectContext adds the context prefix and suffix of the client to the content of a user message
+func injectContext(client *Client, content string) string {
+	parts := []string{content}
+	if len(client.contextPrefix) > 0 {
+		parts = append([]string{client.contextPrefix}, parts...)
+	}
+	if len(client.contextSuffix) > 0 {
+		parts = append(parts, client.contextSuffix)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// sendCompletion renders the current history and returns the commands
+// that send the completion request for it
+func (m *Model) sendCompletion() []tea.Cmd {
+	content, _ := m.renderMessages(m.client.history)
+	m.viewport.SetContent(content)
+	m.viewport.GotoBottom()
+
+	// the selection applies to one request, the message being answered is always sent
+	if m.selectedMessages != nil {
+		m.selectedMessages[len(m.client.history)-1] = true
+	}
+	req := newCompletionRequest(m.client, m.tokenCounter, m.selectedMessages)
+	m.selectedMessages = nil
+	m.resetStreamRender()
+	m.cached = false
+	m.pendingCacheKey = ""
+	if m.responseCache != nil {
+		if key, err := cacheKey(req); err != nil {
+			logger.Warn("failed to compute cache key", "error", err)
+		} else if resp, ok := m.responseCache.Get(key); ok {
+			logger.Debug("serving cached response", "key", key)
+			return []tea.Cmd{func() tea.Msg { return cachedMsg{resp: resp} }, m.startWaiting()}
+		} else {
+			m.pendingCacheKey = key
+		}
+	}
+	commands := []tea.Cmd{createCompletionCmd(m.client, req, m.fallbackModel)}
+	if m.client.stream {
+		commands = append(commands, waitEventsCmd(m.client))
+	}
+	// set waiting to true so spinner will be visible
+	commands = append(commands, m.startWaiting())
+	return commands
+}
+
+// imagesRenderedMsg is sent when the queued images have been rendered
+type imagesRenderedMsg struct{}
+
+// rateLimitResetMsg is sent when the request rate limit resets
+type rateLimitResetMsg struct{}
+
+// waitRateLimitCmd returns a tea.Cmd which receives the rate limits of the next response
+func waitRateLimitCmd(client *Client) tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case info := <-client.rateLimits:
+			return info
+		case <-client.done:
+			return nil
+		}
+	}
+}
+
+// rateLimited reports whether sending is disabled until the request rate limit resets
+func (m Model) rateLimited() bool {
+	return m.rateLimit != nil && m.rateLimit.rateLimited(time.Now())
+}
+
+// rateLimitedView returns the time sending is disabled until
+func (m Model) rateLimitedView() string {
+	return "⏱ Rate limited until " + m.rateLimit.ResetRequests.Local().Format(time.TimeOnly)
+}
+
+// cachedMsg is sent instead of a completion request if the response of the request is cached
+type cachedMsg struct {
+	resp *CompletionResponse
+}
+
+// cacheResponse stores the response for the request sent last, if caching is enabled
+func (m *Model) cacheResponse(resp CompletionResponse) {
+	if m.responseCache == nil || m.cached || len(m.pendingCacheKey) == 0 {
+		return
+	}
+	m.responseCache.Set(m.pendingCacheKey, resp)
+	m.pendingCacheKey = ""
+}
+
+// fallbackMsg is sent when the completion was created with the fallback model
+type fallbackMsg struct {
+	model string
+	resp  *CompletionResponse
 }
 
 // createCompletionCmd returns a tea.Cmd which constructs the CompletionRequest
 // and returns CompletionResponse if stream is set to false
-func createCompletionCmd(client *Client, req *CompletionRequest) tea.Cmd {
+func createCompletionCmd(client *Client, req *CompletionRequest, fallback string) tea.Cmd {
 	return func() tea.Msg {
+		model := req.Model
 		// Blocking call to send completion request
-		resp, err := client.CreateCompletion(req)
+		resp, err := client.CreateCompletionWithFallback(req, fallback)
 		if err != nil {
 			return err
 		}
+		if req.Model != model {
+			return fallbackMsg{model: req.Model, resp: resp}
+		}
 
 		// Return CompletionResponse if stream set to false
 		if !client.stream && resp != nil {
@@ -377,7 +2039,12 @@ func createCompletionCmd(client *Client, req *CompletionRequest) tea.Cmd {
 // Returns the value when received from the channel
 func waitEventsCmd(client *Client) tea.Cmd {
 	return func() tea.Msg {
-		return <-client.events
+		select {
+		case event := <-client.events:
+			return event
+		case <-client.done:
+			return nil
+		}
 	}
 }
 
@@ -387,29 +2054,90 @@ func (m Model) renderMessages(messages []Message) (string, error) {
 
 	user := senderStyle.Render(userName) + "\n"
 	chat := chatStyle.Render(chatGPTName) + "\n"
+	system := helpStyle.Render(systemName) + "\n"
 
-	for _, message := range messages {
-		output, err := m.renderer.Render(message.Content)
+	cache := m.cache
+	if cache == nil {
+		cache = &messageCache{}
+	}
+	// the system message of the client is sent before the history
+	if len(m.client.system) > 0 || m.editingSystem {
+		label := system
+		if m.editingSystem {
+			label = helpStyle.Render(systemName) + " " + warnStyle.Render("[editing]") + "\n"
+		}
+		renderedMessages = append(renderedMessages, label+m.renderSystemMessage(m.client.system))
+	}
+	// code blocks are numbered across the messages in navigation mode
+	codeBlocks := 0
+	// shown counts the messages rendered, the separator goes between them
+	shown := 0
+	// replies are indented under the messages they reply to
+	depths := messageTree(messages, m.historyOffset).depths()
+	for i, message := range messages {
+		if m.navigating {
+			n := len(parseCodeBlocks(message.Content))
+			if n > 0 {
+				message.Content = collapseCodeBlocks(message.Content, codeBlocks, m.expandedBlocks, m.codeCursor)
+			}
+			codeBlocks += n
+		}
+		output, err := cache.render(m.renderer, m.codeRenderer, i, message)
 		if err != nil {
-			return "", err
+			logger.Warn("falling back to plain text", "error", err)
 		}
 		var author string
 		switch message.Role {
+		case "system":
+			author = system
+			output = m.renderSystemMessage(message.Content)
 		case "user":
 			author = user
 		case "assistant":
 			author = chat
+			if m.lastTruncated && i == len(messages)-1 {
+				output += warnStyle.Render(truncatedHint) + "\n"
+			}
+			if m.showDiff && len(m.prevResponse) > 0 && i == len(m.client.history)-1 {
+				output = renderDiff(m.prevResponse, message.Content, m.viewport.Width) + "\n"
+			}
+			if m.langMismatch && messageID(m.historyOffset+i) == m.langMessageID {
+				output = langMismatchStyle.Width(max(m.viewport.Width-langMismatchStyle.GetHorizontalBorderSize(), 0)).Render(strings.Trim(output, "\n")) + "\n"
+			}
 		default:
 			continue
 		}
-		output = author + output
+		if i < len(m.client.history) {
+			if m.selectedMessages != nil {
+				author = m.selectionCheckbox(i) + author
+			}
+			if m.annotating && i == m.noteCursor {
+				author = senderStyle.Render("▸ ") + author
+			}
+			output += m.renderRating(i) + m.renderNote(i)
+		}
+		output = indentReply(author+output, depths[i])
+		if len(m.separator) > 0 && shown > 0 {
+			renderedMessages = append(renderedMessages, lipgloss.NewStyle().Width(m.viewport.Width).Align(lipgloss.Center).Render(m.separator)+"\n")
+		}
+		shown++
 		renderedMessages = append(renderedMessages, output)
 	}
-	return strings.Join(renderedMessages, "\n"), nil
+	for _, input := range m.pendingMessages {
+		renderedMessages = append(renderedMessages, helpStyle.Render(userName+" (queued)")+"\n"+helpStyle.Render(input)+"\n")
+	}
+	if len(m.notice) > 0 {
+		renderedMessages = append(renderedMessages, m.notice+"\n")
+	}
+	content := strings.Join(renderedMessages, "\n")
+	if m.showLineNumbers {
+		content = addLineNumbers(content, m.viewport.Width)
+	}
+	return content, nil
 }
 
 // loadHistory reads conversation history from a JSON file
-func (m Model) loadHistory(filePath string) error {
+func (m *Model) loadHistory(filePath string) error {
 	// handle path starts with "~/"
 	if strings.HasPrefix(filePath, "~/") {
 		homeDir, err := os.UserHomeDir()
@@ -423,41 +2151,108 @@ func (m Model) loadHistory(filePath string) error {
 			return err
 		}
 	}
-	data, err := os.ReadFile(filePath)
+	session, loader, err := sessionStorage.open(filePath, historyPageSize)
 	if err != nil {
 		return err
 	}
-	err = json.Unmarshal(data, &m.client.history)
-	if err != nil {
-		return err
+	m.historyLoader = loader
+	m.historyOffset = len(loader.ends) - len(session.Messages)
+	m.client.history = session.Messages
+	m.parseLastResponse()
+	m.sessionId = session.ID
+	m.createdAt = session.CreatedAt
+	m.pinned = session.Pinned
+	m.title = session.Title
+	m.tags = session.Tags
+	m.notes = session.Notes
+	m.ratings = session.Ratings
+	if changes := session.Metadata.changes(m.metadata()); len(changes) > 0 {
+		m.pendingMetadata = &session.Metadata
+		m.notice = warnStyle.Render(fmt.Sprintf("⚠ Session was created with %s. Switch to it? [y/N]", strings.Join(changes, ", ")))
 	}
 	return nil
 }
 
-// saveHistory saves chat history to JSON file
-func (m Model) saveHistory() error {
-	homeDir, err := os.UserHomeDir()
+// metadata returns the current settings to save with the session
+func (m Model) metadata() SessionMetadata {
+	return SessionMetadata{
+		Model:        m.client.model,
+		BaseURL:      m.client.baseURL,
+		Temperature:  m.client.temperature,
+		SystemPrompt: m.client.system,
+		GptUIVersion: m.version,
+	}
+}
+
+// applyMetadata switches to the recorded settings of a session
+func (m *Model) applyMetadata(md SessionMetadata) {
+	if len(md.Model) > 0 {
+		m.client.model = md.Model
+	}
+	if len(md.BaseURL) > 0 && md.BaseURL != m.client.baseURL {
+		m.client.setBaseURL(md.BaseURL)
+	}
+	if len(md.SystemPrompt) > 0 {
+		m.client.system = md.SystemPrompt
+	}
+	m.client.temperature = md.Temperature
+}
+
+// historyPath returns the path of the session file, creating the history directory
+func (m Model) historyPath() (string, error) {
+	dir, err := HistoryDir()
 	if err != nil {
-		return err
+		return "", err
 	}
-	// TODO: make the history path configurable
-	dir := path.Join(homeDir, ".config", "gptui", "chat")
 
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		err = os.MkdirAll(dir, 0755)
 		if err != nil {
-			return err
+			return "", err
 		}
 	}
-	filepath := path.Join(dir, fmt.Sprintf("%s.json", m.sessionId))
-	data, err := json.Marshal(m.client.history)
+	return path.Join(dir, fmt.Sprintf("%s.json", m.sessionId)), nil
+}
+
+// saveHistory saves chat history to JSON file
+func (m Model) saveHistory() error {
+	filepath, err := m.historyPath()
 	if err != nil {
 		return err
 	}
+	session := &Session{
+		ID:        m.sessionId,
+		CreatedAt: m.createdAt,
+		Title:     m.title,
+		Pinned:    m.pinned,
+		Metadata:  m.metadata(),
+		Tags:      m.tags,
+		Notes:     m.notes,
+		Ratings:   m.ratings,
+		Messages:  m.client.history,
+	}
+	// keep the older messages which are not loaded yet
+	return sessionStorage.save(filepath, session, m.historyLoader, m.historyOffset)
+}
 
-	err = os.WriteFile(filepath, data, 0644)
+// loadOlderMessages prepends the previous page of messages from the session file
+func (m *Model) loadOlderMessages() error {
+	return m.loadMessagesFrom(max(m.historyOffset-historyPageSize, 0))
+}
+
+// loadMessagesFrom prepends the messages of the session file from index from to the loaded ones
+func (m *Model) loadMessagesFrom(from int) error {
+	older, err := sessionStorage.messages(m.historyLoader, from, m.historyOffset)
 	if err != nil {
 		return err
 	}
+	m.client.history = append(older, m.client.history...)
+	m.historyOffset = from
+
+	// keep the current messages in place after prepending
+	lines := m.viewport.TotalLineCount()
+	content, _ := m.renderMessages(m.client.history)
+	m.viewport.SetContent(content)
+	m.viewport.SetYOffset(m.viewport.TotalLineCount() - lines)
 	return nil
 }
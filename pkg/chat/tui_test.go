@@ -0,0 +1,857 @@
+package chat
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestModel creates a Model which can be updated without a terminal
+func newTestModel(t *testing.T) Model {
+	renderer, err := newGlamourRenderer(80)
+	assert.NoError(t, err)
+	return Model{
+		client:   NewChatClient("http://localhost", "token", "gpt-3.5-turbo", "", true, 1024),
+		viewport: viewport.New(80, 20),
+		renderer: renderer,
+		cache:    &messageCache{},
+	}
+}
+
+// inputModel runs a Model in a tea.Program until it receives quitInputMsg
+type inputModel struct {
+	Model
+}
+
+type quitInputMsg struct{}
+
+func (m inputModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m inputModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if _, ok := msg.(quitInputMsg); ok {
+		return m, tea.Quit
+	}
+	model, cmd := m.Model.Update(msg)
+	return inputModel{model.(Model)}, cmd
+}
+
+// inputReader returns the input at once, like a terminal returns pasted text,
+// and closes done when the program reads past its end
+type inputReader struct {
+	input string
+	done  chan struct{}
+}
+
+func (r *inputReader) Read(p []byte) (int, error) {
+	if len(r.input) == 0 {
+		close(r.done)
+		return 0, io.EOF
+	}
+	n := copy(p, r.input)
+	r.input = r.input[n:]
+	return n, nil
+}
+
+// runInput runs the model on the bytes of the terminal input, so that they are
+// parsed into messages by bubbletea, and returns the updated model
+func runInput(t *testing.T, m Model, input string) Model {
+	reader := &inputReader{input: input, done: make(chan struct{})}
+	p := tea.NewProgram(inputModel{m}, tea.WithInput(reader), tea.WithOutput(io.Discard), tea.WithoutSignalHandler())
+	go func() {
+		<-reader.done
+		// let the commands of the last keys run
+		time.Sleep(4 * pasteInterval)
+		p.Send(quitInputMsg{})
+	}()
+	model, err := p.Run()
+	require.NoError(t, err)
+	return model.(inputModel).Model
+}
+
+func TestUpdate_StreamFlushBatches(t *testing.T) {
+	m := newTestModel(t)
+	m.streamFlushInterval = 50 * time.Millisecond
+	m.waiting = true
+
+	for i := 0; i < 100; i++ {
+		delta := CompletionStreamResponse{Choices: []CompletionStreamChoice{{Delta: CompletionStreamDelta{Content: fmt.Sprintf("%d ", i)}}}}
+		model, _ := m.Update(delta)
+		m = model.(Model)
+	}
+
+	// deltas are buffered until the flush
+	assert.Len(t, m.streamBuffer, 100)
+	assert.True(t, m.flushScheduled)
+	assert.Empty(t, m.streamDeltas)
+	assert.NotContains(t, m.viewport.View(), "99")
+
+	model, _ := m.Update(flushStreamMsg{})
+	m = model.(Model)
+	assert.Empty(t, m.streamBuffer)
+	assert.False(t, m.flushScheduled)
+	assert.Contains(t, m.streamDeltas, "0 1 2")
+	assert.Contains(t, m.viewport.View(), "99")
+}
+
+func TestUpdate_StreamSkipsDuplicateEvents(t *testing.T) {
+	defer func(delay time.Duration) { streamReconnectDelay = delay }(streamReconnectDelay)
+	streamReconnectDelay = 0
+	// the connection drops after the second event
+	interrupted := "" +
+		"id: 1\ndata: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n" +
+		"id: 2\ndata: {\"choices\":[{\"delta\":{\"content\":\" world\"}}]}\n\n"
+	// the server resends the events from the start after the reconnect
+	resumed := "" +
+		"id: 1\ndata: {\"choices\":[{\"delta\":{\"content\":\"Hello\"}}]}\n\n" +
+		"id: 2\ndata: {\"choices\":[{\"delta\":{\"content\":\" world\"}}]}\n\n" +
+		"id: 3\ndata: {\"choices\":[{\"delta\":{\"content\":\"!\"}}]}\n\n" +
+		"data: [DONE]\n\n"
+	var lastEventIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		if len(lastEventIDs) == 1 {
+			w.Write([]byte(interrupted))
+			return
+		}
+		w.Write([]byte(resumed))
+	}))
+	defer server.Close()
+
+	m := newTestModel(t)
+	m.client = NewChatClient(server.URL, "token", "gpt-3.5-turbo", "", true, 1024)
+	m.waiting = true
+	errs := make(chan error)
+	go func() {
+		_, err := m.client.CreateCompletion(&CompletionRequest{Model: "gpt-3.5-turbo"})
+		errs <- err
+	}()
+
+	for i := 0; i < 3; i++ {
+		model, _ := m.Update(<-m.client.events)
+		m = model.(Model)
+	}
+	assert.NoError(t, <-errs)
+	assert.Equal(t, "Hello world!", m.streamDeltas)
+	assert.Equal(t, []string{"", "2"}, lastEventIDs)
+}
+
+func TestCreateCompletion_StreamWithoutEventIDs(t *testing.T) {
+	stream := "" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"ha\"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"ha\"}}]}\n\n" +
+		"data: [DONE]\n\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(stream))
+	}))
+	defer server.Close()
+
+	client := NewChatClient(server.URL, "token", "gpt-3.5-turbo", "", true, 1024)
+	errs := make(chan error)
+	go func() {
+		_, err := client.CreateCompletion(&CompletionRequest{Model: "gpt-3.5-turbo"})
+		errs <- err
+	}()
+
+	// identical events without IDs are numbered and not skipped
+	assert.Equal(t, "ha", (<-client.events).Choices[0].Delta.Content)
+	assert.Equal(t, "ha", (<-client.events).Choices[0].Delta.Content)
+	assert.NoError(t, <-errs)
+}
+
+func TestCreateCompletion_MalformedEvent(t *testing.T) {
+	stream := "" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\"}]}\n\n" +
+		"data: [DONE]\n\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(stream))
+	}))
+	defer server.Close()
+
+	client := NewChatClient(server.URL, "token", "gpt-3.5-turbo", "", true, 1024)
+	errs := make(chan error)
+	go func() {
+		_, err := client.CreateCompletion(&CompletionRequest{Model: "gpt-3.5-turbo"})
+		errs <- err
+	}()
+
+	// the events after the malformed one are still sent
+	assert.Equal(t, "Hel", (<-client.events).Choices[0].Delta.Content)
+	assert.Equal(t, "lo", (<-client.events).Choices[0].Delta.Content)
+	err := <-errs
+	var streamErr *StreamError
+	require.ErrorAs(t, err, &streamErr)
+	assert.Len(t, streamErr.Errors, 1)
+	assert.EqualError(t, err, "1 stream events were malformed and skipped")
+
+	// the TUI shows a warning instead of the error screen
+	m := newTestModel(t)
+	model, _ := m.Update(err)
+	m = model.(Model)
+	assert.NoError(t, m.err)
+	assert.Contains(t, m.viewport.View(), "⚠ 1 stream events were malformed and skipped")
+}
+
+func TestUpdate_MalformedFinishEvent(t *testing.T) {
+	setTestHome(t)
+	stream := "" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{\"content\":\"lo\"}}]}\n\n" +
+		"data: {\"choices\":[{\"delta\":{},\"finish_reason\":\n\n" +
+		"data: [DONE]\n\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(stream))
+	}))
+	defer server.Close()
+
+	m := newTestModel(t)
+	m.client = NewChatClient(server.URL, "token", "gpt-3.5-turbo", "", true, 1024)
+	m.client.history = []Message{{Role: "user", Content: "Hi"}}
+	m.waiting = true
+	errs := make(chan error)
+	go func() {
+		_, err := m.client.CreateCompletion(&CompletionRequest{Model: "gpt-3.5-turbo"})
+		errs <- err
+	}()
+
+	// the stream is complete without its finish event
+	for i := 0; i < 3 && m.waiting; i++ {
+		model, _ := m.Update(waitEventsCmd(m.client)())
+		m = model.(Model)
+	}
+	assert.False(t, m.waiting)
+	assert.Equal(t, Message{Role: "assistant", Content: "Hello"}, m.client.history[len(m.client.history)-1])
+
+	model, _ := m.Update(<-errs)
+	m = model.(Model)
+	assert.NoError(t, m.err)
+	assert.Contains(t, m.viewport.View(), "⚠ 1 stream events were malformed and skipped")
+}
+
+func TestUpdate_RetryEmptyResponse(t *testing.T) {
+	setTestHome(t)
+	responses := []string{
+		`{"choices":[]}`,
+		`{"choices":[{"message":{"role":"assistant","content":""},"finish_reason":"stop"}]}`,
+		`{"choices":[{"message":{"role":"assistant","content":"Hello!"},"finish_reason":"stop"}]}`,
+	}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(responses[min(requests, len(responses)-1)]))
+		requests++
+	}))
+	defer server.Close()
+
+	m := newTestModel(t)
+	m.textarea = newTextArea()
+	m.client = NewChatClient(server.URL, "token", "gpt-3.5-turbo", "", false, 1024)
+	// run the requests until the model stops sending them
+	run := func(cmds []tea.Cmd) {
+		for len(cmds) > 0 {
+			var next []tea.Cmd
+			for _, msg := range batchMessages(tea.Batch(cmds...)) {
+				if resp, ok := msg.(*CompletionResponse); ok {
+					model, cmd := m.Update(resp)
+					m = model.(Model)
+					next = append(next, cmd)
+				}
+			}
+			cmds = next
+		}
+	}
+
+	run(m.send("hi"))
+	assert.Equal(t, 3, requests)
+	assert.NoError(t, m.err)
+	assert.False(t, m.waiting)
+	assert.Equal(t, []Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "Hello!"}}, m.client.history)
+
+	// the error is shown after two retries
+	responses = responses[:1]
+	requests = 0
+	run(m.send("again"))
+	assert.Equal(t, 3, requests)
+	assert.EqualError(t, m.err, "empty response")
+	assert.False(t, m.waiting)
+	assert.Len(t, m.client.history, 3)
+}
+
+func TestNewCompletionRequest_InjectContext(t *testing.T) {
+	client := NewChatClient("http://localhost", "token", "gpt-3.5-turbo", "", false, 1024)
+	client.contextPrefix = "Be brief."
+	client.contextSuffix = "Reply in JSON."
+	client.history = []Message{
+		{Role: "user", Content: "List three colors"},
+		{Role: "assistant", Content: `["red","green","blue"]`},
+		{Role: "user", Content: "And three fruits"},
+	}
+
+	req := newCompletionRequest(client, nil, nil)
+	assert.Equal(t, []Message{
+		{Role: "user", Content: "Be brief.\n\nList three colors\n\nReply in JSON."},
+		{Role: "assistant", Content: `["red","green","blue"]`},
+		{Role: "user", Content: "Be brief.\n\nAnd three fruits\n\nReply in JSON."},
+	}, req.Messages)
+	assert.Equal(t, "List three colors", client.history[0].Content)
+	assert.Equal(t, "And three fruits", client.history[2].Content)
+
+	client.contextPrefix = ""
+	assert.Equal(t, "Hi\n\nReply in JSON.", injectContext(client, "Hi"))
+	client.contextSuffix = ""
+	assert.Equal(t, "Hi", injectContext(client, "Hi"))
+}
+
+func TestNewCompletionRequest_SystemMessagesFirst(t *testing.T) {
+	client := NewChatClient("http://localhost", "token", "gpt-3.5-turbo", "You are helpful.", false, 1024)
+	client.history = []Message{
+		{Role: "user", Content: "Hello"},
+		{Role: "assistant", Content: "Hi"},
+		{Role: "system", Content: "Answer in French."},
+		{Role: "user", Content: "How are you?"},
+	}
+
+	req := newCompletionRequest(client, nil, nil)
+	assert.Equal(t, []Message{
+		{Role: "system", Content: "You are helpful."},
+		{Role: "system", Content: "Answer in French."},
+		{Role: "user", Content: "Hello"},
+		{Role: "assistant", Content: "Hi"},
+		{Role: "user", Content: "How are you?"},
+	}, req.Messages)
+}
+
+func TestNewCompletionRequest_LatestMessageTooLong(t *testing.T) {
+	client := NewChatClient("http://localhost", "token", "gpt-3.5-turbo", "You are helpful.", false, 10)
+	client.history = []Message{
+		{Role: "user", Content: "Hello"},
+		{Role: "assistant", Content: "Hi"},
+		{Role: "user", Content: strings.Repeat("word ", 20)},
+	}
+
+	// the latest message is sent rather than a request without it
+	req := newCompletionRequest(client, nil, nil)
+	assert.Equal(t, []Message{
+		{Role: "system", Content: "You are helpful."},
+		{Role: "user", Content: strings.Repeat("word ", 20)},
+	}, req.Messages)
+}
+
+func TestSend_ContextTooLong(t *testing.T) {
+	m := newTestModel(t)
+	m.textarea = newTextArea()
+	m.client.system = "You are reviewing the following codebase:"
+	m.attachments = []string{"@main.go\n```go\n" + strings.Repeat("var x = 1\n", 300) + "```"}
+
+	// the message goes back to the textarea with the attachments
+	assert.Nil(t, m.send("What does it do?"))
+	assert.Empty(t, m.client.history)
+	assert.Equal(t, "What does it do?", m.textarea.Value())
+	assert.Len(t, m.attachments, 1)
+	assert.Contains(t, m.notice, "does not fit in the context")
+	assert.Contains(t, m.notice, "--max-context-length is 1024")
+
+	m.attachments = []string{"@main.go\n```go\npackage main\n```"}
+	assert.NotEmpty(t, m.send("What does it do?"))
+	assert.Equal(t, "What does it do?\n\n@main.go\n```go\npackage main\n```", m.client.history[0].Content)
+	assert.Empty(t, m.attachments)
+}
+
+func TestHandleCommand_MarkSystem(t *testing.T) {
+	setTestHome(t)
+	m := newTestModel(t)
+	m.client.history = []Message{
+		{Role: "user", Content: "Hello"},
+		{Role: "assistant", Content: "Always answer in French."},
+	}
+
+	_, ok := m.handleCommand("/mark-system 2")
+	assert.True(t, ok)
+	assert.Equal(t, "system", m.client.history[1].Role)
+	assert.Contains(t, m.viewport.View(), systemName)
+	assert.Equal(t, "system", newCompletionRequest(m.client, nil, nil).Messages[0].Role)
+
+	m.handleCommand("/mark-system 2")
+	assert.Equal(t, "assistant", m.client.history[1].Role)
+
+	m.handleCommand("/mark-system 3")
+	assert.Contains(t, m.notice, "usage")
+
+	// the previous role is kept when an older message is loaded in front
+	m.historyOffset = 1
+	m.handleCommand("/mark-system 2")
+	m.client.history = append([]Message{{Role: "user", Content: "Hi"}}, m.client.history...)
+	m.historyOffset = 0
+	m.toggleSystem(2)
+	assert.Equal(t, "assistant", m.client.history[2].Role)
+}
+
+func TestUpdate_CycleTheme(t *testing.T) {
+	m := newTestModel(t)
+	m.keys = keys
+	m.themeName = themeOrder[0]
+	m.client.history = []Message{{Role: "user", Content: "# Hello"}}
+
+	for i := 1; i <= len(themeOrder); i++ {
+		renderer := m.renderer
+		model, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlT})
+		m = model.(Model)
+		assert.Equal(t, themeOrder[i%len(themeOrder)], m.themeName)
+		assert.NotSame(t, renderer, m.renderer)
+		assert.Contains(t, m.statusView(), m.themeName)
+		assert.Contains(t, m.viewport.View(), "Hello")
+	}
+}
+
+func TestUpdate_HorizontalScroll(t *testing.T) {
+	m := newTestModel(t)
+	m.keys = keys
+	m.hscroll = true
+	m.viewport.SetContent("short\n" + strings.Repeat("x", 100))
+
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlRight})
+	m = model.(Model)
+	assert.Equal(t, hscrollStep, m.hscrollOffset)
+	assert.Contains(t, m.viewportView(), "→")
+
+	for i := 0; i < 10; i++ {
+		model, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlRight})
+		m = model.(Model)
+	}
+	assert.Equal(t, 20, m.hscrollOffset)
+	assert.NotContains(t, m.viewportView(), "→")
+
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlLeft})
+	m = model.(Model)
+	assert.Equal(t, 20-hscrollStep, m.hscrollOffset)
+}
+
+func TestUpdate_RequestQueue(t *testing.T) {
+	setTestHome(t)
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.client.history = []Message{{Role: "user", Content: "first"}}
+	m.waiting = true
+
+	for _, input := range []string{"second", "third"} {
+		m.textarea.SetValue(input)
+		model, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+		m = model.(Model)
+	}
+	assert.Len(t, m.pendingMessages, 2)
+	assert.Empty(t, m.textarea.Value())
+	assert.Contains(t, m.statusView(), "[+2 queued]")
+	assert.Contains(t, m.viewport.View(), "third")
+
+	// the next message is sent when the response is complete
+	answer := CompletionStreamResponse{Choices: []CompletionStreamChoice{{Delta: CompletionStreamDelta{Content: "Sure."}}}}
+	finish := CompletionStreamResponse{Choices: []CompletionStreamChoice{{FinishReason: "stop"}}}
+	model, _ := m.Update(answer)
+	m = model.(Model)
+	model, _ = m.Update(finish)
+	m = model.(Model)
+	assert.True(t, m.waiting)
+	assert.Len(t, m.pendingMessages, 1)
+	last := m.client.history[len(m.client.history)-1]
+	assert.Equal(t, "user", last.Role)
+	assert.Equal(t, "second", strings.TrimSpace(last.Content))
+
+	// cancelling discards the rest of the queue
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyCtrlK})
+	m = model.(Model)
+	assert.Empty(t, m.pendingMessages)
+	assert.NotContains(t, m.statusView(), "queued")
+
+	model, _ = m.Update(answer)
+	m = model.(Model)
+	model, _ = m.Update(finish)
+	m = model.(Model)
+	assert.False(t, m.waiting)
+	assert.Equal(t, "assistant", m.client.history[len(m.client.history)-1].Role)
+}
+
+func TestUpdate_EmptyStreamResponse(t *testing.T) {
+	setTestHome(t)
+	m := newTestModel(t)
+	m.client.history = []Message{{Role: "user", Content: "Hello"}}
+	m.waiting = true
+
+	// an event without choices is skipped
+	model, cmd := m.Update(CompletionStreamResponse{})
+	m = model.(Model)
+	assert.True(t, m.waiting)
+	assert.NotNil(t, cmd)
+
+	// an empty response is requested again, then reported
+	finish := CompletionStreamResponse{Choices: []CompletionStreamChoice{{FinishReason: "stop"}}}
+	for i := 1; i <= maxEmptyRetries; i++ {
+		model, _ = m.Update(finish)
+		m = model.(Model)
+		assert.True(t, m.waiting)
+		assert.Equal(t, i, m.emptyRetries)
+	}
+	model, _ = m.Update(finish)
+	m = model.(Model)
+	assert.False(t, m.waiting)
+	assert.Equal(t, errEmptyResponse, m.err)
+	assert.Equal(t, 0, m.emptyRetries)
+	assert.Len(t, m.client.history, 1)
+}
+
+func TestRenderSystemMessage_Collapsed(t *testing.T) {
+	m := newTestModel(t)
+	content := "You are a pirate.\nAlways answer in rhymes.\nNever break character."
+
+	output := m.renderSystemMessage(content)
+	assert.Contains(t, output, "⚙ You are a pirate. …")
+	assert.NotContains(t, output, "rhymes")
+	assert.NotContains(t, output, "System message uses")
+
+	m.systemExpanded = true
+	output = m.renderSystemMessage(content)
+	assert.Contains(t, output, "Always answer in rhymes.")
+	assert.Contains(t, output, "Never break character.")
+
+	// a large system message in a nearly full context window
+	m.client.model = "gpt-3.5-turbo"
+	large := strings.Repeat("word ", 1000)
+	m.client.history = []Message{{Role: "system", Content: large}, {Role: "user", Content: strings.Repeat("hello ", 2500)}}
+	assert.Contains(t, m.renderSystemMessage(large), "⚠ System message uses 24% of context")
+}
+
+func TestHandleCommand_EditSystem(t *testing.T) {
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.client.system = "Be brief."
+
+	_, ok := m.handleCommand("/system")
+	assert.True(t, ok)
+	assert.True(t, m.editingSystem)
+	assert.Equal(t, "Be brief.", m.textarea.Value())
+	assert.Contains(t, m.viewport.View(), "[editing]")
+
+	m.textarea.SetValue("Be verbose.")
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+	m = model.(Model)
+	assert.False(t, m.editingSystem)
+	assert.Equal(t, "Be verbose.", m.client.system)
+	assert.Empty(t, m.client.history)
+	assert.NotContains(t, m.viewport.View(), "[editing]")
+}
+
+func TestHandleCommand_Diff(t *testing.T) {
+	m := newTestModel(t)
+	m.textarea = newTextArea()
+	reference := filepath.Join(t.TempDir(), "reference.go")
+	require.NoError(t, os.WriteFile(reference, []byte("return a + b"), 0644))
+
+	_, ok := m.handleCommand("/diff " + reference)
+	assert.True(t, ok)
+	assert.Contains(t, m.notice, "no response to compare")
+
+	m.client.history = []Message{{Role: "user", Content: "add"}, {Role: "assistant", Content: "return b + a"}}
+	m.handleCommand("/diff " + reference)
+	assert.Contains(t, m.notice, "- return a + b\n+ return b + a")
+
+	m.handleCommand("/diff " + filepath.Join(t.TempDir(), "missing.go"))
+	assert.Contains(t, m.notice, "no such file or directory")
+}
+
+func TestWordWrapWidth(t *testing.T) {
+	for _, tt := range []struct {
+		viewportWidth, margin, expected int
+	}{
+		{80, 2, 78},
+		{80, 0, 80},
+		{120, 10, 110},
+		{22, 2, 20},
+		{21, 2, 20},
+		{10, 2, 20},
+		{0, 2, 20},
+	} {
+		assert.Equal(t, tt.expected, wordWrapWidth(tt.viewportWidth, tt.margin), "width %d, margin %d", tt.viewportWidth, tt.margin)
+	}
+}
+
+func TestUpdate_CachedResponse(t *testing.T) {
+	setTestHome(t)
+	m := newTestModel(t)
+	m.responseCache = NewResponseCache(time.Hour)
+	m.client.history = []Message{{Role: "user", Content: "Hi"}}
+
+	m.sendCompletion()
+	resp := CompletionResponse{Choices: []CompletionChoice{{Message: Message{Role: "assistant", Content: "Hello!"}, FinishReason: "stop"}}}
+	model, _ := m.Update(resp)
+	m = model.(Model)
+	assert.False(t, m.cached)
+
+	// the identical request is answered from the cache
+	m.client.history = m.client.history[:1]
+	before := time.Now()
+	commands := m.sendCompletion()
+	require.Len(t, commands, 2)
+	assert.True(t, m.waiting)
+	// the spinner times the wait from the cached request
+	assert.False(t, m.waitStart.Before(before))
+	msg := commands[0]()
+	require.IsType(t, cachedMsg{}, msg)
+	model, _ = m.Update(msg)
+	m = model.(Model)
+	assert.True(t, m.cached)
+	assert.False(t, m.waiting)
+	assert.Contains(t, m.statusView(), "[cached]")
+	assert.Equal(t, "Hello!", m.client.history[len(m.client.history)-1].Content)
+}
+
+func TestLoadHistory_SwitchToMetadata(t *testing.T) {
+	setTestHome(t)
+	filePath := path.Join(t.TempDir(), "2023-05-01_10-00-00.json")
+	session := &Session{
+		ID:       "2023-05-01_10-00-00",
+		Metadata: SessionMetadata{Model: "gpt-4", Temperature: 0.2},
+		Messages: []Message{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "```sh\nls\n```"}},
+	}
+	require.NoError(t, SaveSession(filePath, session))
+
+	m := newTestModel(t)
+	require.NoError(t, m.loadHistory(filePath))
+	assert.Equal(t, []Segment{CodeSegment{Language: "sh", Code: "ls"}}, m.lastParsedResponse)
+	require.NotNil(t, m.pendingMetadata)
+	assert.Contains(t, m.notice, "Session was created with gpt-4, temperature 0.2. Switch to it? [y/N]")
+
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("y")})
+	m = model.(Model)
+	assert.Nil(t, m.pendingMetadata)
+	assert.Equal(t, "gpt-4", m.client.model)
+	assert.Equal(t, float32(0.2), m.client.temperature)
+	assert.Equal(t, "gpt-4", m.metadata().Model)
+}
+
+func TestUpdate_MultilinePaste(t *testing.T) {
+	newModel := func() Model {
+		m := newTestModel(t)
+		m.keys = keys
+		m.textarea = newTextArea()
+		m.textarea.Focus()
+		return m
+	}
+	m := newModel()
+	m.autoMultilinePaste = true
+	// terminals paste line breaks as carriage returns, some as line feeds
+	m = runInput(t, m, "func main() {\r\tfmt.Println()\n}")
+	assert.True(t, m.multiline)
+	assert.False(t, m.navigating)
+	assert.Equal(t, "func main() {\nfmt.Println()\n}", m.textarea.Value())
+	assert.Contains(t, m.notice, "Multiline mode enabled for paste")
+	assert.Empty(t, m.client.history)
+
+	// the lines are sent one by one if disabled
+	m = newModel()
+	m.client.history = nil
+	m = runInput(t, m, "/clear\r/clear")
+	assert.False(t, m.multiline)
+	assert.Equal(t, "/clear", m.textarea.Value())
+
+	// a line break typed after a pause sends the message
+	m = newModel()
+	m.autoMultilinePaste = true
+	m = runInput(t, m, "/clear")
+	m = runInput(t, m, "\r")
+	assert.False(t, m.multiline)
+	assert.Empty(t, m.textarea.Value())
+}
+
+func TestView_TokenWarning(t *testing.T) {
+	setTestHome(t)
+	filePath := path.Join(t.TempDir(), "2023-05-01_10-00-00.json")
+	session := &Session{ID: "2023-05-01_10-00-00"}
+	// 3500 of the 4096 tokens of gpt-3.5-turbo
+	for i := 0; i < 35; i++ {
+		session.Messages = append(session.Messages, Message{Role: "user", Content: strings.Repeat("word ", 100)})
+	}
+	require.NoError(t, SaveSession(filePath, session))
+
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.tokenWarnAt = 80
+	require.NoError(t, m.loadHistory(filePath))
+	model, _ := m.Update(tea.WindowSizeMsg{Width: 80, Height: 40})
+	m = model.(Model)
+	assert.True(t, m.tokenWarnVisible)
+	assert.Contains(t, m.View(), "⚠ Context at 85% — consider /compact or /clear")
+	height := m.viewport.Height
+
+	// the banner stays below the threshold until a key is pressed
+	m.client.history = m.client.history[:1]
+	model, _ = m.Update(tea.WindowSizeMsg{Width: 80, Height: 40})
+	m = model.(Model)
+	assert.True(t, m.tokenWarnVisible)
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")})
+	m = model.(Model)
+	assert.False(t, m.tokenWarnVisible)
+	assert.NotContains(t, m.View(), "Context at")
+	assert.Equal(t, height+1, m.viewport.Height)
+}
+
+func TestUpdate_ContextSelection(t *testing.T) {
+	setTestHome(t)
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.client.history = []Message{
+		{Role: "user", Content: "first question"},
+		{Role: "assistant", Content: "first answer"},
+		{Role: "user", Content: "second question"},
+		{Role: "assistant", Content: "second answer"},
+	}
+
+	press := func(msg tea.KeyMsg) {
+		model, _ := m.Update(msg)
+		m = model.(Model)
+	}
+	press(tea.KeyMsg{Type: tea.KeyCtrlS})
+	require.True(t, m.selecting)
+	assert.Contains(t, m.viewport.View(), "[x]")
+
+	// uncheck the second exchange
+	press(tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(" ")})
+	press(tea.KeyMsg{Type: tea.KeyUp})
+	press(tea.KeyMsg{Type: tea.KeySpace, Runes: []rune(" ")})
+	assert.Contains(t, m.viewport.View(), "[ ]")
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.False(t, m.selecting)
+	assert.Equal(t, map[int]bool{0: true, 1: true, 2: false, 3: false}, m.selectedMessages)
+
+	m.client.history = append(m.client.history, Message{Role: "user", Content: "third question"})
+	m.selectedMessages[len(m.client.history)-1] = true
+	req := newCompletionRequest(m.client, nil, m.selectedMessages)
+	var contents []string
+	for _, message := range req.Messages {
+		contents = append(contents, message.Content)
+	}
+	assert.Equal(t, []string{"first question", "first answer", "third question"}, contents)
+
+	// the selection is reset after one request
+	m.sendCompletion()
+	assert.Nil(t, m.selectedMessages)
+	assert.Len(t, newCompletionRequest(m.client, nil, m.selectedMessages).Messages, 5)
+}
+
+func TestUpdate_NavigateCodeBlocks(t *testing.T) {
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.textarea.Focus()
+	m.client.history = []Message{
+		{Role: "user", Content: "Add two numbers"},
+		{Role: "assistant", Content: codeBlocksFixture},
+	}
+
+	press := func(msg tea.KeyMsg) string {
+		model, _ := m.Update(msg)
+		m = model.(Model)
+		content, err := m.renderMessages(m.client.history)
+		require.NoError(t, err)
+		return ansiPattern.ReplaceAllString(content, "")
+	}
+	// a line feed does not start the navigation
+	press(tea.KeyMsg{Type: tea.KeyCtrlJ})
+	require.False(t, m.navigating)
+
+	view := press(tea.KeyMsg{Type: tea.KeyCtrlG})
+	require.True(t, m.navigating)
+	assert.Contains(t, view, "▶ python (2 lines)")
+	assert.NotContains(t, view, "return a + b")
+
+	// expand the python block
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("k")})
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("k")})
+	view = press(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.Contains(t, view, "» ▼ python (2 lines)")
+	assert.Contains(t, view, "return a + b")
+
+	view = press(tea.KeyMsg{Type: tea.KeyEnter})
+	assert.NotContains(t, view, "return a + b")
+
+	view = press(tea.KeyMsg{Type: tea.KeyEsc})
+	assert.False(t, m.navigating)
+	assert.NotContains(t, view, "python (2 lines)")
+	assert.Contains(t, view, "return a + b")
+}
+
+func TestRenderMessages_Separator(t *testing.T) {
+	m := newTestModel(t)
+	m.client.history = []Message{
+		{Role: "user", Content: "first question"},
+		{Role: "assistant", Content: "first answer"},
+		{Role: "user", Content: "second question"},
+	}
+	plain, err := m.renderMessages(m.client.history)
+	require.NoError(t, err)
+
+	m.separator = separatorStyles["dots"]
+	content, err := m.renderMessages(m.client.history)
+	require.NoError(t, err)
+	content = ansiPattern.ReplaceAllString(content, "")
+	assert.Equal(t, 2, strings.Count(content, "···"))
+	first, separator, second := strings.Index(content, "first answer"), strings.LastIndex(content, "···"), strings.Index(content, "second question")
+	assert.Less(t, first, separator)
+	assert.Less(t, separator, second)
+	// a separator entry and its blank line between each pair of messages
+	assert.Equal(t, strings.Count(plain, "\n")+4, strings.Count(content, "\n"))
+
+	m.separator = ""
+	content, err = m.renderMessages(m.client.history)
+	require.NoError(t, err)
+	assert.Equal(t, plain, content)
+}
+
+func TestUpdate_RegenerateDiff(t *testing.T) {
+	setTestHome(t)
+	m := newTestModel(t)
+	m.keys = keys
+	m.textarea = newTextArea()
+	m.client.stream = false
+	m.client.history = []Message{{Role: "user", Content: "Capital of France?"}}
+	m.appendResponse(Message{Role: "assistant", Content: "It is Paris."})
+
+	model, _ := m.Update(tea.KeyMsg{Type: tea.KeyCtrlR})
+	m = model.(Model)
+	assert.Equal(t, "It is Paris.", m.prevResponse)
+	assert.Len(t, m.client.history, 1)
+	assert.Nil(t, m.lastParsedResponse)
+
+	model, _ = m.Update(CompletionResponse{Choices: []CompletionChoice{{Message: Message{Role: "assistant", Content: "It is Lyon."}}}})
+	m = model.(Model)
+	assert.Equal(t, []Segment{TextSegment{Text: "It is Lyon."}}, m.lastParsedResponse)
+	view := ansiPattern.ReplaceAllString(m.viewport.View(), "")
+	assert.Contains(t, view, "previous")
+	assert.Contains(t, view, "Paris.")
+
+	// the diff can be hidden to show the rendered response
+	model, _ = m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("r"), Alt: true})
+	m = model.(Model)
+	assert.False(t, m.showDiff)
+	assert.Empty(t, m.textarea.Value())
+	assert.NotContains(t, ansiPattern.ReplaceAllString(m.viewport.View(), ""), "previous")
+}
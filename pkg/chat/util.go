@@ -1,16 +1,85 @@
 package chat
 
-import "unicode"
+import (
+	"crypto/rand"
+	_ "embed"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
 
-// countTokens counts the approximate number of tokens from the given text
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+	"github.com/rivo/uniseg"
+)
+
+func init() {
+	// use the embedded BPE ranks instead of downloading them
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// TokenCounter counts tokens with the BPE encoding of a model.
+// It falls back to the countTokens heuristic for unrecognized models.
+type TokenCounter struct {
+	encoding *tiktoken.Tiktoken
+}
+
+// NewTokenCounter creates a TokenCounter with the encoding used by the model
+func NewTokenCounter(model string) (*TokenCounter, error) {
+	if !hasEncoding(model) {
+		return &TokenCounter{}, nil
+	}
+	encoding, err := tiktoken.EncodingForModel(model)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenCounter{encoding: encoding}, nil
+}
+
+// hasEncoding reports whether a BPE encoding is known for the model
+func hasEncoding(model string) bool {
+	if _, ok := tiktoken.MODEL_TO_ENCODING[model]; ok {
+		return true
+	}
+	for prefix := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns the number of tokens in the text
+func (c *TokenCounter) Count(text string) int {
+	if c == nil || c.encoding == nil {
+		return countTokens(text)
+	}
+	return len(c.encoding.Encode(text, nil, nil))
+}
+
+// countTokens counts the approximate number of tokens from the given text.
+// Words separated by whitespace count as one token each, symbol grapheme
+// clusters such as emoji count as one token regardless of their rune count.
 func countTokens(text string) int {
 	tokenCount := 0
 	isPrevSpace := true
 
-	for _, r := range text {
-		if unicode.IsSpace(r) {
+	graphemes := uniseg.NewGraphemes(text)
+	for graphemes.Next() {
+		r := graphemes.Runes()[0]
+		switch {
+		case unicode.IsSpace(r):
+			isPrevSpace = true
+		case unicode.IsSymbol(r):
+			tokenCount++
 			isPrevSpace = true
-		} else {
+		default:
 			if isPrevSpace {
 				tokenCount++
 			}
@@ -20,3 +89,254 @@ func countTokens(text string) int {
 
 	return tokenCount
 }
+
+// countTokensReader counts the approximate number of tokens read from r
+func countTokensReader(r io.Reader) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	return countTokens(string(data)), nil
+}
+
+// isTruncated reports whether the finish reason indicates that the response
+// was cut off by the max_tokens limit
+func isTruncated(finishReason string) bool {
+	return finishReason == "length"
+}
+
+// maxStaleTokenCounts is the number of counts of contents no longer in the history a tokenCache keeps
+const maxStaleTokenCounts = 32
+
+// contextWindow returns the context window size of the model, or 0 if it is unknown
+func contextWindow(model string) int {
+	info, _ := lookupModelInfo(model)
+	return info.ContextWindow
+}
+
+// contextUtilization returns the ratio of the tokens to the context window of the model.
+// It returns 0 for unknown models and at most 1.
+func contextUtilization(tokens int, model string) float64 {
+	size := contextWindow(model)
+	if size == 0 {
+		return 0
+	}
+	return math.Min(float64(tokens)/float64(size), 1)
+}
+
+// tokenCache keeps the number of tokens of the messages, which are counted on every render
+type tokenCache struct {
+	counts map[string]int
+}
+
+// count returns the number of tokens of the content, counted once per content
+func (c *tokenCache) count(counter *TokenCounter, content string) int {
+	if c == nil {
+		return counter.Count(content)
+	}
+	if tokens, ok := c.counts[content]; ok {
+		return tokens
+	}
+	if c.counts == nil {
+		c.counts = map[string]int{}
+	}
+	tokens := counter.Count(content)
+	c.counts[content] = tokens
+	return tokens
+}
+
+// total returns the number of tokens of the messages. The counts of other contents are
+// dropped once they outnumber the messages, e.g. after the history was compacted.
+func (c *tokenCache) total(counter *TokenCounter, messages []Message) int {
+	tokens := 0
+	for _, message := range messages {
+		tokens += c.count(counter, message.Content)
+	}
+	if c != nil && len(c.counts) > 2*len(messages)+maxStaleTokenCounts {
+		kept := make(map[string]int, len(messages))
+		for _, message := range messages {
+			kept[message.Content] = c.counts[message.Content]
+		}
+		c.counts = kept
+	}
+	return tokens
+}
+
+// normalizeMessage returns the message content compared for duplicates
+func normalizeMessage(content string) string {
+	return strings.ToLower(strings.TrimSpace(content))
+}
+
+// duplicateDistance returns how many user messages ago the candidate was sent
+// within the last window user messages of the history, or 0 if it was not
+func duplicateDistance(history []Message, candidate string, window int) int {
+	candidate = normalizeMessage(candidate)
+	n := 0
+	for i := len(history) - 1; i >= 0 && n < window; i-- {
+		if history[i].Role != "user" {
+			continue
+		}
+		n++
+		if normalizeMessage(history[i].Content) == candidate {
+			return n
+		}
+	}
+	return 0
+}
+
+// isDuplicate reports whether the candidate matches one of the last window user messages of the history
+func isDuplicate(history []Message, candidate string, window int) bool {
+	return duplicateDistance(history, candidate, window) > 0
+}
+
+// formatThousands formats n with comma thousands separators, e.g. 128,000
+func formatThousands(n int) string {
+	if n < 0 {
+		return "-" + formatThousands(-n)
+	}
+	s := strconv.Itoa(n)
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+//go:embed stopwords.txt
+var stopWordsFile string
+
+// StopWords are common English words excluded from word frequencies
+var StopWords = strings.Fields(stopWordsFile)
+
+// WordFrequency counts the lowercase words of the messages with the role, or of all messages if role is empty.
+// The stop words are not counted.
+func WordFrequency(messages []Message, role string, stopWords []string) map[string]int {
+	stop := make(map[string]bool, len(stopWords))
+	for _, word := range stopWords {
+		stop[strings.ToLower(word)] = true
+	}
+	frequency := map[string]int{}
+	for _, message := range messages {
+		if len(role) > 0 && message.Role != role {
+			continue
+		}
+		words := strings.FieldsFunc(strings.ToLower(message.Content), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+		})
+		for _, word := range words {
+			word = strings.Trim(word, "'")
+			if len(word) > 0 && !stop[word] {
+				frequency[word]++
+			}
+		}
+	}
+	return frequency
+}
+
+// WordCount is the number of occurrences of a word
+type WordCount struct {
+	Word  string
+	Count int
+}
+
+// TopWords returns the n most frequent words, ties are sorted alphabetically
+func TopWords(frequency map[string]int, n int) []WordCount {
+	counts := make([]WordCount, 0, len(frequency))
+	for word, count := range frequency {
+		counts = append(counts, WordCount{Word: word, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Word < counts[j].Word
+	})
+	if n >= 0 && n < len(counts) {
+		counts = counts[:n]
+	}
+	return counts
+}
+
+// HistogramBin counts the values in the range [Min, Max]
+type HistogramBin struct {
+	Min, Max, Count int
+}
+
+// BuildHistogram counts the values in at most bins evenly spaced bins from the smallest to the largest value.
+// There are fewer bins if the range of the values is smaller than the number of bins.
+func BuildHistogram(values []int, bins int) []HistogramBin {
+	if len(values) == 0 || bins <= 0 {
+		return nil
+	}
+	lo, hi := slices.Min(values), slices.Max(values)
+	span := hi - lo + 1
+	width := (span + min(bins, span) - 1) / min(bins, span)
+
+	histogram := make([]HistogramBin, (span+width-1)/width)
+	for i := range histogram {
+		histogram[i].Min = lo + i*width
+		histogram[i].Max = min(lo+(i+1)*width-1, hi)
+	}
+	for _, v := range values {
+		histogram[(v-lo)/width].Count++
+	}
+	return histogram
+}
+
+// RenderHistogram renders a bar per bin with its range and count.
+// The longest bar is width columns wide, bars are drawn in half blocks.
+func RenderHistogram(bins []HistogramBin, width int) string {
+	maxCount, labelWidth := 0, 0
+	for _, bin := range bins {
+		maxCount = max(maxCount, bin.Count)
+		labelWidth = max(labelWidth, len(strconv.Itoa(bin.Max)))
+	}
+	var b strings.Builder
+	for _, bin := range bins {
+		halves := 0
+		if maxCount > 0 {
+			halves = (bin.Count*width*2 + maxCount/2) / maxCount
+		}
+		bar := strings.Repeat("█", halves/2)
+		if halves%2 == 1 {
+			bar += "▌"
+		}
+		fmt.Fprintf(&b, "%*d-%-*d │%s %d\n", labelWidth, bin.Min, labelWidth, bin.Max, bar, bin.Count)
+	}
+	return b.String()
+}
+
+// envVarPattern matches the ${KEY} tokens of a template
+var envVarPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnvVars replaces the ${KEY} tokens of s with the environment variables, unset variables are empty
+func expandEnvVars(s string) string {
+	return envVarPattern.ReplaceAllStringFunc(s, func(token string) string {
+		return os.Getenv(envVarPattern.FindStringSubmatch(token)[1])
+	})
+}
+
+// missingEnvVars returns the names of the unset environment variables referenced by s
+func missingEnvVars(s string) []string {
+	var missing []string
+	for _, match := range envVarPattern.FindAllStringSubmatch(s, -1) {
+		if _, ok := os.LookupEnv(match[1]); !ok && !slices.Contains(missing, match[1]) {
+			missing = append(missing, match[1])
+		}
+	}
+	return missing
+}
+
+// generateRequestID returns a random UUID v4 identifying an API request
+func generateRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,216 @@
+package chat
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTruncated(t *testing.T) {
+	assert.True(t, isTruncated("length"))
+	assert.False(t, isTruncated("stop"))
+	assert.False(t, isTruncated(""))
+}
+
+func TestCountTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want int
+	}{
+		{"empty", "", 0},
+		{"words", "hello world", 2},
+		{"surrounding spaces", "  hello \n\t world  ", 2},
+		{"combining mark", "cafe\u0301 au lait", 3},
+		{"zwj family emoji", "👨‍👩‍👧‍👦", 1},
+		{"flag emoji", "🇩🇪", 1},
+		{"skin tone emoji", "👍🏽", 1},
+		{"emoji after word", "thanks👍", 2},
+		{"consecutive emoji", "hi 👋👋", 3},
+		{"arabic", "مرحبا بالعالم", 2},
+		{"hebrew", "שלום עולם", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, countTokens(tt.text))
+		})
+	}
+}
+
+func TestCountTokensReader(t *testing.T) {
+	count, err := countTokensReader(strings.NewReader("👨‍👩‍👧‍👦 family"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestTokenCounter(t *testing.T) {
+	// expected counts from the OpenAI cookbook "How to count tokens with tiktoken"
+	counter, err := NewTokenCounter("gpt-3.5-turbo")
+	assert.NoError(t, err)
+	assert.Equal(t, 6, counter.Count("tiktoken is great!"))
+	assert.Equal(t, 6, counter.Count("antidisestablishmentarianism"))
+	assert.Equal(t, 7, counter.Count("2 + 2 = 4"))
+	assert.Equal(t, 9, counter.Count("お誕生日おめでとう"))
+
+	counter, err = NewTokenCounter("gpt-4-0613")
+	assert.NoError(t, err)
+	assert.Equal(t, 6, counter.Count("tiktoken is great!"))
+}
+
+func TestTokenCounter_Fallback(t *testing.T) {
+	counter, err := NewTokenCounter("llama-2-7b")
+	assert.NoError(t, err)
+	assert.Equal(t, countTokens("tiktoken is great!"), counter.Count("tiktoken is great!"))
+
+	var nilCounter *TokenCounter
+	assert.Equal(t, 3, nilCounter.Count("tiktoken is great!"))
+}
+
+func TestContextUtilization(t *testing.T) {
+	counter, err := NewTokenCounter("gpt-4")
+	assert.NoError(t, err)
+	// 6 tokens each
+	history := []Message{
+		{Role: "user", Content: "tiktoken is great!"},
+		{Role: "assistant", Content: "antidisestablishmentarianism"},
+	}
+
+	assert.Equal(t, 8192, contextWindow("gpt-4-0613"))
+	assert.Equal(t, 32768, contextWindow("gpt-4-32k-0613"))
+	cache := &tokenCache{}
+	tokens := cache.total(counter, history)
+	assert.Equal(t, 12, tokens)
+	assert.InDelta(t, 12.0/8192, contextUtilization(tokens, "gpt-4"), 1e-9)
+	assert.InDelta(t, 12.0/4096, contextUtilization(tokens, "gpt-3.5-turbo-0613"), 1e-9)
+	assert.Equal(t, 0.0, contextUtilization(tokens, "llama-2-7b"))
+	assert.Equal(t, 0.0, contextUtilization(0, "gpt-4"))
+
+	long := []Message{{Role: "user", Content: strings.Repeat("hello ", 10000)}}
+	assert.Equal(t, 1.0, contextUtilization(cache.total(counter, long), "gpt-4"))
+}
+
+func TestTokenCache(t *testing.T) {
+	counter, err := NewTokenCounter("gpt-4")
+	require.NoError(t, err)
+	cache := &tokenCache{}
+	history := []Message{{Role: "user", Content: "tiktoken is great!"}}
+	assert.Equal(t, 6, cache.total(counter, history))
+	// the cached count is returned without counting again
+	cache.counts["tiktoken is great!"] = 7
+	assert.Equal(t, 7, cache.total(counter, history))
+	assert.Equal(t, 6, (*tokenCache)(nil).total(counter, history))
+
+	// the counts of contents no longer in the history are dropped eventually
+	for i := 0; i < maxStaleTokenCounts+2; i++ {
+		cache.count(counter, strconv.Itoa(i))
+	}
+	cache.total(counter, history)
+	assert.Equal(t, map[string]int{"tiktoken is great!": 7}, cache.counts)
+}
+
+func TestIsDuplicate(t *testing.T) {
+	history := []Message{
+		{Role: "user", Content: "Hello there"},
+		{Role: "assistant", Content: "Hi!"},
+		{Role: "user", Content: "How are you?"},
+		{Role: "assistant", Content: "Fine."},
+	}
+	assert.True(t, isDuplicate(history, "  hello THERE\n", 20))
+	assert.True(t, isDuplicate(history, "how are you?", 20))
+	assert.False(t, isDuplicate(history, "Hi!", 20))
+	assert.False(t, isDuplicate(history, "hello", 20))
+	assert.False(t, isDuplicate(history, "Hello there", 1))
+	assert.Equal(t, 2, duplicateDistance(history, "hello there", 20))
+	assert.Equal(t, 0, duplicateDistance(nil, "hello there", 20))
+}
+
+func TestFormatThousands(t *testing.T) {
+	assert.Equal(t, "0", formatThousands(0))
+	assert.Equal(t, "999", formatThousands(999))
+	assert.Equal(t, "2,340", formatThousands(2340))
+	assert.Equal(t, "128,000", formatThousands(128000))
+	assert.Equal(t, "-1,000,000", formatThousands(-1000000))
+}
+
+func TestWordFrequency(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "You are a Go expert."},
+		{Role: "user", Content: "How do I read a file in Go?"},
+		{Role: "assistant", Content: "Use os.ReadFile to read the whole file. Go's standard library makes it easy."},
+		{Role: "user", Content: "And line by line?"},
+		{Role: "assistant", Content: "Use a bufio.Scanner: it reads the file line by line."},
+	}
+
+	frequency := WordFrequency(messages, "assistant", StopWords)
+	assert.Equal(t, map[string]int{
+		"use": 2, "os": 1, "readfile": 1, "read": 1, "whole": 1, "file": 2, "go's": 1, "standard": 1,
+		"library": 1, "makes": 1, "easy": 1, "bufio": 1, "scanner": 1, "reads": 1, "line": 2,
+	}, frequency)
+	assert.Equal(t, []WordCount{{"file", 2}, {"line", 2}, {"use", 2}, {"bufio", 1}}, TopWords(frequency, 4))
+
+	frequency = WordFrequency(messages, "", StopWords)
+	assert.Equal(t, 3, frequency["file"])
+	assert.Equal(t, 2, frequency["go"])
+	assert.Len(t, TopWords(frequency, 100), len(frequency))
+}
+
+func TestExpandEnvVars(t *testing.T) {
+	t.Setenv("GIT_BRANCH", "main")
+	t.Setenv("JIRA_PROJECT", "GPT")
+	t.Setenv("EMPTY", "")
+
+	assert.Equal(t, "Project GPT on branch main.", expandEnvVars("Project ${JIRA_PROJECT} on branch ${GIT_BRANCH}."))
+	assert.Equal(t, "no variables", expandEnvVars("no variables"))
+	// only the braced form is expanded
+	assert.Equal(t, "$GIT_BRANCH main", expandEnvVars("$GIT_BRANCH ${GIT_BRANCH}"))
+	assert.Equal(t, "missing: .", expandEnvVars("missing: ${GPTUI_UNSET_VARIABLE}."))
+}
+
+func TestMissingEnvVars(t *testing.T) {
+	t.Setenv("GIT_BRANCH", "main")
+	t.Setenv("EMPTY", "")
+
+	assert.Empty(t, missingEnvVars("${GIT_BRANCH} ${EMPTY}"))
+	assert.Equal(t, []string{"GPTUI_UNSET_A", "GPTUI_UNSET_B"}, missingEnvVars("${GPTUI_UNSET_A} ${GIT_BRANCH} ${GPTUI_UNSET_B} ${GPTUI_UNSET_A}"))
+}
+
+func TestBuildHistogram(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		values   []int
+		bins     int
+		expected []HistogramBin
+	}{
+		{"empty", nil, 10, nil},
+		{"no bins", []int{1, 2}, 0, nil},
+		{"single value", []int{7, 7, 7}, 10, []HistogramBin{{7, 7, 3}}},
+		{"range smaller than bins", []int{1, 3}, 10, []HistogramBin{{1, 1, 1}, {2, 2, 0}, {3, 3, 1}}},
+		{"even split", []int{0, 9, 10, 19, 99}, 10, []HistogramBin{
+			{0, 9, 2}, {10, 19, 2}, {20, 29, 0}, {30, 39, 0}, {40, 49, 0},
+			{50, 59, 0}, {60, 69, 0}, {70, 79, 0}, {80, 89, 0}, {90, 99, 1},
+		}},
+		{"last bin is narrower", []int{0, 4, 5, 6}, 3, []HistogramBin{{0, 2, 1}, {3, 5, 2}, {6, 6, 1}}},
+	} {
+		assert.Equal(t, tt.expected, BuildHistogram(tt.values, tt.bins), tt.name)
+	}
+
+	// every value is counted once
+	values := []int{3, 141, 59, 26, 53, 58, 97, 93, 23, 84}
+	total := 0
+	for _, bin := range BuildHistogram(values, 10) {
+		total += bin.Count
+	}
+	assert.Equal(t, len(values), total)
+}
+
+func TestRenderHistogram(t *testing.T) {
+	bins := []HistogramBin{{0, 9, 4}, {10, 19, 1}, {20, 29, 0}}
+	expected := " 0-9  │██ 4\n" +
+		"10-19 │▌ 1\n" +
+		"20-29 │ 0\n"
+	assert.Equal(t, expected, RenderHistogram(bins, 2))
+	assert.Empty(t, RenderHistogram(nil, 2))
+}
@@ -0,0 +1,106 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// welcomeFrameInterval is the time each frame of the welcome animation is shown
+const welcomeFrameInterval = 200 * time.Millisecond
+
+// welcomeLogo is revealed line by line by the welcome animation
+var welcomeLogo = []string{
+	"             _         _ ",
+	"  __ _ _ __ | |_ _   _(_)",
+	" / _` | '_ \\| __| | | | |",
+	"| (_| | |_) | |_| |_| | |",
+	" \\__, | .__/ \\__|\\__,_|_|",
+	" |___/|_|                ",
+}
+
+// welcomeAnimation are the frames of the animation shown on the first launch
+var welcomeAnimation = []string{
+	strings.Join(welcomeLogo[:2], "\n"),
+	strings.Join(welcomeLogo[:3], "\n"),
+	strings.Join(welcomeLogo[:4], "\n"),
+	strings.Join(welcomeLogo[:5], "\n"),
+	strings.Join(welcomeLogo, "\n"),
+}
+
+// welcomeTickMsg shows the frame of the welcome animation, the welcome text follows the last frame
+type welcomeTickMsg struct {
+	frame int
+}
+
+// welcomeTickCmd returns a tea.Cmd which sends welcomeTickMsg for the frame after the interval
+func welcomeTickCmd(frame int) tea.Cmd {
+	return tea.Tick(welcomeFrameInterval, func(time.Time) tea.Msg {
+		return welcomeTickMsg{frame: frame}
+	})
+}
+
+// welcomeText returns the welcome message with the version and the settings of the chat
+func welcomeText(version, model, baseURL string, stream bool) string {
+	info := fmt.Sprintf("Version: %s\nModel: %s\nAPI: %s\nStream: %t\n", version, model, baseURL, stream)
+	return fmt.Sprintf("%s\n\n%s\n%s",
+		"ChatGPT Terminal UI",
+		helpStyle.Render(info),
+		"Type a message and press Enter to send.")
+}
+
+// welcomedPath returns the path of the file marking that the welcome animation was shown
+func welcomedPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, "welcomed"), nil
+}
+
+// isFirstLaunch reports whether the welcome animation has not been shown yet
+func isFirstLaunch() bool {
+	filePath, err := welcomedPath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(filePath)
+	return errors.Is(err, os.ErrNotExist)
+}
+
+// markWelcomed creates the file marking that the welcome animation was shown
+func markWelcomed() error {
+	filePath, err := welcomedPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, nil, 0644)
+}
+
+// showWelcomeFrame shows the frame of the welcome animation and returns the tick of the next one.
+// The welcome text is shown after the last frame or as soon as the conversation starts.
+func (m *Model) showWelcomeFrame(frame int) tea.Cmd {
+	if !m.animating {
+		return nil
+	}
+	if frame >= len(welcomeAnimation) || len(m.client.history) > 0 || m.waiting {
+		m.animating = false
+		if err := markWelcomed(); err != nil {
+			logger.Warn("failed to mark the welcome animation as shown", "error", err)
+		}
+		if len(m.client.history) == 0 && !m.waiting {
+			m.viewport.SetContent(m.welcome)
+		}
+		return nil
+	}
+	m.viewport.SetContent(chatStyle.Render(welcomeAnimation[frame]))
+	return welcomeTickCmd(frame + 1)
+}
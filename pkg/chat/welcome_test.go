@@ -0,0 +1,50 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdate_WelcomeAnimation(t *testing.T) {
+	setTestHome(t)
+	assert.True(t, isFirstLaunch())
+
+	m := newTestModel(t)
+	m.welcome = welcomeText("v1.2.3", "gpt-4", "https://api.openai.com/v1", true)
+	m.animating = true
+
+	for frame := range welcomeAnimation {
+		model, cmd := m.Update(welcomeTickMsg{frame: frame})
+		m = model.(Model)
+		assert.True(t, m.animating)
+		assert.NotNil(t, cmd)
+		assert.Contains(t, m.viewport.View(), welcomeLogo[frame+1])
+	}
+
+	model, _ := m.Update(welcomeTickMsg{frame: len(welcomeAnimation)})
+	m = model.(Model)
+	assert.False(t, m.animating)
+	assert.Contains(t, m.viewport.View(), "Version: v1.2.3")
+	assert.Contains(t, m.viewport.View(), "Model: gpt-4")
+	assert.False(t, isFirstLaunch())
+
+	// ticks after the animation are ignored
+	m.viewport.SetContent("conversation")
+	model, _ = m.Update(welcomeTickMsg{frame: 1})
+	m = model.(Model)
+	assert.Contains(t, m.viewport.View(), "conversation")
+}
+
+func TestUpdate_WelcomeAnimationStopsWhenChatStarts(t *testing.T) {
+	setTestHome(t)
+	m := newTestModel(t)
+	m.animating = true
+	m.client.history = []Message{{Role: "user", Content: "Hi"}}
+	m.viewport.SetContent("conversation")
+
+	model, _ := m.Update(welcomeTickMsg{frame: 2})
+	m = model.(Model)
+	assert.False(t, m.animating)
+	assert.Contains(t, m.viewport.View(), "conversation")
+}
@@ -0,0 +1,238 @@
+package chat
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/fsnotify/fsnotify"
+)
+
+// workspaceSystemMessage starts the system message of a workspace session, followed by the file tree
+const workspaceSystemMessage = "You are reviewing the following codebase:"
+
+// WorkspaceLoader discovers the source files of a directory which are attached as the
+// initial context of a session
+type WorkspaceLoader struct {
+	Dir string
+	// Extensions are the extensions of the attached files, e.g. .go, with or without the dot
+	Extensions []string
+	// MaxFiles is the number of files attached at most, in the order of their paths
+	MaxFiles int
+	// MaxFileSize is the size in bytes above which files are skipped
+	MaxFileSize int64
+	// MaxTokens is the number of tokens of the system message and the attachments at most,
+	// counted by Counter. The files which do not fit are skipped, 0 for no limit.
+	MaxTokens int
+	Counter   *TokenCounter
+}
+
+// Discover returns the paths relative to the directory of the files with the extensions,
+// sorted. Hidden files and directories are skipped, like files larger than MaxFileSize.
+func (l WorkspaceLoader) Discover() ([]string, error) {
+	extensions := map[string]bool{}
+	for _, ext := range l.Extensions {
+		extensions["."+strings.TrimPrefix(ext, ".")] = true
+	}
+	var files []string
+	err := filepath.WalkDir(l.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && path != l.Dir {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !extensions[filepath.Ext(path)] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if l.MaxFileSize > 0 && info.Size() > l.MaxFileSize {
+			logger.Debug("skipping large workspace file", "path", path, "size", info.Size())
+			return nil
+		}
+		rel, err := filepath.Rel(l.Dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	if l.MaxFiles > 0 && len(files) > l.MaxFiles {
+		files = files[:l.MaxFiles]
+	}
+	return files, nil
+}
+
+// SystemMessage returns the system message introducing the files as a tree
+func (l WorkspaceLoader) SystemMessage(files []string) string {
+	return workspaceSystemMessage + "\n\n" + fileTree(files)
+}
+
+// Attachments reads the files and returns them as fenced code blocks headed by @path.
+// The files which are not valid UTF-8 are skipped and returned as skipped.
+func (l WorkspaceLoader) Attachments(files []string) (blocks, skipped []string, err error) {
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(l.Dir, filepath.FromSlash(file)))
+		if err != nil {
+			return nil, nil, err
+		}
+		if !utf8.Valid(data) {
+			logger.Warn("skipping binary workspace file", "path", file)
+			skipped = append(skipped, file)
+			continue
+		}
+		lang := strings.TrimPrefix(filepath.Ext(file), ".")
+		blocks = append(blocks, fmt.Sprintf("@%s\n```%s\n%s\n```", file, lang, strings.TrimRight(string(data), "\n")))
+	}
+	return blocks, skipped, nil
+}
+
+// fit returns the files and their attachments which fit in MaxTokens with the system
+// message, in the order of the files, and the files which do not
+func (l WorkspaceLoader) fit(files, blocks []string) (fitting, fittingBlocks, dropped []string) {
+	if l.MaxTokens <= 0 {
+		return files, blocks, nil
+	}
+	budget := l.MaxTokens - l.Counter.Count(l.SystemMessage(files))
+	for i, block := range blocks {
+		tokens := l.Counter.Count(block)
+		if tokens > budget {
+			logger.Warn("skipping workspace file over the token budget", "path", files[i], "tokens", tokens)
+			dropped = append(dropped, files[i])
+			continue
+		}
+		budget -= tokens
+		fitting = append(fitting, files[i])
+		fittingBlocks = append(fittingBlocks, block)
+	}
+	return fitting, fittingBlocks, dropped
+}
+
+// workspaceAttachments are the files of a workspace attached to the first message
+type workspaceAttachments struct {
+	files  []string
+	blocks []string
+	// binary are the files skipped because they are not text
+	binary []string
+	// overBudget are the files skipped because they do not fit in MaxTokens
+	overBudget []string
+	watcher    *workspaceWatcher
+}
+
+// load discovers the files, reads them as attachments and watches them for changes.
+// The skipped files are left out of the files.
+func (l WorkspaceLoader) load() (workspaceAttachments, error) {
+	var a workspaceAttachments
+	files, err := l.Discover()
+	if err != nil {
+		return a, err
+	}
+	blocks, binary, err := l.Attachments(files)
+	if err != nil {
+		return a, err
+	}
+	files = slices.DeleteFunc(files, func(file string) bool { return slices.Contains(binary, file) })
+	a.files, a.blocks, a.overBudget = l.fit(files, blocks)
+	a.binary = binary
+	if a.watcher, err = l.Watch(a.files); err != nil {
+		return workspaceAttachments{}, err
+	}
+	return a, nil
+}
+
+// fileTree renders the sorted slash separated paths as an indented tree
+func fileTree(files []string) string {
+	var b strings.Builder
+	var parents []string
+	for _, file := range files {
+		dirs := strings.Split(file, "/")
+		name := dirs[len(dirs)-1]
+		dirs = dirs[:len(dirs)-1]
+		// the directories shared with the previous file are already written
+		common := 0
+		for common < len(dirs) && common < len(parents) && dirs[common] == parents[common] {
+			common++
+		}
+		for i := common; i < len(dirs); i++ {
+			fmt.Fprintf(&b, "%s%s/\n", strings.Repeat("  ", i), dirs[i])
+		}
+		fmt.Fprintf(&b, "%s%s\n", strings.Repeat("  ", len(dirs)), name)
+		parents = dirs
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// workspaceChangedMsg is sent when an attached file of the workspace changes on disk
+type workspaceChangedMsg string
+
+// workspaceWatcher reports the changes of the attached files of a workspace
+type workspaceWatcher struct {
+	watcher *fsnotify.Watcher
+	dir     string
+	files   map[string]bool
+}
+
+// Watch watches the directories of the files for changes
+func (l WorkspaceLoader) Watch(files []string) (*workspaceWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &workspaceWatcher{watcher: watcher, dir: l.Dir, files: map[string]bool{}}
+	dirs := map[string]bool{}
+	for _, file := range files {
+		w.files[file] = true
+		dirs[filepath.Dir(filepath.Join(l.Dir, filepath.FromSlash(file)))] = true
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// waitCmd returns a tea.Cmd which waits for the next change of an attached file
+func (w *workspaceWatcher) waitCmd() tea.Cmd {
+	return func() tea.Msg {
+		for {
+			select {
+			case event, ok := <-w.watcher.Events:
+				if !ok {
+					return nil
+				}
+				rel, err := filepath.Rel(w.dir, event.Name)
+				if err == nil && w.files[filepath.ToSlash(rel)] && !event.Has(fsnotify.Chmod) {
+					return workspaceChangedMsg(filepath.ToSlash(rel))
+				}
+			case err, ok := <-w.watcher.Errors:
+				if !ok {
+					return nil
+				}
+				logger.Warn("failed to watch workspace", "error", err)
+			}
+		}
+	}
+}
+
+// Close stops watching the files
+func (w *workspaceWatcher) Close() error {
+	return w.watcher.Close()
+}
@@ -0,0 +1,124 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeWorkspace(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+		require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestWorkspaceLoader_Discover(t *testing.T) {
+	dir := writeWorkspace(t, map[string]string{
+		"main.go":            "package main",
+		"README.md":          "# readme",
+		"pkg/util.go":        "package pkg",
+		"pkg/util_test.go":   "package pkg",
+		"pkg/large.go":       strings.Repeat("x", 100),
+		".git/config.go":     "hidden",
+		"scripts/build.py":   "print()",
+		"vendor/.hidden.go":  "hidden",
+		"web/src/index.ts":   "export {}",
+		"web/src/styles.css": "body {}",
+	})
+
+	files, err := WorkspaceLoader{Dir: dir, Extensions: []string{".go", "py", ".ts"}, MaxFileSize: 50}.Discover()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main.go", "pkg/util.go", "pkg/util_test.go", "scripts/build.py", "web/src/index.ts"}, files)
+
+	files, err = WorkspaceLoader{Dir: dir, Extensions: []string{".go"}, MaxFiles: 2}.Discover()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main.go", "pkg/large.go"}, files)
+
+	_, err = WorkspaceLoader{Dir: filepath.Join(dir, "missing"), Extensions: []string{".go"}}.Discover()
+	assert.Error(t, err)
+}
+
+func TestWorkspaceLoader_Attachments(t *testing.T) {
+	dir := writeWorkspace(t, map[string]string{
+		"main.go":     "package main\n",
+		"pkg/util.go": "package pkg",
+		"bin/tool.go": "\xff\xfe",
+	})
+	loader := WorkspaceLoader{Dir: dir, Extensions: []string{".go"}}
+
+	// the binary file is skipped
+	blocks, skipped, err := loader.Attachments([]string{"bin/tool.go", "main.go", "pkg/util.go"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"@main.go\n```go\npackage main\n```", "@pkg/util.go\n```go\npackage pkg\n```"}, blocks)
+	assert.Equal(t, []string{"bin/tool.go"}, skipped)
+
+	attachments, err := loader.load()
+	require.NoError(t, err)
+	defer attachments.watcher.Close()
+	assert.Equal(t, []string{"main.go", "pkg/util.go"}, attachments.files)
+	assert.Len(t, attachments.blocks, 2)
+	assert.Equal(t, []string{"bin/tool.go"}, attachments.binary)
+	assert.Empty(t, attachments.overBudget)
+
+	assert.Equal(t, "You are reviewing the following codebase:\n\nmain.go\npkg/\n  util.go\n  sub/\n    a.go\nweb/\n  index.ts",
+		loader.SystemMessage([]string{"main.go", "pkg/util.go", "pkg/sub/a.go", "web/index.ts"}))
+}
+
+func TestWorkspaceLoader_MaxTokens(t *testing.T) {
+	dir := writeWorkspace(t, map[string]string{
+		"a.go": "package a",
+		"b.go": "package b\n\n" + strings.Repeat("var x = 1\n", 100),
+		"c.go": "package c",
+	})
+	loader := WorkspaceLoader{Dir: dir, Extensions: []string{".go"}, MaxTokens: 60}
+
+	// the large file does not fit, the smaller ones after it do
+	attachments, err := loader.load()
+	require.NoError(t, err)
+	defer attachments.watcher.Close()
+	assert.Equal(t, []string{"a.go", "c.go"}, attachments.files)
+	assert.Len(t, attachments.blocks, 2)
+	assert.Equal(t, []string{"b.go"}, attachments.overBudget)
+}
+
+func TestWorkspaceWatcher(t *testing.T) {
+	dir := writeWorkspace(t, map[string]string{"main.go": "package main", "other.go": "package main"})
+	watcher, err := WorkspaceLoader{Dir: dir}.Watch([]string{"main.go"})
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	msgs := make(chan any, 1)
+	go func() { msgs <- watcher.waitCmd()() }()
+	// changes of files which are not attached are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.go"), []byte("package other"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte("package changed"), 0644))
+	select {
+	case msg := <-msgs:
+		assert.Equal(t, workspaceChangedMsg("main.go"), msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported")
+	}
+}
+
+func TestUpdate_WorkspaceChanged(t *testing.T) {
+	dir := writeWorkspace(t, map[string]string{"main.go": "package main"})
+	watcher, err := WorkspaceLoader{Dir: dir}.Watch([]string{"main.go"})
+	require.NoError(t, err)
+	defer watcher.Close()
+
+	m := newTestModel(t)
+	m.workspace = watcher
+	model, cmd := m.Update(workspaceChangedMsg("main.go"))
+	m = model.(Model)
+	assert.Equal(t, "📁 workspace updated: main.go", m.notice)
+	assert.NotNil(t, cmd)
+}
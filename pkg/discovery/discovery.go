@@ -0,0 +1,167 @@
+// Package discovery finds the OpenAI-compatible servers announced with mDNS on the local network,
+// such as LM Studio, by browsing the DNS-SD services of type _openai._tcp.
+package discovery
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ServiceType is the DNS-SD service type of the OpenAI-compatible servers
+const ServiceType = "_openai._tcp"
+
+// mdnsAddr is the address the queries are sent to, replaced in tests
+var mdnsAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// ServiceInfo is a server discovered on the local network
+type ServiceInfo struct {
+	// Instance is the name of the service, e.g. LM Studio
+	Instance string
+	// HostName is the host of the server without the trailing dot, e.g. studio.local
+	HostName string
+	Port     int
+	// IPs are the IPv4 addresses announced for the host
+	IPs []net.IP
+}
+
+// BaseURL returns the URL of the OpenAI API of the server
+func (s ServiceInfo) BaseURL() string {
+	return fmt.Sprintf("http://%s/v1", net.JoinHostPort(s.HostName, strconv.Itoa(s.Port)))
+}
+
+// DiscoverServers browses the local network for the servers of ServiceType until timeout.
+// The servers are sorted by instance name.
+func DiscoverServers(timeout time.Duration) ([]ServiceInfo, error) {
+	return discover(mdnsAddr, timeout)
+}
+
+// discover sends the query to addr and collects the answers until timeout. The query is sent
+// from an ephemeral port, so that responders answer it with unicast to that port (RFC 6762 §6.7).
+func discover(addr *net.UDPAddr, timeout time.Duration) ([]ServiceInfo, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	query, err := browseQuery()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(query, addr); err != nil {
+		return nil, fmt.Errorf("failed to send the mDNS query: %w", err)
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	records := newRecords()
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// malformed packets of other responders are ignored
+		_ = records.add(buf[:n])
+	}
+	return records.services(), nil
+}
+
+// serviceName returns the fully qualified name of ServiceType in the .local domain
+func serviceName() string {
+	return ServiceType + ".local."
+}
+
+// browseQuery returns the PTR query listing the instances of ServiceType
+func browseQuery() ([]byte, error) {
+	name, err := dnsmessage.NewName(serviceName())
+	if err != nil {
+		return nil, err
+	}
+	msg := dnsmessage.Message{
+		Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}},
+	}
+	return msg.Pack()
+}
+
+// records holds the resource records of the answers
+type records struct {
+	// instances are the names of the instances pointed to by the service
+	instances map[string]bool
+	srv       map[string]dnsmessage.SRVResource
+	ips       map[string][]net.IP
+}
+
+func newRecords() *records {
+	return &records{instances: map[string]bool{}, srv: map[string]dnsmessage.SRVResource{}, ips: map[string][]net.IP{}}
+}
+
+// add adds the records of the answer and additional sections of the packet
+func (r *records) add(packet []byte) error {
+	var msg dnsmessage.Message
+	if err := msg.Unpack(packet); err != nil {
+		return err
+	}
+	for _, resource := range append(msg.Answers, msg.Additionals...) {
+		name := strings.ToLower(resource.Header.Name.String())
+		switch body := resource.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if name == serviceName() {
+				r.instances[body.PTR.String()] = true
+			}
+		case *dnsmessage.SRVResource:
+			r.srv[name] = *body
+		case *dnsmessage.AResource:
+			ip := net.IP(body.A[:])
+			for _, known := range r.ips[name] {
+				if known.Equal(ip) {
+					ip = nil
+					break
+				}
+			}
+			if ip != nil {
+				r.ips[name] = append(r.ips[name], ip)
+			}
+		}
+	}
+	return nil
+}
+
+// services returns the instances whose host and port are known
+func (r *records) services() []ServiceInfo {
+	var services []ServiceInfo
+	for instance := range r.instances {
+		srv, ok := r.srv[strings.ToLower(instance)]
+		if !ok {
+			continue
+		}
+		host := srv.Target.String()
+		services = append(services, ServiceInfo{
+			Instance: unescapeInstance(strings.TrimSuffix(instance, "."+serviceName())),
+			HostName: strings.TrimSuffix(host, "."),
+			Port:     int(srv.Port),
+			IPs:      r.ips[strings.ToLower(host)],
+		})
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Instance < services[j].Instance
+	})
+	return services
+}
+
+// unescapeInstance removes the escaping of the dots and spaces of an instance name
+func unescapeInstance(name string) string {
+	return strings.NewReplacer(`\.`, ".", `\ `, " ", `\032`, " ").Replace(name)
+}
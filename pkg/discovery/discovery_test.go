@@ -0,0 +1,86 @@
+package discovery
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// startResponder answers the PTR queries of ServiceType with the records returned by answer
+func startResponder(t *testing.T, answer func(query dnsmessage.Message) []dnsmessage.Resource) *net.UDPAddr {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 9000)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil {
+				continue
+			}
+			// a packet per record, like several responders would answer
+			for _, resource := range answer(query) {
+				resp := dnsmessage.Message{Header: dnsmessage.Header{Response: true, Authoritative: true}, Answers: []dnsmessage.Resource{resource}}
+				packet, err := resp.Pack()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				conn.WriteToUDP(packet, from)
+			}
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr)
+}
+
+func resource(name string, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Class: dnsmessage.ClassINET, TTL: 120},
+		Body:   body,
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	questions := make(chan []dnsmessage.Question, 1)
+	addr := startResponder(t, func(query dnsmessage.Message) []dnsmessage.Resource {
+		questions <- query.Questions
+		return []dnsmessage.Resource{
+			resource("_openai._tcp.local.", &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("LM Studio._openai._tcp.local.")}),
+			resource("_openai._tcp.local.", &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("ollama._openai._tcp.local.")}),
+			resource("LM Studio._openai._tcp.local.", &dnsmessage.SRVResource{Target: dnsmessage.MustNewName("studio.local."), Port: 1234}),
+			resource("studio.local.", &dnsmessage.AResource{A: [4]byte{192, 168, 1, 20}}),
+			resource("ollama._openai._tcp.local.", &dnsmessage.SRVResource{Target: dnsmessage.MustNewName("gpu.local."), Port: 11434}),
+			// services of other types are ignored
+			resource("_http._tcp.local.", &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("printer._http._tcp.local.")}),
+			resource("printer._http._tcp.local.", &dnsmessage.SRVResource{Target: dnsmessage.MustNewName("printer.local."), Port: 80}),
+		}
+	})
+
+	services, err := discover(addr, 300*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, []dnsmessage.Question{{Name: dnsmessage.MustNewName("_openai._tcp.local."), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}}, <-questions)
+	require.Len(t, services, 2)
+	assert.Equal(t, "LM Studio", services[0].Instance)
+	assert.Equal(t, "studio.local", services[0].HostName)
+	assert.Equal(t, 1234, services[0].Port)
+	assert.True(t, services[0].IPs[0].Equal(net.IPv4(192, 168, 1, 20)))
+	assert.Equal(t, "http://studio.local:1234/v1", services[0].BaseURL())
+	assert.Equal(t, "ollama", services[1].Instance)
+	assert.Equal(t, "http://gpu.local:11434/v1", services[1].BaseURL())
+}
+
+func TestDiscover_NoServers(t *testing.T) {
+	addr := startResponder(t, func(dnsmessage.Message) []dnsmessage.Resource { return nil })
+	services, err := discover(addr, 100*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Empty(t, services)
+}
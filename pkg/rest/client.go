@@ -1,16 +1,28 @@
 package rest
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"strings"
+	"syscall"
 	"time"
+
+	"github.com/andybalholm/brotli"
 )
 
 // Client is a simple HTTP REST client
 type Client struct {
 	httpClient *http.Client
 	baseURL    string
+	// ctx is the default context of the requests
+	ctx context.Context
 }
 
 type ClientOption func(*Client)
@@ -41,6 +53,58 @@ func WithBaseURL(baseURL string) ClientOption {
 	}
 }
 
+// WithDefaultContext returns ClientOption which sets the context of all requests of the Client,
+// e.g. to give a session an overall deadline. WithContext overrides it for a single request.
+func WithDefaultContext(ctx context.Context) ClientOption {
+	return func(c *Client) {
+		c.ctx = ctx
+	}
+}
+
+// TransportOptions configures the connection pooling of the Client transport.
+// Zero values keep the defaults of http.DefaultTransport.
+type TransportOptions struct {
+	MaxIdleConns          int
+	MaxIdleConnsPerHost   int
+	IdleConnTimeout       time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	// DialControl is called with the address of each connection before it is made, an error
+	// refuses the connection. Proxies are not used when it is set, since it would only see theirs.
+	DialControl func(network, address string, c syscall.RawConn) error
+}
+
+// WithTransport returns ClientOption which sets the transport for the Client.
+func WithTransport(opts TransportOptions) ClientOption {
+	return func(c *Client) {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if opts.MaxIdleConns > 0 {
+			transport.MaxIdleConns = opts.MaxIdleConns
+		}
+		if opts.MaxIdleConnsPerHost > 0 {
+			transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+		}
+		if opts.IdleConnTimeout > 0 {
+			transport.IdleConnTimeout = opts.IdleConnTimeout
+		}
+		if opts.TLSHandshakeTimeout > 0 {
+			transport.TLSHandshakeTimeout = opts.TLSHandshakeTimeout
+		}
+		if opts.ResponseHeaderTimeout > 0 {
+			transport.ResponseHeaderTimeout = opts.ResponseHeaderTimeout
+		}
+		if opts.DialControl != nil {
+			transport.Proxy = nil
+			transport.DialContext = (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+				Control:   opts.DialControl,
+			}).DialContext
+		}
+		c.httpClient.Transport = transport
+	}
+}
+
 // NewRequest creates a new http request.
 func (c *Client) NewRequest(path string, opts ...RequestOption) (*http.Request, error) {
 	reqURL, err := url.JoinPath(c.baseURL, path)
@@ -52,6 +116,9 @@ func (c *Client) NewRequest(path string, opts ...RequestOption) (*http.Request,
 	if err != nil {
 		return nil, err
 	}
+	if c.ctx != nil {
+		req = req.WithContext(c.ctx)
+	}
 
 	for _, opt := range opts {
 		opt(req)
@@ -60,17 +127,63 @@ func (c *Client) NewRequest(path string, opts ...RequestOption) (*http.Request,
 }
 
 // Do sends http request and returns http response.
+// Response bodies compressed with gzip or Brotli are decompressed.
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	if err := decompressBody(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
 	return resp, nil
 }
 
+// decompressedBody reads the decompressed body and closes the original one
+type decompressedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// decompressBody replaces the body of a gzip or Brotli encoded response with its decompressed content.
+// The transport only decompresses gzip if it has set the Accept-Encoding header itself.
+func decompressBody(resp *http.Response) error {
+	var reader io.Reader
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip":
+		gz, err := gzip.NewReader(resp.Body)
+		if err == io.EOF {
+			// empty body
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		reader = gz
+	case "br":
+		reader = brotli.NewReader(resp.Body)
+	default:
+		return nil
+	}
+	resp.Body = decompressedBody{Reader: reader, Closer: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
 // RequestOption is a function that operates on a http.Request.
 type RequestOption func(*http.Request)
 
+// WithContext sets the context of the request, overriding the default context of the Client.
+func WithContext(ctx context.Context) RequestOption {
+	return func(req *http.Request) {
+		*req = *req.WithContext(ctx)
+	}
+}
+
 // WithMethod sets the HTTP method for the request.
 func WithMethod(method string) RequestOption {
 	return func(req *http.Request) {
@@ -79,15 +192,154 @@ func WithMethod(method string) RequestOption {
 }
 
 // WithBody sets the body for the request.
+// The content length is set if the size of the body is known, which includes
+// the rest of a regular file, so that it is not sent with chunked encoding.
 func WithBody(body io.Reader) RequestOption {
 	return func(req *http.Request) {
 		req.Body = io.NopCloser(body)
+		switch v := body.(type) {
+		case *bytes.Buffer:
+			setContentLength(req, int64(v.Len()))
+		case *bytes.Reader:
+			setContentLength(req, int64(v.Len()))
+		case *strings.Reader:
+			setContentLength(req, int64(v.Len()))
+		case *os.File:
+			if n, ok := remainingFileSize(v); ok {
+				setContentLength(req, n)
+			}
+		}
 	}
 }
 
+// WithBodyStream sets a body of the given size for the request, e.g. a file being uploaded.
+// The body is closed once the request is sent. A negative size sends it with chunked encoding.
+func WithBodyStream(r io.ReadCloser, size int64) RequestOption {
+	return func(req *http.Request) {
+		req.Body = r
+		if size >= 0 {
+			if size == 0 {
+				r.Close()
+			}
+			setContentLength(req, size)
+		}
+	}
+}
+
+// remainingFileSize returns the number of bytes from the offset of a regular file to its end
+func remainingFileSize(f *os.File) (int64, bool) {
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false
+	}
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, false
+	}
+	return max(info.Size()-offset, 0), true
+}
+
+// WithContentLength sets the content length for the request body.
+func WithContentLength(n int64) RequestOption {
+	return func(req *http.Request) {
+		setContentLength(req, n)
+	}
+}
+
+// WithBodyJSON sets the JSON encoding of v as the body for the request.
+// If v cannot be encoded, the error is returned when the request is sent.
+func WithBodyJSON(v any) RequestOption {
+	return func(req *http.Request) {
+		payload, err := json.Marshal(v)
+		if err != nil {
+			req.Body = io.NopCloser(errReader{err})
+			return
+		}
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+		req.Header.Set("Content-Type", "application/json")
+		WithBody(bytes.NewReader(payload))(req)
+	}
+}
+
+// setContentLength sets the content length, an empty body is sent without chunked encoding
+func setContentLength(req *http.Request, n int64) {
+	req.ContentLength = n
+	if n == 0 {
+		req.Body = http.NoBody
+	}
+}
+
+// errReader is an io.Reader which always returns the error
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
 // WithHeader sets header for the request.
+// Values replace those of the same keys, so it composes with the other header options.
 func WithHeader(header http.Header) RequestOption {
 	return func(req *http.Request) {
-		req.Header = header
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+		for key, values := range header {
+			req.Header[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+}
+
+// WithAcceptEncoding sets the Accept-Encoding header, e.g. "gzip, br".
+// Responses in these encodings are decompressed by Do.
+func WithAcceptEncoding(enc string) RequestOption {
+	return func(req *http.Request) {
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+		req.Header.Set("Accept-Encoding", enc)
+	}
+}
+
+// WithBasicAuth sets the Authorization header for HTTP basic authentication.
+func WithBasicAuth(username, password string) RequestOption {
+	return func(req *http.Request) {
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+		req.SetBasicAuth(username, password)
+	}
+}
+
+// WithBearerToken sets the Authorization header to the bearer token.
+func WithBearerToken(token string) RequestOption {
+	return func(req *http.Request) {
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// WithRequestID sets the X-Request-ID header identifying the request in the logs of the server.
+func WithRequestID(id string) RequestOption {
+	return func(req *http.Request) {
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+		req.Header.Set("X-Request-ID", id)
+	}
+}
+
+// WithAPIKey sets the api-key header used by Azure OpenAI instead of the Authorization header.
+func WithAPIKey(key string) RequestOption {
+	return func(req *http.Request) {
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+		req.Header.Set("api-key", key)
 	}
 }
@@ -2,12 +2,23 @@ package rest
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"sync"
+	"syscall"
 	"testing"
 	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/require"
 )
 
 func TestClient_NewRequest(t *testing.T) {
@@ -83,3 +94,302 @@ func TestRequestOptions(t *testing.T) {
 	assert.Equal(t, method, req.Method)
 	assert.Equal(t, header, req.Header)
 }
+
+func TestWithTransport(t *testing.T) {
+	opts := TransportOptions{
+		MaxIdleConns:          10,
+		MaxIdleConnsPerHost:   2,
+		IdleConnTimeout:       time.Minute,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+	}
+	client := NewClient(WithTransport(opts))
+
+	transport := client.httpClient.Transport.(*http.Transport)
+	assert.Equal(t, 10, transport.MaxIdleConns)
+	assert.Equal(t, 2, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+	assert.Equal(t, 5*time.Second, transport.TLSHandshakeTimeout)
+	assert.Equal(t, 10*time.Second, transport.ResponseHeaderTimeout)
+	assert.NotNil(t, transport.Proxy)
+}
+
+func TestWithTransport_MaxIdleConnsPerHost(t *testing.T) {
+	var mu sync.Mutex
+	states := map[http.ConnState]int{}
+	release := make(chan struct{})
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		mu.Lock()
+		defer mu.Unlock()
+		states[state]++
+	}
+	server.Start()
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL), WithTransport(TransportOptions{MaxIdleConnsPerHost: 1}))
+
+	// concurrent requests need one connection each
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, err := client.NewRequest("/")
+			assert.NoError(t, err)
+			resp, err := client.Do(req)
+			assert.NoError(t, err)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}()
+	}
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return states[http.StateNew] == 5
+	}, 5*time.Second, 10*time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// only one connection is kept in the idle pool, the others are closed
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return states[http.StateClosed] == 4
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestWithTransport_DialControl(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	var dialed []string
+	client := NewClient(WithBaseURL(server.URL), WithTransport(TransportOptions{
+		DialControl: func(network, address string, c syscall.RawConn) error {
+			dialed = append(dialed, address)
+			return errors.New("refused")
+		},
+	}))
+	assert.Nil(t, client.httpClient.Transport.(*http.Transport).Proxy)
+	req, err := client.NewRequest("/")
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	assert.ErrorContains(t, err, "refused")
+	assert.Equal(t, []string{server.Listener.Addr().String()}, dialed)
+}
+
+func TestWithBody_ContentLength(t *testing.T) {
+	var contentLength string
+	var transferEncoding []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.Header.Get("Content-Length")
+		transferEncoding = r.TransferEncoding
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL))
+	send := func(opts ...RequestOption) {
+		req, err := client.NewRequest("/", append([]RequestOption{WithMethod(http.MethodPost)}, opts...)...)
+		assert.NoError(t, err)
+		resp, err := client.Do(req)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	send(WithBody(bytes.NewReader([]byte("hello"))))
+	assert.Equal(t, "5", contentLength)
+	assert.Empty(t, transferEncoding)
+
+	send(WithBody(bytes.NewBufferString("hello world")))
+	assert.Equal(t, "11", contentLength)
+
+	send(WithBody(io.MultiReader(bytes.NewBufferString("hello"))), WithContentLength(5))
+	assert.Equal(t, "5", contentLength)
+
+	send(WithBody(io.MultiReader(bytes.NewBufferString("hello"))))
+	assert.Empty(t, contentLength)
+	assert.Equal(t, []string{"chunked"}, transferEncoding)
+
+	// the rest of a file from its offset
+	f, err := os.CreateTemp(t.TempDir(), "upload")
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteString("hello world")
+	require.NoError(t, err)
+	_, err = f.Seek(6, io.SeekStart)
+	require.NoError(t, err)
+	send(WithBody(f))
+	assert.Equal(t, "5", contentLength)
+	assert.Empty(t, transferEncoding)
+}
+
+// closeRecorder records whether the body was closed
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestWithBodyStream(t *testing.T) {
+	var body, contentLength string
+	var transferEncoding []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		contentLength = r.Header.Get("Content-Length")
+		transferEncoding = r.TransferEncoding
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := NewClient(WithBaseURL(server.URL))
+	send := func(opts ...RequestOption) {
+		req, err := client.NewRequest("/", append([]RequestOption{WithMethod(http.MethodPost)}, opts...)...)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	stream := &closeRecorder{Reader: io.MultiReader(bytes.NewBufferString("audio"))}
+	send(WithBodyStream(stream, 5))
+	assert.Equal(t, "audio", body)
+	assert.Equal(t, "5", contentLength)
+	assert.Empty(t, transferEncoding)
+	assert.True(t, stream.closed)
+
+	stream = &closeRecorder{Reader: io.MultiReader(bytes.NewBufferString("audio"))}
+	send(WithBodyStream(stream, -1))
+	assert.Equal(t, "audio", body)
+	assert.Equal(t, []string{"chunked"}, transferEncoding)
+	assert.True(t, stream.closed)
+}
+
+func TestWithBodyJSON(t *testing.T) {
+	client := NewClient(WithBaseURL("http://localhost:8080"))
+	req, err := client.NewRequest("/", WithBodyJSON(map[string]string{"hello": "world"}))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	assert.Equal(t, int64(17), req.ContentLength)
+	body, err := io.ReadAll(req.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"hello":"world"}`, string(body))
+
+	req, err = client.NewRequest("/", WithBodyJSON(func() {}))
+	assert.NoError(t, err)
+	_, err = io.ReadAll(req.Body)
+	assert.Error(t, err)
+}
+
+func TestWithRequestID(t *testing.T) {
+	client := NewClient(WithBaseURL("http://localhost:8080"))
+	req, err := client.NewRequest("/", WithHeader(http.Header{"Content-Type": []string{"application/json"}}), WithRequestID("f47ac10b-58cc-4372-a567-0e02b2c3d479"))
+	assert.NoError(t, err)
+	assert.Equal(t, "f47ac10b-58cc-4372-a567-0e02b2c3d479", req.Header.Get("X-Request-ID"))
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+}
+
+func TestAuthOptions(t *testing.T) {
+	client := NewClient(WithBaseURL("http://localhost:8080"))
+	header := http.Header{"Content-Type": []string{"application/json"}}
+
+	for _, tt := range []struct {
+		name          string
+		option        RequestOption
+		key, expected string
+	}{
+		{"basic auth", WithBasicAuth("user", "secret"), "Authorization", "Basic dXNlcjpzZWNyZXQ="},
+		{"bearer token", WithBearerToken("sk-123"), "Authorization", "Bearer sk-123"},
+		{"api key", WithAPIKey("azure-key"), "api-key", "azure-key"},
+	} {
+		// the header options compose in any order
+		for _, opts := range [][]RequestOption{
+			{tt.option, WithHeader(header)},
+			{WithHeader(header), tt.option},
+		} {
+			req, err := client.NewRequest("/", opts...)
+			assert.NoError(t, err, tt.name)
+			assert.Equal(t, tt.expected, req.Header.Get(tt.key), tt.name)
+			assert.Equal(t, "application/json", req.Header.Get("Content-Type"), tt.name)
+		}
+	}
+
+	req, err := client.NewRequest("/", WithAPIKey("azure-key"))
+	assert.NoError(t, err)
+	assert.Empty(t, req.Header.Get("Authorization"))
+}
+
+func TestClient_DoDecompresses(t *testing.T) {
+	body := `{"message":"hello"}`
+	compress := map[string]func(w io.Writer) io.WriteCloser{
+		"gzip": func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"br":   func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+	}
+	for encoding, newWriter := range compress {
+		t.Run(encoding, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "gzip, br", r.Header.Get("Accept-Encoding"))
+				w.Header().Set("Content-Encoding", encoding)
+				cw := newWriter(w)
+				cw.Write([]byte(body))
+				cw.Close()
+			}))
+			defer server.Close()
+
+			client := NewClient(WithBaseURL(server.URL))
+			req, err := client.NewRequest("/", WithAcceptEncoding("gzip, br"))
+			assert.NoError(t, err)
+			resp, err := client.Do(req)
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+
+			var ret struct{ Message string }
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&ret))
+			assert.Equal(t, "hello", ret.Message)
+			assert.Empty(t, resp.Header.Get("Content-Encoding"))
+		})
+	}
+}
+
+func TestWithDefaultContext(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	defer close(done)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	client := NewClient(WithBaseURL(server.URL), WithDefaultContext(ctx))
+
+	req, err := client.NewRequest("/")
+	assert.NoError(t, err)
+	start := time.Now()
+	_, err = client.Do(req)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// the context of a request overrides the default one
+	req, err = client.NewRequest("/", WithContext(context.Background()))
+	assert.NoError(t, err)
+	assert.Equal(t, context.Background(), req.Context())
+}
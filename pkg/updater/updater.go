@@ -0,0 +1,282 @@
+package updater
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imfing/gptui/pkg/rest"
+)
+
+const (
+	// checksumsName is the name of the checksum file attached to releases
+	checksumsName = "checksums.txt"
+	binaryName    = "gptui"
+)
+
+var (
+	// releaseURL is the GitHub API endpoint of the latest release
+	releaseURL = "https://api.github.com/repos/imfing/gptui/releases/latest"
+	// executable returns the path of the binary to replace
+	executable = os.Executable
+)
+
+// Release is a GitHub release
+type Release struct {
+	TagName string  `json:"tag_name"`
+	Assets  []Asset `json:"assets"`
+}
+
+// Asset is a file attached to a GitHub release
+type Asset struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// LatestRelease fetches the latest release from the GitHub API
+func LatestRelease() (*Release, error) {
+	resp, err := get(releaseURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var release Release
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// IsNewer reports whether the release version is newer than the current version.
+// Development builds without a version are always outdated.
+func IsNewer(release, current string) bool {
+	latest, ok := parseVersion(release)
+	if !ok {
+		return false
+	}
+	installed, ok := parseVersion(current)
+	if !ok {
+		return true
+	}
+	for i := range latest {
+		if latest[i] != installed[i] {
+			return latest[i] > installed[i]
+		}
+	}
+	return false
+}
+
+// parseVersion parses the major, minor and patch numbers of a version like "v1.2.3"
+func parseVersion(version string) ([3]int, bool) {
+	var numbers [3]int
+	version, _, _ = strings.Cut(strings.TrimPrefix(version, "v"), "-")
+	parts := strings.Split(version, ".")
+	if len(parts) > len(numbers) {
+		return numbers, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return numbers, false
+		}
+		numbers[i] = n
+	}
+	return numbers, true
+}
+
+// SelfUpdate replaces the running binary with the latest release if it is newer than currentVersion
+func SelfUpdate(currentVersion string) error {
+	release, err := LatestRelease()
+	if err != nil {
+		return err
+	}
+	if !IsNewer(release.TagName, currentVersion) {
+		return nil
+	}
+	return Install(release)
+}
+
+// Install replaces the running binary with the archive of the release for the platform,
+// after verifying it against the checksums of the release
+func Install(release *Release) error {
+	archive, err := findAsset(release, archiveName(runtime.GOOS, runtime.GOARCH))
+	if err != nil {
+		return err
+	}
+	checksums, err := findAsset(release, checksumsName)
+	if err != nil {
+		return err
+	}
+
+	data, err := download(archive.BrowserDownloadURL)
+	if err != nil {
+		return err
+	}
+	checksumData, err := download(checksums.BrowserDownloadURL)
+	if err != nil {
+		return err
+	}
+	if err := verifyChecksum(data, archive.Name, checksumData); err != nil {
+		return err
+	}
+
+	binary, err := extractBinary(data, archive.Name)
+	if err != nil {
+		return err
+	}
+	return replaceExecutable(binary)
+}
+
+// archiveName returns the name of the release archive for the platform, see .goreleaser.yml
+func archiveName(goos, goarch string) string {
+	arch := goarch
+	switch goarch {
+	case "amd64":
+		arch = "x86_64"
+	case "386":
+		arch = "i386"
+	}
+	ext := ".tar.gz"
+	if goos == "windows" {
+		ext = ".zip"
+	}
+	return fmt.Sprintf("%s_%s_%s%s", binaryName, strings.ToUpper(goos[:1])+goos[1:], arch, ext)
+}
+
+// findAsset returns the asset of the release with the name
+func findAsset(release *Release, name string) (*Asset, error) {
+	for _, asset := range release.Assets {
+		if asset.Name == name {
+			return &asset, nil
+		}
+	}
+	return nil, fmt.Errorf("release %s has no asset %s", release.TagName, name)
+}
+
+// verifyChecksum checks the SHA-256 of data against the entry for name in the checksum file
+func verifyChecksum(data []byte, name string, checksums []byte) error {
+	sum := sha256.Sum256(data)
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == name {
+			if fields[0] != hex.EncodeToString(sum[:]) {
+				return fmt.Errorf("checksum mismatch for %s", name)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("no checksum found for %s", name)
+}
+
+// extractBinary returns the gptui binary from the tar.gz or zip archive
+func extractBinary(data []byte, name string) ([]byte, error) {
+	if strings.HasSuffix(name, ".zip") {
+		r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range r.File {
+			if filepath.Base(f.Name) == binaryName+".exe" {
+				rc, err := f.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				return io.ReadAll(rc)
+			}
+		}
+		return nil, fmt.Errorf("%s not found in %s", binaryName, name)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s not found in %s", binaryName, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag == tar.TypeReg && filepath.Base(header.Name) == binaryName {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+// replaceExecutable writes the binary next to the running executable and renames it over it
+func replaceExecutable(binary []byte) error {
+	path, err := executable()
+	if err != nil {
+		return err
+	}
+	if path, err = filepath.EvalSymlinks(path); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+binaryName+"-update-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// download returns the content of the URL
+func download(url string) ([]byte, error) {
+	resp, err := get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// get sends a GET request to the URL and checks the response status
+func get(url string) (*http.Response, error) {
+	client := rest.NewClient(rest.WithBaseURL(url), rest.WithTimeout(5*time.Minute))
+	req, err := client.NewRequest("")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: status code: %d", url, resp.StatusCode)
+	}
+	return resp, nil
+}
@@ -0,0 +1,124 @@
+package updater
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newArchive creates a tar.gz archive containing the binary
+func newArchive(t *testing.T, binary []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: binaryName, Mode: 0755, Size: int64(len(binary)), Typeflag: tar.TypeReg}))
+	_, err := tw.Write(binary)
+	assert.NoError(t, err)
+	assert.NoError(t, tw.Close())
+	assert.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+// newReleaseServer serves a mock GitHub API with a release containing the archive
+func newReleaseServer(t *testing.T, tag string, archive []byte, checksum string) *httptest.Server {
+	name := archiveName(runtime.GOOS, runtime.GOARCH)
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	mux.HandleFunc("/repos/imfing/gptui/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"tag_name":%q,"assets":[{"name":%q,"browser_download_url":"%s/download/%s"},{"name":"checksums.txt","browser_download_url":"%s/download/checksums.txt"}]}`,
+			tag, name, server.URL, name, server.URL)
+	})
+	mux.HandleFunc("/download/"+name, func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	})
+	mux.HandleFunc("/download/checksums.txt", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  %s\n", checksum, name)
+	})
+	t.Cleanup(server.Close)
+
+	releaseURL = server.URL + "/repos/imfing/gptui/releases/latest"
+	t.Cleanup(func() { releaseURL = "https://api.github.com/repos/imfing/gptui/releases/latest" })
+	return server
+}
+
+// useExecutable makes the updater replace a fake executable
+func useExecutable(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), binaryName)
+	assert.NoError(t, os.WriteFile(path, []byte("old"), 0755))
+	executable = func() (string, error) { return path, nil }
+	t.Cleanup(func() { executable = os.Executable })
+	return path
+}
+
+func TestIsNewer(t *testing.T) {
+	assert.True(t, IsNewer("v0.4.0", "v0.3.9"))
+	assert.True(t, IsNewer("v1.0.0", "0.9.0"))
+	assert.True(t, IsNewer("v0.4.0", "dev"))
+	assert.False(t, IsNewer("v0.4.0", "v0.4.0"))
+	assert.False(t, IsNewer("v0.3.0", "v0.4.0"))
+	assert.False(t, IsNewer("nightly", "v0.4.0"))
+}
+
+func TestLatestRelease(t *testing.T) {
+	newReleaseServer(t, "v0.5.0", nil, "")
+	release, err := LatestRelease()
+	assert.NoError(t, err)
+	assert.Equal(t, "v0.5.0", release.TagName)
+	assert.Len(t, release.Assets, 2)
+}
+
+func TestSelfUpdate(t *testing.T) {
+	archive := newArchive(t, []byte("new"))
+	sum := sha256.Sum256(archive)
+	newReleaseServer(t, "v0.5.0", archive, hex.EncodeToString(sum[:]))
+	path := useExecutable(t)
+
+	// up to date
+	assert.NoError(t, SelfUpdate("v0.5.0"))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+
+	assert.NoError(t, SelfUpdate("v0.4.0"))
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+}
+
+func TestInstall(t *testing.T) {
+	archive := newArchive(t, []byte("new"))
+	sum := sha256.Sum256(archive)
+	newReleaseServer(t, "v0.5.0", archive, hex.EncodeToString(sum[:]))
+	path := useExecutable(t)
+
+	release, err := LatestRelease()
+	assert.NoError(t, err)
+	// the release is not fetched again
+	releaseURL = "http://127.0.0.1:0/unreachable"
+	assert.NoError(t, Install(release))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+}
+
+func TestSelfUpdate_ChecksumMismatch(t *testing.T) {
+	archive := newArchive(t, []byte("new"))
+	newReleaseServer(t, "v0.5.0", archive, hex.EncodeToString(make([]byte, sha256.Size)))
+	path := useExecutable(t)
+
+	assert.ErrorContains(t, SelfUpdate("v0.4.0"), "checksum mismatch")
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+}